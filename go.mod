@@ -2,4 +2,7 @@ module github.com/vchilikov/takeout-fix
 
 go 1.26.0
 
-require golang.org/x/sys v0.34.0 // indirect
+require (
+	golang.org/x/sys v0.34.0
+	golang.org/x/text v0.27.0
+)
@@ -0,0 +1,47 @@
+// Package archive reads the archive formats Google Takeout can export.
+package archive
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Entry is one directory or regular file inside an archive. Name uses forward
+// slashes, as stored in the archive.
+type Entry struct {
+	Name  string
+	Size  uint64
+	IsDir bool
+}
+
+// WalkFunc is called for every directory and regular file in archive order.
+// r is nil for directories and is only valid until WalkFunc returns.
+type WalkFunc func(entry Entry, r io.Reader) error
+
+// Format reads one archive format. Links and special files are skipped.
+type Format interface {
+	Name() string
+	Walk(path string, fn WalkFunc) error
+}
+
+var formats = []struct {
+	suffixes []string
+	format   Format
+}{
+	{suffixes: []string{".zip"}, format: zipFormat{}},
+	{suffixes: []string{".tgz", ".tar.gz"}, format: tarGzFormat{}},
+}
+
+// Detect returns the format for an archive file name, matched by extension.
+func Detect(name string) (Format, bool) {
+	lower := strings.ToLower(filepath.Base(name))
+	for _, f := range formats {
+		for _, suffix := range f.suffixes {
+			if strings.HasSuffix(lower, suffix) && len(lower) > len(suffix) {
+				return f.format, true
+			}
+		}
+	}
+	return nil, false
+}
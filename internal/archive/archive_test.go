@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"takeout-001.zip":    "zip",
+		"TAKEOUT-002.ZIP":    "zip",
+		"takeout-003.tgz":    "tgz",
+		"takeout-004.tar.gz": "tgz",
+		"takeout.tar":        "",
+		"notes.gz":           "",
+		".zip":               "",
+	}
+	for name, want := range cases {
+		format, ok := Detect(name)
+		got := ""
+		if ok {
+			got = format.Name()
+		}
+		if got != want {
+			t.Fatalf("Detect(%q): want %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestWalkReadsZipAndTarGz(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "a.zip")
+	tgzPath := filepath.Join(dir, "a.tgz")
+	if err := writeZip(zipPath); err != nil {
+		t.Fatalf("write zip: %v", err)
+	}
+	if err := writeTarGz(tgzPath); err != nil {
+		t.Fatalf("write tgz: %v", err)
+	}
+
+	for _, path := range []string{zipPath, tgzPath} {
+		format, ok := Detect(path)
+		if !ok {
+			t.Fatalf("Detect(%q) failed", path)
+		}
+
+		var got []string
+		err := format.Walk(path, func(entry Entry, r io.Reader) error {
+			if entry.IsDir {
+				got = append(got, entry.Name)
+				return nil
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if uint64(len(data)) != entry.Size {
+				t.Fatalf("%s: size mismatch for %s: header %d, read %d", path, entry.Name, entry.Size, len(data))
+			}
+			got = append(got, entry.Name+"="+string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk(%q): %v", path, err)
+		}
+		want := []string{"Takeout/", "Takeout/a.jpg=photo"}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Walk(%q): want %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestWalkTarGzReportsTruncatedArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.tgz")
+	if err := writeTarGz(path); err != nil {
+		t.Fatalf("write tgz: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read tgz: %v", err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-8], 0o600); err != nil {
+		t.Fatalf("truncate tgz: %v", err)
+	}
+
+	err = tarGzFormat{}.Walk(path, func(_ Entry, r io.Reader) error {
+		if r != nil {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected error for truncated tgz")
+	}
+}
+
+func writeZip(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	zw := zip.NewWriter(f)
+	if _, err := zw.Create("Takeout/"); err != nil {
+		return err
+	}
+	w, err := zw.Create("Takeout/a.jpg")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("photo")); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTarGz(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "Takeout/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "Takeout/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "Takeout/a.jpg", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte("photo")); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+type tarGzFormat struct{}
+
+func (tarGzFormat) Name() string {
+	return "tgz"
+}
+
+func (tarGzFormat) Walk(path string, fn WalkFunc) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open tgz: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close tgz: %w", closeErr)
+		}
+	}()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("open gzip: %w", err)
+	}
+	defer func() {
+		if closeErr := gz.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close gzip: %w", closeErr)
+		}
+	}()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := fn(Entry{Name: header.Name, IsDir: true}, nil); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if header.Size < 0 {
+				return fmt.Errorf("entry %s: negative size", header.Name)
+			}
+			if err := fn(Entry{Name: header.Name, Size: uint64(header.Size)}, tr); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Reach the gzip trailer so its checksum is verified.
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return fmt.Errorf("read gzip: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+)
+
+type zipFormat struct{}
+
+func (zipFormat) Name() string {
+	return "zip"
+}
+
+func (zipFormat) Walk(path string, fn WalkFunc) (err error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close zip: %w", closeErr)
+		}
+	}()
+
+	for _, f := range r.File {
+		info := f.FileInfo()
+		if info.IsDir() {
+			if err := fn(Entry{Name: f.Name, IsDir: true}, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("open entry %s: %w", f.Name, err)
+		}
+		fnErr := fn(Entry{Name: f.Name, Size: f.UncompressedSize64}, rc)
+		closeErr := rc.Close()
+		if fnErr != nil {
+			return fnErr
+		}
+		if closeErr != nil {
+			return fmt.Errorf("close entry %s: %w", f.Name, closeErr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package backup keeps copies of original files so a run can be rolled back.
+// Copies are reflinks where the filesystem supports them and full copies
+// otherwise. They are never hardlinks, so a write that reaches the original
+// through another link cannot change the copy.
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps one copy per file under dir, at the file's path relative to
+// the processed root. The first copy of a file is kept, so the store holds
+// the file as it was before any run changed it.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Path returns where the copy of rel is kept.
+func (s *Store) Path(rel string) string {
+	return filepath.Join(s.dir, rel)
+}
+
+// Has reports whether the store holds a copy of rel.
+func (s *Store) Has(rel string) bool {
+	_, err := os.Lstat(s.Path(rel))
+	return err == nil
+}
+
+// Save copies rootPath/rel into the store unless it already holds a copy.
+func (s *Store) Save(rootPath string, rel string) error {
+	if s.Has(rel) {
+		return nil
+	}
+	if err := copyFile(filepath.Join(rootPath, rel), s.Path(rel)); err != nil {
+		return fmt.Errorf("back up %s: %w", rel, err)
+	}
+	return nil
+}
+
+// Restore puts the copy of rel back at rootPath/rel. The current file is
+// replaced by a rename, so its other hardlinks keep their content.
+func (s *Store) Restore(rootPath string, rel string) error {
+	if err := copyFile(s.Path(rel), filepath.Join(rootPath, rel)); err != nil {
+		return fmt.Errorf("restore %s: %w", rel, err)
+	}
+	return nil
+}
+
+// Reset removes the store at dir. A missing store is not an error.
+func Reset(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("remove backup: %w", err)
+	}
+	return nil
+}
+
+// copyFile writes src to a temporary file next to dst and renames it into
+// place, keeping the mode and modification time of src. A copy cut short
+// never takes the place of dst.
+func copyFile(src string, dst string) (err error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".takeoutfix-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if cloneErr := cloneFile(tmp, in); cloneErr != nil {
+		if _, err := io.Copy(tmp, in); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestStoreSaveKeepsFirstCopy(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(t.TempDir(), "backup"))
+	rel := filepath.Join("album", "a.jpg")
+	modTime := time.Date(2019, 7, 4, 15, 30, 12, 0, time.UTC)
+	writeFile(t, filepath.Join(root, rel), "original", modTime)
+
+	if err := store.Save(root, rel); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	writeFile(t, filepath.Join(root, rel), "changed", time.Now())
+	if err := store.Save(root, rel); err != nil {
+		t.Fatalf("second Save returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(store.Path(rel))
+	if err != nil || string(data) != "original" {
+		t.Fatalf("expected the first copy to be kept, got %q (%v)", data, err)
+	}
+	info, err := os.Stat(store.Path(rel))
+	if err != nil || !info.ModTime().Equal(modTime) {
+		t.Fatalf("expected the copy to keep the modification time, got %v (%v)", info.ModTime(), err)
+	}
+}
+
+func TestStoreSaveMissingFile(t *testing.T) {
+	store := NewStore(t.TempDir())
+	if err := store.Save(t.TempDir(), "missing.jpg"); err == nil {
+		t.Fatalf("expected error for a missing file")
+	}
+	if store.Has("missing.jpg") {
+		t.Fatalf("a failed save must not leave a copy")
+	}
+}
+
+func TestStoreRestoreReplacesHardlinkedFile(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(t.TempDir(), "backup"))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeFile(t, filepath.Join(root, "a.jpg"), "original", modTime)
+	if err := store.Save(root, "a.jpg"); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	writeFile(t, filepath.Join(root, "b.jpg"), "canonical", time.Now())
+	if err := os.Remove(filepath.Join(root, "a.jpg")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Link(filepath.Join(root, "b.jpg"), filepath.Join(root, "a.jpg")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+
+	if err := store.Restore(root, "a.jpg"); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	for name, want := range map[string]string{"a.jpg": "original", "b.jpg": "canonical"} {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s: want %q, got %q (%v)", name, want, data, err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(root, "a.jpg"))
+	if err != nil || !info.ModTime().Equal(modTime) {
+		t.Fatalf("expected the restored file to keep its modification time, got %v (%v)", info.ModTime(), err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	writeFile(t, filepath.Join(dir, "a.jpg"), "x", time.Now())
+	if err := Reset(dir); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the store to be removed, got %v", err)
+	}
+	if err := Reset(dir); err != nil {
+		t.Fatalf("Reset of a missing store returned error: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package backup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy-on-write clone of src through clonefile(2) on
+// APFS. clonefile only creates new paths, so the clone is made next to dst
+// and renamed over it; dst is left untouched when cloning fails.
+func cloneFile(dst *os.File, src *os.File) error {
+	tmp := dst.Name() + ".clone"
+	if err := unix.Clonefile(src.Name(), tmp, unix.CLONE_NOFOLLOW); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst.Name()); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
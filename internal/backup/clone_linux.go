@@ -0,0 +1,13 @@
+package backup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile shares the extents of src with dst through the FICLONE ioctl on
+// filesystems such as Btrfs and XFS.
+func cloneFile(dst *os.File, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
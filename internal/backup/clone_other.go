@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+var errCloneUnsupported = errors.New("reflink not supported")
+
+func cloneFile(*os.File, *os.File) error {
+	return errCloneUnsupported
+}
@@ -0,0 +1,64 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/vchilikov/takeout-fix/internal/archive"
+)
+
+func ExtractArchive(archivePath string, dest string) (int, error) {
+	format, ok := archive.Detect(archivePath)
+	if !ok {
+		return 0, fmt.Errorf("unsupported archive format: %s", archivePath)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return 0, fmt.Errorf("mkdir dest: %w", err)
+	}
+	return extractOne(format, archivePath, dest)
+}
+
+func extractOne(format archive.Format, archivePath string, dest string) (files int, err error) {
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return 0, fmt.Errorf("open root %q: %w", dest, err)
+	}
+	defer func() {
+		if closeErr := root.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = format.Walk(archivePath, func(entry archive.Entry, r io.Reader) error {
+		name := entry.Name
+		if entry.IsDir {
+			return root.MkdirAll(name, 0o755)
+		}
+
+		dir := path.Dir(name)
+		if dir != "." {
+			if err := root.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+
+		out, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+
+		_, copyErr := io.Copy(out, r)
+		closeOutErr := out.Close()
+		if copyErr != nil {
+			return copyErr
+		}
+		if closeOutErr != nil {
+			return closeOutErr
+		}
+		files++
+		return nil
+	})
+	return files, err
+}
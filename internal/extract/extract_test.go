@@ -1,7 +1,9 @@
 package extract
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"compress/gzip"
 	"os"
 	"path/filepath"
 	"testing"
@@ -30,6 +32,51 @@ func TestExtractArchiveExtractsFiles(t *testing.T) {
 	}
 }
 
+func TestExtractArchiveExtractsTarGz(t *testing.T) {
+	dir := t.TempDir()
+	tgzPath := filepath.Join(dir, "a.tar.gz")
+	if err := writeTarGz(tgzPath, map[string]string{"Takeout/one.txt": "1", "Takeout/two.txt": "2"}); err != nil {
+		t.Fatalf("write tgz: %v", err)
+	}
+
+	dest := filepath.Join(dir, "out")
+	files, err := ExtractArchive(tgzPath, dest)
+	if err != nil {
+		t.Fatalf("ExtractArchive error: %v", err)
+	}
+	if files != 2 {
+		t.Fatalf("expected 2 extracted files, got %d", files)
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if _, err := os.Stat(filepath.Join(dest, "Takeout", name)); err != nil {
+			t.Fatalf("expected extracted file %s: %v", name, err)
+		}
+	}
+}
+
+func TestExtractArchiveRejectsTarGzPathEscape(t *testing.T) {
+	dir := t.TempDir()
+	tgzPath := filepath.Join(dir, "a.tgz")
+	if err := writeTarGz(tgzPath, map[string]string{"../escape.txt": "1"}); err != nil {
+		t.Fatalf("write tgz: %v", err)
+	}
+
+	_, err := ExtractArchive(tgzPath, filepath.Join(dir, "out"))
+	if err == nil {
+		t.Fatalf("expected path escape error")
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "escape.txt")); statErr == nil {
+		t.Fatalf("file escaped the destination")
+	}
+}
+
+func TestExtractArchiveRejectsUnsupportedFormat(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ExtractArchive(filepath.Join(dir, "a.rar"), filepath.Join(dir, "out")); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
+
 func TestExtractArchiveRejectsSymlinkComponent(t *testing.T) {
 	dir := t.TempDir()
 	zipPath := filepath.Join(dir, "a.zip")
@@ -103,3 +150,29 @@ func writeZip(path string, files map[string]string) error {
 	}
 	return zw.Close()
 }
+
+func writeTarGz(path string, files map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		h := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content)), ModTime: time.Now()}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -1,7 +1,6 @@
 package preflight
 
 import (
-	"archive/zip"
 	"cmp"
 	"fmt"
 	"io"
@@ -12,8 +11,11 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/vchilikov/takeout-fix/internal/archive"
 )
 
+// ZipArchive is one top-level Takeout archive part in any supported format.
 type ZipArchive struct {
 	Name        string
 	Path        string
@@ -36,7 +38,8 @@ type IntegritySummary struct {
 	TotalZipBytes     uint64
 }
 
-func DiscoverTopLevelZips(cwd string) ([]ZipArchive, error) {
+// DiscoverTopLevelArchives lists the .zip, .tgz and .tar.gz files in cwd.
+func DiscoverTopLevelArchives(cwd string) ([]ZipArchive, error) {
 	entries, err := os.ReadDir(cwd)
 	if err != nil {
 		return nil, err
@@ -47,7 +50,7 @@ func DiscoverTopLevelZips(cwd string) ([]ZipArchive, error) {
 		if entry.IsDir() {
 			continue
 		}
-		if !strings.EqualFold(filepath.Ext(entry.Name()), ".zip") {
+		if _, ok := archive.Detect(entry.Name()); !ok {
 			continue
 		}
 
@@ -106,7 +109,7 @@ func ValidateAll(zips []ZipArchive) IntegritySummary {
 			for j := range jobs {
 				results <- result{
 					index: j.index,
-					check: ValidateZip(j.archive),
+					check: ValidateArchive(j.archive),
 				}
 			}
 		})
@@ -142,44 +145,28 @@ func ValidateAll(zips []ZipArchive) IntegritySummary {
 	return summary
 }
 
-func ValidateZip(z ZipArchive) (res ArchiveIntegrity) {
-	res = ArchiveIntegrity{Archive: z}
+// ValidateArchive reads every entry of z to prove it is complete and sums
+// the uncompressed size of its files.
+func ValidateArchive(z ZipArchive) ArchiveIntegrity {
+	res := ArchiveIntegrity{Archive: z}
 
-	r, err := zip.OpenReader(z.Path)
-	if err != nil {
-		res.Err = fmt.Errorf("open zip: %w", err)
+	format, ok := archive.Detect(z.Name)
+	if !ok {
+		res.Err = fmt.Errorf("unsupported archive format: %s", z.Name)
 		return res
 	}
-	defer func() {
-		if closeErr := r.Close(); closeErr != nil && res.Err == nil {
-			res.Err = fmt.Errorf("close zip: %w", closeErr)
-		}
-	}()
 
-	for _, f := range r.File {
-		if f.FileInfo().IsDir() {
-			continue
+	res.Err = format.Walk(z.Path, func(entry archive.Entry, r io.Reader) error {
+		if entry.IsDir {
+			return nil
 		}
 
 		res.FileCount++
-		res.UncompressedBytes += f.UncompressedSize64
-
-		rc, err := f.Open()
-		if err != nil {
-			res.Err = fmt.Errorf("open entry %s: %w", f.Name, err)
-			return res
-		}
-		_, copyErr := io.Copy(io.Discard, rc)
-		closeErr := rc.Close()
-		if copyErr != nil {
-			res.Err = fmt.Errorf("read entry %s: %w", f.Name, copyErr)
-			return res
-		}
-		if closeErr != nil {
-			res.Err = fmt.Errorf("close entry %s: %w", f.Name, closeErr)
-			return res
+		res.UncompressedBytes += entry.Size
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return fmt.Errorf("read entry %s: %w", entry.Name, err)
 		}
-	}
-
+		return nil
+	})
 	return res
 }
@@ -1,7 +1,9 @@
 package preflight
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"compress/gzip"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -32,9 +34,9 @@ func TestValidateAll_MixedBatch(t *testing.T) {
 		t.Fatalf("truncate bad zip: %v", err)
 	}
 
-	zips, err := DiscoverTopLevelZips(dir)
+	zips, err := DiscoverTopLevelArchives(dir)
 	if err != nil {
-		t.Fatalf("DiscoverTopLevelZips: %v", err)
+		t.Fatalf("DiscoverTopLevelArchives: %v", err)
 	}
 	if len(zips) != 2 {
 		t.Fatalf("expected 2 zips, got %d", len(zips))
@@ -78,9 +80,9 @@ func TestValidateAll_SingleArchive(t *testing.T) {
 		t.Fatalf("write zip: %v", err)
 	}
 
-	zips, err := DiscoverTopLevelZips(dir)
+	zips, err := DiscoverTopLevelArchives(dir)
 	if err != nil {
-		t.Fatalf("DiscoverTopLevelZips: %v", err)
+		t.Fatalf("DiscoverTopLevelArchives: %v", err)
 	}
 	if len(zips) != 1 {
 		t.Fatalf("expected 1 zip, got %d", len(zips))
@@ -113,9 +115,9 @@ func TestValidateAll_MultipleArchivesKeepsInputOrder(t *testing.T) {
 		}
 	}
 
-	zips, err := DiscoverTopLevelZips(dir)
+	zips, err := DiscoverTopLevelArchives(dir)
 	if err != nil {
-		t.Fatalf("DiscoverTopLevelZips: %v", err)
+		t.Fatalf("DiscoverTopLevelArchives: %v", err)
 	}
 	if len(zips) != 5 {
 		t.Fatalf("expected 5 zips, got %d", len(zips))
@@ -136,6 +138,46 @@ func TestValidateAll_MultipleArchivesKeepsInputOrder(t *testing.T) {
 	}
 }
 
+func TestValidateAll_TarGzArchives(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeTarGz(filepath.Join(dir, "a.tgz"), map[string]string{"a.txt": "hello"}); err != nil {
+		t.Fatalf("write tgz: %v", err)
+	}
+	badPath := filepath.Join(dir, "b.tar.gz")
+	if err := writeTarGz(badPath, map[string]string{"b.txt": "world"}); err != nil {
+		t.Fatalf("write bad tgz source: %v", err)
+	}
+	data, err := os.ReadFile(badPath)
+	if err != nil {
+		t.Fatalf("read bad tgz: %v", err)
+	}
+	if err := os.WriteFile(badPath, data[:len(data)-8], 0o600); err != nil {
+		t.Fatalf("truncate bad tgz: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.tar"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("write tar: %v", err)
+	}
+
+	archives, err := DiscoverTopLevelArchives(dir)
+	if err != nil {
+		t.Fatalf("DiscoverTopLevelArchives: %v", err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("expected 2 archives, got %d", len(archives))
+	}
+
+	summary := ValidateAll(archives)
+	if len(summary.Corrupt) != 1 || summary.Corrupt[0].Archive.Name != "b.tar.gz" {
+		t.Fatalf("expected b.tar.gz to be corrupt, got %+v", summary.Corrupt)
+	}
+	if summary.Checked[0].FileCount != 1 {
+		t.Fatalf("expected 1 file in a.tgz, got %d", summary.Checked[0].FileCount)
+	}
+	if summary.TotalUncompressed != 5 {
+		t.Fatalf("expected 5 uncompressed bytes, got %d", summary.TotalUncompressed)
+	}
+}
+
 func TestFingerprintChangesWithInput(t *testing.T) {
 	fp1 := Fingerprint(100, nowForTest(1))
 	fp2 := Fingerprint(100, nowForTest(2))
@@ -169,3 +211,29 @@ func writeZip(path string, files map[string]string) error {
 	}
 	return zw.Close()
 }
+
+func writeTarGz(path string, files map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		h := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
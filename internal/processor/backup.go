@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"path/filepath"
+
+	"github.com/vchilikov/takeout-fix/internal/backup"
+	"github.com/vchilikov/takeout-fix/internal/state"
+)
+
+// openBackupStore returns the store originals are saved to, or nil when
+// the run changes no input files or backups are off.
+func openBackupStore(opts Options) *backup.Store {
+	if opts.BackupDir == "" || opts.DryRun || opts.OutputDir != "" {
+		return nil
+	}
+	return backup.NewStore(opts.BackupDir)
+}
+
+// backupOriginal saves rel and an XMP sidecar already next to it before
+// their first change, and journals each copy so Rollback can find it.
+func backupOriginal(store *backup.Store, journal *state.Journal, rootPath string, rel string) error {
+	if store == nil {
+		return nil
+	}
+	files := []string{rel}
+	if sidecar := rel + ".xmp"; pathExists(filepath.Join(rootPath, sidecar)) {
+		files = append(files, sidecar)
+	}
+	for _, file := range files {
+		if err := store.Save(rootPath, file); err != nil {
+			return err
+		}
+		if err := recordJournal(journal, state.JournalEvent{Media: file, Step: state.StepBackedUp}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
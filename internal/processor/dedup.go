@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vchilikov/takeout-fix/utils/files"
+)
+
+// DedupMode selects what happens to byte-identical media copies.
+type DedupMode string
+
+const (
+	DedupOff DedupMode = ""
+	// DedupHardlink replaces each duplicate with a hardlink to the canonical copy.
+	DedupHardlink DedupMode = "hardlink"
+	// DedupRemove deletes each duplicate together with its XMP sidecar.
+	DedupRemove DedupMode = "remove"
+)
+
+var (
+	findDuplicateMedia = files.FindDuplicateMedia
+	linkFile           = os.Link
+	removeDuplicate    = os.Remove
+)
+
+// DuplicateGroup is a set of byte-identical media files. Paths are absolute.
+type DuplicateGroup struct {
+	Canonical  string
+	Duplicates []string
+	Size       int64
+}
+
+// ParseDedupMode validates a dedup mode name. An empty name turns dedup off.
+func ParseDedupMode(name string) (DedupMode, error) {
+	switch mode := DedupMode(name); mode {
+	case DedupOff, DedupHardlink, DedupRemove:
+		return mode, nil
+	default:
+		return DedupOff, fmt.Errorf("unknown dedup mode %q (want hardlink or remove)", name)
+	}
+}
+
+// applyDedup finds byte-identical media under baseDir and keeps only the
+// canonical copy of each group. The canonical copy is chosen by the paths
+// media had before the layout moves. The directories in skip are not
+// searched. Copies that are already hardlinked to the canonical file are
+// left alone, so a repeated run changes nothing.
+func applyDedup(report *Report, baseDir string, moves []PlannedMove, skip []string, mode DedupMode, dryRun bool) {
+	sources := make(map[string]string, len(moves))
+	for _, move := range moves {
+		sources[relToRoot(baseDir, move.To)] = relToRoot(baseDir, move.From)
+	}
+	groups, err := findDuplicateMedia(baseDir, sources, skip)
+	if err != nil {
+		report.addProblem("dedup errors", err.Error())
+		return
+	}
+
+	for _, group := range groups {
+		canonical := filepath.Join(baseDir, group.Files[0])
+		canonicalInfo, err := os.Stat(canonical)
+		if err != nil {
+			report.addProblem("dedup errors", canonical)
+			continue
+		}
+
+		result := DuplicateGroup{Canonical: canonical, Size: group.Size}
+		for _, rel := range group.Files[1:] {
+			duplicate := filepath.Join(baseDir, rel)
+			if info, err := os.Stat(duplicate); err == nil && os.SameFile(canonicalInfo, info) {
+				continue
+			}
+			if !dryRun {
+				if err := dedupFile(canonical, duplicate, mode); err != nil {
+					report.addProblem("dedup errors", duplicate)
+					continue
+				}
+			}
+			result.Duplicates = append(result.Duplicates, duplicate)
+			report.Summary.DuplicateFiles++
+			report.Summary.DedupBytesSaved += group.Size
+		}
+		if len(result.Duplicates) > 0 {
+			report.Duplicates = append(report.Duplicates, result)
+		}
+	}
+}
+
+func dedupFile(canonical string, duplicate string, mode DedupMode) error {
+	if mode == DedupRemove {
+		if err := removeDuplicate(duplicate); err != nil {
+			return err
+		}
+		sidecar := duplicate + ".xmp"
+		if pathExists(sidecar) {
+			return removeDuplicate(sidecar)
+		}
+		return nil
+	}
+
+	// Link next to the duplicate first so a failed rename leaves it in place.
+	tmp := duplicate + ".takeoutfix-link"
+	if err := linkFile(canonical, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, duplicate); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
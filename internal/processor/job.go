@@ -0,0 +1,228 @@
+package processor
+
+import (
+	"cmp"
+	"path/filepath"
+
+	"github.com/vchilikov/takeout-fix/internal/backup"
+	"github.com/vchilikov/takeout-fix/internal/state"
+	"github.com/vchilikov/takeout-fix/utils/extensions"
+	"github.com/vchilikov/takeout-fix/utils/files"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
+)
+
+// mediaJob is the unit a worker processes: one media file, or the still and
+// video halves of a Live Photo, which must be renamed together.
+type mediaJob struct {
+	parts []mediaPart
+}
+
+type mediaPart struct {
+	mediaFile string
+	jsonFile  string
+	metaOpts  metadata.Options
+	// livePhoto is the still of the Live Photo this part belongs to.
+	livePhoto string
+	// unpaired marks media without a JSON. Only its extension and capture
+	// date are fixed, and only its backup and rename are journaled.
+	unpaired bool
+}
+
+type mediaResult struct {
+	mediaFile string
+	mediaPath string
+	jsonFile  string
+	livePhoto string
+	unpaired  bool
+	fixResult extensions.FixResult
+	meta      metadata.ApplyResult
+	commands  [][]string
+	copyErr   error
+	backupErr error
+	fixErr    error
+	metaErr   error
+	// journalErr is the first journal write failure for this media.
+	journalErr error
+}
+
+// buildJobs groups paired media into jobs. A Live Photo video whose still is
+// also paired is processed in the still's job. Every part starts from
+// baseOpts and gets its own albums.
+func buildJobs(mediaFiles []string, scan files.MediaScanResult, albums map[string][]string, baseOpts metadata.Options) []mediaJob {
+	optsFor := func(mediaFile string) metadata.Options {
+		opts := baseOpts
+		opts.Albums = albums[mediaFile]
+		return opts
+	}
+
+	videoByStill := make(map[string]string)
+	for video, still := range scan.LivePhotos {
+		_, videoPaired := scan.Pairs[video]
+		_, stillPaired := scan.Pairs[still]
+		if videoPaired && stillPaired {
+			videoByStill[still] = video
+		}
+	}
+
+	jobs := make([]mediaJob, 0, len(mediaFiles))
+	for _, mediaFile := range mediaFiles {
+		if still, ok := scan.LivePhotos[mediaFile]; ok && videoByStill[still] == mediaFile {
+			continue
+		}
+
+		part := mediaPart{
+			mediaFile: mediaFile,
+			jsonFile:  scan.Pairs[mediaFile],
+			metaOpts:  optsFor(mediaFile),
+		}
+		video, ok := videoByStill[mediaFile]
+		if !ok {
+			jobs = append(jobs, mediaJob{parts: []mediaPart{part}})
+			continue
+		}
+
+		contentID := livePhotoContentID(mediaFile)
+		part.metaOpts.ContentIdentifier = contentID
+		part.livePhoto = mediaFile
+		videoPart := mediaPart{
+			mediaFile: video,
+			jsonFile:  scan.Pairs[video],
+			metaOpts:  optsFor(video),
+			livePhoto: mediaFile,
+		}
+		videoPart.metaOpts.ContentIdentifier = contentID
+		jobs = append(jobs, mediaJob{parts: []mediaPart{part, videoPart}})
+	}
+	return jobs
+}
+
+// processJob copies (with OutputDir), fixes extensions and applies metadata
+// for every part of job, or plans those steps in a dry run. Unpaired parts
+// only get their capture date restored.
+func processJob(rootPath string, opts Options, journal *state.Journal, backups *backup.Store, job mediaJob, session *exiftoolSession) []mediaResult {
+	results := make([]mediaResult, len(job.parts))
+	for i, part := range job.parts {
+		res := &results[i]
+		*res = mediaResult{
+			mediaFile: part.mediaFile,
+			mediaPath: filepath.Join(rootPath, part.mediaFile),
+			jsonFile:  part.jsonFile,
+			livePhoto: part.livePhoto,
+			unpaired:  part.unpaired,
+		}
+		if opts.DryRun {
+			continue
+		}
+
+		if opts.OutputDir != "" {
+			target := filepath.Join(opts.OutputDir, part.mediaFile)
+			if err := copyMediaFile(res.mediaPath, target); err != nil {
+				res.copyErr = err
+				continue
+			}
+			res.mediaPath = target
+		}
+		if err := backupOriginal(backups, journal, rootPath, part.mediaFile); err != nil {
+			res.backupErr = err
+			continue
+		}
+		if part.unpaired {
+			continue
+		}
+		res.journalErr = recordJournal(journal, state.JournalEvent{
+			Media: part.mediaFile,
+			Step:  state.StepPaired,
+			JSON:  part.jsonFile,
+		})
+	}
+
+	fixJobExtensions(results, opts.DryRun, session)
+
+	for i, part := range job.parts {
+		res := &results[i]
+		if res.skipped() || res.fixErr != nil {
+			continue
+		}
+		if part.unpaired {
+			if opts.DryRun {
+				res.commands, res.meta, res.metaErr = runPlanUnpairedWithFallback(res.fixResult.Path, res.planOptions(part.metaOpts), session)
+				continue
+			}
+			if res.fixResult.Renamed {
+				res.journalErr = recordJournal(journal, state.JournalEvent{
+					Media: part.mediaFile,
+					Step:  state.StepExtensionFixed,
+					Path:  relToRoot(rootPath, res.fixResult.Path),
+				})
+			}
+			res.meta, res.metaErr = runUnpairedWithFallback(res.fixResult.Path, part.metaOpts, session)
+			continue
+		}
+		jsonPath := filepath.Join(rootPath, part.jsonFile)
+
+		if opts.DryRun {
+			res.commands, res.meta, res.metaErr = runPlanMetadataWithFallback(res.fixResult.Path, jsonPath, res.planOptions(part.metaOpts), session)
+			continue
+		}
+
+		if res.fixResult.Renamed {
+			res.journalErr = cmp.Or(res.journalErr, recordJournal(journal, state.JournalEvent{
+				Media: part.mediaFile,
+				Step:  state.StepExtensionFixed,
+				Path:  relToRoot(rootPath, res.fixResult.Path),
+			}))
+		}
+		res.meta, res.metaErr = runMetadataWithFallback(res.fixResult.Path, jsonPath, part.metaOpts, session)
+		if res.metaErr == nil {
+			res.journalErr = cmp.Or(res.journalErr, recordJournal(journal, state.JournalEvent{
+				Media:   relToRoot(rootPath, res.fixResult.Path),
+				Step:    state.StepMetadataApplied,
+				Sidecar: res.meta.SidecarPath != "",
+			}))
+		}
+	}
+	return results
+}
+
+// planOptions makes a plan read the media where it is now: a dry run does
+// not rename it to fixResult.Path.
+func (r *mediaResult) planOptions(opts metadata.Options) metadata.Options {
+	opts.SourcePath = r.mediaPath
+	return opts
+}
+
+// skipped reports whether the media could not be copied or backed up, so it
+// must not be changed.
+func (r *mediaResult) skipped() bool {
+	return r.copyErr != nil || r.backupErr != nil
+}
+
+// fixJobExtensions fixes (or plans) extensions for the parts that were copied
+// and backed up. Live Photo halves are fixed together so they keep a shared
+// name.
+func fixJobExtensions(results []mediaResult, dryRun bool, session *exiftoolSession) {
+	if len(results) == 2 && !results[0].skipped() && !results[1].skipped() {
+		var still, video extensions.FixResult
+		var err error
+		if dryRun {
+			still, video, err = runPlanFixPairWithFallback(results[0].mediaPath, results[1].mediaPath, session)
+		} else {
+			still, video, err = runFixPairWithFallback(results[0].mediaPath, results[1].mediaPath, session)
+		}
+		results[0].fixResult, results[1].fixResult = still, video
+		results[0].fixErr, results[1].fixErr = err, err
+		return
+	}
+
+	for i := range results {
+		res := &results[i]
+		if res.skipped() {
+			continue
+		}
+		if dryRun {
+			res.fixResult, res.fixErr = runPlanFixWithFallback(res.mediaPath, session)
+		} else {
+			res.fixResult, res.fixErr = runFixWithFallback(res.mediaPath, session)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/vchilikov/takeout-fix/internal/state"
+	"github.com/vchilikov/takeout-fix/utils/files"
+)
+
+// MatchJournal marks pairs restored from the journal of an earlier run.
+const MatchJournal files.MatchStrategy = "journal"
+
+var (
+	openJournal = state.OpenJournal
+	loadJournal = state.LoadJournal
+)
+
+// resumedMedia is a media file whose metadata was applied by an earlier run.
+type resumedMedia struct {
+	mediaFile string
+	jsonFile  string
+	// jsonPending is true while the paired JSON is still on disk and must be
+	// counted before it can be removed.
+	jsonPending bool
+}
+
+func openRunJournal(opts Options) (*state.Journal, error) {
+	// Output runs leave the input untouched, so there is nothing to resume.
+	if opts.JournalPath == "" || opts.OutputDir != "" {
+		return nil, nil
+	}
+	if opts.DryRun {
+		return loadJournal(opts.JournalPath)
+	}
+	return openJournal(opts.JournalPath)
+}
+
+func closeJournal(journal *state.Journal) {
+	if journal != nil {
+		_ = journal.Close()
+	}
+}
+
+func recordJournal(journal *state.Journal, event state.JournalEvent) error {
+	if journal == nil {
+		return nil
+	}
+	return journal.Record(event)
+}
+
+// resumeFromJournal takes media finished by an earlier run out of the scan and
+// restores journaled pairs, so media whose JSON was already removed are not
+// reported as missing and unfinished media keep the pair chosen before.
+func resumeFromJournal(journal *state.Journal, scan files.MediaScanResult) (files.MediaScanResult, []resumedMedia) {
+	if journal == nil {
+		return scan, nil
+	}
+	entries := journal.Entries()
+	if len(entries) == 0 {
+		return scan, nil
+	}
+
+	out := files.MediaScanResult{
+		Pairs:            maps.Clone(scan.Pairs),
+		PairSources:      maps.Clone(scan.PairSources),
+		AmbiguousJSON:    maps.Clone(scan.AmbiguousJSON),
+		LocalizedEdits:   scan.LocalizedEdits,
+		NoJSON:           scan.NoJSON,
+		Albums:           maps.Clone(scan.Albums),
+		MediaAlbums:      maps.Clone(scan.MediaAlbums),
+		LivePhotos:       maps.Clone(scan.LivePhotos),
+		InvalidOverrides: scan.InvalidOverrides,
+	}
+	if out.Pairs == nil {
+		out.Pairs = make(map[string]string)
+	}
+	if out.PairSources == nil {
+		out.PairSources = make(map[string]files.MatchStrategy)
+	}
+	if out.AmbiguousJSON == nil {
+		out.AmbiguousJSON = make(map[string][]string)
+	}
+
+	missing := make(map[string]struct{}, len(scan.MissingJSON))
+	for _, mediaFile := range scan.MissingJSON {
+		missing[mediaFile] = struct{}{}
+	}
+	jsonOnDisk := make(map[string]struct{}, len(scan.Pairs)+len(scan.UnusedJSON))
+	for _, jsonFile := range scan.Pairs {
+		jsonOnDisk[jsonFile] = struct{}{}
+	}
+	for _, jsonFile := range scan.UnusedJSON {
+		jsonOnDisk[jsonFile] = struct{}{}
+	}
+
+	isPresent := func(mediaFile string) bool {
+		if _, ok := out.Pairs[mediaFile]; ok {
+			return true
+		}
+		if _, ok := out.AmbiguousJSON[mediaFile]; ok {
+			return true
+		}
+		_, ok := missing[mediaFile]
+		return ok
+	}
+	forget := func(mediaFile string) {
+		delete(out.Pairs, mediaFile)
+		delete(out.PairSources, mediaFile)
+		delete(out.AmbiguousJSON, mediaFile)
+		delete(missing, mediaFile)
+	}
+
+	var resumed []resumedMedia
+	for _, key := range slices.Sorted(maps.Keys(entries)) {
+		entry := entries[key]
+		mediaFile := entry.Path
+		if !isPresent(mediaFile) {
+			continue
+		}
+		_, jsonExists := jsonOnDisk[entry.JSON]
+
+		if entry.MetadataApplied {
+			forget(mediaFile)
+			resumed = append(resumed, resumedMedia{
+				mediaFile:   mediaFile,
+				jsonFile:    entry.JSON,
+				jsonPending: entry.JSON != "" && jsonExists && !entry.JSONRemoved,
+			})
+			continue
+		}
+		// A pair chosen in the overrides file wins over the journal.
+		if entry.Paired && entry.JSON != "" && jsonExists && !isOverridden(scan, mediaFile) {
+			forget(mediaFile)
+			out.Pairs[mediaFile] = entry.JSON
+			out.PairSources[mediaFile] = MatchJournal
+		}
+	}
+
+	usedJSON := make(map[string]struct{}, len(out.Pairs)+len(resumed))
+	for _, jsonFile := range out.Pairs {
+		usedJSON[jsonFile] = struct{}{}
+	}
+	for _, media := range resumed {
+		if media.jsonPending {
+			usedJSON[media.jsonFile] = struct{}{}
+		}
+	}
+	// JSON left without a pair becomes unused.
+	for _, jsonFile := range slices.Sorted(maps.Keys(jsonOnDisk)) {
+		if _, ok := usedJSON[jsonFile]; !ok {
+			out.UnusedJSON = append(out.UnusedJSON, jsonFile)
+		}
+	}
+
+	out.MissingJSON = slices.Sorted(maps.Keys(missing))
+	return out, resumed
+}
+
+func isOverridden(scan files.MediaScanResult, mediaFile string) bool {
+	_, noJSON := slices.BinarySearch(scan.NoJSON, mediaFile)
+	return noJSON || scan.PairSources[mediaFile] == files.MatchOverride
+}
+
+func relToRoot(rootPath string, path string) string {
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UndatedFolder holds media without a resolved capture date when a layout is
+// used.
+const UndatedFolder = "undated"
+
+var (
+	moveFile     = os.Rename
+	layoutTokens = []string{"YYYY", "MM", "DD"}
+)
+
+// layoutItem is a media file that is placed by the layout, with its sidecar.
+type layoutItem struct {
+	path        string
+	sidecarPath string
+	captureTime time.Time
+	// group keeps items together, such as the halves of a Live Photo.
+	group string
+}
+
+// ValidateLayout checks a layout template such as "YYYY/MM" or
+// "YYYY/YYYY-MM-DD". Templates use / between folders and may contain the
+// YYYY, MM and DD tokens.
+func ValidateLayout(layout string) error {
+	if strings.TrimSpace(layout) == "" {
+		return errors.New("layout is empty")
+	}
+	if !slices.ContainsFunc(layoutTokens, func(token string) bool {
+		return strings.Contains(layout, token)
+	}) {
+		return fmt.Errorf("layout %q has no YYYY, MM or DD token", layout)
+	}
+	if strings.HasPrefix(layout, "/") || filepath.IsAbs(layout) {
+		return fmt.Errorf("layout %q must be relative", layout)
+	}
+	for part := range strings.SplitSeq(layout, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\:`) {
+			return fmt.Errorf("layout %q has an invalid folder %q", layout, part)
+		}
+	}
+	return nil
+}
+
+// layoutDir expands the layout tokens for a capture time.
+func layoutDir(layout string, captureTime time.Time) string {
+	if captureTime.IsZero() {
+		return UndatedFolder
+	}
+	r := strings.NewReplacer(
+		"YYYY", fmt.Sprintf("%04d", captureTime.Year()),
+		"MM", fmt.Sprintf("%02d", int(captureTime.Month())),
+		"DD", fmt.Sprintf("%02d", captureTime.Day()),
+	)
+	return filepath.FromSlash(r.Replace(layout))
+}
+
+// applyLayout moves media and their sidecars into layout folders under baseDir
+// and returns the media moves it made. Items are placed in path order and a
+// taken name gets a "-1", "-2", ... suffix, so the same input always yields
+// the same result. A target holding the same content as the item, such as
+// one left by an earlier run into the same output, is replaced rather than
+// suffixed. Items of one group, such as the halves of a Live Photo, go to
+// the same folder with the same suffix.
+func applyLayout(report *Report, baseDir string, layout string, items []layoutItem, dryRun bool) []PlannedMove {
+	var moves []PlannedMove
+	claimed := make(map[string]struct{}, len(items))
+	for _, unit := range layoutUnits(items) {
+		var captureTime time.Time
+		for _, item := range unit {
+			if captureTime.IsZero() {
+				captureTime = item.captureTime
+			}
+		}
+		dir := filepath.Join(baseDir, layoutDir(layout, captureTime))
+		targets := layoutTargets(dir, unit, claimed)
+
+		for i, item := range unit {
+			target := targets[i]
+			claimed[target] = struct{}{}
+			if target == item.path {
+				continue
+			}
+
+			if dryRun {
+				report.Plan.Moves = append(report.Plan.Moves, PlannedMove{From: item.path, To: target})
+				if item.sidecarPath != "" {
+					report.Plan.Moves = append(report.Plan.Moves, PlannedMove{From: item.sidecarPath, To: target + ".xmp"})
+				}
+				report.Summary.OrganizedMedia++
+				continue
+			}
+
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				report.addProblem("layout errors", item.path)
+				continue
+			}
+			if err := moveFile(item.path, target); err != nil {
+				report.addProblem("layout errors", item.path)
+				continue
+			}
+			if item.sidecarPath != "" {
+				if err := moveFile(item.sidecarPath, target+".xmp"); err != nil {
+					report.addProblem("layout errors", item.sidecarPath)
+				}
+			}
+			report.Summary.OrganizedMedia++
+			moves = append(moves, PlannedMove{From: item.path, To: target})
+		}
+	}
+	return moves
+}
+
+// layoutUnits splits items into groups placed together, ordered by path.
+func layoutUnits(items []layoutItem) [][]layoutItem {
+	slices.SortFunc(items, func(a, b layoutItem) int {
+		return strings.Compare(a.path, b.path)
+	})
+
+	var units [][]layoutItem
+	groupIndex := make(map[string]int)
+	for _, item := range items {
+		if item.group == "" {
+			units = append(units, []layoutItem{item})
+			continue
+		}
+		if i, ok := groupIndex[item.group]; ok {
+			units[i] = append(units[i], item)
+			continue
+		}
+		groupIndex[item.group] = len(units)
+		units = append(units, []layoutItem{item})
+	}
+	return units
+}
+
+// layoutTargets picks the first suffix that is free for every item of a unit.
+func layoutTargets(dir string, unit []layoutItem, claimed map[string]struct{}) []string {
+	targets := make([]string, len(unit))
+	for n := 0; ; n++ {
+		free := true
+		for i, item := range unit {
+			name := filepath.Base(item.path)
+			if n > 0 {
+				ext := filepath.Ext(name)
+				name = strings.TrimSuffix(name, ext) + "-" + strconv.Itoa(n) + ext
+			}
+			targets[i] = filepath.Join(dir, name)
+			if !isLayoutTargetFree(targets[i], item, claimed) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return targets
+		}
+	}
+}
+
+// isLayoutTargetFree reports whether item may be moved to target. A file
+// already at target with the same content, such as the copy a previous run
+// placed in the same output, is the same item and is replaced.
+func isLayoutTargetFree(target string, item layoutItem, claimed map[string]struct{}) bool {
+	if target == item.path {
+		return true
+	}
+	if _, taken := claimed[target]; taken {
+		return false
+	}
+	if pathExists(target) && !sameContent(target, item.path) {
+		return false
+	}
+	return item.sidecarPath == "" || !pathExists(target+".xmp") || sameContent(target+".xmp", item.sidecarPath)
+}
+
+// sameContent reports whether the files at a and b hold the same bytes.
+func sameContent(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil || !infoA.Mode().IsRegular() || infoA.Size() != infoB.Size() {
+		return false
+	}
+	fileA, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = fileA.Close()
+	}()
+	fileB, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = fileB.Close()
+	}()
+
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		n, errA := io.ReadFull(fileA, bufA)
+		m, errB := io.ReadFull(fileB, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			return errors.Is(errA, io.ErrUnexpectedEOF) || errors.Is(errA, io.EOF)
+		}
+	}
+}
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
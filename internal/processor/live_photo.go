@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+
+	"github.com/vchilikov/takeout-fix/utils/extensions"
+)
+
+var (
+	fixLivePhoto            = extensions.FixPair
+	fixLivePhotoWithRunner  = extensions.FixPairWithRunner
+	planLivePhoto           = extensions.PlanPair
+	planLivePhotoWithRunner = extensions.PlanPairWithRunner
+)
+
+// livePhotoContentID derives the ContentIdentifier shared by both halves of
+// a Live Photo from the still's path, so repeated runs write the same value.
+// It is formatted like the upper-case UUIDs Apple devices write.
+func livePhotoContentID(stillRel string) string {
+	sum := sha1.Sum([]byte("takeoutfix-live-photo:" + filepath.ToSlash(stillRel)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func runFixPairWithFallback(stillPath string, videoPath string, session *exiftoolSession) (extensions.FixResult, extensions.FixResult, error) {
+	if session != nil && *session != nil {
+		still, video, err := fixLivePhotoWithRunner(stillPath, videoPath, (*session).Run)
+		if err == nil {
+			return still, video, nil
+		}
+		closeAndResetSession(session)
+	}
+	return fixLivePhoto(stillPath, videoPath)
+}
+
+func runPlanFixPairWithFallback(stillPath string, videoPath string, session *exiftoolSession) (extensions.FixResult, extensions.FixResult, error) {
+	if session != nil && *session != nil {
+		still, video, err := planLivePhotoWithRunner(stillPath, videoPath, (*session).Run)
+		if err == nil {
+			return still, video, nil
+		}
+		closeAndResetSession(session)
+	}
+	return planLivePhoto(stillPath, videoPath)
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var copyMediaFile = copyFile
+
+// checkOutputDir rejects an output directory that overlaps the processed
+// root. An output inside the root would be scanned as input on the next run,
+// and a root inside the output would get copies and layout folders written
+// into it.
+func checkOutputDir(rootPath string, outputDir string) error {
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		return fmt.Errorf("resolve root: %w", err)
+	}
+	output, err := filepath.Abs(outputDir)
+	if err != nil {
+		return fmt.Errorf("resolve output: %w", err)
+	}
+	if isWithin(root, output) || isWithin(output, root) {
+		return fmt.Errorf("output directory %s must be outside %s", outputDir, rootPath)
+	}
+	return nil
+}
+
+// isWithin reports whether path is base itself or lies under it.
+func isWithin(base string, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// toOutputPath maps a path under rootPath to the same place under outputDir.
+// Paths outside rootPath are returned unchanged.
+func toOutputPath(rootPath string, outputDir string, path string) string {
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(outputDir, rel)
+}
+
+// copyFile copies src to dst, creating parent directories and keeping the
+// source modification time.
+func copyFile(src string, dst string) (err error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("stat source: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("mkdir output dir: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create copy: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copy data: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close copy: %w", err)
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("set copy times: %w", err)
+	}
+	return nil
+}
+
+// toOutputCommands points planned exiftool commands at the output copy.
+func toOutputCommands(rootPath string, outputDir string, commands [][]string) [][]string {
+	mapped := make([][]string, 0, len(commands))
+	for _, args := range commands {
+		out := make([]string, len(args))
+		for i, arg := range args {
+			out[i] = toOutputPath(rootPath, outputDir, arg)
+		}
+		mapped = append(mapped, out)
+	}
+	return mapped
+}
@@ -1,28 +1,37 @@
 package processor
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
 	"slices"
+	"strings"
 	"sync"
 
 	"github.com/vchilikov/takeout-fix/internal/exiftool"
+	"github.com/vchilikov/takeout-fix/internal/state"
 	"github.com/vchilikov/takeout-fix/utils/extensions"
 	"github.com/vchilikov/takeout-fix/utils/files"
 	"github.com/vchilikov/takeout-fix/utils/metadata"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
 )
 
 const maxProblemSamples = 5
 
 var (
-	scanTakeout                  = files.ScanTakeout
+	scanTakeout                  = files.ScanTakeoutWithOverrides
 	fixMediaExtension            = extensions.FixDetailed
 	fixMediaExtensionWithRunner  = extensions.FixDetailedWithRunner
+	planMediaExtension           = extensions.Plan
+	planMediaExtensionWithRunner = extensions.PlanWithRunner
 	applyMediaMetadata           = metadata.ApplyDetailed
 	applyMediaMetadataWithRunner = metadata.ApplyDetailedWithRunner
+	planMediaMetadata            = metadata.Plan
+	planMediaMetadataWithRunner  = metadata.PlanWithRunner
 	openExiftoolSession          = func() (exiftoolSession, error) { return exiftool.Start() }
 	removeJSONFile               = os.Remove
 )
@@ -44,12 +53,182 @@ type Summary struct {
 	UnusedJSON          int
 	JSONRemoved         int
 	JSONKeptDueToErrors int
+	// ResumedMedia counts media the journal recorded as finished by an
+	// earlier run, which were skipped.
+	ResumedMedia int
+	// MatchedByTitle counts media paired with their JSON through its title
+	// field rather than its filename.
+	MatchedByTitle int
+	// CopiedUnchanged counts media without a JSON that were copied to the
+	// output directory without any change.
+	CopiedUnchanged int
+	// OrganizedMedia counts media moved, or planned to be moved, into
+	// layout folders.
+	OrganizedMedia int
+	// AlbumMedia counts media whose album titles were written.
+	AlbumMedia int
+	// LivePhotos counts Live Photos whose still and video were processed
+	// together as one item.
+	LivePhotos int
+	// PeopleTagged counts media whose JSON people were written as
+	// PersonInImage.
+	PeopleTagged int
+	// Favorites counts media the JSON marks as favorited that got the
+	// favorite rating.
+	Favorites int
+	// LocalizedEdits counts edited copies paired by removing a non-English
+	// edited suffix, such as "-bearbeitet", from their name.
+	LocalizedEdits int
+	// Overridden counts media paired, or marked as having no JSON, by the
+	// overrides file.
+	Overridden int
+	// LocalZoneFallbacks counts media whose dates were written in the local
+	// zone because the gps timezone policy found no GPS position.
+	LocalZoneFallbacks int
+	// SidecarIssues counts media whose JSON had fields that could not be
+	// used. The fields are listed under the "sidecar issues" problem.
+	SidecarIssues int
+	// DateConflicts counts media with a rejected date or dates that
+	// disagree. Each one is listed under the "date conflicts" problem.
+	DateConflicts int
+	// UnpairedRenamed, UnpairedFilenameDates and UnpairedDatesSynced count
+	// media without a JSON whose extension was fixed, whose date was
+	// restored from the filename, and whose file dates were set to the
+	// DateTimeOriginal already in the file.
+	UnpairedRenamed       int
+	UnpairedFilenameDates int
+	UnpairedDatesSynced   int
+	// ExifRepaired counts media whose corrupt EXIF was repaired before the
+	// JSON values were written.
+	ExifRepaired int
+	// DuplicateFiles counts the files the dedup replaced with a hardlink to,
+	// or removed in favor of, an identical copy. DedupBytesSaved is the
+	// space they took.
+	DuplicateFiles  int
+	DedupBytesSaved int64
 }
 
 type Report struct {
 	Summary        Summary
+	Plan           Plan
+	Matches        []PairMatch
+	Duplicates     []DuplicateGroup
 	ProblemCounts  map[string]int
 	ProblemSamples map[string][]string
+	// SkippedFields counts, per metadata.Fields entry, the media whose JSON
+	// value was left unwritten by the write policy.
+	SkippedFields map[string]int
+	// FilenameDates lists the media whose capture date was restored from
+	// the filename, in processing order.
+	FilenameDates []FilenameDate
+	// RepairedExif lists the media whose corrupt EXIF was repaired, in
+	// processing order.
+	RepairedExif []RepairedExif
+}
+
+// Options controls how RunWithOptions processes a Takeout tree.
+type Options struct {
+	// DryRun plans every change into Report.Plan without touching any file.
+	DryRun bool
+	// JournalPath is the per-media journal used to resume an interrupted run.
+	// Empty disables journaling.
+	JournalPath string
+	// OutputDir receives processed copies of the media. When set, the
+	// processed root is left untouched, JSON files are kept and media without
+	// a JSON pair are copied unchanged. The journal is not used.
+	OutputDir string
+	// Layout moves processed media into date folders such as "YYYY/MM"
+	// under OutputDir, or under the processed root without OutputDir. Empty
+	// keeps the Takeout folder layout. See ValidateLayout.
+	Layout string
+	// Dedup keeps one copy of byte-identical media once metadata is applied.
+	// A dry run lists duplicates by the current content of the processed root.
+	Dedup DedupMode
+	// AlbumTag selects where album names from album metadata.json files are
+	// written. Empty uses metadata.DefaultAlbumTag.
+	AlbumTag metadata.AlbumTag
+	// PeopleHierarchy is the HierarchicalSubject parent for person names
+	// from the JSON. Empty uses metadata.DefaultPeopleHierarchy.
+	PeopleHierarchy string
+	// FavoriteRating is the XMP:Rating written for favorited media. Zero
+	// uses metadata.DefaultFavoriteRating.
+	FavoriteRating int
+	// FavoriteKeyword also adds a "Favorite" keyword to favorited media.
+	FavoriteKeyword bool
+	// Timezone selects the zone capture dates are written in. Empty keeps
+	// exiftool's conversion with the local zone and writes no offset tags.
+	Timezone metadata.TimezonePolicy
+	// DatePrecedence orders the sources capture dates are taken from.
+	// Empty uses metadata.DefaultDatePrecedence.
+	DatePrecedence metadata.DatePrecedence
+	// DateChecks selects the sanity checks capture dates must pass. Empty
+	// enables all checks.
+	DateChecks metadata.DateChecks
+	// WritePolicy selects per field whether JSON values replace values
+	// already in the media. Empty overwrites every field.
+	WritePolicy metadata.WritePolicy
+	// BackupDir keeps a copy of every media, XMP sidecar and JSON before
+	// the run first changes or removes it, for Rollback. The copies are
+	// journaled, so JournalPath must be set. Empty disables backups. Dry
+	// runs and runs with OutputDir change no input files and make none.
+	BackupDir string
+	// OverridesPath is a file of manual pairings that take precedence over
+	// matching. See files.LoadOverrides. A missing file has no overrides.
+	OverridesPath string
+}
+
+// Plan lists the changes a dry run found. Paths are absolute.
+type Plan struct {
+	Copies       []PlannedCopy
+	Renames      []PlannedRename
+	Commands     []PlannedCommand
+	Moves        []PlannedMove
+	JSONRemovals []string
+}
+
+type PlannedRename struct {
+	From string
+	To   string
+}
+
+type PlannedCopy struct {
+	From string
+	To   string
+}
+
+type PlannedMove struct {
+	From string
+	To   string
+}
+
+type PlannedCommand struct {
+	Media string
+	Args  []string
+}
+
+// PairMatch is one processed media/JSON pair and the strategy that matched
+// it. Paths are relative to the processed root.
+type PairMatch struct {
+	Media    string
+	JSON     string
+	Strategy files.MatchStrategy
+}
+
+// FilenameDate is one media whose capture date was restored from its
+// filename and the pattern that matched. Media is relative to the
+// processed root.
+type FilenameDate struct {
+	Media     string
+	Pattern   string
+	Precision metadata.DatePrecision
+}
+
+// RepairedExif is one media whose corrupt EXIF was repaired, how, and the
+// tags the repair lost. Media is relative to the processed root.
+type RepairedExif struct {
+	Media    string
+	Repair   metadata.ExifRepair
+	LostTags []string
 }
 
 type ProgressEvent struct {
@@ -63,51 +242,154 @@ func Run(rootPath string) (Report, error) {
 }
 
 func RunWithProgress(rootPath string, onProgress func(ProgressEvent)) (Report, error) {
+	return RunWithOptions(rootPath, Options{}, onProgress)
+}
+
+func RunWithOptions(rootPath string, opts Options, onProgress func(ProgressEvent)) (Report, error) {
 	report := Report{
 		ProblemCounts:  make(map[string]int),
 		ProblemSamples: make(map[string][]string),
+		SkippedFields:  make(map[string]int),
 	}
 
-	scanResult, err := scanTakeout(rootPath)
+	if opts.OutputDir != "" {
+		if err := checkOutputDir(rootPath, opts.OutputDir); err != nil {
+			return report, err
+		}
+	}
+	if opts.Layout != "" {
+		if err := ValidateLayout(opts.Layout); err != nil {
+			return report, err
+		}
+	}
+	if _, err := ParseDedupMode(string(opts.Dedup)); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParseAlbumTag(string(opts.AlbumTag)); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParsePeopleHierarchy(opts.PeopleHierarchy); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParseTimezonePolicy(string(opts.Timezone)); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParseDatePrecedence(string(opts.DatePrecedence)); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParseDateChecks(string(opts.DateChecks)); err != nil {
+		return report, err
+	}
+	if _, err := metadata.ParseWritePolicy(string(opts.WritePolicy)); err != nil {
+		return report, err
+	}
+	if opts.BackupDir != "" && opts.JournalPath == "" {
+		return report, errors.New("backups need a journal path")
+	}
+	if opts.FavoriteRating != 0 {
+		if err := metadata.ValidateFavoriteRating(opts.FavoriteRating); err != nil {
+			return report, err
+		}
+	}
+
+	var overrides files.Overrides
+	if opts.OverridesPath != "" {
+		loaded, err := files.LoadOverrides(opts.OverridesPath)
+		if err != nil {
+			return report, err
+		}
+		overrides = loaded
+	}
+	scanResult, err := scanTakeout(rootPath, overrides)
 	if err != nil {
 		return report, fmt.Errorf("scan takeout: %w", err)
 	}
+	report.Summary.Overridden = len(scanResult.NoJSON)
+	for _, mediaFile := range scanResult.InvalidOverrides {
+		report.addProblem("invalid overrides", mediaFile)
+	}
 
+	report.Summary.MediaFound = len(scanResult.Pairs) + len(scanResult.MissingJSON) + len(scanResult.AmbiguousJSON)
+
+	backups := openBackupStore(opts)
+	journal, err := openRunJournal(opts)
+	if err != nil {
+		// Backups the journal cannot record could never be rolled back.
+		if backups != nil {
+			return report, fmt.Errorf("open journal for backups: %w", err)
+		}
+		report.addProblem("journal errors", err.Error())
+		journal = nil
+	}
+	defer closeJournal(journal)
+
+	scanResult, resumed := resumeFromJournal(journal, scanResult)
+	report.Summary.ResumedMedia = len(resumed)
 	report.Summary.MissingJSON = len(scanResult.MissingJSON)
 	report.Summary.AmbiguousMedia = len(scanResult.AmbiguousJSON)
 	report.Summary.UnusedJSON = len(scanResult.UnusedJSON)
-	report.Summary.MediaFound = len(scanResult.Pairs) + len(scanResult.MissingJSON) + len(scanResult.AmbiguousJSON)
 
 	jsonPairCount := make(map[string]int, len(scanResult.Pairs))
 	for _, jsonFile := range scanResult.Pairs {
 		jsonPairCount[jsonFile]++
 	}
 	jsonSuccessCount := make(map[string]int, len(jsonPairCount))
+	jsonMedia := make(map[string][]string, len(jsonPairCount))
+	for _, media := range resumed {
+		if !media.jsonPending {
+			continue
+		}
+		jsonPairCount[media.jsonFile]++
+		jsonSuccessCount[media.jsonFile]++
+		jsonMedia[media.jsonFile] = append(jsonMedia[media.jsonFile], media.mediaFile)
+	}
 
 	mediaFiles := slices.Sorted(maps.Keys(scanResult.Pairs))
-	total := len(mediaFiles)
-
-	if total > 0 {
-		type mediaJob struct {
-			mediaFile string
-			jsonFile  string
+	var layoutItems []layoutItem
+	for _, mediaFile := range mediaFiles {
+		strategy := cmp.Or(scanResult.PairSources[mediaFile], files.MatchFilename)
+		if strategy == files.MatchTitle {
+			report.Summary.MatchedByTitle++
 		}
-		type mediaResult struct {
-			mediaFile string
-			mediaPath string
-			jsonFile  string
-			fixResult extensions.FixResult
-			meta      metadata.ApplyResult
-			fixErr    error
-			metaErr   error
+		if _, ok := scanResult.LocalizedEdits[mediaFile]; ok {
+			report.Summary.LocalizedEdits++
 		}
+		if strategy == files.MatchOverride {
+			report.Summary.Overridden++
+		}
+		report.Matches = append(report.Matches, PairMatch{
+			Media:    mediaFile,
+			JSON:     scanResult.Pairs[mediaFile],
+			Strategy: strategy,
+		})
+	}
+	unpaired := slices.Concat(scanResult.MissingJSON, slices.Collect(maps.Keys(scanResult.AmbiguousJSON)))
+	slices.Sort(unpaired)
+	total := len(mediaFiles) + len(unpaired)
+
+	albums := scanResult.MediaAlbums
+	if opts.AlbumTag == metadata.AlbumTagNone {
+		albums = nil
+	}
 
+	if total > 0 {
+		metaOpts := metadata.Options{
+			AlbumTag:        opts.AlbumTag,
+			PeopleHierarchy: opts.PeopleHierarchy,
+			FavoriteRating:  opts.FavoriteRating,
+			FavoriteKeyword: opts.FavoriteKeyword,
+			Timezone:        opts.Timezone,
+			DatePrecedence:  opts.DatePrecedence,
+			DateChecks:      opts.DateChecks,
+			WritePolicy:     opts.WritePolicy,
+		}
+		queued := slices.Concat(buildJobs(mediaFiles, scanResult, albums, metaOpts), unpairedJobs(unpaired, metaOpts))
 		workers := max(runtime.NumCPU(), 1)
-		if workers > total {
-			workers = total
+		if workers > len(queued) {
+			workers = len(queued)
 		}
 
-		jobs := make(chan mediaJob, total)
+		jobs := make(chan mediaJob, len(queued))
 		results := make(chan mediaResult, total)
 		var wg sync.WaitGroup
 
@@ -120,38 +402,15 @@ func RunWithProgress(rootPath string, onProgress func(ProgressEvent)) (Report, e
 				defer closeSession(session)
 
 				for job := range jobs {
-					mediaPath := filepath.Join(rootPath, job.mediaFile)
-					jsonPath := filepath.Join(rootPath, job.jsonFile)
-
-					fixResult, fixErr := runFixWithFallback(mediaPath, &session)
-					if fixErr != nil {
-						results <- mediaResult{
-							mediaFile: job.mediaFile,
-							mediaPath: mediaPath,
-							jsonFile:  job.jsonFile,
-							fixErr:    fixErr,
-						}
-						continue
-					}
-
-					metaResult, metaErr := runMetadataWithFallback(fixResult.Path, jsonPath, &session)
-					results <- mediaResult{
-						mediaFile: job.mediaFile,
-						mediaPath: mediaPath,
-						jsonFile:  job.jsonFile,
-						fixResult: fixResult,
-						meta:      metaResult,
-						metaErr:   metaErr,
+					for _, res := range processJob(rootPath, opts, journal, backups, job, &session) {
+						results <- res
 					}
 				}
 			})
 		}
 
-		for _, mediaFile := range mediaFiles {
-			jobs <- mediaJob{
-				mediaFile: mediaFile,
-				jsonFile:  scanResult.Pairs[mediaFile],
-			}
+		for _, job := range queued {
+			jobs <- job
 		}
 		close(jobs)
 
@@ -163,25 +422,122 @@ func RunWithProgress(rootPath string, onProgress func(ProgressEvent)) (Report, e
 		processed := 0
 		for res := range results {
 			processed++
+			if res.journalErr != nil {
+				report.addProblem("journal errors", res.mediaPath)
+			}
+			if res.copyErr != nil {
+				report.addProblem("copy errors", res.mediaPath)
+				notifyProgress(onProgress, processed, total, res.mediaFile)
+				continue
+			}
+			if res.backupErr != nil {
+				report.addProblem("backup errors", res.mediaPath)
+				notifyProgress(onProgress, processed, total, res.mediaFile)
+				continue
+			}
+			if opts.DryRun && opts.OutputDir != "" {
+				inputPath := res.mediaPath
+				res.mediaPath = toOutputPath(rootPath, opts.OutputDir, inputPath)
+				res.fixResult.Path = toOutputPath(rootPath, opts.OutputDir, res.fixResult.Path)
+				if res.meta.SidecarPath != "" {
+					res.meta.SidecarPath = toOutputPath(rootPath, opts.OutputDir, res.meta.SidecarPath)
+				}
+				res.commands = toOutputCommands(rootPath, opts.OutputDir, res.commands)
+				report.Plan.Copies = append(report.Plan.Copies, PlannedCopy{From: inputPath, To: res.mediaPath})
+			}
 			if res.fixErr != nil {
 				report.addProblem("extension errors", res.mediaPath)
 				notifyProgress(onProgress, processed, total, res.mediaFile)
 				continue
 			}
 			if res.fixResult.Renamed {
-				report.Summary.RenamedExtensions++
+				if res.unpaired {
+					report.Summary.UnpairedRenamed++
+				} else {
+					report.Summary.RenamedExtensions++
+				}
+				if opts.DryRun {
+					report.Plan.Renames = append(report.Plan.Renames, PlannedRename{From: res.mediaPath, To: res.fixResult.Path})
+				}
 			}
 
 			if res.metaErr != nil {
 				report.addProblem("metadata errors", res.fixResult.Path)
+				if errors.Is(res.metaErr, sidecar.ErrInvalidJSON) {
+					report.addProblem("invalid sidecar json", res.metaErr.Error())
+				}
+				notifyProgress(onProgress, processed, total, res.mediaFile)
+				continue
+			}
+			if res.unpaired {
+				addUnpairedResult(&report, rootPath, opts, res)
+				// Unpaired media are only organized in the output tree, which
+				// must hold the whole library.
+				if opts.Layout != "" && opts.OutputDir != "" {
+					layoutItems = append(layoutItems, layoutItem{path: res.fixResult.Path, captureTime: res.meta.CaptureTime})
+				}
 				notifyProgress(onProgress, processed, total, res.mediaFile)
 				continue
 			}
 
+			for _, issue := range res.meta.SidecarIssues {
+				report.addProblem("sidecar issues", filepath.Join(rootPath, res.jsonFile)+": "+issue)
+			}
+			if len(res.meta.SidecarIssues) > 0 {
+				report.Summary.SidecarIssues++
+			}
+			for _, conflict := range res.meta.DateConflicts {
+				report.addProblem("date conflicts", res.fixResult.Path+": "+conflict)
+			}
+			if len(res.meta.DateConflicts) > 0 {
+				report.Summary.DateConflicts++
+			}
+			for _, field := range res.meta.SkippedFields {
+				report.SkippedFields[field]++
+			}
+
+			for _, args := range res.commands {
+				report.Plan.Commands = append(report.Plan.Commands, PlannedCommand{Media: res.fixResult.Path, Args: args})
+			}
+
 			jsonSuccessCount[res.jsonFile]++
+			if opts.Layout != "" {
+				layoutItems = append(layoutItems, layoutItem{
+					path:        res.fixResult.Path,
+					sidecarPath: res.meta.SidecarPath,
+					captureTime: res.meta.CaptureTime,
+					group:       res.livePhoto,
+				})
+			}
+			jsonMedia[res.jsonFile] = append(jsonMedia[res.jsonFile], relToRoot(rootPath, res.fixResult.Path))
 			report.Summary.MetadataApplied++
+			if len(albums[res.mediaFile]) > 0 {
+				report.Summary.AlbumMedia++
+			}
+			if res.livePhoto != "" && res.livePhoto != res.mediaFile {
+				report.Summary.LivePhotos++
+			}
+			if res.meta.PeopleTagged {
+				report.Summary.PeopleTagged++
+			}
+			if res.meta.Favorite {
+				report.Summary.Favorites++
+			}
 			if res.meta.UsedFilenameDate {
 				report.Summary.FilenameDateApplied++
+				report.FilenameDates = append(report.FilenameDates, FilenameDate{
+					Media:     relToRoot(rootPath, res.fixResult.Path),
+					Pattern:   res.meta.FilenamePattern,
+					Precision: res.meta.FilenamePrecision,
+				})
+			}
+			if res.meta.ExifRepair != "" {
+				report.Summary.ExifRepaired++
+				report.RepairedExif = append(report.RepairedExif, RepairedExif{
+					Media:    relToRoot(rootPath, res.fixResult.Path),
+					Repair:   res.meta.ExifRepair,
+					LostTags: res.meta.LostTags,
+				})
 			}
 			if res.meta.UsedXMPSidecar {
 				report.Summary.XMPSidecars++
@@ -196,32 +552,89 @@ func RunWithProgress(rootPath string, onProgress func(ProgressEvent)) (Report, e
 			if res.meta.MediaFileDateWarned {
 				report.addProblem("media file date warnings", res.fixResult.Path)
 			}
+			addLocalZoneFallback(&report, res)
 
 			notifyProgress(onProgress, processed, total, res.mediaFile)
 		}
 	}
 
-	jsonToRemove := make([]string, 0, len(jsonPairCount))
-	for jsonFile, pairCount := range jsonPairCount {
-		if jsonSuccessCount[jsonFile] == pairCount {
-			jsonToRemove = append(jsonToRemove, jsonFile)
-		} else {
-			report.Summary.JSONKeptDueToErrors++
+	// JSON stays in the input tree in output mode.
+	if opts.OutputDir == "" {
+		jsonToRemove := make([]string, 0, len(jsonPairCount))
+		for jsonFile, pairCount := range jsonPairCount {
+			if jsonSuccessCount[jsonFile] == pairCount {
+				jsonToRemove = append(jsonToRemove, jsonFile)
+			} else {
+				report.Summary.JSONKeptDueToErrors++
+			}
+		}
+		slices.Sort(jsonToRemove)
+
+		for _, jsonFile := range jsonToRemove {
+			if opts.DryRun {
+				report.Plan.JSONRemovals = append(report.Plan.JSONRemovals, filepath.Join(rootPath, jsonFile))
+				report.Summary.JSONRemoved++
+				continue
+			}
+			if err := backupOriginal(backups, journal, rootPath, jsonFile); err != nil {
+				report.addProblem("backup errors", filepath.Join(rootPath, jsonFile))
+				continue
+			}
+			if err := removeJSONFile(filepath.Join(rootPath, jsonFile)); err != nil {
+				report.addProblem("json remove errors", filepath.Join(rootPath, jsonFile))
+				continue
+			}
+			report.Summary.JSONRemoved++
+			for _, mediaFile := range jsonMedia[jsonFile] {
+				if err := recordJournal(journal, state.JournalEvent{Media: mediaFile, Step: state.StepJSONRemoved}); err != nil {
+					report.addProblem("journal errors", filepath.Join(rootPath, mediaFile))
+				}
+			}
 		}
 	}
-	slices.Sort(jsonToRemove)
 
-	for _, jsonFile := range jsonToRemove {
-		if err := removeJSONFile(filepath.Join(rootPath, jsonFile)); err != nil {
-			report.addProblem("json remove errors", filepath.Join(rootPath, jsonFile))
-			continue
+	var moves []PlannedMove
+	if opts.Layout != "" {
+		moves = applyLayout(&report, cmp.Or(opts.OutputDir, rootPath), opts.Layout, layoutItems, opts.DryRun)
+		if !opts.DryRun {
+			for _, move := range moves {
+				event := state.JournalEvent{Media: relToRoot(rootPath, move.From), Step: state.StepMoved, Path: relToRoot(rootPath, move.To)}
+				if err := recordJournal(journal, event); err != nil {
+					report.addProblem("journal errors", move.From)
+				}
+			}
+		}
+	}
+
+	if opts.Dedup != DedupOff {
+		if opts.DryRun {
+			applyDedup(&report, rootPath, nil, nil, opts.Dedup, true)
+		} else {
+			// checkOutputDir keeps the input out of OutputDir; skip it
+			// anyway so a dedup of the copies never reaches the originals.
+			var skip []string
+			if opts.OutputDir != "" {
+				skip = []string{rootPath}
+			}
+			applyDedup(&report, cmp.Or(opts.OutputDir, rootPath), moves, skip, opts.Dedup, false)
 		}
-		report.Summary.JSONRemoved++
 	}
 
+	if opts.DryRun {
+		sortPlan(&report.Plan)
+	}
 	return report, nil
 }
 
+// addLocalZoneFallback counts media the gps timezone policy could not place
+// and lists them under "local timezone fallbacks".
+func addLocalZoneFallback(report *Report, res mediaResult) {
+	if res.meta.LocalZoneFallback {
+		report.Summary.LocalZoneFallbacks++
+		report.addProblem("local timezone fallbacks", res.fixResult.Path)
+	}
+}
+
 func runFixWithFallback(mediaPath string, session *exiftoolSession) (extensions.FixResult, error) {
 	if session != nil && *session != nil {
 		result, err := fixMediaExtensionWithRunner(mediaPath, (*session).Run)
@@ -233,15 +646,50 @@ func runFixWithFallback(mediaPath string, session *exiftoolSession) (extensions.
 	return fixMediaExtension(mediaPath)
 }
 
-func runMetadataWithFallback(mediaPath string, jsonPath string, session *exiftoolSession) (metadata.ApplyResult, error) {
+func runMetadataWithFallback(mediaPath string, jsonPath string, metaOpts metadata.Options, session *exiftoolSession) (metadata.ApplyResult, error) {
 	if session != nil && *session != nil {
-		result, err := applyMediaMetadataWithRunner(mediaPath, jsonPath, (*session).Run)
+		result, err := applyMediaMetadataWithRunner(mediaPath, jsonPath, metaOpts, (*session).Run)
 		if err == nil {
 			return result, nil
 		}
 		closeAndResetSession(session)
 	}
-	return applyMediaMetadata(mediaPath, jsonPath)
+	return applyMediaMetadata(mediaPath, jsonPath, metaOpts)
+}
+
+func runPlanFixWithFallback(mediaPath string, session *exiftoolSession) (extensions.FixResult, error) {
+	if session != nil && *session != nil {
+		result, err := planMediaExtensionWithRunner(mediaPath, (*session).Run)
+		if err == nil {
+			return result, nil
+		}
+		closeAndResetSession(session)
+	}
+	return planMediaExtension(mediaPath)
+}
+
+func runPlanMetadataWithFallback(mediaPath string, jsonPath string, metaOpts metadata.Options, session *exiftoolSession) ([][]string, metadata.ApplyResult, error) {
+	if session != nil && *session != nil {
+		commands, result, err := planMediaMetadataWithRunner(mediaPath, jsonPath, metaOpts, (*session).Run)
+		if err == nil {
+			return commands, result, nil
+		}
+		closeAndResetSession(session)
+	}
+	return planMediaMetadata(mediaPath, jsonPath, metaOpts)
+}
+
+// sortPlan orders planned entries by path because workers finish in any order.
+func sortPlan(plan *Plan) {
+	slices.SortStableFunc(plan.Copies, func(a, b PlannedCopy) int {
+		return strings.Compare(a.From, b.From)
+	})
+	slices.SortStableFunc(plan.Renames, func(a, b PlannedRename) int {
+		return strings.Compare(a.From, b.From)
+	})
+	slices.SortStableFunc(plan.Commands, func(a, b PlannedCommand) int {
+		return strings.Compare(a.Media, b.Media)
+	})
 }
 
 func closeAndResetSession(session *exiftoolSession) {
@@ -2,13 +2,21 @@ package processor
 
 import (
 	"errors"
+	"fmt"
+	"maps"
+	"os"
 	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/vchilikov/takeout-fix/internal/state"
 	"github.com/vchilikov/takeout-fix/utils/extensions"
 	"github.com/vchilikov/takeout-fix/utils/files"
 	"github.com/vchilikov/takeout-fix/utils/metadata"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
 )
 
 func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T) {
@@ -17,7 +25,7 @@ func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T)
 
 	root := t.TempDir()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{
 			Pairs: map[string]string{
 				"a.jpg": "a.json",
@@ -41,7 +49,7 @@ func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T)
 			return extensions.FixResult{Path: mediaPath}, errors.New("fix failed")
 		case "c.jpg":
 			return extensions.FixResult{Path: filepath.Join(filepath.Dir(mediaPath), "c-renamed.jpg"), Renamed: true}, nil
-		case "d.jpg":
+		case "d.jpg", "missing.jpg", "ambiguous.jpg":
 			return extensions.FixResult{Path: mediaPath}, nil
 		default:
 			t.Fatalf("unexpected media in fix: %s", mediaPath)
@@ -49,14 +57,14 @@ func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T)
 		}
 	}
 
-	applyMediaMetadata = func(mediaPath string, jsonPath string) (metadata.ApplyResult, error) {
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
 		switch filepath.Base(mediaPath) {
 		case "a.jpg":
 			return metadata.ApplyResult{UsedXMPSidecar: true}, nil
 		case "c-renamed.jpg":
 			return metadata.ApplyResult{}, errors.New("metadata failed")
 		case "d.jpg":
-			return metadata.ApplyResult{CreateDateWarned: true, UsedFilenameDate: true}, nil
+			return metadata.ApplyResult{CreateDateWarned: true, UsedFilenameDate: true, FilenamePattern: "camera", FilenamePrecision: metadata.PrecisionDateTime}, nil
 		default:
 			t.Fatalf("unexpected media in metadata apply: %s (%s)", mediaPath, jsonPath)
 			return metadata.ApplyResult{}, nil
@@ -89,6 +97,10 @@ func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T)
 	if report.Summary.FilenameDateApplied != 1 {
 		t.Fatalf("FilenameDateApplied: want 1, got %d", report.Summary.FilenameDateApplied)
 	}
+	wantFilenameDates := []FilenameDate{{Media: "d.jpg", Pattern: "camera", Precision: metadata.PrecisionDateTime}}
+	if !slices.Equal(report.FilenameDates, wantFilenameDates) {
+		t.Fatalf("FilenameDates: want %+v, got %+v", wantFilenameDates, report.FilenameDates)
+	}
 	if report.Summary.RenamedExtensions != 1 {
 		t.Fatalf("RenamedExtensions: want 1, got %d", report.Summary.RenamedExtensions)
 	}
@@ -127,14 +139,14 @@ func TestRunWithProgress_AggregatesResultsAndContinuesOnFileErrors(t *testing.T)
 		t.Fatalf("json remove errors: want 1, got %d", got)
 	}
 
-	if len(progress) != 4 {
-		t.Fatalf("expected 4 progress events, got %d", len(progress))
+	if len(progress) != 6 {
+		t.Fatalf("expected 6 progress events, got %d", len(progress))
 	}
 
 	gotProcessed := make([]int, 0, len(progress))
 	for _, event := range progress {
-		if event.Total != 4 {
-			t.Fatalf("progress total: want 4, got %d", event.Total)
+		if event.Total != 6 {
+			t.Fatalf("progress total: want 6, got %d", event.Total)
 		}
 		gotProcessed = append(gotProcessed, event.Processed)
 	}
@@ -159,7 +171,7 @@ func TestRunWithProgress_SharedJSONRemovedOnceWhenAllLinkedMediaSucceed(t *testi
 
 	root := t.TempDir()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{
 			Pairs: map[string]string{
 				"a.jpg": "shared.json",
@@ -172,7 +184,7 @@ func TestRunWithProgress_SharedJSONRemovedOnceWhenAllLinkedMediaSucceed(t *testi
 		return extensions.FixResult{Path: mediaPath}, nil
 	}
 
-	applyMediaMetadata = func(mediaPath string, jsonPath string) (metadata.ApplyResult, error) {
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
 		if filepath.Base(jsonPath) != "shared.json" {
 			t.Fatalf("unexpected json path: %s", jsonPath)
 		}
@@ -213,7 +225,7 @@ func TestRunWithProgress_SharedJSONKeptWhenAnyLinkedMediaFails(t *testing.T) {
 
 	root := t.TempDir()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{
 			Pairs: map[string]string{
 				"a.jpg": "shared.json",
@@ -226,7 +238,7 @@ func TestRunWithProgress_SharedJSONKeptWhenAnyLinkedMediaFails(t *testing.T) {
 		return extensions.FixResult{Path: mediaPath}, nil
 	}
 
-	applyMediaMetadata = func(mediaPath string, jsonPath string) (metadata.ApplyResult, error) {
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
 		if filepath.Base(jsonPath) != "shared.json" {
 			t.Fatalf("unexpected json path: %s", jsonPath)
 		}
@@ -273,7 +285,7 @@ func TestRunWithProgress_FilenameDateWarningIsNonFatal(t *testing.T) {
 
 	root := t.TempDir()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{
 			Pairs: map[string]string{
 				"a.jpg": "a.json",
@@ -285,7 +297,7 @@ func TestRunWithProgress_FilenameDateWarningIsNonFatal(t *testing.T) {
 		return extensions.FixResult{Path: mediaPath}, nil
 	}
 
-	applyMediaMetadata = func(mediaPath string, jsonPath string) (metadata.ApplyResult, error) {
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
 		if filepath.Base(mediaPath) != "a.jpg" || filepath.Base(jsonPath) != "a.json" {
 			t.Fatalf("unexpected metadata input: media=%s json=%s", mediaPath, jsonPath)
 		}
@@ -329,7 +341,7 @@ func TestRunWithProgress_MediaFileDateWarningIsNonFatal(t *testing.T) {
 
 	root := t.TempDir()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{
 			Pairs: map[string]string{
 				"a.avi": "a.json",
@@ -341,7 +353,7 @@ func TestRunWithProgress_MediaFileDateWarningIsNonFatal(t *testing.T) {
 		return extensions.FixResult{Path: mediaPath}, nil
 	}
 
-	applyMediaMetadata = func(mediaPath string, jsonPath string) (metadata.ApplyResult, error) {
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
 		if filepath.Base(mediaPath) != "a.avi" || filepath.Base(jsonPath) != "a.json" {
 			t.Fatalf("unexpected metadata input: media=%s json=%s", mediaPath, jsonPath)
 		}
@@ -386,7 +398,7 @@ func TestRunWithProgress_ReturnsScanError(t *testing.T) {
 	restore := stubProcessorDeps()
 	defer restore()
 
-	scanTakeout = func(string) (files.MediaScanResult, error) {
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
 		return files.MediaScanResult{}, errors.New("scan failed")
 	}
 
@@ -396,109 +408,1739 @@ func TestRunWithProgress_ReturnsScanError(t *testing.T) {
 	}
 }
 
-func TestRunFixWithFallback_ClosesBrokenSessionAndFallsBack(t *testing.T) {
+func TestRunWithOptions_DryRunPlansWithoutChanges(t *testing.T) {
 	restore := stubProcessorDeps()
 	defer restore()
 
-	fakeSession := &fakeExiftoolSession{}
-	session := exiftoolSession(fakeSession)
+	root := t.TempDir()
 
-	fixMediaExtensionWithRunner = func(string, func([]string) (string, error)) (extensions.FixResult, error) {
-		return extensions.FixResult{}, errors.New("session path failed")
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				"a.jpg": "a.json",
+				"b.jpg": "b.json",
+			},
+			MissingJSON: []string{"missing.jpg"},
+		}, nil
 	}
 
-	oneshotCalls := 0
 	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
-		oneshotCalls++
+		t.Fatalf("dry run must not fix extensions: %s", mediaPath)
+		return extensions.FixResult{}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
+		t.Fatalf("dry run must not apply metadata: %s", mediaPath)
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(path string) error {
+		t.Fatalf("dry run must not remove json: %s", path)
+		return nil
+	}
+
+	planMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		if filepath.Base(mediaPath) == "b.jpg" {
+			return extensions.FixResult{Path: filepath.Join(filepath.Dir(mediaPath), "b.png"), Renamed: true}, nil
+		}
 		return extensions.FixResult{Path: mediaPath}, nil
 	}
+	planMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) ([][]string, metadata.ApplyResult, error) {
+		return [][]string{{"-overwrite_original", mediaPath}}, metadata.ApplyResult{}, nil
+	}
 
-	result, err := runFixWithFallback("/tmp/a.jpg", &session)
+	report, err := RunWithOptions(root, Options{DryRun: true}, nil)
 	if err != nil {
-		t.Fatalf("runFixWithFallback returned error: %v", err)
+		t.Fatalf("RunWithOptions returned error: %v", err)
 	}
-	if result.Path != "/tmp/a.jpg" {
-		t.Fatalf("unexpected result path: %s", result.Path)
+
+	wantRenames := []PlannedRename{{From: filepath.Join(root, "b.jpg"), To: filepath.Join(root, "b.png")}}
+	if !slices.Equal(report.Plan.Renames, wantRenames) {
+		t.Fatalf("renames mismatch: want %v, got %v", wantRenames, report.Plan.Renames)
 	}
-	if oneshotCalls != 1 {
-		t.Fatalf("expected one fallback oneshot call, got %d", oneshotCalls)
+	if len(report.Plan.Commands) != 2 {
+		t.Fatalf("expected one planned command per media, got %v", report.Plan.Commands)
 	}
-	if session != nil {
-		t.Fatalf("expected session to be reset after runner failure")
+	if got := report.Plan.Commands[1].Media; got != filepath.Join(root, "b.png") {
+		t.Fatalf("planned command should target renamed path, got %q", got)
 	}
-	if fakeSession.closeCalls != 1 {
-		t.Fatalf("expected session close once, got %d", fakeSession.closeCalls)
+	wantRemovals := []string{filepath.Join(root, "a.json"), filepath.Join(root, "b.json")}
+	if !slices.Equal(report.Plan.JSONRemovals, wantRemovals) {
+		t.Fatalf("json removals mismatch: want %v, got %v", wantRemovals, report.Plan.JSONRemovals)
+	}
+	if report.Summary.RenamedExtensions != 1 {
+		t.Fatalf("RenamedExtensions: want 1, got %d", report.Summary.RenamedExtensions)
+	}
+	if report.Summary.JSONRemoved != 2 {
+		t.Fatalf("JSONRemoved: want 2, got %d", report.Summary.JSONRemoved)
 	}
 }
 
-func TestRunMetadataWithFallback_ClosesBrokenSessionAndFallsBack(t *testing.T) {
+func TestRunWithOptions_ResumesFromJournal(t *testing.T) {
 	restore := stubProcessorDeps()
 	defer restore()
 
-	fakeSession := &fakeExiftoolSession{}
-	session := exiftoolSession(fakeSession)
+	root := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
 
-	applyMediaMetadataWithRunner = func(string, string, func([]string) (string, error)) (metadata.ApplyResult, error) {
-		return metadata.ApplyResult{}, errors.New("session path failed")
+	previous, err := state.OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal returned error: %v", err)
+	}
+	for _, event := range []state.JournalEvent{
+		{Media: "a.jpg", Step: state.StepPaired, JSON: "a.jpg.json"},
+		{Media: "a.jpg", Step: state.StepExtensionFixed, Path: "a.png"},
+		{Media: "a.png", Step: state.StepMetadataApplied},
+		{Media: "c.jpg", Step: state.StepPaired, JSON: "c.jpg.json"},
+		{Media: "c.jpg", Step: state.StepMetadataApplied},
+		{Media: "c.jpg", Step: state.StepJSONRemoved},
+	} {
+		if err := previous.Record(event); err != nil {
+			t.Fatalf("Record returned error: %v", err)
+		}
+	}
+	if err := previous.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
 	}
 
-	oneshotCalls := 0
-	applyMediaMetadata = func(string, string) (metadata.ApplyResult, error) {
-		oneshotCalls++
-		return metadata.ApplyResult{UsedXMPSidecar: true}, nil
+	// The renamed a.png no longer matches its JSON by name, and c.jpg lost its
+	// JSON in the interrupted run.
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{"b.jpg": "b.jpg.json"},
+			MissingJSON: []string{"a.png", "c.jpg"},
+			UnusedJSON:  []string{"a.jpg.json"},
+		}, nil
+	}
+
+	var processed []string
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		processed = append(processed, filepath.Base(mediaPath))
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+
+	var removed []string
+	removeJSONFile = func(path string) error {
+		removed = append(removed, filepath.Base(path))
+		return nil
 	}
 
-	result, err := runMetadataWithFallback("/tmp/a.jpg", "/tmp/a.json", &session)
+	report, err := RunWithOptions(root, Options{JournalPath: journalPath}, nil)
 	if err != nil {
-		t.Fatalf("runMetadataWithFallback returned error: %v", err)
+		t.Fatalf("RunWithOptions returned error: %v", err)
 	}
-	if !result.UsedXMPSidecar {
-		t.Fatalf("expected fallback oneshot result")
+
+	if !slices.Equal(processed, []string{"b.jpg"}) {
+		t.Fatalf("processed media: want [b.jpg], got %v", processed)
 	}
-	if oneshotCalls != 1 {
-		t.Fatalf("expected one fallback oneshot call, got %d", oneshotCalls)
+	if report.Summary.MediaFound != 3 {
+		t.Fatalf("MediaFound: want 3, got %d", report.Summary.MediaFound)
 	}
-	if session != nil {
-		t.Fatalf("expected session to be reset after runner failure")
+	if report.Summary.ResumedMedia != 2 {
+		t.Fatalf("ResumedMedia: want 2, got %d", report.Summary.ResumedMedia)
 	}
-	if fakeSession.closeCalls != 1 {
-		t.Fatalf("expected session close once, got %d", fakeSession.closeCalls)
+	if report.Summary.MissingJSON != 0 || report.Summary.UnusedJSON != 0 {
+		t.Fatalf("unexpected missing/unused counts: %+v", report.Summary)
+	}
+	slices.Sort(removed)
+	if !slices.Equal(removed, []string{"a.jpg.json", "b.jpg.json"}) {
+		t.Fatalf("removed json: want [a.jpg.json b.jpg.json], got %v", removed)
+	}
+	if len(report.ProblemCounts) != 0 {
+		t.Fatalf("unexpected problems: %v", report.ProblemCounts)
+	}
+
+	journal, err := state.LoadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("LoadJournal returned error: %v", err)
+	}
+	for _, media := range []string{"a.png", "b.jpg"} {
+		entry, ok := journal.Lookup(media)
+		if !ok || !entry.MetadataApplied || !entry.JSONRemoved {
+			t.Fatalf("journal entry for %s: want applied and json removed, got %+v (found %v)", media, entry, ok)
+		}
 	}
 }
 
-func stubProcessorDeps() func() {
-	origScanTakeout := scanTakeout
-	origFixMediaExtension := fixMediaExtension
-	origFixMediaExtensionWithRunner := fixMediaExtensionWithRunner
-	origApplyMediaMetadata := applyMediaMetadata
-	origApplyMediaMetadataWithRunner := applyMediaMetadataWithRunner
-	origOpenExiftoolSession := openExiftoolSession
-	origRemoveJSONFile := removeJSONFile
+func TestRunWithOptions_AppliesOverridesFile(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
 
-	openExiftoolSession = func() (exiftoolSession, error) {
-		return nil, errors.New("disabled in tests")
+	overridesPath := filepath.Join(t.TempDir(), "pairs.json")
+	data := `{"pairs": [{"media": "a.jpg", "json": "x.json"}, {"media": "b.jpg", "no_json": true}]}`
+	if err := os.WriteFile(overridesPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("write overrides: %v", err)
+	}
+	var gotOverrides files.Overrides
+	scanTakeout = func(_ string, overrides files.Overrides) (files.MediaScanResult, error) {
+		gotOverrides = overrides
+		return files.MediaScanResult{
+			Pairs:            map[string]string{"a.jpg": "x.json"},
+			PairSources:      map[string]files.MatchStrategy{"a.jpg": files.MatchOverride},
+			MissingJSON:      []string{"b.jpg"},
+			NoJSON:           []string{"b.jpg"},
+			InvalidOverrides: []string{"c.jpg"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
 	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
 
-	return func() {
-		scanTakeout = origScanTakeout
-		fixMediaExtension = origFixMediaExtension
-		fixMediaExtensionWithRunner = origFixMediaExtensionWithRunner
-		applyMediaMetadata = origApplyMediaMetadata
-		applyMediaMetadataWithRunner = origApplyMediaMetadataWithRunner
-		openExiftoolSession = origOpenExiftoolSession
-		removeJSONFile = origRemoveJSONFile
+	report, err := RunWithOptions(t.TempDir(), Options{OverridesPath: overridesPath}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if want := (files.Overrides{"a.jpg": "x.json", "b.jpg": ""}); !maps.Equal(gotOverrides, want) {
+		t.Fatalf("overrides passed to the scan: want %v, got %v", want, gotOverrides)
+	}
+	if report.Summary.Overridden != 2 {
+		t.Fatalf("Overridden: want 2, got %d", report.Summary.Overridden)
+	}
+	if got := report.ProblemSamples["invalid overrides"]; !slices.Equal(got, []string{"c.jpg"}) {
+		t.Fatalf("invalid overrides: want [c.jpg], got %v", got)
+	}
+
+	if err := os.WriteFile(overridesPath, []byte(`{"pairs": [`), 0o600); err != nil {
+		t.Fatalf("write overrides: %v", err)
+	}
+	if _, err := RunWithOptions(t.TempDir(), Options{OverridesPath: overridesPath}, nil); err == nil {
+		t.Fatal("expected an error for a broken overrides file")
 	}
 }
 
-type fakeExiftoolSession struct {
-	closeCalls int
+func TestRunWithOptions_OverridesWinOverJournalPairs(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	previous, err := state.OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal returned error: %v", err)
+	}
+	for _, event := range []state.JournalEvent{
+		{Media: "a.jpg", Step: state.StepPaired, JSON: "old.json"},
+		{Media: "b.jpg", Step: state.StepPaired, JSON: "b.jpg.json"},
+	} {
+		if err := previous.Record(event); err != nil {
+			t.Fatalf("Record returned error: %v", err)
+		}
+	}
+	if err := previous.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{"a.jpg": "new.json"},
+			PairSources: map[string]files.MatchStrategy{"a.jpg": files.MatchOverride},
+			MissingJSON: []string{"b.jpg"},
+			NoJSON:      []string{"b.jpg"},
+			UnusedJSON:  []string{"b.jpg.json", "old.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	applyUnpairedMetadata = func(string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{JournalPath: journalPath}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	want := []PairMatch{{Media: "a.jpg", JSON: "new.json", Strategy: files.MatchOverride}}
+	if !slices.Equal(report.Matches, want) {
+		t.Fatalf("matches: want %v, got %v", want, report.Matches)
+	}
 }
 
-func (f *fakeExiftoolSession) Run([]string) (string, error) {
-	return "", nil
+func TestRunWithOptions_ReportsPairStrategies(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				"a.jpg":            "a.jpg.json",
+				"b.jpg":            "renamed.json",
+				"c-bearbeitet.jpg": "c.jpg.json",
+			},
+			PairSources: map[string]files.MatchStrategy{
+				"a.jpg":            files.MatchFilename,
+				"b.jpg":            files.MatchTitle,
+				"c-bearbeitet.jpg": files.MatchFilename,
+			},
+			LocalizedEdits: map[string]string{"c-bearbeitet.jpg": "de"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	want := []PairMatch{
+		{Media: "a.jpg", JSON: "a.jpg.json", Strategy: files.MatchFilename},
+		{Media: "b.jpg", JSON: "renamed.json", Strategy: files.MatchTitle},
+		{Media: "c-bearbeitet.jpg", JSON: "c.jpg.json", Strategy: files.MatchFilename},
+	}
+	if !slices.Equal(report.Matches, want) {
+		t.Fatalf("matches mismatch: want %v, got %v", want, report.Matches)
+	}
+	if report.Summary.MatchedByTitle != 1 {
+		t.Fatalf("MatchedByTitle: want 1, got %d", report.Summary.MatchedByTitle)
+	}
+	if report.Summary.LocalizedEdits != 1 {
+		t.Fatalf("LocalizedEdits: want 1, got %d", report.Summary.LocalizedEdits)
+	}
 }
 
-func (f *fakeExiftoolSession) Close() error {
-	f.closeCalls++
-	return nil
+func TestRunWithOptions_OutputDirLeavesInputUntouched(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	output := t.TempDir()
+	for name, content := range map[string]string{
+		"album/a.jpg":      "photo",
+		"album/a.jpg.json": "{}",
+		"album/b.jpg":      "lonely",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{filepath.Join("album", "a.jpg"): filepath.Join("album", "a.jpg.json")},
+			MissingJSON: []string{filepath.Join("album", "b.jpg")},
+		}, nil
+	}
+	var fixed, applied []string
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		fixed = append(fixed, mediaPath)
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, jsonPath string, _ metadata.Options) (metadata.ApplyResult, error) {
+		applied = append(applied, mediaPath+"<-"+jsonPath)
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(path string) error {
+		t.Fatalf("json must not be removed in output mode: %s", path)
+		return nil
+	}
+
+	report, err := RunWithOptions(root, Options{OutputDir: output}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	outMedia := filepath.Join(output, "album", "a.jpg")
+	slices.Sort(fixed)
+	if !slices.Equal(fixed, []string{outMedia, filepath.Join(output, "album", "b.jpg")}) {
+		t.Fatalf("extension fix should target the output copies, got %v", fixed)
+	}
+	wantApplied := outMedia + "<-" + filepath.Join(root, "album", "a.jpg.json")
+	if !slices.Equal(applied, []string{wantApplied}) {
+		t.Fatalf("metadata should be written to the output copy, got %v", applied)
+	}
+	for name, want := range map[string]string{"a.jpg": "photo", "b.jpg": "lonely"} {
+		data, err := os.ReadFile(filepath.Join(output, "album", name))
+		if err != nil || string(data) != want {
+			t.Fatalf("output copy of %s: want %q, got %q (%v)", name, want, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "album", "a.jpg.json")); err != nil {
+		t.Fatalf("input json should be kept: %v", err)
+	}
+	if report.Summary.MetadataApplied != 1 || report.Summary.CopiedUnchanged != 1 || report.Summary.JSONRemoved != 0 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+}
+
+func TestRunWithOptions_DryRunReadsMediaBeforeRename(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	mediaPath := filepath.Join(root, "a.jpg")
+	renamedPath := filepath.Join(root, "a.png")
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{"a.jpg": "a.jpg.json"}}, nil
+	}
+	planMediaExtension = func(path string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: renamedPath, Renamed: true}, nil
+	}
+	var gotPath, gotSource string
+	planMediaMetadata = func(path string, _ string, opts metadata.Options) ([][]string, metadata.ApplyResult, error) {
+		gotPath, gotSource = path, opts.SourcePath
+		return [][]string{{"-Title=a", "-overwrite_original", path}}, metadata.ApplyResult{}, nil
+	}
+
+	report, err := RunWithOptions(root, Options{DryRun: true}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if gotPath != renamedPath || gotSource != mediaPath {
+		t.Fatalf("expected a plan for %s read from %s, got %s read from %s", renamedPath, mediaPath, gotPath, gotSource)
+	}
+	if len(report.Plan.Commands) != 1 || report.Plan.Commands[0].Media != renamedPath {
+		t.Fatalf("expected one command for the renamed path, got %+v", report.Plan.Commands)
+	}
+}
+
+func TestRunWithOptions_OutputDirDryRunPlansCopies(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	output := t.TempDir()
+	mediaPath := filepath.Join(root, "a.jpg")
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{"a.jpg": "a.jpg.json"}}, nil
+	}
+	planMediaExtension = func(path string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: path}, nil
+	}
+	planMediaMetadata = func(path string, _ string, _ metadata.Options) ([][]string, metadata.ApplyResult, error) {
+		return [][]string{{"-Title=a", "-overwrite_original", path}}, metadata.ApplyResult{}, nil
+	}
+	copyMediaFile = func(string, string) error {
+		t.Fatalf("dry run must not copy files")
+		return nil
+	}
+
+	report, err := RunWithOptions(root, Options{DryRun: true, OutputDir: output}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	outMedia := filepath.Join(output, "a.jpg")
+	if !slices.Equal(report.Plan.Copies, []PlannedCopy{{From: mediaPath, To: outMedia}}) {
+		t.Fatalf("unexpected planned copies: %v", report.Plan.Copies)
+	}
+	if len(report.Plan.Commands) != 1 {
+		t.Fatalf("expected one planned command, got %v", report.Plan.Commands)
+	}
+	wantArgs := []string{"-Title=a", "-overwrite_original", outMedia}
+	if got := report.Plan.Commands[0]; got.Media != outMedia || !slices.Equal(got.Args, wantArgs) {
+		t.Fatalf("unexpected planned command: %+v", got)
+	}
+	if len(report.Plan.JSONRemovals) != 0 {
+		t.Fatalf("expected no json removals, got %v", report.Plan.JSONRemovals)
+	}
+}
+
+func TestRunWithOptions_RejectsOutputInsideRoot(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		t.Fatalf("scan should not run")
+		return files.MediaScanResult{}, nil
+	}
+
+	if _, err := RunWithOptions(root, Options{OutputDir: filepath.Join(root, "out")}, nil); err == nil {
+		t.Fatalf("expected error for output inside root")
+	}
+}
+
+func TestRunWithOptions_RejectsRootInsideOutput(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	output := t.TempDir()
+	root := filepath.Join(output, "Takeout")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		t.Fatalf("scan should not run")
+		return files.MediaScanResult{}, nil
+	}
+
+	if _, err := RunWithOptions(root, Options{OutputDir: output}, nil); err == nil {
+		t.Fatalf("expected error for root inside output")
+	}
+}
+
+func TestRunWithOptions_LayoutMovesMediaAndSidecars(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	for _, name := range []string{
+		"album/a.jpg", "album/a.jpg.json",
+		"trip/a.jpg", "trip/a.jpg.json",
+		"trip/clip.avi", "trip/clip.avi.json", "trip/clip.avi.xmp",
+		"trip/lonely.jpg",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				filepath.Join("album", "a.jpg"):   filepath.Join("album", "a.jpg.json"),
+				filepath.Join("trip", "a.jpg"):    filepath.Join("trip", "a.jpg.json"),
+				filepath.Join("trip", "clip.avi"): filepath.Join("trip", "clip.avi.json"),
+			},
+			MissingJSON: []string{filepath.Join("trip", "lonely.jpg")},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	captureTime := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.Local)
+	applyMediaMetadata = func(mediaPath string, _ string, _ metadata.Options) (metadata.ApplyResult, error) {
+		if filepath.Ext(mediaPath) == ".avi" {
+			return metadata.ApplyResult{UsedXMPSidecar: true, SidecarPath: mediaPath + ".xmp"}, nil
+		}
+		return metadata.ApplyResult{CaptureTime: captureTime}, nil
+	}
+	removeJSONFile = os.Remove
+
+	report, err := RunWithOptions(root, Options{JournalPath: journalPath, Layout: "YYYY/MM"}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	for _, name := range []string{"2021/03/a.jpg", "2021/03/a-1.jpg", "undated/clip.avi", "undated/clip.avi.xmp", "trip/lonely.jpg"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatalf("expected %s after layout: %v", name, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "2021", "03", "a.jpg"))
+	if err != nil || string(data) != "album/a.jpg" {
+		t.Fatalf("collisions should be resolved in path order, got %q (%v)", data, err)
+	}
+	if report.Summary.OrganizedMedia != 3 || report.Summary.JSONRemoved != 3 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+
+	journal, err := state.LoadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("LoadJournal: %v", err)
+	}
+	entry, ok := journal.Lookup(filepath.Join("2021", "03", "a-1.jpg"))
+	if !ok || !entry.MetadataApplied || !entry.JSONRemoved {
+		t.Fatalf("moved media should keep its journal state, got %+v (found=%v)", entry, ok)
+	}
+}
+
+func TestRunWithOptions_LayoutRerunIntoOutputReusesCopies(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	output := t.TempDir()
+	for _, name := range []string{"album/a.jpg", "trip/a.jpg"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				filepath.Join("album", "a.jpg"): filepath.Join("album", "a.jpg.json"),
+				filepath.Join("trip", "a.jpg"):  filepath.Join("trip", "a.jpg.json"),
+			},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{CaptureTime: time.Date(2021, time.March, 4, 10, 0, 0, 0, time.Local)}, nil
+	}
+
+	for run := range 2 {
+		if _, err := RunWithOptions(root, Options{OutputDir: output, Layout: "YYYY"}, nil); err != nil {
+			t.Fatalf("run %d: RunWithOptions returned error: %v", run, err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(output, "2021"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"a-1.jpg", "a.jpg"}) {
+		t.Fatalf("a rerun should reuse the earlier copies, got %v", names)
+	}
+	data, err := os.ReadFile(filepath.Join(output, "2021", "a-1.jpg"))
+	if err != nil || string(data) != "trip/a.jpg" {
+		t.Fatalf("the suffixed copy should stay trip/a.jpg, got %q (%v)", data, err)
+	}
+}
+
+func TestRunWithOptions_LayoutDryRunPlansMoves(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{"a.jpg": "a.jpg.json"}}, nil
+	}
+	planMediaExtension = func(path string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: path}, nil
+	}
+	planMediaMetadata = func(string, string, metadata.Options) ([][]string, metadata.ApplyResult, error) {
+		return nil, metadata.ApplyResult{CaptureTime: time.Date(2020, time.December, 31, 23, 0, 0, 0, time.Local)}, nil
+	}
+	moveFile = func(string, string) error {
+		t.Fatalf("dry run must not move files")
+		return nil
+	}
+
+	report, err := RunWithOptions(root, Options{DryRun: true, Layout: "YYYY/YYYY-MM-DD"}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	want := []PlannedMove{{From: filepath.Join(root, "a.jpg"), To: filepath.Join(root, "2020", "2020-12-31", "a.jpg")}}
+	if !slices.Equal(report.Plan.Moves, want) {
+		t.Fatalf("unexpected planned moves: %v", report.Plan.Moves)
+	}
+	if report.Summary.OrganizedMedia != 1 {
+		t.Fatalf("expected one organized media, got %d", report.Summary.OrganizedMedia)
+	}
+}
+
+func TestRunWithOptions_DedupHardlinksIdenticalMedia(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Photos from 2021/a.jpg": "same",
+		"Album/a.jpg":            "same",
+		"Album/b.jpg":            "other",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{}, nil
+	}
+
+	report, err := RunWithOptions(root, Options{Dedup: DedupHardlink}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	canonical := filepath.Join(root, "Photos from 2021", "a.jpg")
+	duplicate := filepath.Join(root, "Album", "a.jpg")
+	if len(report.Duplicates) != 1 || report.Duplicates[0].Canonical != canonical ||
+		!slices.Equal(report.Duplicates[0].Duplicates, []string{duplicate}) || report.Duplicates[0].Size != 4 {
+		t.Fatalf("unexpected duplicate groups: %+v", report.Duplicates)
+	}
+	if report.Summary.DuplicateFiles != 1 || report.Summary.DedupBytesSaved != 4 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	canonicalInfo, err := os.Stat(canonical)
+	if err != nil {
+		t.Fatalf("stat canonical: %v", err)
+	}
+	duplicateInfo, err := os.Stat(duplicate)
+	if err != nil {
+		t.Fatalf("stat duplicate: %v", err)
+	}
+	if !os.SameFile(canonicalInfo, duplicateInfo) {
+		t.Fatalf("duplicate should be a hardlink to the canonical copy")
+	}
+
+	again, err := RunWithOptions(root, Options{Dedup: DedupHardlink}, nil)
+	if err != nil {
+		t.Fatalf("second RunWithOptions returned error: %v", err)
+	}
+	if again.Summary.DuplicateFiles != 0 || len(again.Duplicates) != 0 {
+		t.Fatalf("already linked copies should be left alone, got %+v", again.Duplicates)
+	}
+}
+
+func TestRunWithOptions_DedupAfterLayoutKeepsYearFolderCopy(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	for _, name := range []string{"Album/a.jpg", "Photos from 2021/b.jpg"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("same"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				filepath.Join("Album", "a.jpg"):            "a.json",
+				filepath.Join("Photos from 2021", "b.jpg"): "b.json",
+			},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{CaptureTime: time.Date(2021, time.March, 4, 10, 0, 0, 0, time.Local)}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(root, Options{Layout: "YYYY", Dedup: DedupRemove}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	canonical := filepath.Join(root, "2021", "b.jpg")
+	duplicate := filepath.Join(root, "2021", "a.jpg")
+	if len(report.Duplicates) != 1 || report.Duplicates[0].Canonical != canonical ||
+		!slices.Equal(report.Duplicates[0].Duplicates, []string{duplicate}) {
+		t.Fatalf("expected the copy from the year folder to be kept, got %+v", report.Duplicates)
+	}
+}
+
+func TestRunWithOptions_DedupInOutputLeavesInputAndBackupsAlone(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	output := t.TempDir()
+	for _, name := range []string{"a/clip.avi", "b/clip.avi", ".takeoutfix/backup/a/clip.avi"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{filepath.Join("a", "clip.avi"): "a.json"}}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+
+	report, err := RunWithOptions(root, Options{OutputDir: output, Dedup: DedupRemove}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if len(report.Duplicates) != 0 {
+		t.Fatalf("the input and its backups are not duplicates of the copy, got %+v", report.Duplicates)
+	}
+	for _, name := range []string{"a/clip.avi", "b/clip.avi", ".takeoutfix/backup/a/clip.avi"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatalf("expected %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestRunWithOptions_DedupRemoveDeletesDuplicateAndSidecar(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a/clip.avi":     "video",
+		"b/clip.avi":     "video",
+		"b/clip.avi.xmp": "sidecar",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{}, nil
+	}
+
+	dryReport, err := RunWithOptions(root, Options{DryRun: true, Dedup: DedupRemove}, nil)
+	if err != nil {
+		t.Fatalf("dry run returned error: %v", err)
+	}
+	if dryReport.Summary.DuplicateFiles != 1 {
+		t.Fatalf("dry run should list the duplicate, got %+v", dryReport.Summary)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b", "clip.avi")); err != nil {
+		t.Fatalf("dry run must not remove files: %v", err)
+	}
+
+	report, err := RunWithOptions(root, Options{Dedup: DedupRemove}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.DuplicateFiles != 1 || report.Summary.DedupBytesSaved != 5 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	for _, name := range []string{"clip.avi", "clip.avi.xmp"} {
+		if _, err := os.Stat(filepath.Join(root, "b", name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "clip.avi")); err != nil {
+		t.Fatalf("canonical copy should be kept: %v", err)
+	}
+}
+
+func TestRunWithOptions_PassesAlbumMembershipToMetadata(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+			MediaAlbums: map[string][]string{"a.jpg": {"Trip"}},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var mu sync.Mutex
+	got := make(map[string]metadata.Options)
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[filepath.Base(mediaPath)] = opts
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{AlbumTag: metadata.AlbumTagKeywords}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if opts := got["a.jpg"]; !slices.Equal(opts.Albums, []string{"Trip"}) || opts.AlbumTag != metadata.AlbumTagKeywords {
+		t.Fatalf("unexpected metadata options for a.jpg: %+v", opts)
+	}
+	if opts := got["b.jpg"]; len(opts.Albums) != 0 {
+		t.Fatalf("b.jpg is in no album, got %+v", opts)
+	}
+	if report.Summary.AlbumMedia != 1 {
+		t.Fatalf("expected one media with albums, got %d", report.Summary.AlbumMedia)
+	}
+
+	report, err = RunWithOptions(t.TempDir(), Options{AlbumTag: metadata.AlbumTagNone}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if len(got["a.jpg"].Albums) != 0 || report.Summary.AlbumMedia != 0 {
+		t.Fatalf("album tag none should skip albums, got %+v", got["a.jpg"])
+	}
+}
+
+func TestRunWithOptions_ResumeKeepsAlbumMembership(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	previous, err := state.OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal returned error: %v", err)
+	}
+	if err := previous.Record(state.JournalEvent{Media: "done.jpg", Step: state.StepMetadataApplied}); err != nil {
+		t.Fatalf("Record returned error: %v", err)
+	}
+	if err := previous.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	trip := filepath.Join("Trip", "a.jpg")
+	if err := os.MkdirAll(filepath.Join(root, "Trip"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, trip+".json"), []byte(`{"title":"a.jpg"}`), 0o600); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{trip: trip + ".json"},
+			Albums:      map[string]files.Album{"Trip": {Title: "Trip"}},
+			MediaAlbums: map[string][]string{trip: {"Trip"}},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var args []string
+	applyMediaMetadata = func(mediaPath string, jsonPath string, opts metadata.Options) (metadata.ApplyResult, error) {
+		commands, result, err := metadata.PlanWithRunner(mediaPath, jsonPath, opts, func([]string) (string, error) { return "", nil })
+		for _, command := range commands {
+			args = append(args, command...)
+		}
+		return result, err
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(root, Options{JournalPath: journalPath, AlbumTag: metadata.AlbumTagKeywords}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if !slices.Contains(args, "-Keywords+=Trip") || report.Summary.AlbumMedia != 1 {
+		t.Fatalf("resumed run should keep the album keyword, got %v (%+v)", args, report.Summary)
+	}
+}
+
+func TestResumeFromJournal_KeepsLivePhotosAndInvalidOverrides(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := state.OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal returned error: %v", err)
+	}
+	defer closeJournal(journal)
+	if err := journal.Record(state.JournalEvent{Media: "done.jpg", Step: state.StepMetadataApplied}); err != nil {
+		t.Fatalf("Record returned error: %v", err)
+	}
+
+	scan := files.MediaScanResult{
+		Pairs:            map[string]string{"IMG_1.HEIC": "IMG_1.HEIC.json", "IMG_1.MP4": "IMG_1.HEIC.json"},
+		LivePhotos:       map[string]string{"IMG_1.MP4": "IMG_1.HEIC"},
+		InvalidOverrides: []string{"gone.jpg"},
+	}
+	out, _ := resumeFromJournal(journal, scan)
+	if out.LivePhotos["IMG_1.MP4"] != "IMG_1.HEIC" {
+		t.Fatalf("resumed scan lost the Live Photo link: %v", out.LivePhotos)
+	}
+	if !slices.Equal(out.InvalidOverrides, []string{"gone.jpg"}) {
+		t.Fatalf("resumed scan lost the invalid overrides: %v", out.InvalidOverrides)
+	}
+	jobs := buildJobs(slices.Sorted(maps.Keys(out.Pairs)), out, nil, metadata.Options{})
+	if len(jobs) != 1 || len(jobs[0].parts) != 2 || jobs[0].parts[1].mediaFile != "IMG_1.MP4" {
+		t.Fatalf("expected the still and video in one job, got %+v", jobs)
+	}
+}
+
+func TestRunWithOptions_CountsPeopleTaggedAndPassesHierarchy(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var mu sync.Mutex
+	var hierarchies []string
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hierarchies = append(hierarchies, opts.PeopleHierarchy)
+		return metadata.ApplyResult{PeopleTagged: filepath.Base(mediaPath) == "a.jpg"}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{PeopleHierarchy: "Faces"}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.PeopleTagged != 1 {
+		t.Fatalf("expected one file with people tags, got %d", report.Summary.PeopleTagged)
+	}
+	if !slices.Equal(hierarchies, []string{"Faces", "Faces"}) {
+		t.Fatalf("people hierarchy not passed through: %v", hierarchies)
+	}
+
+	if _, err := RunWithOptions(t.TempDir(), Options{PeopleHierarchy: "Faces|"}, nil); err == nil {
+		t.Fatalf("expected error for invalid people hierarchy")
+	}
+}
+
+func TestRunWithOptions_CountsFavorites(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var mu sync.Mutex
+	var got []metadata.Options
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, opts)
+		return metadata.ApplyResult{Favorite: filepath.Base(mediaPath) == "b.jpg"}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{FavoriteRating: 3, FavoriteKeyword: true}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.Favorites != 1 {
+		t.Fatalf("expected one favorite, got %d", report.Summary.Favorites)
+	}
+	for _, opts := range got {
+		if opts.FavoriteRating != 3 || !opts.FavoriteKeyword {
+			t.Fatalf("favorite options not passed through: %+v", opts)
+		}
+	}
+
+	if _, err := RunWithOptions(t.TempDir(), Options{FavoriteRating: 6}, nil); err == nil {
+		t.Fatalf("expected error for invalid favorite rating")
+	}
+}
+
+func TestRunWithOptions_CountsLocalZoneFallbacks(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:       map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+			MissingJSON: []string{"c.jpg"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, _ string, _ metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{LocalZoneFallback: filepath.Base(mediaPath) == "b.jpg"}, nil
+	}
+	applyUnpairedMetadata = func(string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{LocalZoneFallback: true}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	root := t.TempDir()
+	report, err := RunWithOptions(root, Options{Timezone: metadata.TimezoneGPS}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.LocalZoneFallbacks != 2 {
+		t.Fatalf("expected two local zone fallbacks, got %d", report.Summary.LocalZoneFallbacks)
+	}
+	want := []string{filepath.Join(root, "b.jpg"), filepath.Join(root, "c.jpg")}
+	got := slices.Sorted(slices.Values(report.ProblemSamples["local timezone fallbacks"]))
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected fallback samples %v, got %v", want, got)
+	}
+}
+
+func TestRunWithOptions_PassesTimezonePolicy(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{"a.jpg": "a.jpg.json"}}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var got metadata.TimezonePolicy
+	applyMediaMetadata = func(_ string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		got = opts.Timezone
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	if _, err := RunWithOptions(t.TempDir(), Options{Timezone: metadata.TimezoneGPS}, nil); err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if got != metadata.TimezoneGPS {
+		t.Fatalf("timezone policy not passed through: %q", got)
+	}
+
+	if _, err := RunWithOptions(t.TempDir(), Options{Timezone: "Nowhere/City"}, nil); err == nil {
+		t.Fatalf("expected error for unknown timezone")
+	}
+}
+
+func TestRunWithOptions_ProcessesLivePhotoHalvesTogether(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{
+				"IMG_1.HEIC": "IMG_1.HEIC.json",
+				"IMG_1.MP4":  "IMG_1.HEIC.json",
+				"b.jpg":      "b.jpg.json",
+			},
+			LivePhotos: map[string]string{"IMG_1.MP4": "IMG_1.HEIC"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		if filepath.Base(mediaPath) != "b.jpg" {
+			t.Fatalf("Live Photo half %s fixed on its own", mediaPath)
+		}
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var pairCalls int
+	fixLivePhoto = func(stillPath string, videoPath string) (extensions.FixResult, extensions.FixResult, error) {
+		pairCalls++
+		if filepath.Base(stillPath) != "IMG_1.HEIC" || filepath.Base(videoPath) != "IMG_1.MP4" {
+			t.Fatalf("unexpected pair: %s, %s", stillPath, videoPath)
+		}
+		return extensions.FixResult{Path: stillPath}, extensions.FixResult{Path: videoPath}, nil
+	}
+	var mu sync.Mutex
+	got := make(map[string]metadata.Options)
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[filepath.Base(mediaPath)] = opts
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if pairCalls != 1 {
+		t.Fatalf("expected one pair fix, got %d", pairCalls)
+	}
+	still, video := got["IMG_1.HEIC"].ContentIdentifier, got["IMG_1.MP4"].ContentIdentifier
+	if still == "" || still != video {
+		t.Fatalf("expected shared ContentIdentifier, got %q and %q", still, video)
+	}
+	if got["b.jpg"].ContentIdentifier != "" {
+		t.Fatalf("b.jpg is no Live Photo, got %q", got["b.jpg"].ContentIdentifier)
+	}
+	if report.Summary.LivePhotos != 1 || report.Summary.MetadataApplied != 3 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+}
+
+func TestLayoutKeepsLivePhotoHalvesTogether(t *testing.T) {
+	root := t.TempDir()
+	taken := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, name := range []string{"IMG_1.HEIC", "IMG_1.MP4", "2021/IMG_1.MP4"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	var report Report
+	items := []layoutItem{
+		{path: filepath.Join(root, "IMG_1.HEIC"), captureTime: taken, group: "IMG_1.HEIC"},
+		{path: filepath.Join(root, "IMG_1.MP4"), group: "IMG_1.HEIC"},
+	}
+	applyLayout(&report, root, "YYYY", items, false)
+
+	for _, name := range []string{"2021/IMG_1-1.HEIC", "2021/IMG_1-1.MP4"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+	if report.Summary.OrganizedMedia != 2 {
+		t.Fatalf("expected 2 organized media, got %d", report.Summary.OrganizedMedia)
+	}
+}
+
+func TestParseDedupMode(t *testing.T) {
+	for _, name := range []string{"", "hardlink", "remove"} {
+		if _, err := ParseDedupMode(name); err != nil {
+			t.Fatalf("ParseDedupMode(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := ParseDedupMode("symlink"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	for _, layout := range []string{"YYYY", "YYYY/MM", "YYYY/YYYY-MM-DD", "Photos/YYYY"} {
+		if err := ValidateLayout(layout); err != nil {
+			t.Fatalf("ValidateLayout(%q) returned error: %v", layout, err)
+		}
+	}
+	for _, layout := range []string{"", "photos", "/YYYY", "YYYY//MM", "../YYYY", `YYYY\MM`, "C:/YYYY"} {
+		if err := ValidateLayout(layout); err == nil {
+			t.Fatalf("ValidateLayout(%q) should fail", layout)
+		}
+	}
+}
+
+func TestRunFixWithFallback_ClosesBrokenSessionAndFallsBack(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	fakeSession := &fakeExiftoolSession{}
+	session := exiftoolSession(fakeSession)
+
+	fixMediaExtensionWithRunner = func(string, func([]string) (string, error)) (extensions.FixResult, error) {
+		return extensions.FixResult{}, errors.New("session path failed")
+	}
+
+	oneshotCalls := 0
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		oneshotCalls++
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+
+	result, err := runFixWithFallback("/tmp/a.jpg", &session)
+	if err != nil {
+		t.Fatalf("runFixWithFallback returned error: %v", err)
+	}
+	if result.Path != "/tmp/a.jpg" {
+		t.Fatalf("unexpected result path: %s", result.Path)
+	}
+	if oneshotCalls != 1 {
+		t.Fatalf("expected one fallback oneshot call, got %d", oneshotCalls)
+	}
+	if session != nil {
+		t.Fatalf("expected session to be reset after runner failure")
+	}
+	if fakeSession.closeCalls != 1 {
+		t.Fatalf("expected session close once, got %d", fakeSession.closeCalls)
+	}
+}
+
+func TestRunMetadataWithFallback_ClosesBrokenSessionAndFallsBack(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	fakeSession := &fakeExiftoolSession{}
+	session := exiftoolSession(fakeSession)
+
+	applyMediaMetadataWithRunner = func(string, string, metadata.Options, func([]string) (string, error)) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, errors.New("session path failed")
+	}
+
+	oneshotCalls := 0
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		oneshotCalls++
+		return metadata.ApplyResult{UsedXMPSidecar: true}, nil
+	}
+
+	result, err := runMetadataWithFallback("/tmp/a.jpg", "/tmp/a.json", metadata.Options{}, &session)
+	if err != nil {
+		t.Fatalf("runMetadataWithFallback returned error: %v", err)
+	}
+	if !result.UsedXMPSidecar {
+		t.Fatalf("expected fallback oneshot result")
+	}
+	if oneshotCalls != 1 {
+		t.Fatalf("expected one fallback oneshot call, got %d", oneshotCalls)
+	}
+	if session != nil {
+		t.Fatalf("expected session to be reset after runner failure")
+	}
+	if fakeSession.closeCalls != 1 {
+		t.Fatalf("expected session close once, got %d", fakeSession.closeCalls)
+	}
+}
+
+func stubProcessorDeps() func() {
+	origScanTakeout := scanTakeout
+	origFixMediaExtension := fixMediaExtension
+	origFixMediaExtensionWithRunner := fixMediaExtensionWithRunner
+	origApplyMediaMetadata := applyMediaMetadata
+	origApplyMediaMetadataWithRunner := applyMediaMetadataWithRunner
+	origPlanMediaExtension := planMediaExtension
+	origPlanMediaExtensionWithRunner := planMediaExtensionWithRunner
+	origPlanMediaMetadata := planMediaMetadata
+	origPlanMediaMetadataWithRunner := planMediaMetadataWithRunner
+	origOpenExiftoolSession := openExiftoolSession
+	origRemoveJSONFile := removeJSONFile
+	origCopyMediaFile := copyMediaFile
+	origOpenJournal := openJournal
+	origLoadJournal := loadJournal
+	origMoveFile := moveFile
+	origFixLivePhoto := fixLivePhoto
+	origFixLivePhotoWithRunner := fixLivePhotoWithRunner
+	origPlanLivePhoto := planLivePhoto
+	origPlanLivePhotoWithRunner := planLivePhotoWithRunner
+	origApplyUnpairedMetadata := applyUnpairedMetadata
+	origApplyUnpairedMetadataWithRunner := applyUnpairedMetadataWithRunner
+	origPlanUnpairedMetadata := planUnpairedMetadata
+	origPlanUnpairedMetadataWithRunner := planUnpairedMetadataWithRunner
+
+	openExiftoolSession = func() (exiftoolSession, error) {
+		return nil, errors.New("disabled in tests")
+	}
+	// Media without a JSON find no date unless a test says otherwise.
+	applyUnpairedMetadata = func(string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	planUnpairedMetadata = func(string, metadata.Options) ([][]string, metadata.ApplyResult, error) {
+		return nil, metadata.ApplyResult{}, nil
+	}
+
+	return func() {
+		scanTakeout = origScanTakeout
+		fixMediaExtension = origFixMediaExtension
+		fixMediaExtensionWithRunner = origFixMediaExtensionWithRunner
+		applyMediaMetadata = origApplyMediaMetadata
+		applyMediaMetadataWithRunner = origApplyMediaMetadataWithRunner
+		planMediaExtension = origPlanMediaExtension
+		planMediaExtensionWithRunner = origPlanMediaExtensionWithRunner
+		planMediaMetadata = origPlanMediaMetadata
+		planMediaMetadataWithRunner = origPlanMediaMetadataWithRunner
+		openExiftoolSession = origOpenExiftoolSession
+		removeJSONFile = origRemoveJSONFile
+		copyMediaFile = origCopyMediaFile
+		openJournal = origOpenJournal
+		loadJournal = origLoadJournal
+		moveFile = origMoveFile
+		fixLivePhoto = origFixLivePhoto
+		fixLivePhotoWithRunner = origFixLivePhotoWithRunner
+		planLivePhoto = origPlanLivePhoto
+		planLivePhotoWithRunner = origPlanLivePhotoWithRunner
+		applyUnpairedMetadata = origApplyUnpairedMetadata
+		applyUnpairedMetadataWithRunner = origApplyUnpairedMetadataWithRunner
+		planUnpairedMetadata = origPlanUnpairedMetadata
+		planUnpairedMetadataWithRunner = origPlanUnpairedMetadataWithRunner
+	}
+}
+
+type fakeExiftoolSession struct {
+	closeCalls int
+}
+
+func (f *fakeExiftoolSession) Run([]string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeExiftoolSession) Close() error {
+	f.closeCalls++
+	return nil
+}
+
+func TestRunWithOptions_ReportsSidecarIssues(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, _ string, _ metadata.Options) (metadata.ApplyResult, error) {
+		if filepath.Base(mediaPath) == "b.jpg" {
+			return metadata.ApplyResult{}, fmt.Errorf("could not read JSON for %s: %w: not an object", mediaPath, sidecar.ErrInvalidJSON)
+		}
+		return metadata.ApplyResult{SidecarIssues: []string{`photoTakenTime.timestamp: invalid value "soon"`}}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(root, Options{}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.SidecarIssues != 1 || report.Summary.MetadataApplied != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	wantIssue := filepath.Join(root, "a.jpg.json") + `: photoTakenTime.timestamp: invalid value "soon"`
+	if got := report.ProblemSamples["sidecar issues"]; !slices.Equal(got, []string{wantIssue}) {
+		t.Fatalf("unexpected sidecar issue samples: %v", got)
+	}
+	if got := report.ProblemSamples["invalid sidecar json"]; len(got) != 1 || !strings.Contains(got[0], "not an object") {
+		t.Fatalf("unexpected invalid JSON samples: %v", got)
+	}
+	if report.ProblemCounts["metadata errors"] != 1 {
+		t.Fatalf("expected invalid JSON to stay a metadata error, got %v", report.ProblemCounts)
+	}
+}
+
+func TestRunWithOptions_ReportsDateConflicts(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var mu sync.Mutex
+	var got []metadata.Options
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		got = append(got, opts)
+		mu.Unlock()
+		if filepath.Base(mediaPath) == "a.jpg" {
+			return metadata.ApplyResult{DateConflicts: []string{"photoTakenTime 2031-01-01 00:00:00+00:00 rejected: in the future"}}, nil
+		}
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(root, Options{DatePrecedence: "exif,taken", DateChecks: "future"}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.DateConflicts != 1 {
+		t.Fatalf("expected one file with date conflicts, got %d", report.Summary.DateConflicts)
+	}
+	want := filepath.Join(root, "a.jpg") + ": photoTakenTime 2031-01-01 00:00:00+00:00 rejected: in the future"
+	if samples := report.ProblemSamples["date conflicts"]; !slices.Equal(samples, []string{want}) {
+		t.Fatalf("unexpected date conflict samples: %v", samples)
+	}
+	for _, opts := range got {
+		if opts.DatePrecedence != "exif,taken" || opts.DateChecks != "future" {
+			t.Fatalf("date options not passed through: %+v", opts)
+		}
+	}
+
+	if _, err := RunWithOptions(t.TempDir(), Options{DatePrecedence: "gps"}, nil); err == nil {
+		t.Fatalf("expected error for unknown date source")
+	}
+	if _, err := RunWithOptions(t.TempDir(), Options{DateChecks: "soon"}, nil); err == nil {
+		t.Fatalf("expected error for unknown date check")
+	}
+}
+
+func TestRunWithOptions_CountsSkippedFields(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	var mu sync.Mutex
+	var got []metadata.WritePolicy
+	applyMediaMetadata = func(mediaPath string, _ string, opts metadata.Options) (metadata.ApplyResult, error) {
+		mu.Lock()
+		got = append(got, opts.WritePolicy)
+		mu.Unlock()
+		if filepath.Base(mediaPath) == "a.jpg" {
+			return metadata.ApplyResult{SkippedFields: []string{metadata.FieldDates, metadata.FieldGPS}}, nil
+		}
+		return metadata.ApplyResult{SkippedFields: []string{metadata.FieldGPS}}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(t.TempDir(), Options{WritePolicy: "fill-missing"}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	want := map[string]int{metadata.FieldDates: 1, metadata.FieldGPS: 2}
+	if !maps.Equal(report.SkippedFields, want) {
+		t.Fatalf("unexpected skipped fields: %v", report.SkippedFields)
+	}
+	if !slices.Equal(got, []metadata.WritePolicy{"fill-missing", "fill-missing"}) {
+		t.Fatalf("write policy not passed through: %v", got)
+	}
+
+	if _, err := RunWithOptions(t.TempDir(), Options{WritePolicy: "gps=sometimes"}, nil); err == nil {
+		t.Fatalf("expected error for unknown write mode")
+	}
+}
+
+func TestRunWithOptions_ReportsRepairedExif(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs: map[string]string{"a.jpg": "a.jpg.json", "b.jpg": "b.jpg.json"},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, _ string, _ metadata.Options) (metadata.ApplyResult, error) {
+		if filepath.Base(mediaPath) == "a.jpg" {
+			return metadata.ApplyResult{ExifRepair: metadata.ExifRepairRebuilt, LostTags: []string{"ExifIFD:ExposureTime"}}, nil
+		}
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(string) error { return nil }
+
+	report, err := RunWithOptions(root, Options{}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if report.Summary.ExifRepaired != 1 {
+		t.Fatalf("ExifRepaired: want 1, got %d", report.Summary.ExifRepaired)
+	}
+	want := RepairedExif{Media: "a.jpg", Repair: metadata.ExifRepairRebuilt, LostTags: []string{"ExifIFD:ExposureTime"}}
+	if len(report.RepairedExif) != 1 || report.RepairedExif[0].Media != want.Media ||
+		report.RepairedExif[0].Repair != want.Repair || !slices.Equal(report.RepairedExif[0].LostTags, want.LostTags) {
+		t.Fatalf("RepairedExif: want [%+v], got %+v", want, report.RepairedExif)
+	}
+}
+
+func TestRunWithOptions_ProcessesUnpairedMedia(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{
+			Pairs:         map[string]string{"a.jpg": "a.jpg.json"},
+			MissingJSON:   []string{"IMG_20190704_153012.jpg", "plain.jpg"},
+			AmbiguousJSON: map[string][]string{"scan.jpg": {"scan.jpg.json", "scan.jpg(1).json"}},
+		}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		if filepath.Base(mediaPath) == "IMG_20190704_153012.jpg" {
+			return extensions.FixResult{Path: filepath.Join(root, "IMG_20190704_153012.png"), Renamed: true}, nil
+		}
+		return extensions.FixResult{Path: mediaPath}, nil
+	}
+	applyMediaMetadata = func(string, string, metadata.Options) (metadata.ApplyResult, error) {
+		return metadata.ApplyResult{}, nil
+	}
+	var unpaired []string
+	applyUnpairedMetadata = func(mediaPath string, _ metadata.Options) (metadata.ApplyResult, error) {
+		unpaired = append(unpaired, filepath.Base(mediaPath))
+		switch filepath.Base(mediaPath) {
+		case "IMG_20190704_153012.png":
+			return metadata.ApplyResult{
+				UsedFilenameDate:  true,
+				DateSource:        metadata.DateSourceFilename,
+				FilenamePattern:   "camera",
+				FilenamePrecision: metadata.PrecisionDateTime,
+			}, nil
+		case "scan.jpg":
+			return metadata.ApplyResult{DateSource: metadata.DateSourceEmbedded}, nil
+		case "plain.jpg":
+			return metadata.ApplyResult{DateSource: metadata.DateSourceEmbedded, SkippedFields: []string{metadata.FieldDates}}, nil
+		}
+		return metadata.ApplyResult{}, nil
+	}
+	removeJSONFile = func(path string) error {
+		if filepath.Base(path) != "a.jpg.json" {
+			t.Fatalf("only the paired JSON may be removed, got %s", path)
+		}
+		return nil
+	}
+
+	report, err := RunWithOptions(root, Options{}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+
+	slices.Sort(unpaired)
+	if !slices.Equal(unpaired, []string{"IMG_20190704_153012.png", "plain.jpg", "scan.jpg"}) {
+		t.Fatalf("unexpected unpaired media: %v", unpaired)
+	}
+	summary := report.Summary
+	if summary.UnpairedRenamed != 1 || summary.UnpairedFilenameDates != 1 || summary.UnpairedDatesSynced != 1 {
+		t.Fatalf("unexpected unpaired counters: %+v", summary)
+	}
+	if summary.RenamedExtensions != 0 || summary.FilenameDateApplied != 0 || summary.MetadataApplied != 1 {
+		t.Fatalf("unpaired media must not count as paired: %+v", summary)
+	}
+	if summary.MissingJSON != 2 || summary.AmbiguousMedia != 1 {
+		t.Fatalf("unexpected missing counts: %+v", summary)
+	}
+	if report.SkippedFields[metadata.FieldDates] != 1 {
+		t.Fatalf("expected the kept date of plain.jpg to count as skipped, got %v", report.SkippedFields)
+	}
+	wantFilenameDates := []FilenameDate{{Media: "IMG_20190704_153012.png", Pattern: "camera", Precision: metadata.PrecisionDateTime}}
+	if !slices.Equal(report.FilenameDates, wantFilenameDates) {
+		t.Fatalf("FilenameDates: want %+v, got %+v", wantFilenameDates, report.FilenameDates)
+	}
+	if len(report.ProblemCounts) != 0 {
+		t.Fatalf("unexpected problems: %v", report.ProblemCounts)
+	}
+}
+
+func TestRunWithOptions_BackupAndRollback(t *testing.T) {
+	restore := stubProcessorDeps()
+	defer restore()
+
+	root := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	originals := map[string]string{
+		"a.jpg":       "a original",
+		"a.jpg.json":  "a json",
+		"b.heic":      "b original",
+		"b.heic.json": "b json",
+		"c.avi":       "c original",
+		"c.avi.json":  "c json",
+	}
+	for name, content := range originals {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	scanTakeout = func(string, files.Overrides) (files.MediaScanResult, error) {
+		return files.MediaScanResult{Pairs: map[string]string{
+			"a.jpg":  "a.jpg.json",
+			"b.heic": "b.heic.json",
+			"c.avi":  "c.avi.json",
+		}}, nil
+	}
+	fixMediaExtension = func(mediaPath string) (extensions.FixResult, error) {
+		if filepath.Ext(mediaPath) != ".heic" {
+			return extensions.FixResult{Path: mediaPath}, nil
+		}
+		fixed := strings.TrimSuffix(mediaPath, ".heic") + ".jpg"
+		if err := os.Rename(mediaPath, fixed); err != nil {
+			return extensions.FixResult{}, err
+		}
+		return extensions.FixResult{Path: fixed, Renamed: true}, nil
+	}
+	applyMediaMetadata = func(mediaPath string, _ string, _ metadata.Options) (metadata.ApplyResult, error) {
+		if filepath.Ext(mediaPath) == ".avi" {
+			sidecar := mediaPath + ".xmp"
+			return metadata.ApplyResult{UsedXMPSidecar: true, SidecarPath: sidecar}, os.WriteFile(sidecar, []byte("xmp"), 0o600)
+		}
+		return metadata.ApplyResult{}, os.WriteFile(mediaPath, []byte("tagged"), 0o600)
+	}
+	removeJSONFile = os.Remove
+
+	report, err := RunWithOptions(root, Options{JournalPath: journalPath, BackupDir: backupDir}, nil)
+	if err != nil {
+		t.Fatalf("RunWithOptions returned error: %v", err)
+	}
+	if len(report.ProblemCounts) != 0 {
+		t.Fatalf("unexpected problems: %v", report.ProblemCounts)
+	}
+	for name, content := range originals {
+		data, err := os.ReadFile(filepath.Join(backupDir, name))
+		if err != nil || string(data) != content {
+			t.Fatalf("backup of %s: want %q, got %q (%v)", name, content, data, err)
+		}
+	}
+
+	// Roll back b first: its JSON comes back with it and a stays changed.
+	rollback, err := Rollback(root, RollbackOptions{JournalPath: journalPath, BackupDir: backupDir, Files: []string{"b.jpg"}})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if !slices.Equal(rollback.Restored, []string{"b.heic", "b.heic.json"}) {
+		t.Fatalf("restored: want [b.heic b.heic.json], got %v", rollback.Restored)
+	}
+	if pathExists(filepath.Join(root, "b.jpg")) {
+		t.Fatalf("renamed b.jpg should be removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "a.jpg")); string(data) != "tagged" {
+		t.Fatalf("a.jpg should stay changed, got %q", data)
+	}
+
+	rollback, err = Rollback(root, RollbackOptions{JournalPath: journalPath, BackupDir: backupDir})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if !slices.Equal(rollback.Restored, []string{"a.jpg", "a.jpg.json", "c.avi", "c.avi.json"}) {
+		t.Fatalf("restored: want a and c with their JSON, got %v", rollback.Restored)
+	}
+	if len(rollback.NotBackedUp) != 0 || len(rollback.ProblemCounts) != 0 {
+		t.Fatalf("unexpected rollback report: %+v", rollback)
+	}
+	for name, content := range originals {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || string(data) != content {
+			t.Fatalf("%s after rollback: want %q, got %q (%v)", name, content, data, err)
+		}
+	}
+	if pathExists(filepath.Join(root, "c.avi.xmp")) {
+		t.Fatalf("sidecar written by the run should be removed")
+	}
+
+	journal, err := state.LoadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("LoadJournal: %v", err)
+	}
+	if entries := journal.Entries(); len(entries) != 0 {
+		t.Fatalf("rolled back files should leave the journal, got %v", entries)
+	}
+}
+
+func TestRollback_ReportsFilesWithoutBackup(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := state.OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	for _, event := range []state.JournalEvent{
+		{Media: "a.jpg", Step: state.StepPaired, JSON: "a.jpg.json"},
+		{Media: "a.jpg", Step: state.StepMetadataApplied},
+	} {
+		if err := journal.Record(event); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	report, err := Rollback(t.TempDir(), RollbackOptions{JournalPath: journalPath, BackupDir: t.TempDir(), Files: []string{"a.jpg", "missing.jpg"}})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if len(report.Restored) != 0 || !slices.Equal(report.NotBackedUp, []string{"missing.jpg", "a.jpg"}) {
+		t.Fatalf("unexpected rollback report: %+v", report)
+	}
+}
+
+func TestRunWithOptions_BackupNeedsJournal(t *testing.T) {
+	if _, err := RunWithOptions(t.TempDir(), Options{BackupDir: t.TempDir()}, nil); err == nil {
+		t.Fatalf("expected an error for backups without a journal")
+	}
 }
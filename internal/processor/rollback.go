@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vchilikov/takeout-fix/internal/backup"
+	"github.com/vchilikov/takeout-fix/internal/state"
+)
+
+// RollbackOptions selects what Rollback restores.
+type RollbackOptions struct {
+	// JournalPath is the journal of the runs to roll back.
+	JournalPath string
+	// BackupDir is the store the runs saved originals to. See
+	// Options.BackupDir.
+	BackupDir string
+	// Files limits the rollback to these media, by their original or
+	// current path relative to the processed root. Their JSON and XMP
+	// sidecar are restored with them. Empty restores every backed-up file.
+	Files []string
+}
+
+// RollbackReport lists what Rollback did. Paths are relative to the
+// processed root.
+type RollbackReport struct {
+	// Restored are the original paths of the files put back.
+	Restored []string
+	// NotBackedUp are changed files without a copy in the store, and
+	// requested files the journal does not know.
+	NotBackedUp    []string
+	ProblemCounts  map[string]int
+	ProblemSamples map[string][]string
+}
+
+func (r *RollbackReport) addProblem(category string, value string) {
+	r.ProblemCounts[category]++
+	if len(r.ProblemSamples[category]) < maxProblemSamples {
+		r.ProblemSamples[category] = append(r.ProblemSamples[category], value)
+	}
+}
+
+// Rollback restores files under rootPath from the backup store. Renamed or
+// moved media are put back at their original path, XMP sidecars the run
+// created are removed and removed JSON comes back. Each restored file is
+// journaled as rolled back, so the next run processes it again.
+func Rollback(rootPath string, opts RollbackOptions) (RollbackReport, error) {
+	report := RollbackReport{
+		ProblemCounts:  make(map[string]int),
+		ProblemSamples: make(map[string][]string),
+	}
+	if opts.JournalPath == "" || opts.BackupDir == "" {
+		return report, errors.New("rollback needs a journal path and a backup directory")
+	}
+	journal, err := openJournal(opts.JournalPath)
+	if err != nil {
+		return report, fmt.Errorf("open journal: %w", err)
+	}
+	defer closeJournal(journal)
+
+	store := backup.NewStore(opts.BackupDir)
+	entries := journal.Entries()
+	keys, unknown := selectRollback(entries, opts.Files)
+	report.NotBackedUp = unknown
+	for _, key := range keys {
+		entry := entries[key]
+		if !entry.BackedUp {
+			report.NotBackedUp = append(report.NotBackedUp, key)
+			continue
+		}
+		if err := rollbackFile(rootPath, store, entries, key, entry); err != nil {
+			report.addProblem("rollback errors", err.Error())
+			continue
+		}
+		if err := recordJournal(journal, state.JournalEvent{Media: entry.Path, Step: state.StepRolledBack}); err != nil {
+			report.addProblem("journal errors", key)
+		}
+		report.Restored = append(report.Restored, key)
+	}
+	return report, nil
+}
+
+// selectRollback returns the journal keys to roll back in path order, so a
+// media comes before its XMP sidecar. Without files, that is every file the
+// runs backed up or changed. Requested files the journal does not know are
+// returned separately.
+func selectRollback(entries map[string]state.MediaState, files []string) ([]string, []string) {
+	selected := make(map[string]struct{})
+	if len(files) == 0 {
+		for key, entry := range entries {
+			if entry.BackedUp || entry.ExtensionFixed || entry.MetadataApplied || entry.JSONRemoved {
+				selected[key] = struct{}{}
+			}
+		}
+		return slices.Sorted(maps.Keys(selected)), nil
+	}
+
+	byPath := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		byPath[key] = key
+		byPath[entry.Path] = key
+	}
+	var unknown []string
+	for _, file := range files {
+		key, ok := byPath[filepath.Clean(file)]
+		if !ok {
+			unknown = append(unknown, file)
+			continue
+		}
+		selected[key] = struct{}{}
+		for _, related := range []string{entries[key].JSON, key + ".xmp"} {
+			if entry, ok := entries[related]; ok && entry.BackedUp {
+				selected[related] = struct{}{}
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(selected)), unknown
+}
+
+// rollbackFile puts the copy of key back at its original path. The file at
+// the current path, if the media was renamed or moved, and an XMP sidecar
+// the run wrote are removed first.
+func rollbackFile(rootPath string, store *backup.Store, entries map[string]state.MediaState, key string, entry state.MediaState) error {
+	var stale []string
+	if entry.Path != key {
+		stale = append(stale, entry.Path)
+	}
+	if entry.Sidecar && (entry.Path != key || !entries[key+".xmp"].BackedUp) {
+		stale = append(stale, entry.Path+".xmp")
+	}
+	for _, rel := range stale {
+		if err := os.Remove(filepath.Join(rootPath, rel)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", rel, err)
+		}
+	}
+	return store.Restore(rootPath, key)
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"github.com/vchilikov/takeout-fix/utils/metadata"
+)
+
+var (
+	applyUnpairedMetadata           = metadata.ApplyUnpaired
+	applyUnpairedMetadataWithRunner = metadata.ApplyUnpairedWithRunner
+	planUnpairedMetadata            = metadata.PlanUnpaired
+	planUnpairedMetadataWithRunner  = metadata.PlanUnpairedWithRunner
+)
+
+// unpairedJobs queues media without a JSON pair, including media with
+// several candidate JSON files, as single-part jobs.
+func unpairedJobs(unpaired []string, metaOpts metadata.Options) []mediaJob {
+	jobs := make([]mediaJob, 0, len(unpaired))
+	for _, mediaFile := range unpaired {
+		jobs = append(jobs, mediaJob{parts: []mediaPart{{mediaFile: mediaFile, metaOpts: metaOpts, unpaired: true}}})
+	}
+	return jobs
+}
+
+// addUnpairedResult counts the outcome of a media without a JSON whose
+// extension fix and date restore finished.
+func addUnpairedResult(report *Report, rootPath string, opts Options, res mediaResult) {
+	for _, args := range res.commands {
+		report.Plan.Commands = append(report.Plan.Commands, PlannedCommand{Media: res.fixResult.Path, Args: args})
+	}
+	for _, conflict := range res.meta.DateConflicts {
+		report.addProblem("date conflicts", res.fixResult.Path+": "+conflict)
+	}
+	if len(res.meta.DateConflicts) > 0 {
+		report.Summary.DateConflicts++
+	}
+	for _, field := range res.meta.SkippedFields {
+		report.SkippedFields[field]++
+	}
+	synced := res.meta.DateSource == metadata.DateSourceEmbedded && len(res.meta.SkippedFields) == 0
+
+	if res.meta.UsedFilenameDate {
+		report.Summary.UnpairedFilenameDates++
+		report.FilenameDates = append(report.FilenameDates, FilenameDate{
+			Media:     relToRoot(rootPath, res.fixResult.Path),
+			Pattern:   res.meta.FilenamePattern,
+			Precision: res.meta.FilenamePrecision,
+		})
+	}
+	if synced && !res.meta.MediaFileDateWarned {
+		report.Summary.UnpairedDatesSynced++
+	}
+	if res.meta.CreateDateWarned {
+		report.Summary.CreateDateWarnings++
+		report.addProblem("create date warnings", res.fixResult.Path)
+	}
+	if res.meta.FilenameDateWarned {
+		report.addProblem("filename date warnings", res.fixResult.Path)
+	}
+	addLocalZoneFallback(report, res)
+	if res.meta.MediaFileDateWarned {
+		report.addProblem("media file date warnings", res.fixResult.Path)
+	}
+
+	changed := res.fixResult.Renamed || res.meta.UsedFilenameDate || synced
+	if opts.OutputDir != "" && !changed {
+		report.Summary.CopiedUnchanged++
+	}
+}
+
+func runUnpairedWithFallback(mediaPath string, metaOpts metadata.Options, session *exiftoolSession) (metadata.ApplyResult, error) {
+	if session != nil && *session != nil {
+		result, err := applyUnpairedMetadataWithRunner(mediaPath, metaOpts, (*session).Run)
+		if err == nil {
+			return result, nil
+		}
+		closeAndResetSession(session)
+	}
+	return applyUnpairedMetadata(mediaPath, metaOpts)
+}
+
+func runPlanUnpairedWithFallback(mediaPath string, metaOpts metadata.Options, session *exiftoolSession) ([][]string, metadata.ApplyResult, error) {
+	if session != nil && *session != nil {
+		commands, result, err := planUnpairedMetadataWithRunner(mediaPath, metaOpts, (*session).Run)
+		if err == nil {
+			return commands, result, nil
+		}
+		closeAndResetSession(session)
+	}
+	return planUnpairedMetadata(mediaPath, metaOpts)
+}
@@ -0,0 +1,235 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Journal steps, recorded in the order processing reaches them.
+const (
+	StepPaired          = "paired"
+	StepExtensionFixed  = "extension_fixed"
+	StepMetadataApplied = "metadata_applied"
+	StepJSONRemoved     = "json_removed"
+	// StepMoved records a move into the output layout after processing.
+	StepMoved = "moved"
+	// StepBackedUp records that a copy of the original was saved before the
+	// first change. It is also recorded for JSON files before removal.
+	StepBackedUp = "backed_up"
+	// StepRolledBack records that the original was restored. It clears the
+	// state of the file, so the next run processes it again.
+	StepRolledBack = "rolled_back"
+)
+
+// MediaState is the journaled progress of one media file. Paths are relative
+// to the processed Takeout root.
+type MediaState struct {
+	JSON            string
+	Path            string
+	Paired          bool
+	ExtensionFixed  bool
+	MetadataApplied bool
+	JSONRemoved     bool
+	BackedUp        bool
+	// Sidecar is set when the metadata was written to an XMP sidecar next
+	// to the media.
+	Sidecar bool
+}
+
+// JournalEvent is one line of the journal file. Media is the path of the
+// media at the time of the event; Path is the new path after an extension fix
+// or a move. Sidecar marks metadata written to an XMP sidecar.
+type JournalEvent struct {
+	Media   string `json:"media"`
+	Step    string `json:"step"`
+	JSON    string `json:"json,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Sidecar bool   `json:"sidecar,omitempty"`
+}
+
+// Journal is an append-only log of per-media processing steps. It lets an
+// interrupted run resume without redoing finished media or losing pairs whose
+// JSON was already removed.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]MediaState
+	current map[string]string
+}
+
+// LoadJournal reads a journal without opening it for writing. Recorded events
+// only update the in-memory view. A missing file yields an empty journal.
+func LoadJournal(path string) (*Journal, error) {
+	j := &Journal{
+		entries: make(map[string]MediaState),
+		current: make(map[string]string),
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return j, nil
+		}
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event JournalEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A run killed mid-write can leave a partial last line.
+			continue
+		}
+		j.apply(event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+
+	return j, nil
+}
+
+// OpenJournal loads the journal at path and opens it for appending.
+func OpenJournal(path string) (*Journal, error) {
+	j, err := LoadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir journal dir: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal for append: %w", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// ResetJournal removes the journal file. Missing files are not an error.
+func ResetJournal(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove journal: %w", err)
+	}
+	return nil
+}
+
+// Record applies event and appends it to the journal file.
+func (j *Journal) Record(event JournalEvent) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.apply(event)
+	if j.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal journal event: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write journal event: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the state of the media currently stored at mediaRel.
+func (j *Journal) Lookup(mediaRel string) (MediaState, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, ok := j.current[mediaRel]
+	if !ok {
+		return MediaState{}, false
+	}
+	return j.entries[key], true
+}
+
+// Entries returns a copy of all media states keyed by original media path.
+func (j *Journal) Entries() map[string]MediaState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return maps.Clone(j.entries)
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	if err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	return nil
+}
+
+func (j *Journal) apply(event JournalEvent) {
+	if event.Media == "" || !isJournalStep(event.Step) {
+		return
+	}
+
+	key, ok := j.current[event.Media]
+	if event.Step == StepRolledBack {
+		if ok {
+			delete(j.current, event.Media)
+			delete(j.entries, key)
+		}
+		return
+	}
+	if !ok {
+		key = event.Media
+		j.current[key] = key
+	}
+	entry := j.entries[key]
+	if entry.Path == "" {
+		entry.Path = key
+	}
+
+	switch event.Step {
+	case StepPaired:
+		entry.Paired = true
+		entry.JSON = event.JSON
+	case StepExtensionFixed, StepMoved:
+		if event.Step == StepExtensionFixed {
+			entry.ExtensionFixed = true
+		}
+		if event.Path != "" && event.Path != entry.Path {
+			delete(j.current, entry.Path)
+			entry.Path = event.Path
+			j.current[entry.Path] = key
+		}
+	case StepMetadataApplied:
+		entry.MetadataApplied = true
+		entry.Sidecar = event.Sidecar
+	case StepBackedUp:
+		entry.BackedUp = true
+	case StepJSONRemoved:
+		entry.JSONRemoved = true
+	}
+	j.entries[key] = entry
+}
+
+func isJournalStep(step string) bool {
+	switch step {
+	case StepPaired, StepExtensionFixed, StepMetadataApplied, StepJSONRemoved, StepMoved, StepBackedUp, StepRolledBack:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,159 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalRecordAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".takeoutfix", "journal.jsonl")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal error: %v", err)
+	}
+	events := []JournalEvent{
+		{Media: "a.jpg", Step: StepPaired, JSON: "a.jpg.json"},
+		{Media: "a.jpg", Step: StepExtensionFixed, Path: "a.png"},
+		{Media: "a.png", Step: StepMetadataApplied},
+		{Media: "b.jpg", Step: StepPaired, JSON: "b.jpg.json"},
+	}
+	for _, event := range events {
+		if err := j.Record(event); err != nil {
+			t.Fatalf("Record error: %v", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	reloaded, err := LoadJournal(path)
+	if err != nil {
+		t.Fatalf("LoadJournal error: %v", err)
+	}
+
+	got, ok := reloaded.Lookup("a.png")
+	if !ok {
+		t.Fatalf("expected renamed media to be found by its current path")
+	}
+	want := MediaState{JSON: "a.jpg.json", Path: "a.png", Paired: true, ExtensionFixed: true, MetadataApplied: true}
+	if got != want {
+		t.Fatalf("state mismatch: want %+v, got %+v", want, got)
+	}
+	if _, ok := reloaded.Lookup("a.jpg"); ok {
+		t.Fatalf("did not expect lookup by pre-rename path")
+	}
+
+	b, ok := reloaded.Lookup("b.jpg")
+	if !ok || !b.Paired || b.MetadataApplied {
+		t.Fatalf("unexpected state for b.jpg: %+v (found=%v)", b, ok)
+	}
+	if len(reloaded.Entries()) != 2 {
+		t.Fatalf("expected 2 entries, got %v", reloaded.Entries())
+	}
+}
+
+func TestJournalMovedKeepsState(t *testing.T) {
+	j, err := LoadJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJournal error: %v", err)
+	}
+	for _, event := range []JournalEvent{
+		{Media: "album/a.jpg", Step: StepPaired, JSON: "album/a.jpg.json"},
+		{Media: "album/a.jpg", Step: StepMetadataApplied},
+		{Media: "album/a.jpg", Step: StepMoved, Path: "2021/03/a.jpg"},
+	} {
+		if err := j.Record(event); err != nil {
+			t.Fatalf("Record error: %v", err)
+		}
+	}
+
+	got, ok := j.Lookup("2021/03/a.jpg")
+	want := MediaState{JSON: "album/a.jpg.json", Path: "2021/03/a.jpg", Paired: true, MetadataApplied: true}
+	if !ok || got != want {
+		t.Fatalf("state mismatch: want %+v, got %+v (found=%v)", want, got, ok)
+	}
+	if _, ok := j.Lookup("album/a.jpg"); ok {
+		t.Fatalf("did not expect lookup by pre-move path")
+	}
+}
+
+func TestJournalRolledBackClearsState(t *testing.T) {
+	j, err := LoadJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJournal error: %v", err)
+	}
+	for _, event := range []JournalEvent{
+		{Media: "clip.avi", Step: StepPaired, JSON: "clip.avi.json"},
+		{Media: "clip.avi", Step: StepBackedUp},
+		{Media: "clip.avi", Step: StepMetadataApplied, Sidecar: true},
+		{Media: "clip.avi", Step: StepMoved, Path: "2021/03/clip.avi"},
+	} {
+		if err := j.Record(event); err != nil {
+			t.Fatalf("Record error: %v", err)
+		}
+	}
+
+	got, ok := j.Lookup("2021/03/clip.avi")
+	want := MediaState{JSON: "clip.avi.json", Path: "2021/03/clip.avi", Paired: true, MetadataApplied: true, BackedUp: true, Sidecar: true}
+	if !ok || got != want {
+		t.Fatalf("state mismatch: want %+v, got %+v (found=%v)", want, got, ok)
+	}
+
+	if err := j.Record(JournalEvent{Media: "2021/03/clip.avi", Step: StepRolledBack}); err != nil {
+		t.Fatalf("Record error: %v", err)
+	}
+	if _, ok := j.Lookup("2021/03/clip.avi"); ok {
+		t.Fatalf("did not expect state after rollback")
+	}
+	if len(j.Entries()) != 0 {
+		t.Fatalf("expected no entries after rollback, got %v", j.Entries())
+	}
+}
+
+func TestLoadJournalSkipsPartialLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	data := `{"media":"a.jpg","step":"paired","json":"a.json"}` + "\n" + `{"media":"a.jpg","st`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+
+	j, err := LoadJournal(path)
+	if err != nil {
+		t.Fatalf("LoadJournal error: %v", err)
+	}
+	got, ok := j.Lookup("a.jpg")
+	if !ok || !got.Paired || got.JSON != "a.json" {
+		t.Fatalf("unexpected state: %+v (found=%v)", got, ok)
+	}
+}
+
+func TestLoadJournalMissingReturnsEmpty(t *testing.T) {
+	j, err := LoadJournal(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJournal error: %v", err)
+	}
+	if len(j.Entries()) != 0 {
+		t.Fatalf("expected empty journal")
+	}
+	if err := j.Record(JournalEvent{Media: "a.jpg", Step: StepPaired}); err != nil {
+		t.Fatalf("read-only journal should accept in-memory records: %v", err)
+	}
+}
+
+func TestResetJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o600); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+	if err := ResetJournal(path); err != nil {
+		t.Fatalf("ResetJournal error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected journal to be removed, stat err: %v", err)
+	}
+	if err := ResetJournal(path); err != nil {
+		t.Fatalf("ResetJournal on missing file should succeed: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+//go:build ignore
+
+// mkzones converts the timezone-boundary-builder polygons, as published
+// simplified in the tzf-rel-lite module, into zones.bin.
+//
+// Usage:
+//
+//	export TZF_REL_LITE=$(go mod download -json github.com/ringsaturn/tzf-rel-lite@v0.0.2025-b2 | jq -r .Dir)
+//	go generate ./internal/tzlookup
+//
+// The input is a protobuf tzf.v1.Timezones message. The output layout is
+// described in zones.go.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+)
+
+type point struct{ lon, lat float64 }
+
+type polygon struct {
+	rings [][]point // exterior ring first, then holes
+}
+
+type timezone struct {
+	name     string
+	polygons []polygon
+}
+
+func main() {
+	in := flag.String("in", "", "tzf Timezones protobuf")
+	out := flag.String("out", "zones.bin", "output file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zones, version, err := parseTimezones(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].name < zones[j].name })
+
+	var raw bytes.Buffer
+	raw.WriteString("TZP1")
+	writeString(&raw, version)
+	writeUvarint(&raw, uint64(len(zones)))
+	points := 0
+	for _, zone := range zones {
+		writeString(&raw, zone.name)
+		writeUvarint(&raw, uint64(len(zone.polygons)))
+		for _, poly := range zone.polygons {
+			writeUvarint(&raw, uint64(len(poly.rings)))
+			for _, ring := range poly.rings {
+				points += len(ring)
+				writeUvarint(&raw, uint64(len(ring)))
+				var prevLon, prevLat int64
+				for _, p := range ring {
+					lon, lat := quantize(p.lon), quantize(p.lat)
+					writeVarint(&raw, lon-prevLon)
+					writeVarint(&raw, lat-prevLat)
+					prevLon, prevLat = lon, lat
+				}
+			}
+		}
+	}
+
+	var packed bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&packed, gzip.BestCompression)
+	zw.Write(raw.Bytes())
+	if err := zw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, packed.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: %d zones, %d points, %d bytes\n", version, len(zones), points, packed.Len())
+}
+
+// quantize stores degrees in units of 1e-5 (about a metre).
+func quantize(degrees float64) int64 {
+	return int64(math.Round(degrees * 1e5))
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	buf.Write(binary.AppendVarint(nil, v))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// parseTimezones decodes message Timezones { repeated Timezone timezones = 1;
+// bool reduced = 2; string version = 3; }.
+func parseTimezones(data []byte) ([]timezone, string, error) {
+	var zones []timezone
+	var version string
+	err := eachField(data, func(num int, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			zone, err := parseTimezone(value)
+			if err != nil {
+				return err
+			}
+			zones = append(zones, zone)
+		case 3:
+			version = string(value)
+		}
+		return nil
+	})
+	return zones, version, err
+}
+
+// parseTimezone decodes message Timezone { repeated Polygon polygons = 1;
+// string name = 2; }.
+func parseTimezone(data []byte) (timezone, error) {
+	var zone timezone
+	err := eachField(data, func(num int, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			poly, err := parsePolygon(value)
+			if err != nil {
+				return err
+			}
+			zone.polygons = append(zone.polygons, poly)
+		case 2:
+			zone.name = string(value)
+		}
+		return nil
+	})
+	return zone, err
+}
+
+// parsePolygon decodes message Polygon { repeated Point points = 1;
+// repeated Polygon holes = 2; }. Holes of holes do not occur.
+func parsePolygon(data []byte) (polygon, error) {
+	poly := polygon{rings: [][]point{nil}}
+	err := eachField(data, func(num int, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			p, err := parsePoint(value)
+			if err != nil {
+				return err
+			}
+			poly.rings[0] = append(poly.rings[0], p)
+		case 2:
+			hole, err := parsePolygon(value)
+			if err != nil {
+				return err
+			}
+			poly.rings = append(poly.rings, hole.rings[0])
+		}
+		return nil
+	})
+	return poly, err
+}
+
+// parsePoint decodes message Point { float lng = 1; float lat = 2; }.
+func parsePoint(data []byte) (point, error) {
+	var p point
+	err := eachField(data, func(num int, _ []byte, bits uint64) error {
+		value := float64(math.Float32frombits(uint32(bits)))
+		switch num {
+		case 1:
+			p.lon = value
+		case 2:
+			p.lat = value
+		}
+		return nil
+	})
+	return p, err
+}
+
+// eachField walks the fields of a protobuf message. Length-delimited
+// fields are passed as value, fixed and varint fields as bits.
+func eachField(data []byte, fn func(num int, value []byte, bits uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("bad field key")
+		}
+		data = data[n:]
+		num := int(key >> 3)
+		var value []byte
+		var bits uint64
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("bad varint")
+			}
+			bits, data = v, data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errors.New("short fixed64")
+			}
+			bits, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errors.New("bad length")
+			}
+			value, data = data[n:n+int(size)], data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return errors.New("short fixed32")
+			}
+			bits, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		if err := fn(num, value, bits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
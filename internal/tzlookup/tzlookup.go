@@ -0,0 +1,84 @@
+// Package tzlookup finds the time zone of a GPS position without network
+// access.
+//
+// It ships the zone polygons of timezone-boundary-builder, including the
+// ocean zones, as simplified by tzf-rel-lite (ODbL, see zones.LICENSE), and
+// returns the zone whose polygon contains the position. A position in a gap
+// between two simplified polygons gets the zone of the nearest border.
+package tzlookup
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // zone rules for systems without a zoneinfo database
+)
+
+// nearMargin bounds the search for the nearest border, in 1e-5 degrees.
+const nearMargin = 50_000
+
+var loadZones = sync.OnceValue(func() zoneData {
+	zd, err := parseZones(zonesBin)
+	if err != nil {
+		panic("tzlookup: " + err.Error())
+	}
+	return zd
+})
+
+// Lookup returns the zone for a latitude and longitude in degrees. It
+// reports false for coordinates out of range.
+func Lookup(lat float64, lon float64) (*time.Location, bool) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, false
+	}
+
+	best, ok := zoneAt(loadZones(), lat, lon)
+	if !ok {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(best)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// zoneAt returns the name of the zone containing the position. Land zones
+// win over ocean zones where simplified polygons overlap at a coast.
+func zoneAt(zd zoneData, lat float64, lon float64) (string, bool) {
+	x, y := int32(math.Round(lon*1e5)), int32(math.Round(lat*1e5))
+	best := ""
+	for i := range zd.polygons {
+		poly := &zd.polygons[i]
+		if !poly.contains(x, y) {
+			continue
+		}
+		name := zd.names[poly.zone]
+		if !isOceanZone(name) {
+			return name, true
+		}
+		if best == "" {
+			best = name
+		}
+	}
+	if best != "" {
+		return best, true
+	}
+
+	bestDistance := math.Inf(1)
+	for i := range zd.polygons {
+		poly := &zd.polygons[i]
+		if !poly.boxContains(x, y, nearMargin) {
+			continue
+		}
+		if d := poly.edgeDistance(x, y); d < bestDistance {
+			best, bestDistance = zd.names[poly.zone], d
+		}
+	}
+	return best, best != ""
+}
+
+func isOceanZone(name string) bool {
+	return strings.HasPrefix(name, "Etc/")
+}
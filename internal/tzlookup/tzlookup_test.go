@@ -0,0 +1,87 @@
+package tzlookup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"Berlin", 52.52, 13.405, "Europe/Berlin"},
+		{"New York", 40.7128, -74.006, "America/New_York"},
+		{"Los Angeles", 34.0522, -118.2437, "America/Los_Angeles"},
+		{"Tokyo", 35.6762, 139.6503, "Asia/Tokyo"},
+		{"Sydney", -33.8688, 151.2093, "Australia/Sydney"},
+		{"Sao Paulo", -23.5505, -46.6333, "America/Sao_Paulo"},
+		{"Atlantic", 0, -30, "Etc/GMT+2"},
+	}
+	for _, tt := range tests {
+		loc, ok := Lookup(tt.lat, tt.lon)
+		if !ok || loc.String() != tt.want {
+			t.Fatalf("%s: got %v (%v), want %s", tt.name, loc, ok, tt.want)
+		}
+	}
+}
+
+func TestLookup_RejectsOutOfRange(t *testing.T) {
+	for _, coords := range [][2]float64{{91, 0}, {0, 181}, {-91, 0}} {
+		if _, ok := Lookup(coords[0], coords[1]); ok {
+			t.Fatalf("Lookup(%v) should fail", coords)
+		}
+	}
+}
+
+func TestLookup_NearBorders(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"Calais", 50.9513, 1.8587, "Europe/Paris"},
+		{"Dover", 51.1279, 1.3134, "Europe/London"},
+		{"Gdansk", 54.3520, 18.6466, "Europe/Warsaw"},
+		{"Kaliningrad", 54.7104, 20.4522, "Europe/Kaliningrad"},
+		{"Vigo", 42.2406, -8.7207, "Europe/Madrid"},
+		{"Santiago de Compostela", 42.8782, -8.5448, "Europe/Madrid"},
+		{"Tui", 42.0476, -8.6445, "Europe/Madrid"},
+		{"Valenca", 42.0277, -8.6440, "Europe/Lisbon"},
+		{"Detroit", 42.3314, -83.0458, "America/Detroit"},
+		{"Windsor", 42.3149, -83.0364, "America/Toronto"},
+		{"El Paso", 31.7619, -106.4850, "America/Denver"},
+		{"Ciudad Juarez", 31.6904, -106.4245, "America/Ciudad_Juarez"},
+	}
+	for _, tt := range tests {
+		loc, ok := Lookup(tt.lat, tt.lon)
+		if !ok || loc.String() != tt.want {
+			t.Fatalf("%s: got %v (%v), want %s", tt.name, loc, ok, tt.want)
+		}
+	}
+}
+
+func TestZonesLoad(t *testing.T) {
+	zd := loadZones()
+	if len(zd.names) < 400 || len(zd.polygons) < len(zd.names) {
+		t.Fatalf("unexpected zone data: %d zones, %d polygons", len(zd.names), len(zd.polygons))
+	}
+	for _, name := range zd.names {
+		if _, err := time.LoadLocation(name); err != nil {
+			t.Fatalf("zone %s does not load: %v", name, err)
+		}
+	}
+}
+
+func TestRingContains(t *testing.T) {
+	square := []int32{0, 0, 10, 0, 10, 10, 0, 10}
+	for _, tt := range []struct {
+		lon, lat int32
+		want     bool
+	}{{5, 5, true}, {15, 5, false}, {5, -1, false}, {-1, 5, false}} {
+		if got := ringContains(square, tt.lon, tt.lat); got != tt.want {
+			t.Fatalf("ringContains(%d, %d) = %v, want %v", tt.lon, tt.lat, got, tt.want)
+		}
+	}
+}
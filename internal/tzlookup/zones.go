@@ -0,0 +1,186 @@
+package tzlookup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+//go:generate go run mkzones.go -in $TZF_REL_LITE/combined-with-oceans.reduce.bin -out zones.bin
+
+// zones.bin is the gzip of:
+//
+//	"TZP1" string(version) uvarint(zones)
+//	per zone:    string(name) uvarint(polygons)
+//	per polygon: uvarint(rings), the exterior ring first, then holes
+//	per ring:    uvarint(points), then varint deltas of lon and lat per point
+//
+// Strings are a uvarint length and the bytes. Coordinates are in 1e-5
+// degrees; each ring starts its deltas from zero.
+//
+//go:embed zones.bin
+var zonesBin []byte
+
+type polygon struct {
+	zone int
+	// rings hold interleaved lon, lat pairs; rings[0] is the exterior.
+	rings                          [][]int32
+	minLon, minLat, maxLon, maxLat int32
+}
+
+type zoneData struct {
+	version  string
+	names    []string
+	polygons []polygon
+}
+
+func parseZones(data []byte) (zoneData, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return zoneData{}, err
+	}
+	r := bufio.NewReader(zr)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "TZP1" {
+		return zoneData{}, errors.New("not a zone polygon file")
+	}
+
+	var zd zoneData
+	if zd.version, err = readString(r); err != nil {
+		return zoneData{}, err
+	}
+	zoneCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return zoneData{}, err
+	}
+	for zone := range int(zoneCount) {
+		name, err := readString(r)
+		if err != nil {
+			return zoneData{}, err
+		}
+		zd.names = append(zd.names, name)
+		polygonCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return zoneData{}, err
+		}
+		for range polygonCount {
+			poly, err := readPolygon(r, zone)
+			if err != nil {
+				return zoneData{}, fmt.Errorf("zone %s: %w", name, err)
+			}
+			zd.polygons = append(zd.polygons, poly)
+		}
+	}
+	return zd, nil
+}
+
+func readPolygon(r *bufio.Reader, zone int) (polygon, error) {
+	poly := polygon{zone: zone, minLon: math.MaxInt32, minLat: math.MaxInt32, maxLon: math.MinInt32, maxLat: math.MinInt32}
+	ringCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return polygon{}, err
+	}
+	for i := range ringCount {
+		pointCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return polygon{}, err
+		}
+		ring := make([]int32, 0, 2*pointCount)
+		var lon, lat int64
+		for range pointCount {
+			dLon, err := binary.ReadVarint(r)
+			if err != nil {
+				return polygon{}, err
+			}
+			dLat, err := binary.ReadVarint(r)
+			if err != nil {
+				return polygon{}, err
+			}
+			lon, lat = lon+dLon, lat+dLat
+			ring = append(ring, int32(lon), int32(lat))
+			if i == 0 {
+				poly.minLon, poly.maxLon = min(poly.minLon, int32(lon)), max(poly.maxLon, int32(lon))
+				poly.minLat, poly.maxLat = min(poly.minLat, int32(lat)), max(poly.maxLat, int32(lat))
+			}
+		}
+		poly.rings = append(poly.rings, ring)
+	}
+	return poly, nil
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (p *polygon) boxContains(lon int32, lat int32, margin int32) bool {
+	return lon >= p.minLon-margin && lon <= p.maxLon+margin && lat >= p.minLat-margin && lat <= p.maxLat+margin
+}
+
+// contains reports whether the point is inside the exterior ring and
+// outside every hole.
+func (p *polygon) contains(lon int32, lat int32) bool {
+	if !p.boxContains(lon, lat, 0) || !ringContains(p.rings[0], lon, lat) {
+		return false
+	}
+	for _, hole := range p.rings[1:] {
+		if ringContains(hole, lon, lat) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is the even-odd ray casting test.
+func ringContains(ring []int32, lon int32, lat int32) bool {
+	inside := false
+	n := len(ring) / 2
+	x, y := int64(lon), int64(lat)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := int64(ring[2*i]), int64(ring[2*i+1])
+		xj, yj := int64(ring[2*j]), int64(ring[2*j+1])
+		if (yi > y) == (yj > y) {
+			continue
+		}
+		// The edge crosses the ray's latitude; test which side x is on
+		// without dividing.
+		cross := (xj-xi)*(y-yi) - (x-xi)*(yj-yi)
+		if (cross > 0) == (yj > yi) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// edgeDistance is the planar distance in quantized degrees from the point
+// to the nearest edge of the polygon's exterior ring.
+func (p *polygon) edgeDistance(lon int32, lat int32) float64 {
+	ring := p.rings[0]
+	n := len(ring) / 2
+	x, y := float64(lon), float64(lat)
+	best := math.Inf(1)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		ax, ay := float64(ring[2*j]), float64(ring[2*j+1])
+		bx, by := float64(ring[2*i]), float64(ring[2*i+1])
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if dx != 0 || dy != 0 {
+			t = math.Max(0, math.Min(1, ((x-ax)*dx+(y-ay)*dy)/(dx*dx+dy*dy)))
+		}
+		best = math.Min(best, math.Hypot(x-ax-t*dx, y-ay-t*dy))
+	}
+	return best
+}
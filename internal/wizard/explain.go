@@ -0,0 +1,62 @@
+package wizard
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/vchilikov/takeout-fix/utils/files"
+)
+
+// Explain scans the Takeout in cwd and prints how media was matched with its
+// JSON: the lookup keys, the candidates, the rules that filtered them and the
+// final decision. media is an absolute path or a path relative to the
+// processed root.
+func Explain(cwd string, out io.Writer, media string) int {
+	absCwd := cwd
+	if resolved, err := filepath.Abs(cwd); err == nil {
+		absCwd = resolved
+	}
+	writeLine(out, "TakeoutFix explain")
+	writef(out, "Folder: %s\n", absCwd)
+
+	root, message, preflightFail, err := resolveNoZipProcessRoot(absCwd, filepath.Join(absCwd, "takeoutfix-extracted"))
+	if err != nil {
+		writef(out, "Explain failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	if preflightFail {
+		writeLine(out, message)
+		return ExitPreflightFail
+	}
+
+	rel := media
+	if filepath.IsAbs(media) {
+		rel, err = filepath.Rel(root, media)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			writef(out, "%s is not under %s\n", media, root)
+			return ExitPreflightFail
+		}
+	}
+
+	overrides, err := files.LoadOverrides(filepath.Join(absCwd, ".takeoutfix", "pairs.json"))
+	if err != nil {
+		writef(out, "Explain failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	trace := files.Trace{Media: rel}
+	if _, err := explainScan(root, overrides, &trace); err != nil {
+		writef(out, "Explain failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	if !trace.Found {
+		writef(out, "No media %s under %s\n", trace.Media, root)
+		return ExitPreflightFail
+	}
+
+	writef(out, "Media: %s\n", trace.Media)
+	for _, step := range trace.Steps {
+		writef(out, "  %s\n", step)
+	}
+	return ExitSuccess
+}
@@ -9,10 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/vchilikov/takeout-fix/internal/backup"
 	"github.com/vchilikov/takeout-fix/internal/extract"
 	"github.com/vchilikov/takeout-fix/internal/preflight"
 	"github.com/vchilikov/takeout-fix/internal/processor"
 	"github.com/vchilikov/takeout-fix/internal/state"
+	"github.com/vchilikov/takeout-fix/utils/files"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
 )
 
 const (
@@ -26,7 +29,7 @@ const (
 
 var (
 	checkDependencies  = preflight.CheckDependencies
-	discoverZips       = preflight.DiscoverTopLevelZips
+	discoverZips       = preflight.DiscoverTopLevelArchives
 	validateAll        = preflight.ValidateAll
 	checkDiskSpace     = preflight.CheckDiskSpace
 	detectTakeoutRoot  = preflight.DetectProcessableTakeoutRoot
@@ -34,12 +37,58 @@ var (
 	saveState          = state.Save
 	shouldSkip         = state.ShouldSkipExtraction
 	extractArchiveFile = extract.ExtractArchive
-	processTakeout     = processor.RunWithProgress
+	processTakeout     = processor.RunWithOptions
+	resetJournal       = state.ResetJournal
+	resetBackup        = backup.Reset
+	rollbackTakeout    = processor.Rollback
+	explainScan        = files.ScanTakeoutTrace
+	exportScan         = files.ScanTakeoutWithOverrides
+	statPath           = os.Stat
 	removeFile         = os.Remove
 	writeReportJSON    = writeReportJSONImpl
 )
 
+// Options holds user-selected run settings.
+type Options struct {
+	// DryRun plans extraction, renames, metadata writes and deletions into a
+	// plan file without changing anything else on disk.
+	DryRun bool
+	// OutputDir receives processed copies of the media. The extracted files
+	// are left untouched so the run can be repeated without re-extracting.
+	OutputDir string
+	// Layout sorts processed media into date folders, e.g. "YYYY/MM".
+	// Empty keeps the Takeout folder structure.
+	Layout string
+	// Dedup keeps one copy of byte-identical media. Empty turns it off.
+	Dedup processor.DedupMode
+	// AlbumTag selects where album names are written. Empty uses the default.
+	AlbumTag metadata.AlbumTag
+	// PeopleHierarchy is the keyword parent for person names. Empty uses the
+	// default.
+	PeopleHierarchy string
+	// FavoriteRating is the star rating for favorites. Zero uses the default.
+	FavoriteRating int
+	// FavoriteKeyword also tags favorites with a "Favorite" keyword.
+	FavoriteKeyword bool
+	// Timezone selects the zone capture dates are written in.
+	Timezone metadata.TimezonePolicy
+	// DatePrecedence orders the sources capture dates are taken from.
+	DatePrecedence metadata.DatePrecedence
+	// DateChecks selects the sanity checks capture dates must pass.
+	DateChecks metadata.DateChecks
+	// WritePolicy selects per field whether JSON values replace values
+	// already in the media.
+	WritePolicy metadata.WritePolicy
+	// Backup saves each original before its first change, so the run can
+	// be rolled back. It has no effect with OutputDir or in a dry run.
+	Backup bool
+}
+
 func Run(cwd string, out io.Writer) int {
+	return RunWithOptions(cwd, out, Options{})
+}
+
+func RunWithOptions(cwd string, out io.Writer, opts Options) int {
 	absCwd := cwd
 	if resolved, err := filepath.Abs(cwd); err == nil {
 		absCwd = resolved
@@ -50,6 +99,9 @@ func Run(cwd string, out io.Writer) int {
 		Status:         "FAILED",
 		Workdir:        absCwd,
 		StartedAtLocal: runStartedAt,
+		DryRun:         opts.DryRun,
+		OutputDir:      opts.OutputDir,
+		DedupMode:      opts.Dedup,
 	}
 	finish := func(code int) int {
 		finishedAt := time.Now()
@@ -75,6 +127,12 @@ func Run(cwd string, out io.Writer) int {
 	}
 	writeLine(out, "TakeoutFix")
 	writef(out, "Folder: %s\n", report.Workdir)
+	if opts.OutputDir != "" {
+		writef(out, "Output: %s\n", opts.OutputDir)
+	}
+	if opts.DryRun {
+		writeLine(out, "Dry run: nothing will be extracted, changed or deleted.")
+	}
 	writeLine(out, "")
 
 	writef(out, "Step 1/3: Checking dependencies... ")
@@ -94,11 +152,15 @@ func Run(cwd string, out io.Writer) int {
 
 	dest := filepath.Join(report.Workdir, "takeoutfix-extracted")
 	statePath := filepath.Join(report.Workdir, ".takeoutfix", "state.json")
+	journalPath := filepath.Join(report.Workdir, ".takeoutfix", "journal.jsonl")
+	overridesPath := filepath.Join(report.Workdir, ".takeoutfix", "pairs.json")
+	backupDir := filepath.Join(report.Workdir, ".takeoutfix", "backup")
+	journalReset := false
 	st := state.New()
 	lowSpaceDelete := false
 	deferredDelete := make([]preflight.ZipArchive, 0)
 
-	writef(out, "Step 2/3: Looking for ZIP files... ")
+	writef(out, "Step 2/3: Looking for archives (ZIP/TGZ)... ")
 	zipScanStartedAt := time.Now()
 	zips, err := discoverZips(report.Workdir)
 	report.ZipScanDuration = time.Since(zipScanStartedAt)
@@ -125,7 +187,7 @@ func Run(cwd string, out io.Writer) int {
 	}
 
 	if len(zips) > 0 {
-		writeLine(out, "Checking ZIP integrity...")
+		writeLine(out, "Checking archive integrity...")
 		zipValidateStartedAt := time.Now()
 		integrity := validateAll(zips)
 		report.ZipValidateDuration = time.Since(zipValidateStartedAt)
@@ -135,10 +197,10 @@ func Run(cwd string, out io.Writer) int {
 			report.CorruptNames = append(report.CorruptNames, corrupt.Archive.Name)
 		}
 		if report.ArchiveCorrupt > 0 {
-			writeLine(out, "Some ZIP files are corrupted. Please re-download them and run again.")
+			writeLine(out, "Some archives are corrupted. Please re-download them and run again.")
 			return finish(ExitPreflightFail)
 		}
-		writeLine(out, "ZIP files look good.")
+		writeLine(out, "Archives look good.")
 
 		st, err = loadState(statePath)
 		if err != nil {
@@ -171,10 +233,15 @@ func Run(cwd string, out io.Writer) int {
 			}
 			if !space.Enough {
 				lowSpaceDelete = true
-				writeLine(out, "Low-space mode: ZIP files will be deleted right after extraction.")
+				writeLine(out, "Low-space mode: archives will be deleted right after extraction.")
 			}
 		}
-		writeLine(out, "Preparing files from ZIP archives...")
+		if opts.DryRun {
+			planArchives(&report, st, zips, lowSpaceDelete)
+			zips = nil
+		} else {
+			writeLine(out, "Preparing files from archives...")
+		}
 		extractStartedAt := time.Now()
 		for _, archive := range zips {
 			if shouldSkip(st, archive.Name, archive.Fingerprint) {
@@ -199,6 +266,18 @@ func Run(cwd string, out io.Writer) int {
 				continue
 			}
 
+			// Freshly extracted files restore their JSON, so progress and
+			// backups recorded for the previous extraction no longer apply.
+			if !journalReset {
+				if err := resetJournal(journalPath); err != nil {
+					report.addProblem("journal errors", 1, err.Error())
+				}
+				if err := resetBackup(backupDir); err != nil {
+					report.addProblem("backup errors", 1, err.Error())
+				}
+				journalReset = true
+			}
+
 			filesExtracted, err := extractArchiveFile(archive.Path, dest)
 			if err != nil {
 				report.addProblem("extract errors", 1, archive.Name)
@@ -223,15 +302,54 @@ func Run(cwd string, out io.Writer) int {
 			}
 		}
 		report.ExtractDuration = time.Since(extractStartedAt)
-		writeLine(out, "Preparing files from ZIP archives... done")
+		if !opts.DryRun {
+			writeLine(out, "Preparing files from archives... done")
+		}
 	}
 
-	writeLine(out, "Step 3/3: Applying metadata and cleaning JSON...")
+	if opts.DryRun {
+		if _, err := statPath(dest); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				report.addProblem("takeout content detection errors", 1, err.Error())
+				return finish(ExitRuntimeFail)
+			}
+			report.Plan.Notes = append(report.Plan.Notes, "No extracted files yet: per-file changes can be planned after extraction.")
+			report.Status = "SUCCESS"
+			return finish(ExitSuccess)
+		}
+		if len(report.Plan.Extractions) > 0 {
+			report.Plan.Notes = append(report.Plan.Notes, fmt.Sprintf("%d archive(s) are not extracted yet: their files are not included in the per-file plan.", len(report.Plan.Extractions)))
+		}
+		writeLine(out, "Step 3/3: Planning metadata changes and JSON cleanup...")
+	} else if opts.OutputDir != "" {
+		writeLine(out, "Step 3/3: Writing processed copies to the output folder...")
+	} else {
+		writeLine(out, "Step 3/3: Applying metadata and cleaning JSON...")
+	}
 	writeLine(out, "Progress: 0%")
+	if opts.Backup && !opts.DryRun && opts.OutputDir == "" {
+		report.BackupDir = backupDir
+	}
 	processStartedAt := time.Now()
 	lastProcessBucket := 0
 	sawProcessEvent := false
-	procReport, err := processTakeout(dest, func(event processor.ProgressEvent) {
+	procReport, err := processTakeout(dest, processor.Options{
+		DryRun:          opts.DryRun,
+		JournalPath:     journalPath,
+		OutputDir:       opts.OutputDir,
+		Layout:          opts.Layout,
+		Dedup:           opts.Dedup,
+		AlbumTag:        opts.AlbumTag,
+		PeopleHierarchy: opts.PeopleHierarchy,
+		FavoriteRating:  opts.FavoriteRating,
+		FavoriteKeyword: opts.FavoriteKeyword,
+		Timezone:        opts.Timezone,
+		DatePrecedence:  opts.DatePrecedence,
+		DateChecks:      opts.DateChecks,
+		WritePolicy:     opts.WritePolicy,
+		BackupDir:       report.BackupDir,
+		OverridesPath:   overridesPath,
+	}, func(event processor.ProgressEvent) {
 		sawProcessEvent = true
 		bucket := progressBucket10(event.Processed, event.Total)
 		if bucket > lastProcessBucket {
@@ -252,6 +370,12 @@ func Run(cwd string, out io.Writer) int {
 	report.MediaFound = procReport.Summary.MediaFound
 	report.MetadataApplied = procReport.Summary.MetadataApplied
 	report.FilenameDateApplied = procReport.Summary.FilenameDateApplied
+	report.FilenameDates = procReport.FilenameDates
+	report.UnpairedRenamed = procReport.Summary.UnpairedRenamed
+	report.UnpairedFilenameDates = procReport.Summary.UnpairedFilenameDates
+	report.UnpairedDatesSynced = procReport.Summary.UnpairedDatesSynced
+	report.ExifRepaired = procReport.Summary.ExifRepaired
+	report.RepairedExif = procReport.RepairedExif
 	report.RenamedExtensions = procReport.Summary.RenamedExtensions
 	report.XMPSidecars = procReport.Summary.XMPSidecars
 	report.CreateDateWarnings = procReport.Summary.CreateDateWarnings
@@ -260,15 +384,50 @@ func Run(cwd string, out io.Writer) int {
 	report.UnusedJSON = procReport.Summary.UnusedJSON
 	report.JSONRemoved = procReport.Summary.JSONRemoved
 	report.JSONKeptDueToErrors = procReport.Summary.JSONKeptDueToErrors
+	report.ResumedMedia = procReport.Summary.ResumedMedia
+	report.MatchedByTitle = procReport.Summary.MatchedByTitle
+	report.LocalizedEdits = procReport.Summary.LocalizedEdits
+	report.Overridden = procReport.Summary.Overridden
+	report.LocalZoneFallbacks = procReport.Summary.LocalZoneFallbacks
+	report.Matches = procReport.Matches
+	report.CopiedUnchanged = procReport.Summary.CopiedUnchanged
+	report.OrganizedMedia = procReport.Summary.OrganizedMedia
+	report.AlbumMedia = procReport.Summary.AlbumMedia
+	report.LivePhotos = procReport.Summary.LivePhotos
+	report.PeopleTagged = procReport.Summary.PeopleTagged
+	report.Favorites = procReport.Summary.Favorites
+	report.SidecarIssues = procReport.Summary.SidecarIssues
+	report.DateConflicts = procReport.Summary.DateConflicts
+	report.SkippedFields = procReport.SkippedFields
+	report.DuplicateFiles = procReport.Summary.DuplicateFiles
+	report.DedupBytesSaved = procReport.Summary.DedupBytesSaved
+	report.Duplicates = procReport.Duplicates
 
 	for category, count := range procReport.ProblemCounts {
 		report.addProblem(category, count, procReport.ProblemSamples[category]...)
 	}
 
+	if opts.DryRun {
+		report.Plan.Copies = procReport.Plan.Copies
+		report.Plan.Renames = procReport.Plan.Renames
+		report.Plan.Commands = procReport.Plan.Commands
+		report.Plan.Moves = procReport.Plan.Moves
+		if opts.Dedup != processor.DedupOff {
+			report.Plan.Notes = append(report.Plan.Notes, "Duplicates are found by current file contents: metadata writes can make some copies differ.")
+		}
+		report.Plan.JSONRemovals = procReport.Plan.JSONRemovals
+		if hasHardProcessingProblems(procReport.ProblemCounts) {
+			report.Status = "PARTIAL_SUCCESS"
+			return finish(ExitRuntimeFail)
+		}
+		report.Status = "SUCCESS"
+		return finish(ExitSuccess)
+	}
+
 	if hasHardProcessingProblems(procReport.ProblemCounts) {
 		report.Status = "PARTIAL_SUCCESS"
 		if !lowSpaceDelete {
-			writeLine(out, "Some files could not be updated. ZIP files were kept for a rerun.")
+			writeLine(out, "Some files could not be updated. Archives were kept for a rerun.")
 		}
 		return finish(ExitRuntimeFail)
 	}
@@ -292,6 +451,25 @@ func Run(cwd string, out io.Writer) int {
 	return finish(ExitSuccess)
 }
 
+// planArchives records which archives a real run would extract and delete.
+// Archives already extracted are only listed for deletion when still present.
+func planArchives(report *Report, st state.RunState, zips []preflight.ZipArchive, lowSpaceDelete bool) {
+	for _, archive := range zips {
+		if shouldSkip(st, archive.Name, archive.Fingerprint) {
+			report.SkippedArchives++
+			if !st.Archives[archive.Name].Deleted {
+				report.Plan.ZipDeletions = append(report.Plan.ZipDeletions, archive.Path)
+			}
+			continue
+		}
+		report.Plan.Extractions = append(report.Plan.Extractions, archive.Path)
+		report.Plan.ZipDeletions = append(report.Plan.ZipDeletions, archive.Path)
+	}
+	if lowSpaceDelete && len(report.Plan.Extractions) > 0 {
+		report.Plan.Notes = append(report.Plan.Notes, "Low-space mode: each archive would be deleted right after its extraction.")
+	}
+}
+
 func resolveNoZipProcessRoot(cwd string, extractedRoot string) (string, string, bool, error) {
 	info, err := os.Stat(extractedRoot)
 	if err == nil {
@@ -310,7 +488,7 @@ func resolveNoZipProcessRoot(cwd string, extractedRoot string) (string, string,
 		return "", "", false, fmt.Errorf("detect extracted takeout content: %w", detectErr)
 	}
 	if !processable {
-		return "", "No ZIP files or extracted Takeout data found in this folder.", true, nil
+		return "", "No Takeout archives or extracted Takeout data found in this folder.", true, nil
 	}
 
 	return processRoot, fmt.Sprintf("Using existing Takeout content from: %s", processRoot), false, nil
@@ -344,7 +522,7 @@ func hasHardProcessingProblems(problemCounts map[string]int) bool {
 	if len(problemCounts) == 0 {
 		return false
 	}
-	return problemCounts["extension errors"] > 0 || problemCounts["metadata errors"] > 0
+	return problemCounts["extension errors"] > 0 || problemCounts["metadata errors"] > 0 || problemCounts["backup errors"] > 0
 }
 
 func deleteArchiveZip(report *Report, archive preflight.ZipArchive) bool {
@@ -8,12 +8,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/vchilikov/takeout-fix/internal/preflight"
 	"github.com/vchilikov/takeout-fix/internal/processor"
 	"github.com/vchilikov/takeout-fix/internal/state"
+	"github.com/vchilikov/takeout-fix/utils/files"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
 )
 
 func TestRunStopsOnCorruptZip(t *testing.T) {
@@ -37,7 +40,7 @@ func TestRunStopsOnCorruptZip(t *testing.T) {
 		extractCalled = true
 		return 0, nil
 	}
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		t.Fatalf("process should not be called for corrupt zips")
 		return processor.Report{}, nil
 	}
@@ -121,7 +124,7 @@ func TestRunRerunAfterArchiveReplace(t *testing.T) {
 		extractCalls++
 		return 2, nil
 	}
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -204,7 +207,7 @@ func TestRunContinuesWhenOnlyAutoDeleteFits(t *testing.T) {
 	saveState = func(string, state.RunState) error { return nil }
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
 	removeFile = func(string) error { return nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -213,7 +216,7 @@ func TestRunContinuesWhenOnlyAutoDeleteFits(t *testing.T) {
 	if code != ExitSuccess {
 		t.Fatalf("expected success, got %d\n%s", code, out.String())
 	}
-	if !bytes.Contains(out.Bytes(), []byte("Low-space mode: ZIP files will be deleted right after extraction.")) {
+	if !bytes.Contains(out.Bytes(), []byte("Low-space mode: archives will be deleted right after extraction.")) {
 		t.Fatalf("expected low-space mode warning, got:\n%s", out.String())
 	}
 	if bytes.Contains(out.Bytes(), []byte("Enable delete-mode")) {
@@ -317,7 +320,7 @@ func TestRunShowsExtractionProgressForSkippedAndExtracted(t *testing.T) {
 		}
 		return 3, nil
 	}
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -328,7 +331,7 @@ func TestRunShowsExtractionProgressForSkippedAndExtracted(t *testing.T) {
 	}
 
 	output := out.Bytes()
-	if !bytes.Contains(output, []byte("Preparing files from ZIP archives... done")) {
+	if !bytes.Contains(output, []byte("Preparing files from archives... done")) {
 		t.Fatalf("expected archive preparation completion line, got:\n%s", out.String())
 	}
 
@@ -361,7 +364,7 @@ func TestRunShowsThrottledProcessingProgress(t *testing.T) {
 	loadState = func(string) (state.RunState, error) { return state.New(), nil }
 	saveState = func(string, state.RunState) error { return nil }
 	extractArchiveFile = func(string, string) (int, error) { return 2, nil }
-	processTakeout = func(_ string, onProgress func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(_ string, _ processor.Options, onProgress func(processor.ProgressEvent)) (processor.Report, error) {
 		onProgress(processor.ProgressEvent{Processed: 1, Total: 500, Media: "A.jpg"})
 		onProgress(processor.ProgressEvent{Processed: 2, Total: 500, Media: "B.jpg"})
 		onProgress(processor.ProgressEvent{Processed: 5, Total: 500, Media: "C.jpg"})
@@ -408,7 +411,7 @@ func TestRunShowsEmptyProcessingProgress(t *testing.T) {
 	loadState = func(string) (state.RunState, error) { return state.New(), nil }
 	saveState = func(string, state.RunState) error { return nil }
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -449,7 +452,7 @@ func TestRunPassesValidatedArchivesToDiskCheck(t *testing.T) {
 	loadState = func(string) (state.RunState, error) { return state.New(), nil }
 	saveState = func(string, state.RunState) error { return nil }
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -477,7 +480,7 @@ func TestRunReprocessesWhenNoZipsButExtractedDirExists(t *testing.T) {
 	discoverZips = func(string) ([]preflight.ZipArchive, error) { return nil, nil }
 
 	processCalled := false
-	processTakeout = func(dir string, _ func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(dir string, _ processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
 		processCalled = true
 		if !bytes.Contains([]byte(dir), []byte("takeoutfix-extracted")) {
 			t.Fatalf("expected process dir to contain takeoutfix-extracted, got %s", dir)
@@ -514,7 +517,7 @@ func TestRunFailsWhenNoZipsAndNoExtractedDir(t *testing.T) {
 	discoverZips = func(string) ([]preflight.ZipArchive, error) { return nil, nil }
 	detectTakeoutRoot = func(string) (string, bool, error) { return "", false, nil }
 
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		t.Fatalf("process should not be called when no zips and no extracted dir")
 		return processor.Report{}, nil
 	}
@@ -524,7 +527,7 @@ func TestRunFailsWhenNoZipsAndNoExtractedDir(t *testing.T) {
 	if code != ExitPreflightFail {
 		t.Fatalf("expected preflight fail, got %d\n%s", code, out.String())
 	}
-	if !bytes.Contains(out.Bytes(), []byte("No ZIP files or extracted Takeout data found in this folder.")) {
+	if !bytes.Contains(out.Bytes(), []byte("No Takeout archives or extracted Takeout data found in this folder.")) {
 		t.Fatalf("expected no-data message, got:\n%s", out.String())
 	}
 }
@@ -566,7 +569,7 @@ func TestRunProcessesDetectedTakeoutRootWhenNoZips(t *testing.T) {
 	}
 
 	var processedDir string
-	processTakeout = func(dir string, _ func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(dir string, _ processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
 		processedDir = dir
 		return processor.Report{}, nil
 	}
@@ -591,7 +594,7 @@ func TestRunFailsWhenExtractedPathIsFile(t *testing.T) {
 	checkDependencies = func() []preflight.Dependency { return nil }
 	discoverZips = func(string) ([]preflight.ZipArchive, error) { return nil, nil }
 
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		t.Fatalf("process should not be called when extracted path is a file")
 		return processor.Report{}, nil
 	}
@@ -611,6 +614,355 @@ func TestRunFailsWhenExtractedPathIsFile(t *testing.T) {
 	}
 }
 
+func TestRunResetsJournalOnFreshExtraction(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	checkDependencies = func() []preflight.Dependency { return nil }
+	discoverZips = func(string) ([]preflight.ZipArchive, error) {
+		return []preflight.ZipArchive{
+			{Name: "a.zip", Path: "/tmp/a.zip", Fingerprint: "f1"},
+			{Name: "b.zip", Path: "/tmp/b.zip", Fingerprint: "f2"},
+		}, nil
+	}
+	validateAll = func(zips []preflight.ZipArchive) preflight.IntegritySummary {
+		return preflight.IntegritySummary{
+			Checked: []preflight.ArchiveIntegrity{
+				{Archive: zips[0], FileCount: 1, UncompressedBytes: 100},
+				{Archive: zips[1], FileCount: 1, UncompressedBytes: 100},
+			},
+		}
+	}
+	checkDiskSpace = func(string, []preflight.ArchiveIntegrity) (preflight.SpaceCheck, error) {
+		return preflight.SpaceCheck{Enough: true, EnoughWithDelete: true}, nil
+	}
+	loadState = func(string) (state.RunState, error) { return state.New(), nil }
+	saveState = func(string, state.RunState) error { return nil }
+	removeFile = func(string) error { return nil }
+	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
+
+	var resetPaths []string
+	resetJournal = func(path string) error {
+		resetPaths = append(resetPaths, path)
+		return nil
+	}
+	var journalPath, overridesPath string
+	processTakeout = func(_ string, opts processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
+		journalPath, overridesPath = opts.JournalPath, opts.OverridesPath
+		return processor.Report{Summary: processor.Summary{ResumedMedia: 3}}, nil
+	}
+
+	cwd := t.TempDir()
+	var out bytes.Buffer
+	if code := Run(cwd, &out); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+
+	wantPath := filepath.Join(cwd, ".takeoutfix", "journal.jsonl")
+	if len(resetPaths) != 1 || resetPaths[0] != wantPath {
+		t.Fatalf("expected one journal reset for %s, got %v", wantPath, resetPaths)
+	}
+	if journalPath != wantPath {
+		t.Fatalf("expected journal path %s, got %s", wantPath, journalPath)
+	}
+	if want := filepath.Join(cwd, ".takeoutfix", "pairs.json"); overridesPath != want {
+		t.Fatalf("expected overrides path %s, got %s", want, overridesPath)
+	}
+	if !strings.Contains(out.String(), "Already done in a previous run: 3") {
+		t.Fatalf("expected resumed media line, got:\n%s", out.String())
+	}
+}
+
+func TestRunWithOutputDirPassesOutputAndReportsCopies(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	checkDependencies = func() []preflight.Dependency { return nil }
+	discoverZips = func(string) ([]preflight.ZipArchive, error) {
+		return []preflight.ZipArchive{{Name: "a.zip", Path: "/tmp/a.zip", Fingerprint: "f1"}}, nil
+	}
+	validateAll = func(zips []preflight.ZipArchive) preflight.IntegritySummary {
+		return preflight.IntegritySummary{
+			Checked: []preflight.ArchiveIntegrity{{Archive: zips[0], FileCount: 1, UncompressedBytes: 100}},
+		}
+	}
+	checkDiskSpace = func(string, []preflight.ArchiveIntegrity) (preflight.SpaceCheck, error) {
+		return preflight.SpaceCheck{Enough: true, EnoughWithDelete: true}, nil
+	}
+	loadState = func(string) (state.RunState, error) { return state.New(), nil }
+	saveState = func(string, state.RunState) error { return nil }
+	removeFile = func(string) error { return nil }
+	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
+	resetJournal = func(string) error { return nil }
+
+	outputDir := filepath.Join(t.TempDir(), "processed")
+	var gotOptions processor.Options
+	processTakeout = func(_ string, opts processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
+		gotOptions = opts
+		return processor.Report{Summary: processor.Summary{MediaFound: 2, MetadataApplied: 1, CopiedUnchanged: 1}}, nil
+	}
+
+	var out bytes.Buffer
+	if code := RunWithOptions(t.TempDir(), &out, Options{OutputDir: outputDir}); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if gotOptions.OutputDir != outputDir {
+		t.Fatalf("expected output dir %q to reach the processor, got %q", outputDir, gotOptions.OutputDir)
+	}
+	for _, want := range []string{
+		"Step 3/3: Writing processed copies to the output folder...",
+		"Processed copies: " + outputDir,
+		"Copied without metadata changes: 1",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunWithLayoutPassesLayoutAndReportsOrganizedMedia(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	checkDependencies = func() []preflight.Dependency { return nil }
+	discoverZips = func(string) ([]preflight.ZipArchive, error) {
+		return []preflight.ZipArchive{{Name: "a.zip", Path: "/tmp/a.zip", Fingerprint: "f1"}}, nil
+	}
+	validateAll = func(zips []preflight.ZipArchive) preflight.IntegritySummary {
+		return preflight.IntegritySummary{
+			Checked: []preflight.ArchiveIntegrity{{Archive: zips[0], FileCount: 1, UncompressedBytes: 100}},
+		}
+	}
+	checkDiskSpace = func(string, []preflight.ArchiveIntegrity) (preflight.SpaceCheck, error) {
+		return preflight.SpaceCheck{Enough: true, EnoughWithDelete: true}, nil
+	}
+	loadState = func(string) (state.RunState, error) { return state.New(), nil }
+	saveState = func(string, state.RunState) error { return nil }
+	removeFile = func(string) error { return nil }
+	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
+	resetJournal = func(string) error { return nil }
+
+	var gotOptions processor.Options
+	processTakeout = func(_ string, opts processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
+		gotOptions = opts
+		return processor.Report{Summary: processor.Summary{MediaFound: 2, MetadataApplied: 2, OrganizedMedia: 2}}, nil
+	}
+
+	var out bytes.Buffer
+	if code := RunWithOptions(t.TempDir(), &out, Options{Layout: "YYYY/MM"}); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if gotOptions.Layout != "YYYY/MM" {
+		t.Fatalf("expected layout to reach the processor, got %q", gotOptions.Layout)
+	}
+	if !strings.Contains(out.String(), "Organized into date folders: 2") {
+		t.Fatalf("expected organized count in output, got:\n%s", out.String())
+	}
+}
+
+func TestRunWithBackupPassesBackupDirAndResetsItOnFreshExtraction(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	checkDependencies = func() []preflight.Dependency { return nil }
+	discoverZips = func(string) ([]preflight.ZipArchive, error) {
+		return []preflight.ZipArchive{{Name: "a.zip", Path: "/tmp/a.zip", Fingerprint: "f1"}}, nil
+	}
+	validateAll = func(zips []preflight.ZipArchive) preflight.IntegritySummary {
+		return preflight.IntegritySummary{
+			Checked: []preflight.ArchiveIntegrity{{Archive: zips[0], FileCount: 1, UncompressedBytes: 100}},
+		}
+	}
+	checkDiskSpace = func(string, []preflight.ArchiveIntegrity) (preflight.SpaceCheck, error) {
+		return preflight.SpaceCheck{Enough: true, EnoughWithDelete: true}, nil
+	}
+	loadState = func(string) (state.RunState, error) { return state.New(), nil }
+	saveState = func(string, state.RunState) error { return nil }
+	removeFile = func(string) error { return nil }
+	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
+	resetJournal = func(string) error { return nil }
+	var resetPaths []string
+	resetBackup = func(dir string) error {
+		resetPaths = append(resetPaths, dir)
+		return nil
+	}
+
+	var gotOptions processor.Options
+	processTakeout = func(_ string, opts processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
+		gotOptions = opts
+		return processor.Report{Summary: processor.Summary{MediaFound: 1, MetadataApplied: 1}}, nil
+	}
+
+	cwd := t.TempDir()
+	var out bytes.Buffer
+	if code := RunWithOptions(cwd, &out, Options{Backup: true}); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	wantDir := filepath.Join(cwd, ".takeoutfix", "backup")
+	if gotOptions.BackupDir != wantDir {
+		t.Fatalf("expected backup dir %q to reach the processor, got %q", wantDir, gotOptions.BackupDir)
+	}
+	if !slices.Equal(resetPaths, []string{wantDir}) {
+		t.Fatalf("expected the backup to be reset on fresh extraction, got %v", resetPaths)
+	}
+	if !strings.Contains(out.String(), "Originals backed up to: "+wantDir) {
+		t.Fatalf("expected backup line in output, got:\n%s", out.String())
+	}
+}
+
+func TestRollbackRestoresFromWorkdirBackup(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	cwd := t.TempDir()
+	extracted := filepath.Join(cwd, "takeoutfix-extracted")
+	if err := os.Mkdir(extracted, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	var gotRoot string
+	var gotOptions processor.RollbackOptions
+	rollbackTakeout = func(root string, opts processor.RollbackOptions) (processor.RollbackReport, error) {
+		gotRoot, gotOptions = root, opts
+		return processor.RollbackReport{
+			Restored:    []string{"a.jpg", "a.jpg.json"},
+			NotBackedUp: []string{"b.jpg"},
+		}, nil
+	}
+
+	var out bytes.Buffer
+	if code := Rollback(cwd, &out, []string{"a.jpg", "b.jpg"}); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if gotRoot != extracted {
+		t.Fatalf("expected rollback under %s, got %s", extracted, gotRoot)
+	}
+	want := processor.RollbackOptions{
+		JournalPath: filepath.Join(cwd, ".takeoutfix", "journal.jsonl"),
+		BackupDir:   filepath.Join(cwd, ".takeoutfix", "backup"),
+		Files:       []string{"a.jpg", "b.jpg"},
+	}
+	if gotOptions.JournalPath != want.JournalPath || gotOptions.BackupDir != want.BackupDir || !slices.Equal(gotOptions.Files, want.Files) {
+		t.Fatalf("unexpected rollback options: %+v", gotOptions)
+	}
+	for _, line := range []string{"Restored: 2", "Without a backup: 1", "  b.jpg"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q in output, got:\n%s", line, out.String())
+		}
+	}
+
+	rollbackTakeout = func(string, processor.RollbackOptions) (processor.RollbackReport, error) {
+		return processor.RollbackReport{
+			ProblemCounts:  map[string]int{"rollback errors": 1},
+			ProblemSamples: map[string][]string{"rollback errors": {"restore a.jpg: permission denied"}},
+		}, nil
+	}
+	out.Reset()
+	if code := Rollback(cwd, &out, nil); code != ExitRuntimeFail {
+		t.Fatalf("expected runtime failure on rollback errors, got %d\n%s", code, out.String())
+	}
+}
+
+func TestExportOverridesWritesTemplate(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	cwd := t.TempDir()
+	extracted := filepath.Join(cwd, "takeoutfix-extracted")
+	if err := os.Mkdir(extracted, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := filepath.Join(cwd, ".takeoutfix", "pairs.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"pairs": [{"media": "c.jpg", "no_json": true}]}`), 0o600); err != nil {
+		t.Fatalf("write overrides: %v", err)
+	}
+
+	var gotRoot string
+	var gotOverrides files.Overrides
+	exportScan = func(root string, overrides files.Overrides) (files.MediaScanResult, error) {
+		gotRoot, gotOverrides = root, overrides
+		return files.MediaScanResult{
+			AmbiguousJSON: map[string][]string{"a.jpg": {"x.json", "y.json"}},
+			MissingJSON:   []string{"b.jpg", "c.jpg"},
+			NoJSON:        []string{"c.jpg"},
+		}, nil
+	}
+
+	var out bytes.Buffer
+	if code := ExportOverrides(cwd, &out); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if gotRoot != extracted || gotOverrides["c.jpg"] != "" || len(gotOverrides) != 1 {
+		t.Fatalf("expected a scan of %s with the current overrides, got %s %v", extracted, gotRoot, gotOverrides)
+	}
+	for _, line := range []string{"Ambiguous media: 1", "Media without JSON: 1", "Entries added: 2", "Overrides file: " + path} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q in output, got:\n%s", line, out.String())
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read overrides: %v", err)
+	}
+	for _, want := range []string{`"media": "a.jpg"`, `"x.json"`, `"media": "b.jpg"`, `"no_json": true`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s in overrides file:\n%s", want, data)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"pairs": [`), 0o600); err != nil {
+		t.Fatalf("write overrides: %v", err)
+	}
+	out.Reset()
+	if code := ExportOverrides(cwd, &out); code != ExitRuntimeFail {
+		t.Fatalf("expected runtime failure on a broken overrides file, got %d\n%s", code, out.String())
+	}
+}
+
+func TestExplainPrintsTraceSteps(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	cwd := t.TempDir()
+	extracted := filepath.Join(cwd, "takeoutfix-extracted")
+	if err := os.Mkdir(extracted, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	var gotRoot, gotMedia string
+	explainScan = func(root string, _ files.Overrides, trace *files.Trace) (files.MediaScanResult, error) {
+		gotRoot, gotMedia = root, trace.Media
+		if trace.Media == "a.jpg" {
+			trace.Found = true
+			trace.Steps = []string{"a.jpg.json: found a.jpg.json", "result: paired with a.jpg.json (filename)"}
+		}
+		return files.MediaScanResult{}, nil
+	}
+
+	var out bytes.Buffer
+	if code := Explain(cwd, &out, filepath.Join(extracted, "a.jpg")); code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if gotRoot != extracted || gotMedia != "a.jpg" {
+		t.Fatalf("expected a.jpg traced under %s, got %s under %s", extracted, gotMedia, gotRoot)
+	}
+	for _, line := range []string{"Media: a.jpg", "  a.jpg.json: found a.jpg.json", "  result: paired with a.jpg.json (filename)"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q in output, got:\n%s", line, out.String())
+		}
+	}
+
+	out.Reset()
+	if code := Explain(cwd, &out, "b.jpg"); code != ExitPreflightFail {
+		t.Fatalf("expected preflight failure for unknown media, got %d\n%s", code, out.String())
+	}
+	out.Reset()
+	if code := Explain(cwd, &out, filepath.Join(cwd, "a.jpg")); code != ExitPreflightFail {
+		t.Fatalf("expected preflight failure for media outside the root, got %d\n%s", code, out.String())
+	}
+}
+
 func TestRunSkipsDiskCheckWhenAllArchivesExtracted(t *testing.T) {
 	restore := stubWizardDeps()
 	defer restore()
@@ -655,7 +1007,7 @@ func TestRunSkipsDiskCheckWhenAllArchivesExtracted(t *testing.T) {
 		t.Fatalf("extract should not be called when all archives are skipped")
 		return 0, nil
 	}
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -725,7 +1077,7 @@ func TestRunSkipAlreadyDeletedArchiveDoesNotDeleteAgain(t *testing.T) {
 		t.Fatalf("extract should not be called when archive is skipped")
 		return 0, nil
 	}
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -779,7 +1131,7 @@ func TestRunMissingZipDuringDeleteDoesNotReportError(t *testing.T) {
 
 	removeFile = func(string) error { return os.ErrNotExist }
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{}, nil
 	}
 
@@ -838,7 +1190,7 @@ func TestRunPartialSuccessOnHardProcessingErrorsKeepsZipsInSafeMode(t *testing.T
 		return nil
 	}
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{
 			ProblemCounts: map[string]int{
 				"metadata errors": 1,
@@ -902,7 +1254,7 @@ func TestRunWarningOnlyProblemsStillSucceed(t *testing.T) {
 		return nil
 	}
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{
 			Summary: processor.Summary{
 				CreateDateWarnings: 1,
@@ -959,7 +1311,7 @@ func TestRunWritesDetailedJSONReport(t *testing.T) {
 	saveState = func(string, state.RunState) error { return nil }
 	removeFile = func(string) error { return nil }
 	extractArchiveFile = func(string, string) (int, error) { return 1, nil }
-	processTakeout = func(string, func(processor.ProgressEvent)) (processor.Report, error) {
+	processTakeout = func(string, processor.Options, func(processor.ProgressEvent)) (processor.Report, error) {
 		return processor.Report{
 			Summary: processor.Summary{
 				MediaFound:          2,
@@ -967,6 +1319,17 @@ func TestRunWritesDetailedJSONReport(t *testing.T) {
 				FilenameDateApplied: 1,
 				JSONRemoved:         1,
 				MissingJSON:         1,
+				MatchedByTitle:      1,
+				ExifRepaired:        1,
+				LocalizedEdits:      1,
+				Overridden:          2,
+				LocalZoneFallbacks:  3,
+			},
+			Matches: []processor.PairMatch{
+				{Media: "a.jpg", JSON: "renamed.json", Strategy: files.MatchTitle},
+			},
+			RepairedExif: []processor.RepairedExif{
+				{Media: "a.jpg", Repair: metadata.ExifRepairRebuilt, LostTags: []string{"ExifIFD:ExposureTime"}},
 			},
 		}, nil
 	}
@@ -1012,6 +1375,47 @@ func TestRunWritesDetailedJSONReport(t *testing.T) {
 	if _, ok := parsed["metadata"].(map[string]any); !ok {
 		t.Fatalf("expected metadata object in json report, got %T", parsed["metadata"])
 	}
+	pairing, ok := parsed["pairing"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected pairing object in json report, got %T", parsed["pairing"])
+	}
+	pairs, _ := pairing["pairs"].([]any)
+	if len(pairs) != 1 {
+		t.Fatalf("expected one pair in json report, got %v", pairing["pairs"])
+	}
+	if pair, _ := pairs[0].(map[string]any); pair["strategy"] != "title" {
+		t.Fatalf("pair strategy mismatch: want title, got %v", pair["strategy"])
+	}
+
+	if !strings.Contains(out.String(), "Edited copies matched by a localized suffix: 1") {
+		t.Fatalf("expected localized edits line in output, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Dates in the local time zone for lack of GPS: 3") {
+		t.Fatalf("expected local zone fallback line in output, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Set by the overrides file: 2") {
+		t.Fatalf("expected overrides line in output, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Corrupt EXIF repaired: 1 (1 tags lost)") {
+		t.Fatalf("expected EXIF repair line in output, got:\n%s", out.String())
+	}
+	metadataSection, _ := parsed["metadata"].(map[string]any)
+	if got, _ := metadataSection["localized_edits"].(float64); got != 1 {
+		t.Fatalf("localized_edits mismatch: want 1, got %v", metadataSection["localized_edits"])
+	}
+	if got, _ := metadataSection["local_zone_fallbacks"].(float64); got != 3 {
+		t.Fatalf("local_zone_fallbacks mismatch: want 3, got %v", metadataSection["local_zone_fallbacks"])
+	}
+	if got, _ := metadataSection["overridden"].(float64); got != 2 {
+		t.Fatalf("overridden mismatch: want 2, got %v", metadataSection["overridden"])
+	}
+	repairs, _ := metadataSection["exif_repairs"].([]any)
+	if len(repairs) != 1 {
+		t.Fatalf("expected one EXIF repair in json report, got %v", metadataSection["exif_repairs"])
+	}
+	if repair, _ := repairs[0].(map[string]any); repair["media"] != "a.jpg" || repair["repair"] != "rebuilt" {
+		t.Fatalf("unexpected EXIF repair entry: %v", repair)
+	}
 }
 
 func TestRunDoesNotPrintDetailedPathWhenReportWriteFails(t *testing.T) {
@@ -1043,6 +1447,120 @@ func TestRunDoesNotPrintDetailedPathWhenReportWriteFails(t *testing.T) {
 	}
 }
 
+func TestRunDryRunPlansWithoutChanges(t *testing.T) {
+	restore := stubWizardDeps()
+	defer restore()
+
+	checkDependencies = func() []preflight.Dependency { return nil }
+	discoverZips = func(string) ([]preflight.ZipArchive, error) {
+		return []preflight.ZipArchive{
+			{Name: "a.zip", Path: "/tmp/a.zip", Fingerprint: "f1"},
+			{Name: "b.zip", Path: "/tmp/b.zip", Fingerprint: "f2"},
+		}, nil
+	}
+	validateAll = func(zips []preflight.ZipArchive) preflight.IntegritySummary {
+		checked := make([]preflight.ArchiveIntegrity, 0, len(zips))
+		for _, z := range zips {
+			checked = append(checked, preflight.ArchiveIntegrity{Archive: z, FileCount: 1, UncompressedBytes: 10})
+		}
+		return preflight.IntegritySummary{Checked: checked}
+	}
+	checkDiskSpace = func(string, []preflight.ArchiveIntegrity) (preflight.SpaceCheck, error) {
+		return preflight.SpaceCheck{Enough: true, EnoughWithDelete: true}, nil
+	}
+	stored := state.New()
+	stored.Archives["a.zip"] = state.ArchiveState{Fingerprint: "f1", Extracted: true}
+	loadState = func(string) (state.RunState, error) { return stored, nil }
+	saveState = func(string, state.RunState) error {
+		t.Fatalf("dry run must not save state")
+		return nil
+	}
+	extractArchiveFile = func(string, string) (int, error) {
+		t.Fatalf("dry run must not extract archives")
+		return 0, nil
+	}
+	removeFile = func(path string) error {
+		t.Fatalf("dry run must not delete %s", path)
+		return nil
+	}
+	statPath = func(string) (os.FileInfo, error) { return nil, nil }
+
+	var gotOpts processor.Options
+	processTakeout = func(_ string, opts processor.Options, _ func(processor.ProgressEvent)) (processor.Report, error) {
+		gotOpts = opts
+		return processor.Report{
+			Summary: processor.Summary{MediaFound: 1, MetadataApplied: 1, JSONRemoved: 1},
+			Plan: processor.Plan{
+				Renames:      []processor.PlannedRename{{From: "/x/a.jpg", To: "/x/a.png"}},
+				Commands:     []processor.PlannedCommand{{Media: "/x/a.png", Args: []string{"-overwrite_original", "/x/a.png"}}},
+				JSONRemovals: []string{"/x/a.json"},
+			},
+		}, nil
+	}
+
+	cwd := t.TempDir()
+	var out bytes.Buffer
+	code := RunWithOptions(cwd, &out, Options{DryRun: true})
+	if code != ExitSuccess {
+		t.Fatalf("expected success, got %d\n%s", code, out.String())
+	}
+	if !gotOpts.DryRun {
+		t.Fatalf("expected processor to run in dry-run mode")
+	}
+
+	text := out.String()
+	if !strings.Contains(text, "Archives to extract: 1") {
+		t.Fatalf("expected extraction count in output, got:\n%s", text)
+	}
+	if !strings.Contains(text, "Archives to delete: 2") {
+		t.Fatalf("expected deletion count in output, got:\n%s", text)
+	}
+
+	const prefix = "Plan: "
+	var planPath string
+	for line := range strings.SplitSeq(text, "\n") {
+		if after, ok := strings.CutPrefix(line, prefix); ok {
+			planPath = strings.TrimSpace(after)
+		}
+	}
+	if planPath == "" {
+		t.Fatalf("expected plan path in output, got:\n%s", text)
+	}
+	if !strings.HasPrefix(filepath.Base(planPath), "plan-") {
+		t.Fatalf("expected plan file name, got %q", planPath)
+	}
+
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		t.Fatalf("read plan: %v", err)
+	}
+	var parsed struct {
+		DryRun bool `json:"dry_run"`
+		Plan   struct {
+			Extractions      []string `json:"extractions"`
+			Renames          []any    `json:"renames"`
+			ExiftoolCommands []any    `json:"exiftool_commands"`
+			JSONRemovals     []string `json:"json_removals"`
+			ZipDeletions     []string `json:"zip_deletions"`
+		} `json:"plan"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("parse plan: %v", err)
+	}
+	if !parsed.DryRun {
+		t.Fatalf("expected dry_run=true in plan")
+	}
+	if len(parsed.Plan.Extractions) != 1 || parsed.Plan.Extractions[0] != "/tmp/b.zip" {
+		t.Fatalf("unexpected extractions: %v", parsed.Plan.Extractions)
+	}
+	if len(parsed.Plan.Renames) != 1 || len(parsed.Plan.ExiftoolCommands) != 1 || len(parsed.Plan.JSONRemovals) != 1 {
+		t.Fatalf("expected processor plan in file, got %+v", parsed.Plan)
+	}
+	if len(parsed.Plan.ZipDeletions) != 2 {
+		t.Fatalf("expected both zips planned for deletion, got %v", parsed.Plan.ZipDeletions)
+	}
+}
+
 func detailedReportPathFromOutput(output string) string {
 	const prefix = "Detailed report: "
 	for line := range strings.SplitSeq(output, "\n") {
@@ -1066,6 +1584,12 @@ func stubWizardDeps() func() {
 	origRemoveFile := removeFile
 	origDetectTakeoutRoot := detectTakeoutRoot
 	origWriteReportJSON := writeReportJSON
+	origStatPath := statPath
+	origResetJournal := resetJournal
+	origResetBackup := resetBackup
+	origRollbackTakeout := rollbackTakeout
+	origExplainScan := explainScan
+	origExportScan := exportScan
 
 	return func() {
 		checkDependencies = origCheckDependencies
@@ -1080,5 +1604,11 @@ func stubWizardDeps() func() {
 		removeFile = origRemoveFile
 		detectTakeoutRoot = origDetectTakeoutRoot
 		writeReportJSON = origWriteReportJSON
+		statPath = origStatPath
+		resetJournal = origResetJournal
+		resetBackup = origResetBackup
+		rollbackTakeout = origRollbackTakeout
+		explainScan = origExplainScan
+		exportScan = origExportScan
 	}
 }
@@ -0,0 +1,56 @@
+package wizard
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/vchilikov/takeout-fix/utils/files"
+)
+
+// ExportOverrides scans the Takeout in cwd and adds its ambiguous and missing
+// media to the overrides file as entries to fill in. Entries already in the
+// file are kept.
+func ExportOverrides(cwd string, out io.Writer) int {
+	absCwd := cwd
+	if resolved, err := filepath.Abs(cwd); err == nil {
+		absCwd = resolved
+	}
+	writeLine(out, "TakeoutFix export-overrides")
+	writef(out, "Folder: %s\n", absCwd)
+
+	root, message, preflightFail, err := resolveNoZipProcessRoot(absCwd, filepath.Join(absCwd, "takeoutfix-extracted"))
+	if err != nil {
+		writef(out, "Export failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	if preflightFail {
+		writeLine(out, message)
+		return ExitPreflightFail
+	}
+
+	path := filepath.Join(absCwd, ".takeoutfix", "pairs.json")
+	overrides, err := files.LoadOverrides(path)
+	if err != nil {
+		writef(out, "Export failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	result, err := exportScan(root, overrides)
+	if err != nil {
+		writef(out, "Export failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	added, err := files.WriteOverridesTemplate(path, result)
+	if err != nil {
+		writef(out, "Export failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+
+	writef(out, "Ambiguous media: %d\n", len(result.AmbiguousJSON))
+	writef(out, "Media without JSON: %d\n", len(result.MissingJSON)-len(result.NoJSON))
+	writef(out, "Entries added: %d\n", added)
+	writef(out, "Overrides file: %s\n", path)
+	if added > 0 {
+		writeLine(out, "Set \"json\" or \"no_json\" for each entry, then run takeoutfix again.")
+	}
+	return ExitSuccess
+}
@@ -1,10 +1,14 @@
 package wizard
 
 import (
+	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/vchilikov/takeout-fix/internal/preflight"
+	"github.com/vchilikov/takeout-fix/internal/processor"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
 )
 
 type Report struct {
@@ -16,6 +20,14 @@ type Report struct {
 	DetailedReportPath       string
 	DetailedReportWriteError string
 
+	DryRun    bool
+	Plan      DryRunPlan
+	OutputDir string
+	// BackupDir holds the originals saved by the run. Empty when backups
+	// are off.
+	BackupDir string
+	DedupMode processor.DedupMode
+
 	ArchiveFound   int
 	ArchiveValid   int
 	ArchiveCorrupt int
@@ -30,17 +42,41 @@ type Report struct {
 	DeletedZips       int
 	DeleteErrors      []string
 
-	MediaFound          int
-	MetadataApplied     int
-	FilenameDateApplied int
-	RenamedExtensions   int
-	XMPSidecars         int
-	CreateDateWarnings  int
-	MissingJSON         int
-	AmbiguousMedia      int
-	UnusedJSON          int
-	JSONRemoved         int
-	JSONKeptDueToErrors int
+	MediaFound            int
+	MetadataApplied       int
+	FilenameDateApplied   int
+	FilenameDates         []processor.FilenameDate
+	RenamedExtensions     int
+	XMPSidecars           int
+	CreateDateWarnings    int
+	MissingJSON           int
+	AmbiguousMedia        int
+	UnusedJSON            int
+	JSONRemoved           int
+	JSONKeptDueToErrors   int
+	ResumedMedia          int
+	MatchedByTitle        int
+	LocalizedEdits        int
+	Overridden            int
+	LocalZoneFallbacks    int
+	CopiedUnchanged       int
+	OrganizedMedia        int
+	AlbumMedia            int
+	LivePhotos            int
+	PeopleTagged          int
+	Favorites             int
+	SidecarIssues         int
+	DateConflicts         int
+	UnpairedRenamed       int
+	UnpairedFilenameDates int
+	UnpairedDatesSynced   int
+	ExifRepaired          int
+	RepairedExif          []processor.RepairedExif
+	SkippedFields         map[string]int
+	DuplicateFiles        int
+	DedupBytesSaved       int64
+	Duplicates            []processor.DuplicateGroup
+	Matches               []processor.PairMatch
 
 	ZipScanDuration     time.Duration
 	ZipValidateDuration time.Duration
@@ -53,6 +89,18 @@ type Report struct {
 	ProblemSample map[string][]string
 }
 
+// DryRunPlan lists what a real run would do. Paths are absolute.
+type DryRunPlan struct {
+	Extractions  []string
+	ZipDeletions []string
+	Copies       []processor.PlannedCopy
+	Renames      []processor.PlannedRename
+	Commands     []processor.PlannedCommand
+	Moves        []processor.PlannedMove
+	JSONRemovals []string
+	Notes        []string
+}
+
 func (r *Report) addProblem(category string, n int, sample ...string) {
 	if r.ProblemCounts == nil {
 		r.ProblemCounts = make(map[string]int)
@@ -86,11 +134,79 @@ func (r *Report) normalizeProblems() {
 
 func printReport(out io.Writer, report Report) {
 	writeLine(out, "")
+	if report.DryRun {
+		printDryRunReport(out, report)
+		return
+	}
 	writef(out, "Run result: %s\n", runResultLabel(report.Status))
 	writef(out, "Metadata updated: %d of %d files\n", report.MetadataApplied, report.MediaFound)
-	writef(out, "Date restored from filename: %d\n", report.FilenameDateApplied)
+	if patterns := formatFilenamePatterns(report.FilenameDates); patterns != "" {
+		writef(out, "Date restored from filename: %d (%s)\n", report.FilenameDateApplied, patterns)
+	} else {
+		writef(out, "Date restored from filename: %d\n", report.FilenameDateApplied)
+	}
 	writef(out, "JSON removed: %d\n", report.JSONRemoved)
 	writef(out, "Missing metadata JSON: %d\n", report.MissingJSON)
+	if report.UnpairedRenamed+report.UnpairedFilenameDates+report.UnpairedDatesSynced > 0 {
+		writef(out, "Without JSON: %d extensions fixed, %d dates from filename, %d file dates set from EXIF\n",
+			report.UnpairedRenamed, report.UnpairedFilenameDates, report.UnpairedDatesSynced)
+	}
+	if report.OutputDir != "" {
+		writef(out, "Processed copies: %s\n", report.OutputDir)
+		writef(out, "Copied without metadata changes: %d\n", report.CopiedUnchanged)
+	}
+	if report.BackupDir != "" {
+		writef(out, "Originals backed up to: %s\n", report.BackupDir)
+	}
+	if report.AlbumMedia > 0 {
+		writef(out, "Album names written: %d\n", report.AlbumMedia)
+	}
+	if report.LivePhotos > 0 {
+		writef(out, "Live Photos linked: %d\n", report.LivePhotos)
+	}
+	if report.PeopleTagged > 0 {
+		writef(out, "Files with people tags: %d\n", report.PeopleTagged)
+	}
+	if report.Favorites > 0 {
+		writef(out, "Favorites rated: %d\n", report.Favorites)
+	}
+	if skipped := formatSkippedFields(report.SkippedFields); skipped != "" {
+		writef(out, "Fields kept as they were: %s\n", skipped)
+	}
+	if report.DateConflicts > 0 {
+		writef(out, "Files with date conflicts: %d\n", report.DateConflicts)
+	}
+	if report.SidecarIssues > 0 {
+		writef(out, "JSON with unusable fields: %d\n", report.SidecarIssues)
+	}
+	if report.ExifRepaired > 0 {
+		lost := 0
+		for _, repaired := range report.RepairedExif {
+			lost += len(repaired.LostTags)
+		}
+		writef(out, "Corrupt EXIF repaired: %d (%d tags lost)\n", report.ExifRepaired, lost)
+	}
+	if report.OrganizedMedia > 0 {
+		writef(out, "Organized into date folders: %d\n", report.OrganizedMedia)
+	}
+	if report.DedupMode != processor.DedupOff {
+		writef(out, "Duplicates %s: %d (%s saved)\n", dedupActionLabel(report.DedupMode), report.DuplicateFiles, preflight.FormatBytes(uint64(report.DedupBytesSaved)))
+	}
+	if report.MatchedByTitle > 0 {
+		writef(out, "Matched by JSON title: %d\n", report.MatchedByTitle)
+	}
+	if report.LocalizedEdits > 0 {
+		writef(out, "Edited copies matched by a localized suffix: %d\n", report.LocalizedEdits)
+	}
+	if report.Overridden > 0 {
+		writef(out, "Set by the overrides file: %d\n", report.Overridden)
+	}
+	if report.LocalZoneFallbacks > 0 {
+		writef(out, "Dates in the local time zone for lack of GPS: %d\n", report.LocalZoneFallbacks)
+	}
+	if report.ResumedMedia > 0 {
+		writef(out, "Already done in a previous run: %d\n", report.ResumedMedia)
+	}
 
 	if report.Status != "SUCCESS" {
 		writeLine(out, "Some files need attention. See the detailed report.")
@@ -107,6 +223,78 @@ func printReport(out io.Writer, report Report) {
 	}
 }
 
+func printDryRunReport(out io.Writer, report Report) {
+	writef(out, "Dry run result: %s\n", runResultLabel(report.Status))
+	writef(out, "Archives to extract: %d\n", len(report.Plan.Extractions))
+	if report.OutputDir != "" {
+		writef(out, "Files to copy to %s: %d\n", report.OutputDir, len(report.Plan.Copies))
+	}
+	writef(out, "Files to rename: %d\n", len(report.Plan.Renames))
+	writef(out, "Metadata updates planned: %d of %d files\n", report.MetadataApplied, report.MediaFound)
+	if len(report.Plan.Moves) > 0 {
+		writef(out, "Files to move into date folders: %d\n", len(report.Plan.Moves))
+	}
+	if report.DedupMode != processor.DedupOff {
+		writef(out, "Duplicates to be %s: %d (%s)\n", dedupActionLabel(report.DedupMode), report.DuplicateFiles, preflight.FormatBytes(uint64(report.DedupBytesSaved)))
+	}
+	writef(out, "JSON to remove: %d\n", len(report.Plan.JSONRemovals))
+	writef(out, "Archives to delete: %d\n", len(report.Plan.ZipDeletions))
+	for _, note := range report.Plan.Notes {
+		writeLine(out, note)
+	}
+
+	if report.Status != "SUCCESS" {
+		writeLine(out, "Some files need attention. See the plan.")
+	}
+
+	if report.DetailedReportPath != "" {
+		writef(out, "Plan: %s\n", report.DetailedReportPath)
+	} else {
+		writeLine(out, "Plan: unavailable")
+	}
+
+	if report.DetailedReportWriteError != "" {
+		writef(out, "Plan save warning: %s\n", report.DetailedReportWriteError)
+	}
+}
+
+// formatSkippedFields lists skipped field counts in metadata.Fields order,
+// such as "title 3, gps 1".
+func formatSkippedFields(skipped map[string]int) string {
+	var parts []string
+	for _, field := range metadata.Fields {
+		if skipped[field] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", field, skipped[field]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatFilenamePatterns counts restored dates per filename pattern in the
+// order the patterns first appear, such as "camera 3, whatsapp 1".
+func formatFilenamePatterns(dates []processor.FilenameDate) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, date := range dates {
+		if counts[date.Pattern] == 0 {
+			order = append(order, date.Pattern)
+		}
+		counts[date.Pattern]++
+	}
+	parts := make([]string, 0, len(order))
+	for _, pattern := range order {
+		parts = append(parts, fmt.Sprintf("%s %d", pattern, counts[pattern]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func dedupActionLabel(mode processor.DedupMode) string {
+	if mode == processor.DedupRemove {
+		return "removed"
+	}
+	return "hardlinked"
+}
+
 func runResultLabel(status string) string {
 	switch status {
 	case "SUCCESS":
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"slices"
 	"time"
+
+	"github.com/vchilikov/takeout-fix/internal/processor"
 )
 
 type jsonProblem struct {
@@ -28,8 +30,35 @@ type jsonReport struct {
 	Extraction      jsonExtraction  `json:"extraction"`
 	Metadata        jsonMetadata    `json:"metadata"`
 	JSONCleanup     jsonJSONCleanup `json:"json_cleanup"`
+	Pairing         jsonPairing     `json:"pairing"`
+	Dedup           *jsonDedup      `json:"dedup,omitempty"`
 	TimingsMS       jsonTimingsMS   `json:"timings_ms"`
 	Problems        []jsonProblem   `json:"problems,omitempty"`
+	OutputDir       string          `json:"output_dir,omitempty"`
+	BackupDir       string          `json:"backup_dir,omitempty"`
+	DryRun          bool            `json:"dry_run,omitempty"`
+	Plan            *jsonPlan       `json:"plan,omitempty"`
+}
+
+type jsonPlan struct {
+	Extractions      []string          `json:"extractions"`
+	Copies           []jsonPlanRename  `json:"copies"`
+	Renames          []jsonPlanRename  `json:"renames"`
+	ExiftoolCommands []jsonPlanCommand `json:"exiftool_commands"`
+	Moves            []jsonPlanRename  `json:"moves"`
+	JSONRemovals     []string          `json:"json_removals"`
+	ZipDeletions     []string          `json:"zip_deletions"`
+	Notes            []string          `json:"notes,omitempty"`
+}
+
+type jsonPlanRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type jsonPlanCommand struct {
+	Media string   `json:"media"`
+	Args  []string `json:"args"`
 }
 
 type jsonArchives struct {
@@ -57,13 +86,74 @@ type jsonExtraction struct {
 }
 
 type jsonMetadata struct {
-	MediaFound          int `json:"media_found"`
-	MetadataApplied     int `json:"metadata_applied"`
-	FilenameDateApplied int `json:"filename_date_applied"`
-	RenamedExtensions   int `json:"renamed_extensions"`
-	XMPSidecars         int `json:"xmp_sidecars"`
-	MissingJSON         int `json:"missing_json"`
-	AmbiguousMedia      int `json:"ambiguous_media"`
+	MediaFound            int `json:"media_found"`
+	MetadataApplied       int `json:"metadata_applied"`
+	FilenameDateApplied   int `json:"filename_date_applied"`
+	RenamedExtensions     int `json:"renamed_extensions"`
+	XMPSidecars           int `json:"xmp_sidecars"`
+	MissingJSON           int `json:"missing_json"`
+	AmbiguousMedia        int `json:"ambiguous_media"`
+	ResumedMedia          int `json:"resumed_media"`
+	MatchedByTitle        int `json:"matched_by_title"`
+	LocalizedEdits        int `json:"localized_edits"`
+	Overridden            int `json:"overridden"`
+	LocalZoneFallbacks    int `json:"local_zone_fallbacks"`
+	CopiedUnchanged       int `json:"copied_unchanged"`
+	OrganizedMedia        int `json:"organized_media"`
+	AlbumMedia            int `json:"album_media"`
+	LivePhotos            int `json:"live_photos"`
+	PeopleTagged          int `json:"people_tagged"`
+	Favorites             int `json:"favorites"`
+	SidecarIssues         int `json:"sidecar_issues"`
+	DateConflicts         int `json:"date_conflicts"`
+	UnpairedRenamed       int `json:"unpaired_renamed"`
+	UnpairedFilenameDates int `json:"unpaired_filename_dates"`
+	UnpairedDatesSynced   int `json:"unpaired_dates_synced"`
+	ExifRepaired          int `json:"exif_repaired"`
+	// SkippedFields counts media per field the write policy left unwritten.
+	SkippedFields map[string]int `json:"skipped_fields,omitempty"`
+	// FilenameDates lists each date restored from a filename and the
+	// pattern that matched.
+	FilenameDates []jsonFilenameDate `json:"filename_dates,omitempty"`
+	// ExifRepairs lists each media whose corrupt EXIF was repaired and the
+	// tags the repair lost.
+	ExifRepairs []jsonExifRepair `json:"exif_repairs,omitempty"`
+}
+
+type jsonFilenameDate struct {
+	Media     string `json:"media"`
+	Pattern   string `json:"pattern"`
+	Precision string `json:"precision"`
+}
+
+type jsonExifRepair struct {
+	Media    string   `json:"media"`
+	Repair   string   `json:"repair"`
+	LostTags []string `json:"lost_tags,omitempty"`
+}
+
+type jsonPairing struct {
+	ByStrategy map[string]int `json:"by_strategy"`
+	Pairs      []jsonPair     `json:"pairs"`
+}
+
+type jsonPair struct {
+	Media    string `json:"media"`
+	JSON     string `json:"json"`
+	Strategy string `json:"strategy"`
+}
+
+type jsonDedup struct {
+	Mode           string               `json:"mode"`
+	DuplicateFiles int                  `json:"duplicate_files"`
+	BytesSaved     int64                `json:"bytes_saved"`
+	Groups         []jsonDuplicateGroup `json:"groups"`
+}
+
+type jsonDuplicateGroup struct {
+	Canonical  string   `json:"canonical"`
+	Duplicates []string `json:"duplicates"`
+	SizeBytes  int64    `json:"size_bytes"`
 }
 
 type jsonJSONCleanup struct {
@@ -91,7 +181,11 @@ func writeReportJSONImpl(report Report) (string, error) {
 	if reportTime.IsZero() {
 		reportTime = time.Now()
 	}
-	fileName := fmt.Sprintf("report-%s.json", reportTime.Format("20060102-150405"))
+	prefix := "report"
+	if report.DryRun {
+		prefix = "plan"
+	}
+	fileName := fmt.Sprintf("%s-%s.json", prefix, reportTime.Format("20060102-150405"))
 	reportPath := filepath.Join(reportDir, fileName)
 	absReportPath, absErr := filepath.Abs(reportPath)
 	if absErr == nil {
@@ -123,6 +217,11 @@ func buildJSONReport(report Report) jsonReport {
 		}
 	}
 
+	var plan *jsonPlan
+	if report.DryRun {
+		plan = buildJSONPlan(report.Plan)
+	}
+
 	return jsonReport{
 		Status:          report.Status,
 		ExitCode:        report.ExitCode,
@@ -152,13 +251,33 @@ func buildJSONReport(report Report) jsonReport {
 			DeleteErrors:      slices.Clone(report.DeleteErrors),
 		},
 		Metadata: jsonMetadata{
-			MediaFound:          report.MediaFound,
-			MetadataApplied:     report.MetadataApplied,
-			FilenameDateApplied: report.FilenameDateApplied,
-			RenamedExtensions:   report.RenamedExtensions,
-			XMPSidecars:         report.XMPSidecars,
-			MissingJSON:         report.MissingJSON,
-			AmbiguousMedia:      report.AmbiguousMedia,
+			MediaFound:            report.MediaFound,
+			MetadataApplied:       report.MetadataApplied,
+			FilenameDateApplied:   report.FilenameDateApplied,
+			RenamedExtensions:     report.RenamedExtensions,
+			XMPSidecars:           report.XMPSidecars,
+			MissingJSON:           report.MissingJSON,
+			AmbiguousMedia:        report.AmbiguousMedia,
+			ResumedMedia:          report.ResumedMedia,
+			MatchedByTitle:        report.MatchedByTitle,
+			LocalizedEdits:        report.LocalizedEdits,
+			Overridden:            report.Overridden,
+			LocalZoneFallbacks:    report.LocalZoneFallbacks,
+			CopiedUnchanged:       report.CopiedUnchanged,
+			OrganizedMedia:        report.OrganizedMedia,
+			AlbumMedia:            report.AlbumMedia,
+			LivePhotos:            report.LivePhotos,
+			PeopleTagged:          report.PeopleTagged,
+			Favorites:             report.Favorites,
+			SidecarIssues:         report.SidecarIssues,
+			DateConflicts:         report.DateConflicts,
+			UnpairedRenamed:       report.UnpairedRenamed,
+			UnpairedFilenameDates: report.UnpairedFilenameDates,
+			UnpairedDatesSynced:   report.UnpairedDatesSynced,
+			ExifRepaired:          report.ExifRepaired,
+			SkippedFields:         report.SkippedFields,
+			FilenameDates:         buildJSONFilenameDates(report.FilenameDates),
+			ExifRepairs:           buildJSONExifRepairs(report.RepairedExif),
 		},
 		JSONCleanup: jsonJSONCleanup{
 			Removed:         report.JSONRemoved,
@@ -173,6 +292,110 @@ func buildJSONReport(report Report) jsonReport {
 			Process:     report.ProcessDuration.Milliseconds(),
 			Total:       report.TotalDuration.Milliseconds(),
 		},
-		Problems: problems,
+		Pairing:   buildJSONPairing(report.Matches),
+		Dedup:     buildJSONDedup(report),
+		Problems:  problems,
+		OutputDir: report.OutputDir,
+		BackupDir: report.BackupDir,
+		DryRun:    report.DryRun,
+		Plan:      plan,
+	}
+}
+
+func buildJSONFilenameDates(dates []processor.FilenameDate) []jsonFilenameDate {
+	out := make([]jsonFilenameDate, 0, len(dates))
+	for _, date := range dates {
+		out = append(out, jsonFilenameDate{
+			Media:     date.Media,
+			Pattern:   date.Pattern,
+			Precision: string(date.Precision),
+		})
+	}
+	return out
+}
+
+func buildJSONExifRepairs(repairs []processor.RepairedExif) []jsonExifRepair {
+	out := make([]jsonExifRepair, 0, len(repairs))
+	for _, repaired := range repairs {
+		out = append(out, jsonExifRepair{
+			Media:    repaired.Media,
+			Repair:   string(repaired.Repair),
+			LostTags: repaired.LostTags,
+		})
+	}
+	return out
+}
+
+func buildJSONPairing(matches []processor.PairMatch) jsonPairing {
+	pairing := jsonPairing{
+		ByStrategy: make(map[string]int),
+		Pairs:      make([]jsonPair, 0, len(matches)),
+	}
+	for _, match := range matches {
+		pairing.ByStrategy[string(match.Strategy)]++
+		pairing.Pairs = append(pairing.Pairs, jsonPair{
+			Media:    match.Media,
+			JSON:     match.JSON,
+			Strategy: string(match.Strategy),
+		})
+	}
+	return pairing
+}
+
+func buildJSONDedup(report Report) *jsonDedup {
+	if report.DedupMode == processor.DedupOff {
+		return nil
+	}
+	dedup := &jsonDedup{
+		Mode:           string(report.DedupMode),
+		DuplicateFiles: report.DuplicateFiles,
+		BytesSaved:     report.DedupBytesSaved,
+		Groups:         make([]jsonDuplicateGroup, 0, len(report.Duplicates)),
+	}
+	for _, group := range report.Duplicates {
+		dedup.Groups = append(dedup.Groups, jsonDuplicateGroup{
+			Canonical:  group.Canonical,
+			Duplicates: slices.Clone(group.Duplicates),
+			SizeBytes:  group.Size,
+		})
+	}
+	return dedup
+}
+
+func buildJSONPlan(plan DryRunPlan) *jsonPlan {
+	copies := make([]jsonPlanRename, 0, len(plan.Copies))
+	for _, planned := range plan.Copies {
+		copies = append(copies, jsonPlanRename{From: planned.From, To: planned.To})
+	}
+	renames := make([]jsonPlanRename, 0, len(plan.Renames))
+	for _, rename := range plan.Renames {
+		renames = append(renames, jsonPlanRename{From: rename.From, To: rename.To})
+	}
+	commands := make([]jsonPlanCommand, 0, len(plan.Commands))
+	for _, command := range plan.Commands {
+		commands = append(commands, jsonPlanCommand{Media: command.Media, Args: slices.Clone(command.Args)})
+	}
+	moves := make([]jsonPlanRename, 0, len(plan.Moves))
+	for _, move := range plan.Moves {
+		moves = append(moves, jsonPlanRename{From: move.From, To: move.To})
+	}
+
+	return &jsonPlan{
+		Extractions:      nonNilStrings(plan.Extractions),
+		Copies:           copies,
+		Renames:          renames,
+		ExiftoolCommands: commands,
+		Moves:            moves,
+		JSONRemovals:     nonNilStrings(plan.JSONRemovals),
+		ZipDeletions:     nonNilStrings(plan.ZipDeletions),
+		Notes:            slices.Clone(plan.Notes),
+	}
+}
+
+// nonNilStrings keeps empty plan sections as [] instead of null in the file.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
 	}
+	return slices.Clone(values)
 }
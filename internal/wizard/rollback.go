@@ -0,0 +1,59 @@
+package wizard
+
+import (
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/vchilikov/takeout-fix/internal/processor"
+)
+
+// Rollback restores the files backed up by earlier runs in cwd. With files,
+// only those media (and their JSON and XMP sidecar) are restored.
+func Rollback(cwd string, out io.Writer, files []string) int {
+	absCwd := cwd
+	if resolved, err := filepath.Abs(cwd); err == nil {
+		absCwd = resolved
+	}
+	writeLine(out, "TakeoutFix rollback")
+	writef(out, "Folder: %s\n", absCwd)
+
+	root, message, preflightFail, err := resolveNoZipProcessRoot(absCwd, filepath.Join(absCwd, "takeoutfix-extracted"))
+	if err != nil {
+		writef(out, "Rollback failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+	if preflightFail {
+		writeLine(out, message)
+		return ExitPreflightFail
+	}
+
+	report, err := rollbackTakeout(root, processor.RollbackOptions{
+		JournalPath: filepath.Join(absCwd, ".takeoutfix", "journal.jsonl"),
+		BackupDir:   filepath.Join(absCwd, ".takeoutfix", "backup"),
+		Files:       files,
+	})
+	if err != nil {
+		writef(out, "Rollback failed: %s\n", err.Error())
+		return ExitRuntimeFail
+	}
+
+	writef(out, "Restored: %d\n", len(report.Restored))
+	if len(report.NotBackedUp) > 0 {
+		writef(out, "Without a backup: %d\n", len(report.NotBackedUp))
+		for _, rel := range report.NotBackedUp[:min(len(report.NotBackedUp), 5)] {
+			writef(out, "  %s\n", rel)
+		}
+	}
+	if len(report.ProblemCounts) > 0 {
+		for _, category := range slices.Sorted(maps.Keys(report.ProblemCounts)) {
+			writef(out, "%s: %d\n", category, report.ProblemCounts[category])
+			for _, sample := range report.ProblemSamples[category] {
+				writef(out, "  %s\n", sample)
+			}
+		}
+		return ExitRuntimeFail
+	}
+	return ExitSuccess
+}
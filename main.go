@@ -6,40 +6,264 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/vchilikov/takeout-fix/internal/processor"
 	"github.com/vchilikov/takeout-fix/internal/wizard"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
 )
 
+const usage = "usage: takeoutfix [--workdir /path/to/folder] [--output /path/to/output] [--layout YYYY/MM] [--dedup hardlink|remove] [--album-tag album|hierarchical|keywords|none] [--people-hierarchy People|none] [--favorite-rating 1-5] [--favorite-keyword] [--timezone local|gps|ZONE] [--date-sources exif,taken,formatted,created,filename] [--date-checks epoch,future,folder|none] [--write-policy FIELD=overwrite|fill-missing|skip,...] [--backup] [--dry-run]\n       takeoutfix rollback [--workdir /path/to/folder] [FILE...]\n       takeoutfix explain [--workdir /path/to/folder] MEDIA\n       takeoutfix export-overrides [--workdir /path/to/folder]"
+
+type runConfig struct {
+	workDir string
+	options wizard.Options
+}
+
+// rollbackConfig selects the backed-up files to restore. No files restores
+// every backup.
+type rollbackConfig struct {
+	workDir string
+	files   []string
+}
+
+// explainConfig selects the media whose JSON matching is traced.
+type explainConfig struct {
+	workDir string
+	media   string
+}
+
 func main() {
-	workDir, err := resolveWorkDir(os.Args[1:], os.Getwd, os.Stat)
+	if len(os.Args) > 1 && os.Args[1] == "rollback" {
+		cfg, err := parseRollbackConfig(os.Args[2:], os.Getwd, os.Stat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid arguments: %v\n", err)
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(wizard.ExitRuntimeFail)
+		}
+		os.Exit(wizard.Rollback(cfg.workDir, os.Stdout, cfg.files))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		cfg, err := parseExplainConfig(os.Args[2:], os.Getwd, os.Stat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid arguments: %v\n", err)
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(wizard.ExitRuntimeFail)
+		}
+		os.Exit(wizard.Explain(cfg.workDir, os.Stdout, cfg.media))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export-overrides" {
+		workDir, err := parseExportOverridesConfig(os.Args[2:], os.Getwd, os.Stat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid arguments: %v\n", err)
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(wizard.ExitRuntimeFail)
+		}
+		os.Exit(wizard.ExportOverrides(workDir, os.Stdout))
+	}
+
+	cfg, err := parseRunConfig(os.Args[1:], os.Getwd, os.Stat)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "invalid arguments: %v\n", err)
-		fmt.Fprintln(os.Stderr, "usage: takeoutfix [--workdir /path/to/folder]")
+		fmt.Fprintln(os.Stderr, usage)
 		os.Exit(wizard.ExitRuntimeFail)
 	}
 
-	code := wizard.Run(workDir, os.Stdout)
+	code := wizard.RunWithOptions(cfg.workDir, os.Stdout, cfg.options)
 	os.Exit(code)
 }
 
-func resolveWorkDir(
+func parseRunConfig(
 	args []string,
 	getwd func() (string, error),
 	statFn func(string) (os.FileInfo, error),
-) (string, error) {
+) (runConfig, error) {
 	fs := flag.NewFlagSet("takeoutfix", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
 	workdir := fs.String("workdir", "", "working directory")
+	output := fs.String("output", "", "write processed copies to this folder and keep the extracted files unchanged")
+	layout := fs.String("layout", "", "sort processed media into date folders, e.g. YYYY/MM or YYYY/YYYY-MM-DD")
+	dedup := fs.String("dedup", "", "keep one copy of identical media: hardlink or remove the others; the copy from a \"Photos from YYYY\" folder is kept, and dry runs compare contents before metadata is written")
+	albumTag := fs.String("album-tag", "", "where to write album names: album (default), hierarchical, keywords or none")
+	peopleHierarchy := fs.String("people-hierarchy", "", `keyword parent for person names, e.g. "People" (default) gives "People|<name>"; none skips the keywords`)
+	favoriteRating := fs.Int("favorite-rating", metadata.DefaultFavoriteRating, "XMP rating written for favorites, 1 to 5")
+	favoriteKeyword := fs.Bool("favorite-keyword", false, `also add a "Favorite" keyword to favorites`)
+	timezone := fs.String("timezone", "", "write capture dates in this zone: local, gps, a zone name such as Europe/Berlin or an offset such as +02:00")
+	dateSources := fs.String("date-sources", "", "where capture dates come from, most trusted first (default exif,taken,formatted,filename)")
+	dateChecks := fs.String("date-checks", "", "reject dates on the 1970 epoch, in the future or outside their Photos from YYYY folder; none accepts every date (default epoch,future,folder)")
+	writePolicy := fs.String("write-policy", "", "per field overwrite, fill-missing or skip, e.g. gps=fill-missing,title=skip; fields: dates, gps, description, title, keywords, people, rating")
+	backup := fs.Bool("backup", false, "save each original under .takeoutfix/backup before changing it, so the run can be rolled back")
+	dryRun := fs.Bool("dry-run", false, "write a plan of all changes without touching any file")
 	if err := fs.Parse(args); err != nil {
-		return "", err
+		return runConfig{}, err
 	}
 	if fs.NArg() > 0 {
+		return runConfig{}, fmt.Errorf("unexpected positional arguments: %v", fs.Args())
+	}
+
+	resolved, err := resolveWorkDir(*workdir, getwd, statFn)
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	outputDir := strings.TrimSpace(*output)
+	if outputDir != "" {
+		outputDir, err = filepath.Abs(outputDir)
+		if err != nil {
+			return runConfig{}, fmt.Errorf("resolve output %q: %w", *output, err)
+		}
+	}
+
+	layoutTemplate := strings.TrimSpace(*layout)
+	if layoutTemplate != "" {
+		if err := processor.ValidateLayout(layoutTemplate); err != nil {
+			return runConfig{}, err
+		}
+	}
+
+	dedupMode, err := processor.ParseDedupMode(strings.TrimSpace(*dedup))
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	albumTagValue, err := metadata.ParseAlbumTag(strings.TrimSpace(*albumTag))
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	peopleHierarchyValue, err := metadata.ParsePeopleHierarchy(strings.TrimSpace(*peopleHierarchy))
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	if err := metadata.ValidateFavoriteRating(*favoriteRating); err != nil {
+		return runConfig{}, err
+	}
+
+	timezonePolicy, err := metadata.ParseTimezonePolicy(strings.TrimSpace(*timezone))
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	datePrecedence, err := metadata.ParseDatePrecedence(*dateSources)
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	dateCheckList, err := metadata.ParseDateChecks(*dateChecks)
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	writePolicyValue, err := metadata.ParseWritePolicy(*writePolicy)
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	return runConfig{
+		workDir: resolved,
+		options: wizard.Options{
+			DryRun:          *dryRun,
+			OutputDir:       outputDir,
+			Layout:          layoutTemplate,
+			Dedup:           dedupMode,
+			AlbumTag:        albumTagValue,
+			PeopleHierarchy: peopleHierarchyValue,
+			FavoriteRating:  *favoriteRating,
+			FavoriteKeyword: *favoriteKeyword,
+			Timezone:        timezonePolicy,
+			DatePrecedence:  datePrecedence,
+			DateChecks:      dateCheckList,
+			WritePolicy:     writePolicyValue,
+			Backup:          *backup,
+		},
+	}, nil
+}
+
+// parseRollbackConfig parses the arguments after "rollback". Positional
+// arguments are media paths relative to the processed folder.
+func parseRollbackConfig(
+	args []string,
+	getwd func() (string, error),
+	statFn func(string) (os.FileInfo, error),
+) (rollbackConfig, error) {
+	fs := flag.NewFlagSet("takeoutfix rollback", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	workdir := fs.String("workdir", "", "working directory")
+	if err := fs.Parse(args); err != nil {
+		return rollbackConfig{}, err
+	}
+
+	resolved, err := resolveWorkDir(*workdir, getwd, statFn)
+	if err != nil {
+		return rollbackConfig{}, err
+	}
+	return rollbackConfig{workDir: resolved, files: fs.Args()}, nil
+}
+
+// parseExplainConfig parses the arguments after "explain". The media path is
+// made absolute when it exists relative to the current directory, and is
+// otherwise taken as relative to the processed folder.
+func parseExplainConfig(
+	args []string,
+	getwd func() (string, error),
+	statFn func(string) (os.FileInfo, error),
+) (explainConfig, error) {
+	fs := flag.NewFlagSet("takeoutfix explain", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	workdir := fs.String("workdir", "", "working directory")
+	if err := fs.Parse(args); err != nil {
+		return explainConfig{}, err
+	}
+	if fs.NArg() != 1 {
+		return explainConfig{}, errors.New("explain needs exactly one media path")
+	}
+
+	resolved, err := resolveWorkDir(*workdir, getwd, statFn)
+	if err != nil {
+		return explainConfig{}, err
+	}
+	media := fs.Arg(0)
+	if !filepath.IsAbs(media) {
+		if cwd, err := getwd(); err == nil {
+			if _, err := statFn(filepath.Join(cwd, media)); err == nil {
+				media = filepath.Join(cwd, media)
+			}
+		}
+	}
+	return explainConfig{workDir: resolved, media: media}, nil
+}
+
+// parseExportOverridesConfig parses the arguments after "export-overrides"
+// and returns the working directory.
+func parseExportOverridesConfig(
+	args []string,
+	getwd func() (string, error),
+	statFn func(string) (os.FileInfo, error),
+) (string, error) {
+	fs := flag.NewFlagSet("takeoutfix export-overrides", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	workdir := fs.String("workdir", "", "working directory")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 0 {
 		return "", fmt.Errorf("unexpected positional arguments: %v", fs.Args())
 	}
+	return resolveWorkDir(*workdir, getwd, statFn)
+}
 
-	resolved := strings.TrimSpace(*workdir)
+func resolveWorkDir(
+	workdir string,
+	getwd func() (string, error),
+	statFn func(string) (os.FileInfo, error),
+) (string, error) {
+	resolved := strings.TrimSpace(workdir)
 	if resolved == "" {
 		cwd, err := getwd()
 		if err != nil {
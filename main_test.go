@@ -3,55 +3,348 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/vchilikov/takeout-fix/internal/processor"
+	"github.com/vchilikov/takeout-fix/utils/metadata"
 )
 
-func TestResolveWorkDir_DefaultsToCWD(t *testing.T) {
+func TestParseRunConfig_DefaultsToCWD(t *testing.T) {
 	target := t.TempDir()
 
-	got, err := resolveWorkDir(nil, func() (string, error) {
+	got, err := parseRunConfig(nil, func() (string, error) {
 		return target, nil
 	}, os.Stat)
 	if err != nil {
-		t.Fatalf("resolveWorkDir error: %v", err)
+		t.Fatalf("parseRunConfig error: %v", err)
 	}
-	if got != target {
-		t.Fatalf("expected %q, got %q", target, got)
+	if got.workDir != target {
+		t.Fatalf("expected %q, got %q", target, got.workDir)
 	}
 }
 
-func TestResolveWorkDir_FlagValue(t *testing.T) {
+func TestParseRunConfig_FlagValue(t *testing.T) {
 	target := t.TempDir()
 
-	got, err := resolveWorkDir([]string{"--workdir", target}, func() (string, error) {
+	got, err := parseRunConfig([]string{"--workdir", target}, func() (string, error) {
 		return "/should/not/be/used", nil
 	}, os.Stat)
 	if err != nil {
-		t.Fatalf("resolveWorkDir error: %v", err)
+		t.Fatalf("parseRunConfig error: %v", err)
 	}
-	if got != target {
-		t.Fatalf("expected %q, got %q", target, got)
+	if got.workDir != target {
+		t.Fatalf("expected %q, got %q", target, got.workDir)
+	}
+	if got.options.DryRun {
+		t.Fatalf("dry run must be off by default")
 	}
 }
 
-func TestResolveWorkDir_NotExists(t *testing.T) {
+func TestParseRunConfig_NotExists(t *testing.T) {
 	missing := filepath.Join(t.TempDir(), "does-not-exist")
 
-	_, err := resolveWorkDir([]string{"--workdir", missing}, os.Getwd, os.Stat)
+	_, err := parseRunConfig([]string{"--workdir", missing}, os.Getwd, os.Stat)
 	if err == nil {
 		t.Fatalf("expected error for missing path")
 	}
 }
 
-func TestResolveWorkDir_NotDirectory(t *testing.T) {
+func TestParseRunConfig_NotDirectory(t *testing.T) {
 	dir := t.TempDir()
 	filePath := filepath.Join(dir, "file.txt")
 	if err := os.WriteFile(filePath, []byte("x"), 0o600); err != nil {
 		t.Fatalf("write file: %v", err)
 	}
 
-	_, err := resolveWorkDir([]string{"--workdir", filePath}, os.Getwd, os.Stat)
+	_, err := parseRunConfig([]string{"--workdir", filePath}, os.Getwd, os.Stat)
 	if err == nil {
 		t.Fatalf("expected error for file path")
 	}
 }
+
+func TestParseRunConfig_DryRun(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--dry-run"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if !got.options.DryRun {
+		t.Fatalf("expected dry run to be enabled")
+	}
+}
+
+func TestParseRunConfig_OutputIsAbsolute(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--output", "processed"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	want, err := filepath.Abs("processed")
+	if err != nil {
+		t.Fatalf("abs: %v", err)
+	}
+	if got.options.OutputDir != want {
+		t.Fatalf("output mismatch: want %q, got %q", want, got.options.OutputDir)
+	}
+}
+
+func TestParseRunConfig_Layout(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--layout", "YYYY/MM"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.Layout != "YYYY/MM" {
+		t.Fatalf("layout mismatch: got %q", got.options.Layout)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--layout", "../YYYY"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for invalid layout")
+	}
+}
+
+func TestParseRunConfig_Dedup(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--dedup", "hardlink"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.Dedup != processor.DedupHardlink {
+		t.Fatalf("dedup mismatch: got %q", got.options.Dedup)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--dedup", "copy"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for unknown dedup mode")
+	}
+}
+
+func TestParseRunConfig_AlbumTag(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.AlbumTag != metadata.DefaultAlbumTag {
+		t.Fatalf("expected default album tag, got %q", got.options.AlbumTag)
+	}
+
+	got, err = parseRunConfig([]string{"--workdir", target, "--album-tag", "keywords"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.AlbumTag != metadata.AlbumTagKeywords {
+		t.Fatalf("album tag mismatch: got %q", got.options.AlbumTag)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--album-tag", "title"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for unknown album tag")
+	}
+}
+
+func TestParseRunConfig_PeopleHierarchy(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.PeopleHierarchy != metadata.DefaultPeopleHierarchy {
+		t.Fatalf("expected default people hierarchy, got %q", got.options.PeopleHierarchy)
+	}
+
+	got, err = parseRunConfig([]string{"--workdir", target, "--people-hierarchy", "Tags|Faces"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.PeopleHierarchy != "Tags|Faces" {
+		t.Fatalf("people hierarchy mismatch: got %q", got.options.PeopleHierarchy)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--people-hierarchy", "Tags|"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for empty hierarchy level")
+	}
+}
+
+func TestParseRunConfig_Favorites(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.FavoriteRating != metadata.DefaultFavoriteRating || got.options.FavoriteKeyword {
+		t.Fatalf("unexpected favorite defaults: %+v", got.options)
+	}
+
+	got, err = parseRunConfig([]string{"--workdir", target, "--favorite-rating", "4", "--favorite-keyword"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.FavoriteRating != 4 || !got.options.FavoriteKeyword {
+		t.Fatalf("favorite options mismatch: %+v", got.options)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--favorite-rating", "0"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for favorite rating 0")
+	}
+}
+
+func TestParseRunConfig_Timezone(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--timezone", "Europe/Berlin"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.Timezone != "Europe/Berlin" {
+		t.Fatalf("timezone mismatch: got %q", got.options.Timezone)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--timezone", "Nowhere/City"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for unknown timezone")
+	}
+}
+
+func TestParseRunConfig_DateSourcesAndChecks(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.DatePrecedence != metadata.DefaultDatePrecedence || got.options.DateChecks != "" {
+		t.Fatalf("unexpected defaults: %q %q", got.options.DatePrecedence, got.options.DateChecks)
+	}
+
+	got, err = parseRunConfig([]string{"--workdir", target, "--date-sources", "exif,taken,filename", "--date-checks", "none"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.DatePrecedence != "exif,taken,filename" || got.options.DateChecks != metadata.DateChecksNone {
+		t.Fatalf("date options mismatch: %q %q", got.options.DatePrecedence, got.options.DateChecks)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--date-sources", "taken,taken"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for a repeated date source")
+	}
+	if _, err := parseRunConfig([]string{"--workdir", target, "--date-checks", "later"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for an unknown date check")
+	}
+}
+
+func TestParseRunConfig_WritePolicy(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target, "--write-policy", "fill-missing,title=skip"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.WritePolicy != "fill-missing,title=skip" {
+		t.Fatalf("write policy mismatch: got %q", got.options.WritePolicy)
+	}
+
+	if _, err := parseRunConfig([]string{"--workdir", target, "--write-policy", "albums=skip"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected error for an unknown field")
+	}
+}
+
+func TestParseRunConfig_Backup(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRunConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if got.options.Backup {
+		t.Fatalf("backup must be off by default")
+	}
+
+	got, err = parseRunConfig([]string{"--workdir", target, "--backup"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRunConfig error: %v", err)
+	}
+	if !got.options.Backup {
+		t.Fatalf("expected backup to be enabled")
+	}
+}
+
+func TestParseRollbackConfig(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseRollbackConfig([]string{"--workdir", target, "a.jpg", "album/b.jpg"}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRollbackConfig error: %v", err)
+	}
+	if got.workDir != target {
+		t.Fatalf("expected %q, got %q", target, got.workDir)
+	}
+	if !slices.Equal(got.files, []string{"a.jpg", "album/b.jpg"}) {
+		t.Fatalf("files mismatch: got %v", got.files)
+	}
+
+	got, err = parseRollbackConfig(nil, func() (string, error) { return target, nil }, os.Stat)
+	if err != nil {
+		t.Fatalf("parseRollbackConfig error: %v", err)
+	}
+	if got.workDir != target || len(got.files) != 0 {
+		t.Fatalf("expected the whole run in %q, got %+v", target, got)
+	}
+}
+
+func TestParseExplainConfig(t *testing.T) {
+	target := t.TempDir()
+	mediaPath := filepath.Join(target, "a.jpg")
+	if err := os.WriteFile(mediaPath, []byte("x"), 0o600); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	getwd := func() (string, error) { return target, nil }
+
+	got, err := parseExplainConfig([]string{"--workdir", target, "a.jpg"}, getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseExplainConfig error: %v", err)
+	}
+	if got.workDir != target || got.media != mediaPath {
+		t.Fatalf("expected %q in %q, got %+v", mediaPath, target, got)
+	}
+
+	got, err = parseExplainConfig([]string{"Photos/b.jpg"}, getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseExplainConfig error: %v", err)
+	}
+	if got.media != "Photos/b.jpg" {
+		t.Fatalf("expected a path relative to the processed folder, got %q", got.media)
+	}
+
+	for _, args := range [][]string{nil, {"a.jpg", "b.jpg"}} {
+		if _, err := parseExplainConfig(args, getwd, os.Stat); err == nil {
+			t.Fatalf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestParseExportOverridesConfig(t *testing.T) {
+	target := t.TempDir()
+
+	got, err := parseExportOverridesConfig([]string{"--workdir", target}, os.Getwd, os.Stat)
+	if err != nil {
+		t.Fatalf("parseExportOverridesConfig error: %v", err)
+	}
+	if got != target {
+		t.Fatalf("expected %q, got %q", target, got)
+	}
+
+	got, err = parseExportOverridesConfig(nil, func() (string, error) { return target, nil }, os.Stat)
+	if err != nil || got != target {
+		t.Fatalf("expected the current directory %q, got %q, %v", target, got, err)
+	}
+
+	if _, err := parseExportOverridesConfig([]string{"a.jpg"}, os.Getwd, os.Stat); err == nil {
+		t.Fatalf("expected an error for positional arguments")
+	}
+}
@@ -29,13 +29,35 @@ func FixDetailed(mediaPath string) (FixResult, error) {
 }
 
 func FixDetailedWithRunner(mediaPath string, run func(args []string) (string, error)) (FixResult, error) {
+	planned, err := PlanWithRunner(mediaPath, run)
+	if err != nil || !planned.Renamed {
+		return planned, err
+	}
+
+	err = os.Rename(mediaPath, planned.Path)
+	if err != nil {
+		return FixResult{Path: mediaPath}, err
+	}
+
+	return planned, nil
+}
+
+// Plan reports the path FixDetailed would rename mediaPath to, without
+// renaming anything.
+func Plan(mediaPath string) (FixResult, error) {
+	return PlanWithRunner(mediaPath, runExiftool)
+}
+
+// PlanWithRunner detects the proper extension like FixDetailedWithRunner but
+// only reports the target path. Renamed is true when a rename is planned.
+func PlanWithRunner(mediaPath string, run func(args []string) (string, error)) (FixResult, error) {
 	currentExt := filepath.Ext(mediaPath)
-	newExt, err := getNewExtension(mediaPath, run)
+	newExt, err := targetExtension(mediaPath, run)
 	if err != nil {
-		return FixResult{Path: mediaPath}, fmt.Errorf("could not get the proper extensions for %s: %w", mediaPath, err)
+		return FixResult{Path: mediaPath}, err
 	}
 
-	if areExtensionsCompatible(currentExt, newExt) {
+	if newExt == currentExt {
 		return FixResult{Path: mediaPath}, nil
 	}
 
@@ -45,12 +67,113 @@ func FixDetailedWithRunner(mediaPath string, run func(args []string) (string, er
 		return FixResult{Path: mediaPath}, fmt.Errorf("could not generate a new file name for %s with %s extensions: %w", mediaPath, newExt, err)
 	}
 
-	err = os.Rename(mediaPath, newMediaPath)
+	return FixResult{Path: newMediaPath, Renamed: true}, nil
+}
+
+// FixPair fixes the extensions of both halves of a Live Photo. See
+// FixPairWithRunner.
+func FixPair(stillPath string, videoPath string) (FixResult, FixResult, error) {
+	return FixPairWithRunner(stillPath, videoPath, runExiftool)
+}
+
+// PlanPair reports the paths FixPair would rename a Live Photo to.
+func PlanPair(stillPath string, videoPath string) (FixResult, FixResult, error) {
+	return PlanPairWithRunner(stillPath, videoPath, runExiftool)
+}
+
+// FixPairWithRunner fixes the extensions of the still and video halves of a
+// Live Photo so both keep the same name stem.
+func FixPairWithRunner(stillPath string, videoPath string, run func(args []string) (string, error)) (FixResult, FixResult, error) {
+	still, video, err := PlanPairWithRunner(stillPath, videoPath, run)
 	if err != nil {
-		return FixResult{Path: mediaPath}, err
+		return still, video, err
 	}
 
-	return FixResult{Path: newMediaPath, Renamed: true}, nil
+	if still.Renamed {
+		if err := os.Rename(stillPath, still.Path); err != nil {
+			return FixResult{Path: stillPath}, FixResult{Path: videoPath}, err
+		}
+	}
+	if video.Renamed {
+		if err := os.Rename(videoPath, video.Path); err != nil {
+			if still.Renamed {
+				_ = os.Rename(still.Path, stillPath)
+			}
+			return FixResult{Path: stillPath}, FixResult{Path: videoPath}, err
+		}
+	}
+	return still, video, nil
+}
+
+// PlanPairWithRunner plans extension fixes for the two halves of a Live Photo.
+// When one half needs a unique suffix, the other gets the same one so the
+// pair still matches by name.
+func PlanPairWithRunner(stillPath string, videoPath string, run func(args []string) (string, error)) (FixResult, FixResult, error) {
+	unchanged := func() (FixResult, FixResult) {
+		return FixResult{Path: stillPath}, FixResult{Path: videoPath}
+	}
+
+	stillExt, err := targetExtension(stillPath, run)
+	if err != nil {
+		still, video := unchanged()
+		return still, video, err
+	}
+	videoExt, err := targetExtension(videoPath, run)
+	if err != nil {
+		still, video := unchanged()
+		return still, video, err
+	}
+
+	stillBase := strings.TrimSuffix(stillPath, filepath.Ext(stillPath))
+	videoBase := strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+	stillTarget, videoTarget := stillBase+stillExt, videoBase+videoExt
+	if stillTarget == stillPath && videoTarget == videoPath {
+		still, video := unchanged()
+		return still, video, nil
+	}
+
+	isFree := func(target string, current string) bool {
+		return target == current || !doesFileExist(target)
+	}
+	if !isFree(stillTarget, stillPath) || !isFree(videoTarget, videoPath) {
+		found := false
+		const maxAttempts = 10
+		for range maxAttempts {
+			suffix, err := generateRandomSuffix()
+			if err != nil {
+				still, video := unchanged()
+				return still, video, fmt.Errorf("could not generate random suffix: %w", err)
+			}
+			stillTarget = stillBase + "-" + suffix + stillExt
+			videoTarget = videoBase + "-" + suffix + videoExt
+			if isFree(stillTarget, stillPath) && isFree(videoTarget, videoPath) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			still, video := unchanged()
+			return still, video, fmt.Errorf("could not generate a unique file name pair for %s after %d attempts", stillPath, maxAttempts)
+		}
+	}
+
+	return FixResult{Path: stillTarget, Renamed: stillTarget != stillPath},
+		FixResult{Path: videoTarget, Renamed: videoTarget != videoPath},
+		nil
+}
+
+// targetExtension returns the extension mediaPath should have, keeping the
+// current one when it is compatible with the detected file type.
+func targetExtension(mediaPath string, run func(args []string) (string, error)) (string, error) {
+	currentExt := filepath.Ext(mediaPath)
+	newExt, err := getNewExtension(mediaPath, run)
+	if err != nil {
+		return "", fmt.Errorf("could not get the proper extensions for %s: %w", mediaPath, err)
+	}
+	if areExtensionsCompatible(currentExt, newExt) {
+		return currentExt, nil
+	}
+	return newExt, nil
 }
 
 func runExiftool(args []string) (string, error) {
@@ -179,6 +179,90 @@ func TestFixDetailedWithRunner_Rename(t *testing.T) {
 	}
 }
 
+func TestPlanWithRunner_DoesNotRename(t *testing.T) {
+	tmpDir := t.TempDir()
+	origPath := filepath.Join(tmpDir, "photo.jpeg")
+	if err := os.WriteFile(origPath, []byte("fake"), 0644); err != nil {
+		t.Fatalf("create temp file: %v", err)
+	}
+
+	run := func([]string) (string, error) {
+		return ".png\n", nil
+	}
+
+	result, err := PlanWithRunner(origPath, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Renamed {
+		t.Fatalf("expected Renamed=true for planned rename")
+	}
+	if want := filepath.Join(tmpDir, "photo.png"); result.Path != want {
+		t.Fatalf("expected %q, got %q", want, result.Path)
+	}
+	if _, err := os.Stat(origPath); err != nil {
+		t.Fatalf("original file must stay in place: %v", err)
+	}
+	if _, err := os.Stat(result.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("planned target must not be created, stat err: %v", err)
+	}
+}
+
+func TestFixPairWithRunner_KeepsSharedStem(t *testing.T) {
+	tmpDir := t.TempDir()
+	stillPath := filepath.Join(tmpDir, "IMG_1234.HEIC")
+	videoPath := filepath.Join(tmpDir, "IMG_1234.MP4")
+	for _, path := range []string{stillPath, videoPath, filepath.Join(tmpDir, "IMG_1234.jpg")} {
+		if err := os.WriteFile(path, []byte("fake"), 0o600); err != nil {
+			t.Fatalf("create temp file: %v", err)
+		}
+	}
+
+	// The still is really a JPEG, but IMG_1234.jpg is taken, so the pair
+	// needs a suffix. The MOV video keeps its compatible .MP4 extension.
+	run := func(args []string) (string, error) {
+		if args[len(args)-1] == stillPath {
+			return ".jpg\n", nil
+		}
+		return ".mov\n", nil
+	}
+
+	still, video, err := FixPairWithRunner(stillPath, videoPath, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !still.Renamed || !video.Renamed {
+		t.Fatalf("expected both halves to be renamed, got %+v and %+v", still, video)
+	}
+	stillStem := strings.TrimSuffix(filepath.Base(still.Path), filepath.Ext(still.Path))
+	videoStem := strings.TrimSuffix(filepath.Base(video.Path), filepath.Ext(video.Path))
+	if stillStem != videoStem || !strings.HasPrefix(stillStem, "IMG_1234-") {
+		t.Fatalf("expected a shared suffixed stem, got %q and %q", still.Path, video.Path)
+	}
+	if filepath.Ext(still.Path) != ".jpg" || filepath.Ext(video.Path) != ".MP4" {
+		t.Fatalf("unexpected extensions: %q and %q", still.Path, video.Path)
+	}
+	for _, path := range []string{still.Path, video.Path} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("renamed file should exist: %v", err)
+		}
+	}
+}
+
+func TestPlanPairWithRunner_NoRenameWhenCompatible(t *testing.T) {
+	run := func([]string) (string, error) {
+		return ".mp4\n", nil
+	}
+
+	still, video, err := PlanPairWithRunner("/tmp/IMG_1.mov", "/tmp/IMG_1.mp4", run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if still.Renamed || video.Renamed {
+		t.Fatalf("did not expect renames, got %+v and %+v", still, video)
+	}
+}
+
 func TestFixDetailedWithRunner_RunnerError(t *testing.T) {
 	run := func([]string) (string, error) {
 		return "", errors.New("exiftool failed")
@@ -0,0 +1,136 @@
+package files
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// albumMetadataName is the album-level JSON Takeout writes into every album folder.
+const albumMetadataName = "metadata.json"
+
+// Album is the album-level metadata of a Takeout folder.
+type Album struct {
+	Title       string
+	Description string
+	// Date is the album date. It is zero when the JSON has none.
+	Date time.Time
+	// JSON is the album metadata file, relative to the scanned root.
+	JSON string
+}
+
+type albumJSON struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Date        struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"date"`
+}
+
+func isAlbumMetadataFile(name string) bool {
+	return strings.EqualFold(name, albumMetadataName)
+}
+
+// resolveAlbums reads album metadata files and records album membership for
+// every media file in an album folder. A byte-identical copy elsewhere in the
+// tree, such as the one in "Photos from YYYY", gets the same albums so the
+// copies stay identical once metadata is written. Files that are not valid
+// album metadata are returned so they can be reported as unused.
+func resolveAlbums(
+	rootPath string,
+	result *MediaScanResult,
+	albumFiles []string,
+	mediaByDir map[string][]string,
+	cache map[string]mediaFingerprint,
+	errCache map[string]error,
+) []string {
+	var invalid []string
+	for _, jsonRel := range albumFiles {
+		album, ok := readAlbum(filepath.Join(rootPath, jsonRel))
+		if !ok {
+			invalid = append(invalid, jsonRel)
+			continue
+		}
+		dir := filepath.Dir(jsonRel)
+		// Year folders carry the same file, but they are not albums.
+		if isYearFolderPath(jsonRel) {
+			continue
+		}
+		album.JSON = jsonRel
+		result.Albums[dir] = album
+	}
+	if len(result.Albums) == 0 {
+		return invalid
+	}
+
+	sizes := make(map[string]int64)
+	bySize := make(map[int64][]string)
+	for dir, names := range mediaByDir {
+		for _, name := range names {
+			rel := joinRelPath(dir, name)
+			info, err := os.Stat(filepath.Join(rootPath, rel))
+			if err != nil || info.Size() == 0 {
+				continue
+			}
+			sizes[rel] = info.Size()
+			bySize[info.Size()] = append(bySize[info.Size()], rel)
+		}
+	}
+
+	for _, dir := range slices.Sorted(maps.Keys(result.Albums)) {
+		title := result.Albums[dir].Title
+		for _, name := range mediaByDir[dir] {
+			rel := joinRelPath(dir, name)
+			addAlbum(result, rel, title)
+
+			size, ok := sizes[rel]
+			if !ok {
+				continue
+			}
+			for _, other := range bySize[size] {
+				if other == rel || filepath.Dir(other) == dir {
+					continue
+				}
+				if areExactDuplicateMediaClaims(rootPath, []string{rel, other}, cache, errCache) {
+					addAlbum(result, other, title)
+				}
+			}
+		}
+	}
+	for rel := range result.MediaAlbums {
+		slices.Sort(result.MediaAlbums[rel])
+	}
+	return invalid
+}
+
+func addAlbum(result *MediaScanResult, mediaRel string, title string) {
+	if !slices.Contains(result.MediaAlbums[mediaRel], title) {
+		result.MediaAlbums[mediaRel] = append(result.MediaAlbums[mediaRel], title)
+	}
+}
+
+func readAlbum(path string) (Album, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Album{}, false
+	}
+	var parsed albumJSON
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return Album{}, false
+	}
+	title := strings.TrimSpace(parsed.Title)
+	if title == "" {
+		return Album{}, false
+	}
+
+	album := Album{Title: title, Description: strings.TrimSpace(parsed.Description)}
+	if ts, err := strconv.ParseInt(parsed.Date.Timestamp, 10, 64); err == nil && ts > 0 {
+		album.Date = time.Unix(ts, 0)
+	}
+	return album, true
+}
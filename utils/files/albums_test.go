@@ -0,0 +1,59 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScanTakeoutRecordsAlbumMembership(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Trip/metadata.json":             `{"title": "Trip", "description": "Summer", "date": {"timestamp": "1600000000"}}`,
+		"Trip/a.jpg":                     "same",
+		"Trip/a.jpg.json":                `{"title": "a.jpg"}`,
+		"Trip/b.jpg":                     "only in trip",
+		"Photos from 2021/metadata.json": `{"title": "Photos from 2021"}`,
+		"Photos from 2021/a.jpg":         "same",
+		"Photos from 2021/a.jpg.json":    `{"title": "a.jpg"}`,
+		"Photos from 2021/c.jpg":         "only in year",
+		"Broken/metadata.json":           `not json`,
+		"Photos from 2021/c.jpg.json":    `{"title": "c.jpg"}`,
+		"Trip/b.jpg.json":                `{"title": "b.jpg"}`,
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+
+	wantAlbums := map[string]Album{
+		"Trip": {Title: "Trip", Description: "Summer", Date: time.Unix(1600000000, 0), JSON: filepath.Join("Trip", "metadata.json")},
+	}
+	if !reflect.DeepEqual(result.Albums, wantAlbums) {
+		t.Fatalf("albums mismatch: got %+v", result.Albums)
+	}
+
+	wantMembership := map[string][]string{
+		filepath.Join("Trip", "a.jpg"):             {"Trip"},
+		filepath.Join("Trip", "b.jpg"):             {"Trip"},
+		filepath.Join("Photos from 2021", "a.jpg"): {"Trip"},
+	}
+	if !reflect.DeepEqual(result.MediaAlbums, wantMembership) {
+		t.Fatalf("membership mismatch: got %v", result.MediaAlbums)
+	}
+
+	if !reflect.DeepEqual(result.UnusedJSON, []string{filepath.Join("Broken", "metadata.json")}) {
+		t.Fatalf("only invalid album metadata should be unused, got %v", result.UnusedJSON)
+	}
+}
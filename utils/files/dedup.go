@@ -0,0 +1,103 @@
+package files
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DuplicateGroup is a set of byte-identical media files. Paths are relative
+// to the scanned root and Files[0] is the canonical copy to keep.
+type DuplicateGroup struct {
+	Files []string
+	Size  int64
+}
+
+// FindDuplicateMedia recursively finds byte-identical media files under
+// rootPath. Only files that share a size are hashed. The canonical copy of a
+// group is the one in a "Photos from YYYY" folder when there is one, otherwise
+// the first path in sort order. sources maps media moved since the Takeout
+// was extracted, such as by a date layout, to the path they came from, both
+// relative to rootPath; the canonical copy is chosen by those paths. The
+// walk enters neither the state folder nor the directories in skip.
+func FindDuplicateMedia(rootPath string, sources map[string]string, skip []string) ([]DuplicateGroup, error) {
+	bySize := make(map[int64][]string)
+	err := filepath.WalkDir(rootPath, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() && skipWalkDir(rootPath, path, d, skip) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !isMediaCandidate(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache := make(map[string]mediaFingerprint)
+	errCache := make(map[string]error)
+	var groups []DuplicateGroup
+	for size, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := make(map[mediaFingerprint][]string)
+		for _, rel := range candidates {
+			fp, err := mediaFingerprintForPath(rootPath, rel, cache, errCache)
+			if err != nil {
+				return nil, err
+			}
+			byHash[fp] = append(byHash[fp], rel)
+		}
+		for _, same := range byHash {
+			if len(same) < 2 {
+				continue
+			}
+			slices.SortFunc(same, func(a, b string) int {
+				return compareCanonical(cmp.Or(sources[a], a), cmp.Or(sources[b], b))
+			})
+			groups = append(groups, DuplicateGroup{Files: same, Size: size})
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b DuplicateGroup) int {
+		return strings.Compare(a.Files[0], b.Files[0])
+	})
+	return groups, nil
+}
+
+// compareCanonical orders copies in year folders first, then by path. a and
+// b are the paths the copies had in the Takeout.
+func compareCanonical(a, b string) int {
+	aYear, bYear := isYearFolderPath(a), isYearFolderPath(b)
+	if aYear != bYear {
+		if aYear {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Compare(a, b)
+}
+
+func isYearFolderPath(rel string) bool {
+	return strings.HasPrefix(filepath.Base(filepath.Dir(rel)), "Photos from ")
+}
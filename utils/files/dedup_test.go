@@ -0,0 +1,96 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicateMediaGroupsIdenticalFiles(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Photos from 2021/b.jpg": "same",
+		"Album/a.jpg":            "same",
+		"Trip/a.jpg":             "same",
+		"Trip/other.jpg":         "diff",
+		"Trip/a.jpg.json":        "same",
+		"Album/clip.mp4":         "video",
+		"Trip/clip.mp4":          "video",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	groups, err := FindDuplicateMedia(root, nil, nil)
+	if err != nil {
+		t.Fatalf("FindDuplicateMedia error: %v", err)
+	}
+
+	want := []DuplicateGroup{
+		{Files: []string{filepath.Join("Album", "clip.mp4"), filepath.Join("Trip", "clip.mp4")}, Size: 5},
+		{Files: []string{filepath.Join("Photos from 2021", "b.jpg"), filepath.Join("Album", "a.jpg"), filepath.Join("Trip", "a.jpg")}, Size: 4},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("groups mismatch:\nwant %v\ngot  %v", want, groups)
+	}
+}
+
+func TestFindDuplicateMediaPrefersYearFolderSource(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"2021/01/a.jpg", "2021/01/b.jpg"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("same"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	albumCopy := filepath.Join("2021", "01", "a.jpg")
+	yearCopy := filepath.Join("2021", "01", "b.jpg")
+
+	groups, err := FindDuplicateMedia(root, map[string]string{
+		albumCopy: filepath.Join("Album", "a.jpg"),
+		yearCopy:  filepath.Join("Photos from 2021", "b.jpg"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("FindDuplicateMedia error: %v", err)
+	}
+	want := []DuplicateGroup{{Files: []string{yearCopy, albumCopy}, Size: 4}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("groups mismatch:\nwant %v\ngot  %v", want, groups)
+	}
+}
+
+func TestFindDuplicateMediaSkipsStateAndSkippedDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"Photos from 2021/a.jpg",
+		"Album/a.jpg",
+		".takeoutfix/backup/Album/a.jpg",
+		"Takeout/Photos from 2021/a.jpg",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("same"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	groups, err := FindDuplicateMedia(root, nil, []string{filepath.Join(root, "Takeout")})
+	if err != nil {
+		t.Fatalf("FindDuplicateMedia error: %v", err)
+	}
+	want := []DuplicateGroup{{Files: []string{filepath.Join("Photos from 2021", "a.jpg"), filepath.Join("Album", "a.jpg")}, Size: 4}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("groups mismatch:\nwant %v\ngot  %v", want, groups)
+	}
+}
@@ -0,0 +1,100 @@
+package files
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// editedSuffix is the suffix Google Photos adds to the name of an edited
+// copy in exports of one language. The copy shares the JSON of the original.
+type editedSuffix struct {
+	lang   string
+	suffix string
+}
+
+// editedSuffixes lists the known edited suffixes, lowercase and composed
+// (NFC). English comes first; the others are counted as localized matches.
+// Brazilian Portuguese exports share "-editado" with Spanish ones and are
+// counted as es.
+var editedSuffixes = []editedSuffix{
+	{lang: "en", suffix: "-edited"},
+	{lang: "de", suffix: "-bearbeitet"},
+	{lang: "fr", suffix: "-modifié"},
+	{lang: "es", suffix: "-editado"},
+	{lang: "es", suffix: "-ha editado"},
+	{lang: "pt", suffix: "-editada"},
+	{lang: "ca", suffix: "-editat"},
+	{lang: "it", suffix: "-modificato"},
+	{lang: "nl", suffix: "-bewerkt"},
+	{lang: "pl", suffix: "-edytowane"},
+	{lang: "ru", suffix: "-изменено"},
+	{lang: "ar", suffix: "-معدّل"},
+	{lang: "hi", suffix: "-संपादित"},
+	{lang: "ja", suffix: "-編集済み"},
+	{lang: "zh-CN", suffix: "-已编辑"},
+}
+
+// editedTailRe matches what may follow an edited suffix: an optional "(n)"
+// duplicate index and an optional extension.
+var editedTailRe = regexp.MustCompile(`^(\(\d+\))?(\.[^.]*)?$`)
+
+// cutEditedSuffix removes the first edited suffix found at the end of the
+// name stem, ignoring case and Unicode normalization, and reports which one
+// it was. A suffix followed by more of the name, as in "viaje-editado-final",
+// is part of the title and is kept. The rest is decomposed when name was,
+// such as a foldName key, and composed otherwise.
+func cutEditedSuffix(name string) (string, editedSuffix, bool) {
+	composed := norm.NFC.String(name)
+	for _, edited := range editedSuffixes {
+		for from := 0; ; {
+			i := indexFold(composed[from:], edited.suffix)
+			if i < 0 {
+				break
+			}
+			i += from
+			end := i + len(edited.suffix)
+			if !editedTailRe.MatchString(composed[end:]) {
+				from = i + 1
+				continue
+			}
+			rest := composed[:i] + composed[end:]
+			if composed != name && norm.NFD.IsNormalString(name) {
+				rest = norm.NFD.String(rest)
+			}
+			return rest, edited, true
+		}
+	}
+	return name, editedSuffix{}, false
+}
+
+// indexFold is strings.Index ignoring case, for a lowercase substr that
+// starts with "-" and whose letters have the same encoded length in both
+// cases.
+func indexFold(s string, substr string) int {
+	for i := 0; len(s)-i >= len(substr); i++ {
+		hyphen := strings.IndexByte(s[i:len(s)-len(substr)+1], '-')
+		if hyphen < 0 {
+			break
+		}
+		i += hyphen
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// markLocalizedEdits records the paired media whose JSON was found by
+// removing a non-English edited suffix from the media name.
+func markLocalizedEdits(result *MediaScanResult) {
+	for mediaRel, jsonRel := range result.Pairs {
+		_, edited, ok := cutEditedSuffix(filepath.Base(mediaRel))
+		if !ok || edited.lang == "en" || indexFold(norm.NFC.String(filepath.Base(jsonRel)), edited.suffix) >= 0 {
+			continue
+		}
+		result.LocalizedEdits[mediaRel] = edited.lang
+	}
+}
@@ -0,0 +1,151 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestScanTakeout_PairsEditedCopiesInEveryLanguage(t *testing.T) {
+	for _, edited := range editedSuffixes {
+		suffixes := []string{edited.suffix}
+		if decomposed := norm.NFD.String(edited.suffix); decomposed != edited.suffix {
+			suffixes = append(suffixes, decomposed)
+		}
+		for _, suffix := range suffixes {
+			t.Run(edited.lang+suffix, func(t *testing.T) {
+				testPairsEditedCopy(t, edited, suffix)
+			})
+		}
+	}
+}
+
+func testPairsEditedCopy(t *testing.T, edited editedSuffix, suffix string) {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Album"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	localEdit := "IMG_0001" + suffix + ".jpg"
+	globalEdit := filepath.Join("Album", "IMG_0002"+suffix+".jpg")
+	for _, name := range []string{"IMG_0001.jpg.json", localEdit, "IMG_0002.jpg.json", globalEdit} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+	if got := result.Pairs[localEdit]; got != "IMG_0001.jpg.json" {
+		t.Fatalf("local pass: want IMG_0001.jpg.json, got %q (missing %v)", got, result.MissingJSON)
+	}
+	if got := result.Pairs[globalEdit]; got != "IMG_0002.jpg.json" {
+		t.Fatalf("global pass: want IMG_0002.jpg.json, got %q (missing %v)", got, result.MissingJSON)
+	}
+
+	wantEdits := 2
+	if edited.lang == "en" {
+		wantEdits = 0
+	}
+	if len(result.LocalizedEdits) != wantEdits {
+		t.Fatalf("localized edits: want %d, got %v", wantEdits, result.LocalizedEdits)
+	}
+	if wantEdits > 0 && result.LocalizedEdits[localEdit] != edited.lang {
+		t.Fatalf("expected %s to be counted as %s, got %v", localEdit, edited.lang, result.LocalizedEdits)
+	}
+}
+
+func TestCutEditedSuffix_IgnoresCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		lang string
+	}{
+		{name: "IMG_0001-EDITED.jpg", want: "IMG_0001.jpg", lang: "en"},
+		{name: "IMG_0001-Bearbeitet.jpg", want: "IMG_0001.jpg", lang: "de"},
+		{name: "IMG_0001-MODIFIÉ.jpg", want: "IMG_0001.jpg", lang: "fr"},
+		{name: "IMG_0001-Изменено(1).jpg", want: "IMG_0001(1).jpg", lang: "ru"},
+		// Decomposed names, as uploaded from iPhones, and foldName keys.
+		{name: "IMG_1-modifie\u0301.jpg", want: "IMG_1.jpg", lang: "fr"},
+		{name: "IMG_1-MODIFIE\u0301.jpg", want: "IMG_1.jpg", lang: "fr"},
+		{name: foldName("Café-modifié.jpg"), want: "cafe\u0301.jpg", lang: "fr"},
+		{name: "Café-modifie\u0301.jpg", want: "Café.jpg", lang: "fr"},
+		{name: "IMG_1-編集済み.jpg", want: "IMG_1.jpg", lang: "ja"},
+		{name: "IMG_1-Editada.jpg", want: "IMG_1.jpg", lang: "pt"},
+		{name: "IMG_1-editado.jpg", want: "IMG_1.jpg", lang: "es"},
+		{name: "IMG_1-معدّل.jpg", want: "IMG_1.jpg", lang: "ar"},
+		{name: "IMG_1-संपादित.jpg", want: "IMG_1.jpg", lang: "hi"},
+		{name: "IMG_1-已编辑.jpg", want: "IMG_1.jpg", lang: "zh-CN"},
+	}
+	for _, tt := range tests {
+		got, edited, ok := cutEditedSuffix(tt.name)
+		if !ok || got != tt.want || edited.lang != tt.lang {
+			t.Fatalf("cutEditedSuffix(%q) = %q, %q, %v; want %q, %q", tt.name, got, edited.lang, ok, tt.want, tt.lang)
+		}
+	}
+
+	if got, _, ok := cutEditedSuffix("IMG_0001.jpg"); ok || got != "IMG_0001.jpg" {
+		t.Fatalf("expected no suffix, got %q", got)
+	}
+}
+
+func TestCutEditedSuffix_OnlyAtTheEndOfTheStem(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "IMG_1-edited", want: "IMG_1"},
+		{name: "IMG_1-edited(2).jpg", want: "IMG_1(2).jpg"},
+		{name: "viaje-editado-final-editado.jpg", want: "viaje-editado-final.jpg"},
+	}
+	for _, tt := range tests {
+		if got, _, ok := cutEditedSuffix(tt.name); !ok || got != tt.want {
+			t.Fatalf("cutEditedSuffix(%q) = %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+
+	for _, name := range []string{
+		"viaje-editado-final.jpg",
+		"casa-editada-2.jpg",
+		"IMG_1-edited copy.jpg",
+		"-edited-album.jpg",
+	} {
+		if got, _, ok := cutEditedSuffix(name); ok || got != name {
+			t.Fatalf("cutEditedSuffix(%q) = %q, %v; want the name kept", name, got, ok)
+		}
+	}
+}
+
+func TestEditedSuffixesAreComposedLowercase(t *testing.T) {
+	for _, edited := range editedSuffixes {
+		if edited.suffix != norm.NFC.String(strings.ToLower(edited.suffix)) {
+			t.Fatalf("%s suffix %q must be lowercase NFC", edited.lang, edited.suffix)
+		}
+	}
+}
+
+func TestScanTakeout_PairsDecomposedEditedCopy(t *testing.T) {
+	root := t.TempDir()
+	edit := "IMG_1-modifie\u0301.jpg"
+	for _, name := range []string{"IMG_1.jpg.json", edit} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+	if got := result.Pairs[edit]; got != "IMG_1.jpg.json" {
+		t.Fatalf("want IMG_1.jpg.json, got %q (missing %v)", got, result.MissingJSON)
+	}
+	if result.LocalizedEdits[edit] != "fr" {
+		t.Fatalf("expected %s to be counted as fr, got %v", edit, result.LocalizedEdits)
+	}
+}
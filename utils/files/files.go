@@ -12,30 +12,71 @@ import (
 	"github.com/vchilikov/takeout-fix/internal/mediaext"
 )
 
+// StateDirName is the folder TakeoutFix keeps its journal, backups,
+// reports and overrides in. Walks never enter it, so backed-up originals
+// are neither paired nor deduplicated as media.
+const StateDirName = ".takeoutfix"
+
 type MediaScanResult struct {
 	Pairs         map[string]string
+	PairSources   map[string]MatchStrategy
 	MissingJSON   []string
 	UnusedJSON    []string
 	AmbiguousJSON map[string][]string
+	// Albums maps an album folder to its album-level metadata.json.
+	Albums map[string]Album
+	// MediaAlbums lists the album titles of each media file.
+	MediaAlbums map[string][]string
+	// LivePhotos maps the video half of a Live Photo or motion photo to its
+	// still image.
+	LivePhotos map[string]string
+	// LocalizedEdits maps edited copies paired by removing a non-English
+	// edited suffix, such as "-bearbeitet", to the suffix language.
+	LocalizedEdits map[string]string
+	// NoJSON lists the media the overrides file marks as having no JSON.
+	// They are also in MissingJSON.
+	NoJSON []string
+	// InvalidOverrides lists the media whose override names a media or
+	// JSON file the scan did not find.
+	InvalidOverrides []string
 }
 
 // ScanTakeout recursively scans a Takeout root and matches media files with
 // their metadata json files across all nested folders.
 func ScanTakeout(rootPath string) (MediaScanResult, error) {
+	return scanTakeout(rootPath, nil, nil)
+}
+
+// ScanTakeoutWithOverrides scans like ScanTakeout, pairing the media listed
+// in overrides as they say before any matching pass runs.
+func ScanTakeoutWithOverrides(rootPath string, overrides Overrides) (MediaScanResult, error) {
+	return scanTakeout(rootPath, overrides, nil)
+}
+
+func scanTakeout(rootPath string, overrides Overrides, trace *Trace) (MediaScanResult, error) {
 	result := MediaScanResult{
-		Pairs:         make(map[string]string),
-		AmbiguousJSON: make(map[string][]string),
+		Pairs:          make(map[string]string),
+		PairSources:    make(map[string]MatchStrategy),
+		AmbiguousJSON:  make(map[string][]string),
+		Albums:         make(map[string]Album),
+		MediaAlbums:    make(map[string][]string),
+		LivePhotos:     make(map[string]string),
+		LocalizedEdits: make(map[string]string),
 	}
 
 	jsonByDir := make(map[string]map[string]struct{})
 	mediaByDir := make(map[string][]string)
 	var allJSON []string
+	var albumJSON []string
 
 	err := filepath.WalkDir(rootPath, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
 		if d.IsDir() {
+			if skipWalkDir(rootPath, path, d, nil) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -49,6 +90,10 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 			dir = "."
 		}
 
+		if isAlbumMetadataFile(base) {
+			albumJSON = append(albumJSON, rel)
+			return nil
+		}
 		if isJSONFile(base) {
 			if _, ok := jsonByDir[dir]; !ok {
 				jsonByDir[dir] = make(map[string]struct{})
@@ -77,25 +122,36 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 	mediaFingerprintCache := make(map[string]mediaFingerprint)
 	mediaFingerprintErrs := make(map[string]error)
 	var unresolvedMedia []string
+	settled := applyOverrides(&result, overrides, mediaByDir, allJSON, usedJSON, jsonAssignments, trace)
 
 	dirs := sortedDirs(mediaByDir)
 	for _, dir := range dirs {
-		dirJSON := jsonByDir[dir]
 		dirMediaSet := make(map[string]struct{}, len(mediaByDir[dir]))
 		localCandidatesByMedia := make(map[string]string, len(mediaByDir[dir]))
 		localCandidateClaims := make(map[string][]string)
 		for _, mediaFile := range mediaByDir[dir] {
 			dirMediaSet[mediaFile] = struct{}{}
 		}
+		index := newJSONIndex(jsonByDir[dir])
 		for _, mediaFile := range mediaByDir[dir] {
 			mediaRel := joinRelPath(dir, mediaFile)
-			jsonFile, err := getJsonFile(mediaFile, dirJSON, dirMediaSet)
+			if _, ok := settled[mediaRel]; ok {
+				continue
+			}
+			tr := trace.of(mediaRel)
+			if tr != nil {
+				tr.Found = true
+				tr.addf("folder %s: %d JSON files", dir, len(jsonByDir[dir]))
+			}
+			jsonFile, err := index.lookup(mediaFile, dirMediaSet, tr)
 			if err != nil {
+				tr.addf("no JSON in the same folder, searching all folders")
 				unresolvedMedia = append(unresolvedMedia, mediaRel)
 				continue
 			}
 
 			jsonRel := joinRelPath(dir, jsonFile)
+			tr.addf("same-folder match: %s", jsonRel)
 			localCandidatesByMedia[mediaRel] = jsonRel
 			localCandidateClaims[jsonRel] = append(localCandidateClaims[jsonRel], mediaRel)
 		}
@@ -106,13 +162,19 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 			if len(claims) <= 1 {
 				continue
 			}
+			tr := trace.among(claims)
+			tr.addf("%s is also claimed by %v", jsonRel, claims)
 			if canShareJSONAcrossClaims(rootPath, jsonRel, claims, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs) {
+				tr.addf("claimants are identical files, so they share %s", jsonRel)
 				localCandidateShared[jsonRel] = struct{}{}
 				continue
 			}
 			if winner, ok := uniqueClaimantByJSONTargetExtension(jsonRel, claims); ok {
+				tr.addf("JSON extension rule: %s wins %s", winner, jsonRel)
 				localCandidateWinner[jsonRel] = winner
+				continue
 			}
+			tr.addf("no rule picks a claimant of %s", jsonRel)
 		}
 
 		for _, mediaFile := range mediaByDir[dir] {
@@ -125,6 +187,7 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 			if len(claims) > 1 {
 				if _, ok := localCandidateShared[jsonRel]; ok {
 					result.Pairs[mediaRel] = jsonRel
+					result.PairSources[mediaRel] = MatchFilename
 					usedJSON[jsonRel] = struct{}{}
 					jsonAssignments[jsonRel] = append(jsonAssignments[jsonRel], mediaRel)
 					continue
@@ -132,29 +195,34 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 
 				winner, ok := localCandidateWinner[jsonRel]
 				if !ok || winner != mediaRel {
+					trace.of(mediaRel).addf("lost the claim on %s, searching all folders", jsonRel)
 					unresolvedMedia = append(unresolvedMedia, mediaRel)
 					continue
 				}
 				if _, alreadyUsed := usedJSON[jsonRel]; alreadyUsed {
 					if !canShareJSONWithExistingAssignments(rootPath, mediaRel, jsonRel, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs) {
+						trace.of(mediaRel).addf("%s is already used by %v, searching all folders", jsonRel, jsonAssignments[jsonRel])
 						unresolvedMedia = append(unresolvedMedia, mediaRel)
 						continue
 					}
 				}
 
 				result.Pairs[mediaRel] = jsonRel
+				result.PairSources[mediaRel] = MatchFilename
 				usedJSON[jsonRel] = struct{}{}
 				jsonAssignments[jsonRel] = append(jsonAssignments[jsonRel], mediaRel)
 				continue
 			}
 			if _, alreadyUsed := usedJSON[jsonRel]; alreadyUsed {
 				if !canShareJSONWithExistingAssignments(rootPath, mediaRel, jsonRel, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs) {
+					trace.of(mediaRel).addf("%s is already used by %v, searching all folders", jsonRel, jsonAssignments[jsonRel])
 					unresolvedMedia = append(unresolvedMedia, mediaRel)
 					continue
 				}
 			}
 
 			result.Pairs[mediaRel] = jsonRel
+			result.PairSources[mediaRel] = MatchFilename
 			usedJSON[jsonRel] = struct{}{}
 			jsonAssignments[jsonRel] = append(jsonAssignments[jsonRel], mediaRel)
 		}
@@ -175,9 +243,11 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 	globalCandidateClaims := make(map[string][]string)
 
 	for _, mediaRel := range unresolvedMedia {
+		tr := trace.of(mediaRel)
 		keys := mediaLookupKeys(filepath.Base(mediaRel))
 		candidates := collectGlobalCandidates(keys, globalIndex)
-		candidates = applyGlobalCandidateRules(mediaRel, candidates)
+		tr.addf("all folders, keys %q: candidates %v", keys, candidates)
+		candidates = applyGlobalCandidateRules(mediaRel, candidates, tr)
 		globalCandidatesByMedia[mediaRel] = candidates
 
 		if len(candidates) == 1 {
@@ -193,17 +263,24 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 		if len(claims) <= 1 {
 			continue
 		}
+		tr := trace.among(claims)
+		tr.addf("%s is also claimed by %v", candidate, claims)
 		if canShareJSONAcrossClaims(rootPath, candidate, claims, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs) {
+			tr.addf("claimants are identical files, so they share %s", candidate)
 			globalCandidateShared[candidate] = struct{}{}
 			continue
 		}
 		if winner, ok := uniqueClaimantByJSONTargetExtension(candidate, claims); ok {
+			tr.addf("JSON extension rule: %s wins %s", winner, candidate)
 			globalCandidateWinner[candidate] = winner
 			continue
 		}
 		if winner, ok := uniqueSameDirClaimant(candidate, claims); ok {
+			tr.addf("same folder rule: %s wins %s", winner, candidate)
 			globalCandidateWinner[candidate] = winner
+			continue
 		}
+		tr.addf("no rule picks a claimant of %s", candidate)
 	}
 
 	for _, mediaRel := range unresolvedMedia {
@@ -215,6 +292,7 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 			candidate := candidates[0]
 			if _, ok := globalCandidateShared[candidate]; ok {
 				result.Pairs[mediaRel] = candidate
+				result.PairSources[mediaRel] = MatchFilenameGlobal
 				usedJSON[candidate] = struct{}{}
 				jsonAssignments[candidate] = append(jsonAssignments[candidate], mediaRel)
 				continue
@@ -230,12 +308,14 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 			// this check to avoid double-claiming if future rule changes reintroduce overlaps.
 			if _, alreadyUsed := usedJSON[candidate]; alreadyUsed {
 				if !canShareJSONWithExistingAssignments(rootPath, mediaRel, candidate, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs) {
+					trace.of(mediaRel).addf("%s is already used by %v", candidate, jsonAssignments[candidate])
 					result.AmbiguousJSON[mediaRel] = candidates
 					continue
 				}
 			}
 
 			result.Pairs[mediaRel] = candidate
+			result.PairSources[mediaRel] = MatchFilenameGlobal
 			usedJSON[candidate] = struct{}{}
 			jsonAssignments[candidate] = append(jsonAssignments[candidate], mediaRel)
 		default:
@@ -243,14 +323,22 @@ func ScanTakeout(rootPath string) (MediaScanResult, error) {
 		}
 	}
 
+	resolveByTitle(rootPath, &result, allJSON, usedJSON, jsonAssignments, mediaFingerprintCache, mediaFingerprintErrs, trace)
+	resolveLivePhotos(&result, mediaByDir, trace)
+	markLocalizedEdits(&result)
+	result.MissingJSON = append(result.MissingJSON, result.NoJSON...)
+
 	for _, jsonRel := range allJSON {
 		if _, ok := usedJSON[jsonRel]; !ok {
 			result.UnusedJSON = append(result.UnusedJSON, jsonRel)
 		}
 	}
+	invalidAlbums := resolveAlbums(rootPath, &result, albumJSON, mediaByDir, mediaFingerprintCache, mediaFingerprintErrs)
+	result.UnusedJSON = append(result.UnusedJSON, invalidAlbums...)
 
 	slices.Sort(result.MissingJSON)
 	slices.Sort(result.UnusedJSON)
+	trace.finish(&result)
 
 	return result, nil
 }
@@ -267,8 +355,11 @@ func collectGlobalCandidates(keys []string, globalIndex map[string][]string) []s
 	return slices.Sorted(maps.Keys(unique))
 }
 
-func applyGlobalCandidateRules(mediaRel string, candidates []string) []string {
+func applyGlobalCandidateRules(mediaRel string, candidates []string, trace *Trace) []string {
 	filteredByIndex := filterCandidatesByDuplicateIndex(mediaRel, candidates)
+	if len(filteredByIndex) != len(candidates) {
+		trace.addf("duplicate index rule: %v", filteredByIndex)
+	}
 	if len(filteredByIndex) <= 1 {
 		return filteredByIndex
 	}
@@ -276,6 +367,7 @@ func applyGlobalCandidateRules(mediaRel string, candidates []string) []string {
 
 	sameDir := filterCandidatesBySameDir(mediaRel, candidates)
 	if len(sameDir) == 1 {
+		trace.addf("same folder rule: %v", sameDir)
 		return sameDir
 	}
 
@@ -465,8 +557,8 @@ func mediaLookupKeys(mediaFile string) []string {
 	add(mediaFile)
 	add(removeRandomSuffix(mediaFile))
 
-	if strings.Contains(strings.ToLower(mediaFile), "-edited") {
-		add(strings.Replace(mediaFile, "-edited", "", 1))
+	if unedited, _, ok := cutEditedSuffix(mediaFile); ok {
+		add(unedited)
 	}
 
 	if numberSuffixRe.MatchString(mediaFile) {
@@ -474,11 +566,10 @@ func mediaLookupKeys(mediaFile string) []string {
 		add(strings.Replace(mediaFile, match, "", 1) + match)
 	}
 
-	if len(mediaFile) > 46 {
-		add(mediaFile[:46])
+	for _, name := range truncatedNames(mediaFile) {
+		add(name)
 		if numberSuffixRe.MatchString(mediaFile) {
-			match := numberSuffixRe.FindString(mediaFile)
-			add(mediaFile[:46] + match)
+			add(name + numberSuffixRe.FindString(mediaFile))
 		}
 	}
 
@@ -517,3 +608,23 @@ func isSupportedMediaExtension(ext string) bool {
 		return strings.EqualFold(ext, s)
 	})
 }
+
+// skipWalkDir reports whether a walk of rootPath should not enter the
+// directory at path: the state folder, or one of skip.
+func skipWalkDir(rootPath string, path string, d os.DirEntry, skip []string) bool {
+	if path == rootPath {
+		return false
+	}
+	if d.Name() == StateDirName {
+		return true
+	}
+	return slices.ContainsFunc(skip, func(dir string) bool {
+		return sameDir(dir, path)
+	})
+}
+
+func sameDir(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -407,7 +407,7 @@ func TestApplyGlobalCandidateRules_SameDirFallbackKeepsCandidates(t *testing.T)
 		filepath.Join("C", "IMG_0001.jpg.supplemental-metadata.json"),
 	}
 
-	got := applyGlobalCandidateRules(mediaRel, candidates)
+	got := applyGlobalCandidateRules(mediaRel, candidates, nil)
 	if !reflect.DeepEqual(got, candidates) {
 		t.Fatalf("same-dir fallback mismatch: want %v, got %v", candidates, got)
 	}
@@ -419,7 +419,7 @@ func TestApplyGlobalCandidateRules_SingleExplicitDuplicateIndexCandidateFiltered
 		filepath.Join("B", "IMG_0001(0).jpg.supplemental-metadata.json"),
 	}
 
-	got := applyGlobalCandidateRules(mediaRel, candidates)
+	got := applyGlobalCandidateRules(mediaRel, candidates, nil)
 	if len(got) != 0 {
 		t.Fatalf("expected no candidates after duplicate-index filtering, got %v", got)
 	}
@@ -531,17 +531,15 @@ func TestScanTakeout_LocalSharedSingleJSONPrefersJSONTargetJPG(t *testing.T) {
 	if got := result.Pairs[mediaJPG]; got != jsonRel {
 		t.Fatalf("pair mismatch: want %q, got %q", jsonRel, got)
 	}
-	if _, ok := result.Pairs[mediaMP4]; ok {
-		t.Fatalf("did not expect pair for %q, got %v", mediaMP4, result.Pairs)
+	// The MP4 is the motion half of a Live Photo and shares the still's JSON.
+	if got := result.Pairs[mediaMP4]; got != jsonRel || result.PairSources[mediaMP4] != MatchLivePhoto {
+		t.Fatalf("expected live photo pair %q -> %q, got %q (%s)", mediaMP4, jsonRel, got, result.PairSources[mediaMP4])
 	}
 	if len(result.MissingJSON) != 0 {
 		t.Fatalf("expected no missing json, got %v", result.MissingJSON)
 	}
-	wantAmbiguous := map[string][]string{
-		mediaMP4: []string{jsonRel},
-	}
-	if !reflect.DeepEqual(result.AmbiguousJSON, wantAmbiguous) {
-		t.Fatalf("ambiguous mismatch: want %v, got %v", wantAmbiguous, result.AmbiguousJSON)
+	if len(result.AmbiguousJSON) != 0 {
+		t.Fatalf("expected no ambiguous json, got %v", result.AmbiguousJSON)
 	}
 	if len(result.UnusedJSON) != 0 {
 		t.Fatalf("expected no unused json, got %v", result.UnusedJSON)
@@ -623,17 +621,15 @@ func TestScanTakeout_LocalSharedSingleJSONPrefersJSONTargetWithDuplicateIndex(t
 	if got := result.Pairs[mediaJPG]; got != jsonRel {
 		t.Fatalf("pair mismatch: want %q, got %q", jsonRel, got)
 	}
-	if _, ok := result.Pairs[mediaMP4]; ok {
-		t.Fatalf("did not expect pair for %q, got %v", mediaMP4, result.Pairs)
+	// The MP4 is the motion half of a Live Photo and shares the still's JSON.
+	if got := result.Pairs[mediaMP4]; got != jsonRel || result.PairSources[mediaMP4] != MatchLivePhoto {
+		t.Fatalf("expected live photo pair %q -> %q, got %q (%s)", mediaMP4, jsonRel, got, result.PairSources[mediaMP4])
 	}
 	if len(result.MissingJSON) != 0 {
 		t.Fatalf("expected no missing json, got %v", result.MissingJSON)
 	}
-	wantAmbiguous := map[string][]string{
-		mediaMP4: []string{jsonRel},
-	}
-	if !reflect.DeepEqual(result.AmbiguousJSON, wantAmbiguous) {
-		t.Fatalf("ambiguous mismatch: want %v, got %v", wantAmbiguous, result.AmbiguousJSON)
+	if len(result.AmbiguousJSON) != 0 {
+		t.Fatalf("expected no ambiguous json, got %v", result.AmbiguousJSON)
 	}
 	if len(result.UnusedJSON) != 0 {
 		t.Fatalf("expected no unused json, got %v", result.UnusedJSON)
@@ -838,3 +834,49 @@ func TestScanTakeout_DuplicateMediaSingleGlobalJSONIsAmbiguous(t *testing.T) {
 		t.Fatalf("unused mismatch: want %v, got %v", []string{jsonRel}, result.UnusedJSON)
 	}
 }
+
+func BenchmarkScanTakeout50k(b *testing.B) {
+	root := b.TempDir()
+	dir := filepath.Join(root, "Takeout", "Google Photos", "Photos from 2021")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		b.Fatalf("mkdir: %v", err)
+	}
+	mediaFiles, jsonFiles := benchmarkFolder(50_000)
+	for _, names := range []map[string]struct{}{mediaFiles, jsonFiles} {
+		for name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				b.Fatalf("write %s: %v", name, err)
+			}
+		}
+	}
+
+	for b.Loop() {
+		if _, err := ScanTakeout(root); err != nil {
+			b.Fatalf("ScanTakeout error: %v", err)
+		}
+	}
+}
+
+func TestScanTakeoutSkipsStateDir(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.jpg", "a.jpg.json", ".takeoutfix/backup/b.jpg", ".takeoutfix/pairs.json"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Pairs, map[string]string{"a.jpg": "a.jpg.json"}) {
+		t.Fatalf("pairs mismatch: got %v", result.Pairs)
+	}
+	if len(result.MissingJSON) != 0 || len(result.UnusedJSON) != 0 {
+		t.Fatalf("state files must not be scanned: missing %v, unused %v", result.MissingJSON, result.UnusedJSON)
+	}
+}
@@ -21,40 +21,107 @@ var trailingNumberSuffixRe = regexp.MustCompile(`\(\d+\)$`)
 var duplicateIndexSuffixRe = regexp.MustCompile(`\((\d+)\)$`)
 
 func getJsonFile(mediaFile string, jsonFiles map[string]struct{}, mediaFiles map[string]struct{}) (string, error) {
-	if jsonFile, ok := findJSONByStemForMedia(mediaFile, mediaFile, jsonFiles); ok {
+	return newJSONIndex(jsonFiles).lookup(mediaFile, mediaFiles, nil)
+}
+
+// jsonIndex holds the JSON files of one folder keyed by every name form
+// lookup tries, so pairing a folder takes time linear in its size.
+type jsonIndex struct {
+	// canonical maps canonicalizeJSONNameForMatch names to a JSON file.
+	// When several files share a name, the first in sort order is kept.
+	canonical map[string]string
+	// supplemental maps a lowercase media name stem to the sidecars named
+	// "<stem>.supplemental-metadata.json", also truncated or with "(n)".
+	supplemental map[string][]string
+	// keys and randomKeys map normalized name keys, the latter with random
+	// suffixes stripped, to JSON files.
+	keys       map[string][]string
+	randomKeys map[string][]string
+	// duplicateIndex caches the "(n)" index of each JSON file.
+	duplicateIndex map[string]duplicateIndexInfo
+}
+
+type duplicateIndexInfo struct {
+	index    int
+	explicit bool
+}
+
+// newJSONIndex indexes jsonFiles. Lists in the index are in sort order.
+func newJSONIndex(jsonFiles map[string]struct{}) *jsonIndex {
+	idx := &jsonIndex{
+		canonical:      make(map[string]string, len(jsonFiles)),
+		supplemental:   make(map[string][]string),
+		keys:           make(map[string][]string, len(jsonFiles)),
+		randomKeys:     make(map[string][]string, len(jsonFiles)),
+		duplicateIndex: make(map[string]duplicateIndexInfo, len(jsonFiles)),
+	}
+	for _, jsonFile := range slices.Sorted(maps.Keys(jsonFiles)) {
+		if name := canonicalizeJSONNameForMatch(jsonFile); idx.canonical[name] == "" {
+			idx.canonical[name] = jsonFile
+		}
+
+		if lower := foldName(jsonFile); strings.HasSuffix(lower, ".json") {
+			base := canonicalizeJSONStem(strings.TrimSuffix(lower, ".json"))
+			base = trailingNumberSuffixRe.ReplaceAllString(base, "")
+			// ".supplemental-metadata" has a single dot, so a supplemental
+			// suffix always starts at the last dot of the name.
+			if dot := strings.LastIndexByte(base, '.'); dot >= 0 && isSupplementalPrefix(base[dot:]) {
+				idx.supplemental[base[:dot]] = append(idx.supplemental[base[:dot]], jsonFile)
+			}
+		}
+
+		if key := normalizeJSONKeyWithOptions(jsonFile, false); key != "" {
+			idx.keys[key] = append(idx.keys[key], jsonFile)
+		}
+		if key := normalizeJSONKeyWithOptions(jsonFile, true); key != "" {
+			idx.randomKeys[key] = append(idx.randomKeys[key], jsonFile)
+		}
+
+		index, explicit := extractJSONDuplicateIndexInfo(jsonFile)
+		idx.duplicateIndex[jsonFile] = duplicateIndexInfo{index: index, explicit: explicit}
+	}
+	return idx
+}
+
+// lookup finds the JSON of mediaFile, trying the sidecar names Takeout
+// produces from the most to the least exact. mediaFiles are the media in
+// the same folder. Every name tried is recorded in trace.
+func (idx *jsonIndex) lookup(mediaFile string, mediaFiles map[string]struct{}, trace *Trace) (string, error) {
+	if jsonFile, ok := idx.findByStem(mediaFile, mediaFile, trace); ok {
 		return jsonFile, nil
 	}
 
 	baseMediaFile := strings.TrimSuffix(mediaFile, filepath.Ext(mediaFile))
-	if jsonFile, ok := findJSONByStemForMedia(mediaFile, baseMediaFile, jsonFiles); ok {
+	if jsonFile, ok := idx.findByStem(mediaFile, baseMediaFile, trace); ok {
 		return jsonFile, nil
 	}
 
-	if strings.Contains(mediaFile, "-edited") {
-		return getJsonFile(strings.Replace(mediaFile, "-edited", "", 1), jsonFiles, mediaFiles)
+	if unedited, edited, ok := cutEditedSuffix(mediaFile); ok {
+		trace.addf("retry as %s without %q", unedited, edited.suffix)
+		return idx.lookup(unedited, mediaFiles, trace)
 	}
 
 	if numberSuffixRe.MatchString(mediaFile) {
 		match := numberSuffixRe.FindString(mediaFile)
 		jsonStem := strings.Replace(mediaFile, match, "", 1) + match
-		jsonFile, ok := findJSONByStemForMedia(mediaFile, jsonStem, jsonFiles)
+		jsonFile, ok := idx.findByStem(mediaFile, jsonStem, trace)
 		if ok {
 			return jsonFile, nil
 		}
 	}
 
-	if len(mediaFile) > 46 && numberSuffixRe.MatchString(mediaFile) {
+	truncated := truncatedNames(mediaFile)
+	if len(truncated) > 0 && numberSuffixRe.MatchString(mediaFile) {
 		match := numberSuffixRe.FindString(mediaFile)
-		jsonStem := mediaFile[:46] + match
-		jsonFile, ok := findJSONByStemForMedia(mediaFile, jsonStem, jsonFiles)
-		if ok {
-			return jsonFile, nil
+		for _, name := range truncated {
+			if jsonFile, ok := idx.findByStem(mediaFile, name+match, trace); ok {
+				return jsonFile, nil
+			}
 		}
 	}
 
-	if len(mediaFile) > 46 {
-		jsonFile, ok := findJSONByStemForMedia(mediaFile, mediaFile[:46], jsonFiles)
-		if ok {
+	for _, name := range truncated {
+		if jsonFile, ok := idx.findByStem(mediaFile, name, trace); ok {
 			return jsonFile, nil
 		}
 	}
@@ -65,23 +132,24 @@ func getJsonFile(mediaFile string, jsonFiles map[string]struct{}, mediaFiles map
 		extensions := [...]string{".jpg", ".jpeg", ".heic"}
 		for _, ext := range extensions {
 			jsonStem := baseMediaFile + ext
-			jsonFile, ok := findJSONByStemForMedia(mediaFile, jsonStem, jsonFiles)
+			jsonFile, ok := idx.findByStem(mediaFile, jsonStem, trace)
 			if ok {
 				return jsonFile, nil
 			}
-			jsonFileUpper, ok := findJSONByStemForMedia(mediaFile, baseMediaFile+strings.ToUpper(ext), jsonFiles)
+			jsonFileUpper, ok := idx.findByStem(mediaFile, baseMediaFile+strings.ToUpper(ext), trace)
 			if ok {
 				return jsonFileUpper, nil
 			}
 		}
 	}
 
-	if jsonFile, ok := findJSONByBasenameForMedia(mediaFile, jsonFiles, false); ok {
+	if jsonFile, ok := idx.findByBasename(mediaFile, false, trace); ok {
 		return jsonFile, nil
 	}
 
 	if shouldUseRandomSuffixFallback(mediaFile, mediaFiles) {
-		if jsonFile, ok := findJSONByBasenameForMedia(mediaFile, jsonFiles, true); ok {
+		trace.addf("%s exists, so a random suffix may have been added", removeRandomSuffix(mediaFile))
+		if jsonFile, ok := idx.findByBasename(mediaFile, true, trace); ok {
 			return jsonFile, nil
 		}
 	}
@@ -89,87 +157,63 @@ func getJsonFile(mediaFile string, jsonFiles map[string]struct{}, mediaFiles map
 	return "", fmt.Errorf("json file not found for %s", mediaFile)
 }
 
-func findJSONByStemForMedia(mediaFile string, stem string, jsonFiles map[string]struct{}) (string, bool) {
-	if jsonFile, ok := findJSONCaseInsensitive(stem+".json", jsonFiles); ok {
+func (idx *jsonIndex) findByStem(mediaFile string, stem string, trace *Trace) (string, bool) {
+	if jsonFile, ok := idx.canonical[canonicalizeJSONNameForMatch(stem+".json")]; ok {
+		trace.addf("%s.json: found %s", stem, jsonFile)
 		return jsonFile, true
 	}
 
-	candidates := findSupplementalJSONByStem(stem, jsonFiles)
-	candidates = filterCandidatesByDuplicateIndex(mediaFile, candidates)
+	all := idx.supplemental[foldName(stem)]
+	candidates := idx.filterByDuplicateIndex(mediaFile, all)
+	if len(all) == 0 {
+		trace.addf("%s.json: not found, no supplemental-metadata sidecar", stem)
+	} else {
+		trace.addf("%s.json: not found, supplemental-metadata sidecars %v, %v after the duplicate index filter", stem, all, candidates)
+	}
 	if len(candidates) != 1 {
 		return "", false
 	}
 	return candidates[0], true
 }
 
-func findSupplementalJSONByStem(stem string, jsonFiles map[string]struct{}) []string {
-	lowerStem := strings.ToLower(stem)
-	unique := make(map[string]struct{})
-	for jsonFile := range jsonFiles {
-		lower := strings.ToLower(jsonFile)
-		if !strings.HasSuffix(lower, ".json") {
-			continue
-		}
-		base := strings.TrimSuffix(lower, ".json")
-		base = canonicalizeJSONStem(base)
-		base = trailingNumberSuffixRe.ReplaceAllString(base, "")
-		if !strings.HasPrefix(base, lowerStem+".") {
-			continue
-		}
-		suffix := base[len(lowerStem):]
-		if isSupplementalPrefix(suffix) {
-			unique[jsonFile] = struct{}{}
-		}
-	}
-
-	return slices.Sorted(maps.Keys(unique))
-}
-
-func findJSONCaseInsensitive(name string, jsonFiles map[string]struct{}) (string, bool) {
-	target := canonicalizeJSONNameForMatch(name)
-	for jsonFile := range jsonFiles {
-		if canonicalizeJSONNameForMatch(jsonFile) == target {
-			return jsonFile, true
-		}
+func (idx *jsonIndex) findByBasename(mediaFile string, stripRandomSuffix bool, trace *Trace) (string, bool) {
+	keys := idx.keys
+	if stripRandomSuffix {
+		keys = idx.randomKeys
 	}
-	return "", false
-}
-
-func findJSONByBasenameForMedia(mediaFile string, jsonFiles map[string]struct{}, stripRandomSuffix bool) (string, bool) {
-	matches := findJSONCandidatesByBasename(mediaFile, jsonFiles, stripRandomSuffix)
-	matches = filterCandidatesByDuplicateIndex(mediaFile, matches)
+	key := normalizeMediaLookupKeyWithOptions(mediaFile, stripRandomSuffix)
+	all := keys[key]
+	matches := idx.filterByDuplicateIndex(mediaFile, all)
+	trace.addf("normalized name %q: candidates %v, %v after the duplicate index filter", key, all, matches)
 	if len(matches) != 1 {
 		return "", false
 	}
 	return matches[0], true
 }
 
-func findJSONCandidatesByBasename(mediaFile string, jsonFiles map[string]struct{}, stripRandomSuffix bool) []string {
-	mediaKey := normalizeMediaLookupKeyWithOptions(mediaFile, stripRandomSuffix)
-	var matches []string
-
-	for jsonFile := range jsonFiles {
-		jsonKey := normalizeJSONKeyWithOptions(jsonFile, stripRandomSuffix)
-		if jsonKey == "" {
-			continue
-		}
-		if jsonKey == mediaKey {
-			matches = append(matches, jsonFile)
-		}
-	}
-	slices.Sort(matches)
-	return matches
+func (idx *jsonIndex) filterByDuplicateIndex(mediaFile string, candidates []string) []string {
+	return filterByDuplicateIndex(mediaFile, candidates, func(jsonFile string) (int, bool) {
+		info := idx.duplicateIndex[jsonFile]
+		return info.index, info.explicit
+	})
 }
 
 func filterCandidatesByDuplicateIndex(mediaFile string, candidates []string) []string {
+	return filterByDuplicateIndex(mediaFile, candidates, extractJSONDuplicateIndexInfo)
+}
+
+// filterByDuplicateIndex keeps the candidates whose "(n)" duplicate index,
+// as reported by indexOf, matches the one of mediaFile. The result is
+// sorted.
+func filterByDuplicateIndex(mediaFile string, candidates []string, indexOf func(string) (int, bool)) []string {
 	if len(candidates) == 0 {
-		return candidates
+		return nil
 	}
 
 	mediaIndex, mediaHasExplicitIndex := extractMediaDuplicateIndexInfo(mediaFile)
 	filtered := make([]string, 0, len(candidates))
 	for _, candidate := range candidates {
-		jsonIndex, jsonHasExplicitIndex := extractJSONDuplicateIndexInfo(candidate)
+		jsonIndex, jsonHasExplicitIndex := indexOf(candidate)
 		switch {
 		case mediaHasExplicitIndex:
 			// Duplicate media (including "(0)") must match the same explicit
@@ -238,7 +282,7 @@ func normalizeJSONKey(jsonFile string) string {
 }
 
 func normalizeJSONKeyWithOptions(jsonFile string, stripRandomSuffix bool) string {
-	name := strings.ToLower(jsonFile)
+	name := foldName(jsonFile)
 	if !strings.HasSuffix(name, ".json") {
 		return ""
 	}
@@ -254,7 +298,7 @@ func canonicalizeJSONStem(stem string) string {
 }
 
 func canonicalizeJSONNameForMatch(name string) string {
-	lower := strings.ToLower(name)
+	lower := foldName(name)
 	if !strings.HasSuffix(lower, ".json") {
 		return lower
 	}
@@ -286,7 +330,7 @@ func normalizeMediaLookupKey(mediaFile string) string {
 }
 
 func normalizeMediaLookupKeyWithOptions(mediaFile string, stripRandomSuffix bool) string {
-	name := strings.ToLower(mediaFile)
+	name := foldName(mediaFile)
 	ext := filepath.Ext(name)
 	if ext != "" {
 		name = strings.TrimSuffix(name, ext)
@@ -295,7 +339,7 @@ func normalizeMediaLookupKeyWithOptions(mediaFile string, stripRandomSuffix bool
 }
 
 func normalizeNameKeyWithOptions(name string, stripRandomSuffix bool) string {
-	name = strings.Replace(name, "-edited", "", 1)
+	name, _, _ = cutEditedSuffix(name)
 	if stripRandomSuffix {
 		name = randomSuffixRe.ReplaceAllString(name, "")
 	}
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -301,3 +302,44 @@ func TestGetJsonFile(t *testing.T) {
 		})
 	}
 }
+
+// benchmarkFolder returns the media and JSON names of one Takeout folder
+// with n files, using the sidecar naming variants Takeout produces. A fifth
+// of the media have no JSON, so every lookup fallback is exercised.
+func benchmarkFolder(n int) (map[string]struct{}, map[string]struct{}) {
+	mediaFiles := make(map[string]struct{}, n/2)
+	jsonFiles := make(map[string]struct{}, n/2)
+	for i := range n / 2 {
+		var media, jsonFile string
+		switch i % 5 {
+		case 0:
+			media = fmt.Sprintf("IMG_%06d.jpg", i)
+			jsonFile = media + ".supplemental-metadata.json"
+		case 1:
+			media = fmt.Sprintf("PXL_20210101_%09d.MP.mp4", i)
+			jsonFile = media + ".supp.json"
+		case 2:
+			media = fmt.Sprintf("IMG_%06d(1).jpg", i)
+			jsonFile = fmt.Sprintf("IMG_%06d.jpg.supplemental-metadata(1).json", i)
+		case 3:
+			media = fmt.Sprintf("Screenshot_%06d.png", i)
+			jsonFile = media + ".json"
+		default:
+			media = fmt.Sprintf("VID_%06d.mp4", i)
+			jsonFile = fmt.Sprintf("orphan_%06d.json", i)
+		}
+		mediaFiles[media] = struct{}{}
+		jsonFiles[jsonFile] = struct{}{}
+	}
+	return mediaFiles, jsonFiles
+}
+
+func BenchmarkJSONIndexLookup50k(b *testing.B) {
+	mediaFiles, jsonFiles := benchmarkFolder(50_000)
+	for b.Loop() {
+		index := newJSONIndex(jsonFiles)
+		for mediaFile := range mediaFiles {
+			_, _ = index.lookup(mediaFile, mediaFiles, nil)
+		}
+	}
+}
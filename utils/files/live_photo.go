@@ -0,0 +1,69 @@
+package files
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MatchLivePhoto pairs the video half of a Live Photo or motion photo with
+// the JSON of its still image.
+const MatchLivePhoto MatchStrategy = "live_photo"
+
+var (
+	livePhotoStillExts = []string{".heic", ".heif", ".jpg", ".jpeg"}
+	livePhotoVideoExts = []string{".mp4", ".mov"}
+)
+
+// resolveLivePhotos links Live Photo and motion photo halves: a still and a
+// video in the same folder with the same name stem, such as IMG_1234.HEIC and
+// IMG_1234.MP4. The video gets the still's JSON unless it already has a JSON
+// of its own, so both halves receive the same dates and GPS. Stems shared by
+// more than one still or video are left alone.
+func resolveLivePhotos(result *MediaScanResult, mediaByDir map[string][]string, trace *Trace) {
+	linked := make(map[string]struct{})
+	for _, dir := range sortedDirs(mediaByDir) {
+		stills := make(map[string][]string)
+		videos := make(map[string][]string)
+		for _, name := range mediaByDir[dir] {
+			ext := strings.ToLower(filepath.Ext(name))
+			stem := foldName(strings.TrimSuffix(name, filepath.Ext(name)))
+			switch {
+			case slices.Contains(livePhotoStillExts, ext):
+				stills[stem] = append(stills[stem], name)
+			case slices.Contains(livePhotoVideoExts, ext):
+				videos[stem] = append(videos[stem], name)
+			}
+		}
+
+		for stem, videoNames := range videos {
+			stillNames := stills[stem]
+			if len(videoNames) != 1 || len(stillNames) != 1 {
+				continue
+			}
+			videoRel := joinRelPath(dir, videoNames[0])
+			stillRel := joinRelPath(dir, stillNames[0])
+			result.LivePhotos[videoRel] = stillRel
+			if _, noJSON := slices.BinarySearch(result.NoJSON, videoRel); noJSON {
+				continue
+			}
+			trace.among([]string{videoRel, stillRel}).addf("Live Photo: %s is the video of %s", videoRel, stillRel)
+
+			stillJSON, ok := result.Pairs[stillRel]
+			if !ok {
+				continue
+			}
+			if videoJSON, paired := result.Pairs[videoRel]; paired && videoJSON != stillJSON {
+				continue
+			}
+			result.Pairs[videoRel] = stillJSON
+			result.PairSources[videoRel] = MatchLivePhoto
+			linked[videoRel] = struct{}{}
+			delete(result.AmbiguousJSON, videoRel)
+		}
+	}
+	result.MissingJSON = slices.DeleteFunc(result.MissingJSON, func(rel string) bool {
+		_, ok := linked[rel]
+		return ok
+	})
+}
@@ -0,0 +1,45 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanTakeoutPairsLivePhotoHalves(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"IMG_1234.HEIC", "IMG_1234.HEIC.json", "IMG_1234.MP4",
+		"PXL_20210101_101010.MP.jpg", "PXL_20210101_101010.MP.jpg.json", "PXL_20210101_101010.MP.mp4",
+		"clip.mp4",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+
+	wantLive := map[string]string{
+		"IMG_1234.MP4":               "IMG_1234.HEIC",
+		"PXL_20210101_101010.MP.mp4": "PXL_20210101_101010.MP.jpg",
+	}
+	if !reflect.DeepEqual(result.LivePhotos, wantLive) {
+		t.Fatalf("live photos mismatch: got %v", result.LivePhotos)
+	}
+	for video, still := range wantLive {
+		if result.Pairs[video] != result.Pairs[still] || result.Pairs[video] == "" {
+			t.Fatalf("%s should share the JSON of %s, got %q and %q", video, still, result.Pairs[video], result.Pairs[still])
+		}
+		if result.PairSources[video] != MatchLivePhoto {
+			t.Fatalf("%s strategy: got %q", video, result.PairSources[video])
+		}
+	}
+	if !reflect.DeepEqual(result.MissingJSON, []string{"clip.mp4"}) {
+		t.Fatalf("missing json mismatch: got %v", result.MissingJSON)
+	}
+}
@@ -0,0 +1,144 @@
+package files
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MatchStrategy names the matching pass that paired a media file with its JSON.
+type MatchStrategy string
+
+const (
+	// MatchFilename pairs by sidecar name in the media folder.
+	MatchFilename MatchStrategy = "filename"
+	// MatchFilenameGlobal pairs by sidecar name across folders.
+	MatchFilenameGlobal MatchStrategy = "filename_global"
+	// MatchTitle pairs by the original filename stored in the JSON title field.
+	MatchTitle MatchStrategy = "title"
+)
+
+type jsonTitle struct {
+	Title string `json:"title"`
+}
+
+// resolveByTitle pairs media that filename heuristics left missing or
+// ambiguous with JSON files nobody claimed, using the title field every
+// Takeout sidecar carries.
+func resolveByTitle(
+	rootPath string,
+	result *MediaScanResult,
+	allJSON []string,
+	usedJSON map[string]struct{},
+	jsonAssignments map[string][]string,
+	cache map[string]mediaFingerprint,
+	errCache map[string]error,
+	trace *Trace,
+) {
+	unresolved := slices.Clone(result.MissingJSON)
+	for mediaRel := range result.AmbiguousJSON {
+		unresolved = append(unresolved, mediaRel)
+	}
+	if len(unresolved) == 0 {
+		return
+	}
+
+	titleIndex := make(map[string][]string)
+	for _, jsonRel := range allJSON {
+		if _, ok := usedJSON[jsonRel]; ok {
+			continue
+		}
+		title, ok := readJSONTitle(filepath.Join(rootPath, jsonRel))
+		if !ok {
+			continue
+		}
+		key := foldName(title)
+		titleIndex[key] = append(titleIndex[key], jsonRel)
+	}
+	if len(titleIndex) == 0 {
+		return
+	}
+
+	slices.Sort(unresolved)
+	claims := make(map[string][]string)
+	for _, mediaRel := range unresolved {
+		tr := trace.of(mediaRel)
+		keys := titleLookupKeys(filepath.Base(mediaRel))
+		candidates := collectGlobalCandidates(keys, titleIndex)
+		tr.addf("unused JSON titles %q: candidates %v", keys, candidates)
+		candidates = applyGlobalCandidateRules(mediaRel, candidates, tr)
+		if len(candidates) == 1 {
+			claims[candidates[0]] = append(claims[candidates[0]], mediaRel)
+		}
+	}
+
+	resolved := make(map[string]struct{})
+	for _, jsonRel := range slices.Sorted(maps.Keys(claims)) {
+		mediaClaims := claims[jsonRel]
+		winners := mediaClaims
+		if len(mediaClaims) > 1 && !canShareJSONAcrossClaims(rootPath, jsonRel, mediaClaims, jsonAssignments, cache, errCache) {
+			tr := trace.among(mediaClaims)
+			tr.addf("title of %s is also claimed by %v", jsonRel, mediaClaims)
+			winner, ok := uniqueSameDirClaimant(jsonRel, mediaClaims)
+			if !ok {
+				tr.addf("no rule picks a claimant of %s", jsonRel)
+				continue
+			}
+			tr.addf("same folder rule: %s wins %s", winner, jsonRel)
+			winners = []string{winner}
+		}
+		for _, mediaRel := range winners {
+			result.Pairs[mediaRel] = jsonRel
+			result.PairSources[mediaRel] = MatchTitle
+			jsonAssignments[jsonRel] = append(jsonAssignments[jsonRel], mediaRel)
+			delete(result.AmbiguousJSON, mediaRel)
+			resolved[mediaRel] = struct{}{}
+		}
+		usedJSON[jsonRel] = struct{}{}
+	}
+
+	result.MissingJSON = slices.DeleteFunc(result.MissingJSON, func(mediaRel string) bool {
+		_, ok := resolved[mediaRel]
+		return ok
+	})
+}
+
+// titleLookupKeys lists the titles a media file may have been exported from:
+// its own name, the name without an edited suffix and without a "(n)"
+// duplicate index.
+func titleLookupKeys(mediaFile string) []string {
+	name := foldName(mediaFile)
+	keys := []string{name}
+	if unedited, _, ok := cutEditedSuffix(name); ok {
+		keys = append(keys, unedited)
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if trailingNumberSuffixRe.MatchString(stem) {
+		keys = append(keys, trailingNumberSuffixRe.ReplaceAllString(stem, "")+ext)
+	}
+	return keys
+}
+
+func readJSONTitle(path string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var meta jsonTitle
+	if err := json.NewDecoder(file).Decode(&meta); err != nil {
+		return "", false
+	}
+	title := strings.TrimSpace(meta.Title)
+	if title == "" || strings.ContainsAny(title, `/\`) {
+		return "", false
+	}
+	return title, true
+}
@@ -0,0 +1,103 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTitleFixture(t *testing.T, root string, name string, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestScanTakeout_TitleMatchResolvesMissingJSON(t *testing.T) {
+	root := t.TempDir()
+	writeTitleFixture(t, root, "album/Holiday at the beach.jpg", "x")
+	writeTitleFixture(t, root, "album/renamed-by-export.json", `{"title":"Holiday at the beach.jpg"}`)
+	writeTitleFixture(t, root, "album/a.jpg", "x")
+	writeTitleFixture(t, root, "album/a.jpg.json", `{"title":"a.jpg"}`)
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+
+	want := map[string]string{
+		filepath.Join("album", "Holiday at the beach.jpg"): filepath.Join("album", "renamed-by-export.json"),
+		filepath.Join("album", "a.jpg"):                    filepath.Join("album", "a.jpg.json"),
+	}
+	if !reflect.DeepEqual(result.Pairs, want) {
+		t.Fatalf("pairs mismatch: got %v", result.Pairs)
+	}
+	wantSources := map[string]MatchStrategy{
+		filepath.Join("album", "Holiday at the beach.jpg"): MatchTitle,
+		filepath.Join("album", "a.jpg"):                    MatchFilename,
+	}
+	if !reflect.DeepEqual(result.PairSources, wantSources) {
+		t.Fatalf("pair sources mismatch: got %v", result.PairSources)
+	}
+	if len(result.MissingJSON) != 0 || len(result.UnusedJSON) != 0 {
+		t.Fatalf("expected no missing or unused json, got missing=%v unused=%v", result.MissingJSON, result.UnusedJSON)
+	}
+}
+
+func TestScanTakeout_TitleMatchResolvesAmbiguousJSON(t *testing.T) {
+	root := t.TempDir()
+	writeTitleFixture(t, root, "media/photo.jpg", "x")
+	writeTitleFixture(t, root, "meta1/photo.jpg.json", `{"title":"other.jpg"}`)
+	writeTitleFixture(t, root, "meta2/photo.jpg.json", `{"title":"photo.jpg"}`)
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+
+	mediaRel := filepath.Join("media", "photo.jpg")
+	if got, want := result.Pairs[mediaRel], filepath.Join("meta2", "photo.jpg.json"); got != want {
+		t.Fatalf("pair mismatch: want %q, got %q", want, got)
+	}
+	if result.PairSources[mediaRel] != MatchTitle {
+		t.Fatalf("pair source: want %q, got %q", MatchTitle, result.PairSources[mediaRel])
+	}
+	if len(result.AmbiguousJSON) != 0 {
+		t.Fatalf("expected no ambiguous media, got %v", result.AmbiguousJSON)
+	}
+	if !reflect.DeepEqual(result.UnusedJSON, []string{filepath.Join("meta1", "photo.jpg.json")}) {
+		t.Fatalf("unused json mismatch: got %v", result.UnusedJSON)
+	}
+}
+
+func TestScanTakeout_TitleMatchKeepsDuplicateTitlesUnresolved(t *testing.T) {
+	root := t.TempDir()
+	writeTitleFixture(t, root, "IMG_0001.jpg", "x")
+	writeTitleFixture(t, root, "first.json", `{"title":"IMG_0001.jpg"}`)
+	writeTitleFixture(t, root, "second.json", `{"title":"IMG_0001.jpg"}`)
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.MissingJSON, []string{"IMG_0001.jpg"}) {
+		t.Fatalf("missing json mismatch: got %v", result.MissingJSON)
+	}
+	if len(result.Pairs) != 0 {
+		t.Fatalf("expected no pairs, got %v", result.Pairs)
+	}
+}
+
+func TestTitleLookupKeys(t *testing.T) {
+	got := titleLookupKeys("IMG_0001-edited(2).JPG")
+	want := []string{"img_0001-edited(2).jpg", "img_0001(2).jpg", "img_0001-edited.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("titleLookupKeys mismatch: want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,181 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// MatchOverride pairs media with the JSON chosen in the overrides file.
+const MatchOverride MatchStrategy = "override"
+
+// Overrides maps media paths, relative to the scanned root, to the JSON they
+// must be paired with. An empty JSON path marks media that has no JSON.
+type Overrides map[string]string
+
+// overridesFile is the JSON layout of the overrides file. Paths use "/".
+type overridesFile struct {
+	Pairs []overrideEntry `json:"pairs"`
+}
+
+type overrideEntry struct {
+	Media string `json:"media"`
+	// JSON is the sidecar to pair Media with. Entries with neither JSON
+	// nor NoJSON set are undecided and ignored.
+	JSON   string `json:"json"`
+	NoJSON bool   `json:"no_json"`
+	// Candidates lists the sidecars the scan could not choose between. It
+	// only helps editing the file.
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// LoadOverrides reads the overrides file at path. A missing file has no
+// overrides.
+func LoadOverrides(path string) (Overrides, error) {
+	file, err := readOverridesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(Overrides, len(file.Pairs))
+	for _, entry := range file.Pairs {
+		media := filepath.Clean(filepath.FromSlash(entry.Media))
+		if entry.Media == "" || filepath.IsAbs(media) {
+			return nil, fmt.Errorf("parse overrides: media %q must be a path relative to the processed folder", entry.Media)
+		}
+		if entry.JSON != "" && entry.NoJSON {
+			return nil, fmt.Errorf("parse overrides: %s has both a json and no_json", entry.Media)
+		}
+		if entry.JSON == "" && !entry.NoJSON {
+			continue
+		}
+		if _, ok := overrides[media]; ok {
+			return nil, fmt.Errorf("parse overrides: %s is listed twice", entry.Media)
+		}
+		overrides[media] = ""
+		if entry.JSON != "" {
+			overrides[media] = filepath.Clean(filepath.FromSlash(entry.JSON))
+		}
+	}
+	return overrides, nil
+}
+
+// WriteOverridesTemplate adds the ambiguous and missing media of result to
+// the overrides file at path as undecided entries, with the candidates of
+// ambiguous media. Entries already in the file are kept as they are. It
+// returns the number of entries added.
+func WriteOverridesTemplate(path string, result MediaScanResult) (int, error) {
+	file, err := readOverridesFile(path)
+	if err != nil {
+		return 0, err
+	}
+	listed := make(map[string]struct{}, len(file.Pairs))
+	for _, entry := range file.Pairs {
+		listed[filepath.Clean(filepath.FromSlash(entry.Media))] = struct{}{}
+	}
+
+	var added []overrideEntry
+	for _, media := range slices.Sorted(maps.Keys(result.AmbiguousJSON)) {
+		if _, ok := listed[media]; ok {
+			continue
+		}
+		candidates := make([]string, 0, len(result.AmbiguousJSON[media]))
+		for _, candidate := range result.AmbiguousJSON[media] {
+			candidates = append(candidates, filepath.ToSlash(candidate))
+		}
+		added = append(added, overrideEntry{Media: filepath.ToSlash(media), Candidates: candidates})
+	}
+	for _, media := range result.MissingJSON {
+		if _, ok := listed[media]; ok {
+			continue
+		}
+		added = append(added, overrideEntry{Media: filepath.ToSlash(media)})
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	file.Pairs = append(file.Pairs, added...)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("marshal overrides: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("mkdir overrides dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return 0, fmt.Errorf("write overrides: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("write overrides: %w", err)
+	}
+	return len(added), nil
+}
+
+func readOverridesFile(path string) (overridesFile, error) {
+	var file overridesFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return file, nil
+		}
+		return file, fmt.Errorf("read overrides: %w", err)
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("parse overrides: %w", err)
+	}
+	return file, nil
+}
+
+// applyOverrides pairs the media of overrides before any matching pass and
+// returns the media it settled. Media marked as having no JSON are recorded
+// in result.NoJSON. Overrides naming a media or JSON the scan did not find
+// are listed in result.InvalidOverrides and leave the media to the passes.
+func applyOverrides(
+	result *MediaScanResult,
+	overrides Overrides,
+	mediaByDir map[string][]string,
+	allJSON []string,
+	usedJSON map[string]struct{},
+	jsonAssignments map[string][]string,
+	trace *Trace,
+) map[string]struct{} {
+	settled := make(map[string]struct{}, len(overrides))
+	for _, mediaRel := range slices.Sorted(maps.Keys(overrides)) {
+		jsonRel := overrides[mediaRel]
+		_, mediaFound := slices.BinarySearch(mediaByDir[filepath.Dir(mediaRel)], filepath.Base(mediaRel))
+		_, jsonFound := slices.BinarySearch(allJSON, jsonRel)
+		if !mediaFound {
+			trace.of(mediaRel).addf("overrides file: the media %s was not found", mediaRel)
+			result.InvalidOverrides = append(result.InvalidOverrides, mediaRel)
+			continue
+		}
+		if jsonRel != "" && !jsonFound {
+			trace.of(mediaRel).addf("overrides file: the JSON %s was not found, matching as usual", jsonRel)
+			result.InvalidOverrides = append(result.InvalidOverrides, mediaRel)
+			continue
+		}
+
+		settled[mediaRel] = struct{}{}
+		tr := trace.of(mediaRel)
+		if tr != nil {
+			tr.Found = true
+		}
+		if jsonRel == "" {
+			tr.addf("overrides file: no JSON")
+			result.NoJSON = append(result.NoJSON, mediaRel)
+			continue
+		}
+		tr.addf("overrides file: paired with %s", jsonRel)
+		result.Pairs[mediaRel] = jsonRel
+		result.PairSources[mediaRel] = MatchOverride
+		usedJSON[jsonRel] = struct{}{}
+		jsonAssignments[jsonRel] = append(jsonAssignments[jsonRel], mediaRel)
+	}
+	return settled
+}
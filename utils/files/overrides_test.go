@@ -0,0 +1,194 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeOverridesTree(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestScanTakeoutWithOverrides_PairsBeforeHeuristics(t *testing.T) {
+	root := t.TempDir()
+	mediaRel := filepath.Join("Photos", "IMG_0001.jpg")
+	jsonA := filepath.Join("Album A", "IMG_0001.jpg.supplemental-metadata.json")
+	jsonB := filepath.Join("Album B", "IMG_0001.jpg.supplemental-metada.json")
+	writeOverridesTree(t, root, mediaRel, jsonA, jsonB, "b.jpg", "b.jpg.json", "c.jpg", "c.heic", "c.mov", "c.heic.json")
+
+	result, err := ScanTakeoutWithOverrides(root, Overrides{
+		mediaRel:   jsonB,
+		"b.jpg":    "",
+		"c.mov":    "",
+		"gone.jpg": "b.jpg.json",
+		"c.jpg":    "missing.json",
+		"x.jpg":    "",
+	})
+	if err != nil {
+		t.Fatalf("ScanTakeoutWithOverrides error: %v", err)
+	}
+
+	if got := result.Pairs[mediaRel]; got != jsonB {
+		t.Fatalf("override pair: want %q, got %q", jsonB, got)
+	}
+	if got := result.PairSources[mediaRel]; got != MatchOverride {
+		t.Fatalf("override source: want %q, got %q", MatchOverride, got)
+	}
+	if _, ok := result.AmbiguousJSON[mediaRel]; ok {
+		t.Fatalf("overridden media must not be ambiguous: %v", result.AmbiguousJSON)
+	}
+	if _, ok := result.Pairs["b.jpg"]; ok {
+		t.Fatalf("media marked as no JSON was paired: %v", result.Pairs)
+	}
+	if _, ok := result.Pairs["c.mov"]; ok {
+		t.Fatalf("Live Photo video marked as no JSON was paired: %v", result.Pairs)
+	}
+	if !slices.Equal(result.NoJSON, []string{"b.jpg", "c.mov"}) {
+		t.Fatalf("no JSON mismatch: got %v", result.NoJSON)
+	}
+	if !slices.Equal(result.MissingJSON, []string{"b.jpg", "c.mov"}) {
+		t.Fatalf("missing mismatch: got %v", result.MissingJSON)
+	}
+	if !slices.Equal(result.InvalidOverrides, []string{"c.jpg", "gone.jpg", "x.jpg"}) {
+		t.Fatalf("invalid overrides mismatch: got %v", result.InvalidOverrides)
+	}
+	if !slices.Equal(result.UnusedJSON, []string{jsonA, "b.jpg.json"}) {
+		t.Fatalf("unused mismatch: got %v", result.UnusedJSON)
+	}
+}
+
+func TestScanTakeoutTrace_RecordsOverrides(t *testing.T) {
+	root := t.TempDir()
+	writeOverridesTree(t, root, "a.jpg", "a.jpg.json")
+
+	trace := Trace{Media: "a.jpg"}
+	if _, err := ScanTakeoutTrace(root, Overrides{"a.jpg": ""}, &trace); err != nil {
+		t.Fatalf("ScanTakeoutTrace error: %v", err)
+	}
+	want := []string{"overrides file: no JSON", "result: no JSON, as set in the overrides file"}
+	if !trace.Found || !slices.Equal(trace.Steps, want) {
+		t.Fatalf("want steps %q, got found=%v steps=%q", want, trace.Found, trace.Steps)
+	}
+}
+
+func TestScanTakeoutTrace_NamesTheMissingSideOfAnOverride(t *testing.T) {
+	root := t.TempDir()
+	writeOverridesTree(t, root, "a.jpg", "a.jpg.json")
+
+	for media, want := range map[string]string{
+		"a.jpg":    "overrides file: the JSON gone.json was not found, matching as usual",
+		"gone.jpg": "overrides file: the media gone.jpg was not found",
+	} {
+		trace := Trace{Media: media}
+		if _, err := ScanTakeoutTrace(root, Overrides{media: "gone.json"}, &trace); err != nil {
+			t.Fatalf("ScanTakeoutTrace error: %v", err)
+		}
+		if len(trace.Steps) == 0 || trace.Steps[0] != want {
+			t.Fatalf("%s: want first step %q, got %q", media, want, trace.Steps)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	if got, err := LoadOverrides(path); err != nil || len(got) != 0 {
+		t.Fatalf("missing file: want no overrides, got %v, %v", got, err)
+	}
+
+	data := `{"pairs": [
+		{"media": "Photos/a.jpg", "json": "Album/a.jpg.json"},
+		{"media": "b.jpg", "no_json": true},
+		{"media": "c.jpg", "json": "", "candidates": ["x.json", "y.json"]}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := LoadOverrides(path)
+	if err != nil {
+		t.Fatalf("LoadOverrides error: %v", err)
+	}
+	want := Overrides{
+		filepath.Join("Photos", "a.jpg"): filepath.Join("Album", "a.jpg.json"),
+		"b.jpg":                          "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	for name, data := range map[string]string{
+		"both":     `{"pairs": [{"media": "a.jpg", "json": "a.json", "no_json": true}]}`,
+		"twice":    `{"pairs": [{"media": "a.jpg", "no_json": true}, {"media": "./a.jpg", "json": "a.json"}]}`,
+		"absolute": `{"pairs": [{"media": "/a.jpg", "no_json": true}]}`,
+		"syntax":   `{"pairs": [`,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := LoadOverrides(path); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteOverridesTemplate_KeepsExistingEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".takeoutfix", "pairs.json")
+	result := MediaScanResult{
+		AmbiguousJSON: map[string][]string{
+			filepath.Join("Photos", "a.jpg"): {filepath.Join("A", "a.json"), filepath.Join("B", "a.json")},
+		},
+		MissingJSON: []string{"b.jpg", "c.jpg"},
+	}
+
+	added, err := WriteOverridesTemplate(path, result)
+	if err != nil {
+		t.Fatalf("WriteOverridesTemplate error: %v", err)
+	}
+	if added != 3 {
+		t.Fatalf("want 3 entries added, got %d", added)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read template: %v", err)
+	}
+	for _, want := range []string{`"media": "Photos/a.jpg"`, `"A/a.json"`, `"media": "c.jpg"`, `"no_json": false`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s in template:\n%s", want, data)
+		}
+	}
+	if overrides, err := LoadOverrides(path); err != nil || len(overrides) != 0 {
+		t.Fatalf("undecided template entries must be ignored, got %v, %v", overrides, err)
+	}
+
+	edited := strings.Replace(string(data), `"media": "b.jpg",
+      "json": "",
+      "no_json": false`, `"media": "b.jpg",
+      "json": "",
+      "no_json": true`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o600); err != nil {
+		t.Fatalf("write edited template: %v", err)
+	}
+	result.MissingJSON = append(result.MissingJSON, "d.jpg")
+	if added, err = WriteOverridesTemplate(path, result); err != nil || added != 1 {
+		t.Fatalf("second export: want 1 entry added, got %d, %v", added, err)
+	}
+	overrides, err := LoadOverrides(path)
+	if err != nil {
+		t.Fatalf("LoadOverrides error: %v", err)
+	}
+	if !reflect.DeepEqual(overrides, Overrides{"b.jpg": ""}) {
+		t.Fatalf("edited entry was not kept: %v", overrides)
+	}
+}
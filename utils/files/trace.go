@@ -0,0 +1,71 @@
+package files
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// Trace records how ScanTakeoutTrace paired one media file: the lookup keys
+// it tried, the candidates it found, the rules that filtered them and the
+// final decision. A nil *Trace records nothing.
+type Trace struct {
+	// Media is the traced media path relative to the scanned root.
+	Media string
+	// Found is set when the scan saw the media file.
+	Found bool
+	// Steps are the recorded steps in the order they were taken.
+	Steps []string
+}
+
+// ScanTakeoutTrace scans like ScanTakeoutWithOverrides and records every
+// matching step taken for trace.Media into trace.
+func ScanTakeoutTrace(rootPath string, overrides Overrides, trace *Trace) (MediaScanResult, error) {
+	if trace != nil {
+		trace.Media = filepath.Clean(trace.Media)
+	}
+	return scanTakeout(rootPath, overrides, trace)
+}
+
+func (t *Trace) addf(format string, args ...any) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, fmt.Sprintf(format, args...))
+}
+
+// of returns t when it traces mediaRel, and nil otherwise.
+func (t *Trace) of(mediaRel string) *Trace {
+	if t == nil || t.Media != mediaRel {
+		return nil
+	}
+	return t
+}
+
+// among returns t when it traces one of mediaRels, and nil otherwise.
+func (t *Trace) among(mediaRels []string) *Trace {
+	if t == nil || !slices.Contains(mediaRels, t.Media) {
+		return nil
+	}
+	return t
+}
+
+// finish records the final decision for the traced media.
+func (t *Trace) finish(result *MediaScanResult) {
+	if t == nil || !t.Found {
+		return
+	}
+	if jsonRel, ok := result.Pairs[t.Media]; ok {
+		t.addf("result: paired with %s (%s)", jsonRel, result.PairSources[t.Media])
+		return
+	}
+	if slices.Contains(result.NoJSON, t.Media) {
+		t.addf("result: no JSON, as set in the overrides file")
+		return
+	}
+	if candidates, ok := result.AmbiguousJSON[t.Media]; ok {
+		t.addf("result: ambiguous, no rule picks one of %v", candidates)
+		return
+	}
+	t.addf("result: no JSON found")
+}
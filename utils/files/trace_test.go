@@ -0,0 +1,125 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTraceTree(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func hasStep(steps []string, substr string) bool {
+	return slices.ContainsFunc(steps, func(step string) bool {
+		return strings.Contains(step, substr)
+	})
+}
+
+func TestScanTakeoutTrace_RecordsLocalLookup(t *testing.T) {
+	root := t.TempDir()
+	writeTraceTree(t, root, "IMG_0001(1).jpg", "IMG_0001.jpg(1).json", "other.jpg", "other.jpg.json")
+
+	trace := Trace{Media: "IMG_0001(1).jpg"}
+	result, err := ScanTakeoutTrace(root, nil, &trace)
+	if err != nil {
+		t.Fatalf("ScanTakeoutTrace error: %v", err)
+	}
+	plain, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+	if !reflect.DeepEqual(result, plain) {
+		t.Fatalf("tracing changed the scan: want %+v, got %+v", plain, result)
+	}
+
+	if !trace.Found {
+		t.Fatal("expected the media to be found")
+	}
+	for _, want := range []string{
+		"folder .: 2 JSON files",
+		"IMG_0001(1).jpg.json: not found",
+		"IMG_0001.jpg(1).json: found IMG_0001.jpg(1).json",
+		"result: paired with IMG_0001.jpg(1).json (filename)",
+	} {
+		if !hasStep(trace.Steps, want) {
+			t.Fatalf("missing step %q in %q", want, trace.Steps)
+		}
+	}
+	if hasStep(trace.Steps, "other.jpg") {
+		t.Fatalf("steps of other media were recorded: %q", trace.Steps)
+	}
+}
+
+func TestScanTakeoutTrace_RecordsAmbiguity(t *testing.T) {
+	root := t.TempDir()
+	jsonA := filepath.Join("Album A", "IMG_0001.jpg.supplemental-metadata.json")
+	jsonB := filepath.Join("Album B", "IMG_0001.jpg.supplemental-metada.json")
+	mediaRel := filepath.Join("Photos", "IMG_0001.jpg")
+	writeTraceTree(t, root, mediaRel, jsonA, jsonB)
+
+	trace := Trace{Media: "./" + mediaRel}
+	if _, err := ScanTakeoutTrace(root, nil, &trace); err != nil {
+		t.Fatalf("ScanTakeoutTrace error: %v", err)
+	}
+
+	if trace.Media != mediaRel {
+		t.Fatalf("media was not cleaned: %q", trace.Media)
+	}
+	for _, want := range []string{
+		"no JSON in the same folder, searching all folders",
+		"all folders, keys",
+		"candidates [" + jsonA + " " + jsonB + "]",
+		"result: ambiguous, no rule picks one of [" + jsonA + " " + jsonB + "]",
+	} {
+		if !hasStep(trace.Steps, want) {
+			t.Fatalf("missing step %q in %q", want, trace.Steps)
+		}
+	}
+}
+
+func TestScanTakeoutTrace_RecordsClaimRules(t *testing.T) {
+	root := t.TempDir()
+	writeTraceTree(t, root, "IMG_0001.jpg", "IMG_0001.mp4", "IMG_0001.jpg.json")
+
+	trace := Trace{Media: "IMG_0001.jpg"}
+	if _, err := ScanTakeoutTrace(root, nil, &trace); err != nil {
+		t.Fatalf("ScanTakeoutTrace error: %v", err)
+	}
+
+	for _, want := range []string{
+		"IMG_0001.jpg.json is also claimed by [IMG_0001.jpg IMG_0001.mp4]",
+		"JSON extension rule: IMG_0001.jpg wins IMG_0001.jpg.json",
+		"Live Photo: IMG_0001.mp4 is the video of IMG_0001.jpg",
+		"result: paired with IMG_0001.jpg.json (filename)",
+	} {
+		if !hasStep(trace.Steps, want) {
+			t.Fatalf("missing step %q in %q", want, trace.Steps)
+		}
+	}
+}
+
+func TestScanTakeoutTrace_UnknownMedia(t *testing.T) {
+	root := t.TempDir()
+	writeTraceTree(t, root, "a.jpg", "a.jpg.json")
+
+	trace := Trace{Media: "missing.jpg"}
+	if _, err := ScanTakeoutTrace(root, nil, &trace); err != nil {
+		t.Fatalf("ScanTakeoutTrace error: %v", err)
+	}
+	if trace.Found || len(trace.Steps) != 0 {
+		t.Fatalf("expected nothing recorded, got found=%v steps=%q", trace.Found, trace.Steps)
+	}
+}
@@ -0,0 +1,62 @@
+package files
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Names from iPhone uploads are often decomposed (NFD), "é" stored as "e"
+// followed by a combining acute accent, while other sidecars and re-zipped
+// folders are composed (NFC). Matching keys fold both to one form.
+
+// truncatedNameLength is the name length Takeout cuts sidecar names to,
+// before the ".json" extension.
+const truncatedNameLength = 46
+
+// foldName returns the key names are compared by: lowercase and decomposed.
+func foldName(name string) string {
+	return norm.NFD.String(strings.ToLower(name))
+}
+
+// truncatedNames returns the forms Takeout may have cut name to when it was
+// longer than truncatedNameLength: counted in UTF-16 code units or in bytes,
+// of the name as it is and composed or decomposed. Names that fit are not
+// truncated, so the result is empty.
+func truncatedNames(name string) []string {
+	var names []string
+	for _, form := range []string{name, norm.NFC.String(name), norm.NFD.String(name)} {
+		for _, truncated := range []string{truncateUTF16(form, truncatedNameLength), truncateBytes(form, truncatedNameLength)} {
+			if len(truncated) < len(form) && !slices.Contains(names, truncated) {
+				names = append(names, truncated)
+			}
+		}
+	}
+	return names
+}
+
+// truncateUTF16 cuts s to at most n UTF-16 code units, keeping whole runes.
+func truncateUTF16(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		units += utf16.RuneLen(r)
+		if units > n {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// truncateBytes cuts s to at most n bytes, keeping whole runes.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
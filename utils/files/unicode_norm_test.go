@@ -0,0 +1,136 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFoldName_MatchesComposedAndDecomposedNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		composed   string
+		decomposed string
+	}{
+		{name: "accented", composed: "Café.jpg", decomposed: "Cafe\u0301.jpg"},
+		{name: "uppercase accented", composed: "ÉTÉ.JPG", decomposed: "e\u0301te\u0301.jpg"},
+		{name: "several marks", composed: "ǖ.jpg", decomposed: "u\u0308\u0304.jpg"},
+		{name: "vietnamese", composed: "ệ.jpg", decomposed: "e\u0323\u0302.jpg"},
+		{name: "cyrillic", composed: "йож.jpg", decomposed: "и\u0306ож.jpg"},
+		{name: "kana", composed: "がぱ.jpg", decomposed: "か\u3099は\u309a.jpg"},
+		{name: "hangul", composed: "사진.jpg", decomposed: "\u1109\u1161\u110c\u1175\u11ab.jpg"},
+		{name: "emoji", composed: "\U0001f305.jpg", decomposed: "\U0001f305.jpg"},
+	}
+	for _, tt := range tests {
+		if got, want := foldName(tt.composed), foldName(tt.decomposed); got != want {
+			t.Fatalf("%s: foldName(%q) = %q, want %q", tt.name, tt.composed, got, want)
+		}
+	}
+}
+
+func TestTruncatedNames_CountsUTF16UnitsAndBytes(t *testing.T) {
+	if got := truncatedNames("IMG_0001.jpg"); len(got) != 0 {
+		t.Fatalf("short names are not truncated, got %q", got)
+	}
+
+	ascii := strings.Repeat("a", 50) + ".jpg"
+	if got := truncatedNames(ascii); !slices.Equal(got, []string{ascii[:46]}) {
+		t.Fatalf("ascii truncation: got %q", got)
+	}
+
+	// Each emoji is two UTF-16 code units and four bytes.
+	emoji := strings.Repeat("\U0001f305", 30) + ".jpg"
+	got := truncatedNames(emoji)
+	for _, want := range []string{strings.Repeat("\U0001f305", 23), strings.Repeat("\U0001f305", 11)} {
+		if !slices.Contains(got, want) {
+			t.Fatalf("emoji truncation: want %q in %q", want, got)
+		}
+	}
+
+	// Decomposed names are also cut in their composed form. Cuts never
+	// split a rune, but may split a letter from its mark.
+	decomposed := strings.Repeat("e\u0301", 50) + ".jpg"
+	got = truncatedNames(decomposed)
+	for _, want := range []string{strings.Repeat("e\u0301", 23), strings.Repeat("e\u0301", 15) + "e", strings.Repeat("é", 46)} {
+		if !slices.Contains(got, want) {
+			t.Fatalf("decomposed truncation: want %q in %q", want, got)
+		}
+	}
+}
+
+func writeUnicodeTree(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestScanTakeout_PairsAcrossUnicodeNormalization(t *testing.T) {
+	tests := []struct {
+		name  string
+		media string
+		json  string
+	}{
+		{name: "decomposed media, composed json", media: "Cafe\u0301.jpg", json: "Café.jpg.json"},
+		{name: "composed media, decomposed supplemental json", media: "Café(1).jpg", json: "Cafe\u0301.jpg.supplemental-metadata(1).json"},
+		{name: "decomposed hangul", media: "\u1109\u1161\u110c\u1175\u11ab.heic", json: "사진.heic.json"},
+		{name: "decomposed kana, global", media: filepath.Join("Album", "か\u3099そ\u3099う.jpg"), json: filepath.Join("Photos", "がぞう.jpg.json")},
+		{name: "emoji", media: "\U0001f305 sunset.png", json: "\U0001f305 sunset.png.supplemental-metadata.json"},
+		{
+			name:  "long emoji name cut by utf-16 units",
+			media: strings.Repeat("\U0001f305", 30) + ".jpg",
+			json:  strings.Repeat("\U0001f305", 23) + ".json",
+		},
+		{
+			name:  "long cjk name cut by bytes",
+			media: strings.Repeat("写真", 20) + ".jpg",
+			json:  strings.Repeat("写真", 7) + "写.json",
+		},
+		{
+			name:  "long decomposed name cut after composing",
+			media: strings.Repeat("e\u0301", 50) + "(2).jpg",
+			json:  strings.Repeat("é", 46) + "(2).json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeUnicodeTree(t, root, tt.media, tt.json)
+
+			result, err := ScanTakeout(root)
+			if err != nil {
+				t.Fatalf("ScanTakeout error: %v", err)
+			}
+			if got := result.Pairs[tt.media]; got != tt.json {
+				t.Fatalf("want %q paired with %q, got %q (missing %q, ambiguous %q)", tt.media, tt.json, got, result.MissingJSON, result.AmbiguousJSON)
+			}
+		})
+	}
+}
+
+func TestScanTakeout_MatchesTitlesAndLivePhotosAcrossNormalization(t *testing.T) {
+	root := t.TempDir()
+	writeUnicodeTree(t, root, "Cafe\u0301.heic", "Café.mov", "Re\u0301sume\u0301.jpg")
+	if err := os.WriteFile(filepath.Join(root, "renamed.json"), []byte(`{"title":"Résumé.jpg"}`), 0o600); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+
+	result, err := ScanTakeout(root)
+	if err != nil {
+		t.Fatalf("ScanTakeout error: %v", err)
+	}
+	if got := result.Pairs["Re\u0301sume\u0301.jpg"]; got != "renamed.json" {
+		t.Fatalf("title match: got %q (missing %q)", got, result.MissingJSON)
+	}
+	if got := result.LivePhotos["Café.mov"]; got != "Cafe\u0301.heic" {
+		t.Fatalf("live photo link: got %q", got)
+	}
+}
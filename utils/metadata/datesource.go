@@ -0,0 +1,339 @@
+package metadata
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vchilikov/takeout-fix/internal/patharg"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
+)
+
+// DateSource names a place the capture date can be taken from.
+type DateSource string
+
+const (
+	// DateSourceEmbedded is the DateTimeOriginal already in the media, with
+	// OffsetTimeOriginal when present. Reading it costs an exiftool call.
+	DateSourceEmbedded DateSource = "exif"
+	// DateSourceTaken is the JSON photoTakenTime timestamp.
+	DateSourceTaken DateSource = "taken"
+	// DateSourceFormatted is the human-readable photoTakenTime.formatted.
+	DateSourceFormatted DateSource = "formatted"
+	// DateSourceCreated is the JSON creationTime, usually the upload time.
+	DateSourceCreated DateSource = "created"
+	// DateSourceFilename is a date in the filename, such as
+	// "IMG_20190704_153012.jpg". See FilenameDate.
+	DateSourceFilename DateSource = "filename"
+)
+
+// DatePrecedence is a comma-separated list of date sources, most trusted
+// first, such as "exif,taken,filename". The first source with a date that
+// passes the date checks is written. Empty uses DefaultDatePrecedence.
+type DatePrecedence string
+
+// DefaultDatePrecedence trusts a date already in the media most, as scans
+// and edits often carry a correct DateTimeOriginal while the JSON holds the
+// upload time, then the JSON and last the filename. The date checks reject
+// unset camera clocks, such as dates on the 1970 epoch.
+const DefaultDatePrecedence DatePrecedence = "exif,taken,formatted,filename"
+
+var dateSources = []DateSource{
+	DateSourceEmbedded,
+	DateSourceTaken,
+	DateSourceFormatted,
+	DateSourceCreated,
+	DateSourceFilename,
+}
+
+// ParseDatePrecedence validates a date precedence. Source names are case
+// insensitive and may not repeat. Empty gives DefaultDatePrecedence.
+func ParseDatePrecedence(value string) (DatePrecedence, error) {
+	if strings.TrimSpace(value) == "" {
+		return DefaultDatePrecedence, nil
+	}
+	var sources []string
+	for part := range strings.SplitSeq(value, ",") {
+		source := DateSource(strings.ToLower(strings.TrimSpace(part)))
+		if !slices.Contains(dateSources, source) {
+			return "", fmt.Errorf("unknown date source %q (want exif, taken, formatted, created or filename)", part)
+		}
+		if slices.Contains(sources, string(source)) {
+			return "", fmt.Errorf("date source %q is listed twice", source)
+		}
+		sources = append(sources, string(source))
+	}
+	return DatePrecedence(strings.Join(sources, ",")), nil
+}
+
+func (precedence DatePrecedence) sources() []DateSource {
+	value := cmp.Or(precedence, DefaultDatePrecedence)
+	var sources []DateSource
+	for part := range strings.SplitSeq(string(value), ",") {
+		sources = append(sources, DateSource(strings.ToLower(strings.TrimSpace(part))))
+	}
+	return sources
+}
+
+// DateChecks is a comma-separated list of sanity checks a date must pass:
+// "epoch" rejects dates on 1 January 1970, "future" rejects dates after the
+// run and "folder" rejects dates outside the year of a "Photos from YYYY"
+// folder. Empty enables all checks; DateChecksNone disables them.
+type DateChecks string
+
+// DateChecksNone accepts every parseable date.
+const DateChecksNone DateChecks = "none"
+
+const (
+	dateCheckEpoch  = "epoch"
+	dateCheckFuture = "future"
+	dateCheckFolder = "folder"
+)
+
+// ParseDateChecks validates a list of date checks. Empty enables all.
+func ParseDateChecks(value string) (DateChecks, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == string(DateChecksNone) {
+		return DateChecks(value), nil
+	}
+	var checks []string
+	for part := range strings.SplitSeq(value, ",") {
+		check := strings.TrimSpace(part)
+		switch check {
+		case dateCheckEpoch, dateCheckFuture, dateCheckFolder:
+		default:
+			return "", fmt.Errorf("unknown date check %q (want epoch, future, folder or none)", part)
+		}
+		if !slices.Contains(checks, check) {
+			checks = append(checks, check)
+		}
+	}
+	return DateChecks(strings.Join(checks, ",")), nil
+}
+
+func (checks DateChecks) enabled(check string) bool {
+	switch checks {
+	case "":
+		return true
+	case DateChecksNone:
+		return false
+	}
+	return slices.Contains(strings.Split(string(checks), ","), check)
+}
+
+// dateCandidate is a capture date found in one source.
+type dateCandidate struct {
+	source DateSource
+	value  time.Time
+	// zoned is set when value is a known instant. Filename dates and
+	// embedded dates without an offset are wall-clock times whose zone is
+	// only assumed.
+	zoned bool
+	// filename is the pattern match of a DateSourceFilename candidate.
+	filename filenameDate
+}
+
+// zoneSlack is the largest difference between the same wall-clock time in
+// two zones.
+const zoneSlack = 14 * time.Hour
+
+// dateMatchTolerance absorbs rounding between sources of the same date.
+const dateMatchTolerance = time.Minute
+
+var (
+	nowFunc       = time.Now
+	photosFromRe  = regexp.MustCompile(`^Photos from (\d{4})$`)
+	formattedDate = []string{
+		"Jan 2, 2006, 3:04:05 PM MST",
+		"Jan 2, 2006, 15:04:05 MST",
+		"2 Jan 2006, 15:04:05 MST",
+		"2 Jan 2006 15:04:05 MST",
+		"02.01.2006, 15:04:05 MST",
+		"02/01/2006, 15:04:05 MST",
+		"2006-01-02 15:04:05 MST",
+	}
+)
+
+// resolveCaptureDate returns the date of the first source in opts'
+// precedence that passes the date checks. Dates are in zone, or in the
+// local zone when zone is nil. It also describes rejected dates and dates
+// that disagree with the chosen one.
+func (opts Options) resolveCaptureDate(
+	mediaPath string,
+	readPath string,
+	sc sidecar.Sidecar,
+	zone *time.Location,
+	run func(args []string) (string, error),
+) (dateCandidate, bool, []string) {
+	loc := cmp.Or(zone, time.Local)
+	var candidates []dateCandidate
+	for _, source := range opts.DatePrecedence.sources() {
+		if candidate, ok := findDate(source, mediaPath, readPath, sc, zone, loc, run); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	var conflicts []string
+	var chosen dateCandidate
+	found := false
+	folderYear, hasFolderYear := photosFromYear(mediaPath)
+	for _, candidate := range candidates {
+		reason := opts.DateChecks.reject(candidate.value, folderYear, hasFolderYear)
+		if reason != "" {
+			conflicts = append(conflicts, fmt.Sprintf("%s %s rejected: %s", candidate.source.label(), formatCandidate(candidate), reason))
+			continue
+		}
+		if !found {
+			chosen, found = candidate, true
+			continue
+		}
+		if !chosen.matches(candidate) {
+			conflicts = append(conflicts, fmt.Sprintf("%s %s differs from %s %s", candidate.source.label(), formatCandidate(candidate), chosen.source.label(), formatCandidate(chosen)))
+		}
+	}
+	return chosen, found, conflicts
+}
+
+func findDate(
+	source DateSource,
+	mediaPath string,
+	readPath string,
+	sc sidecar.Sidecar,
+	zone *time.Location,
+	loc *time.Location,
+	run func(args []string) (string, error),
+) (dateCandidate, bool) {
+	switch source {
+	case DateSourceEmbedded:
+		return readEmbeddedDate(readPath, loc, run)
+	case DateSourceTaken:
+		if sc.PhotoTakenTime.Status == sidecar.TimestampValid {
+			return dateCandidate{source: source, value: sc.PhotoTakenTime.Time.In(loc), zoned: true}, true
+		}
+	case DateSourceFormatted:
+		if value, ok := parseFormattedDate(sc.PhotoTakenTime.Formatted); ok {
+			return dateCandidate{source: source, value: value.In(loc), zoned: true}, true
+		}
+	case DateSourceCreated:
+		if sc.CreationTime.Status == sidecar.TimestampValid {
+			return dateCandidate{source: source, value: sc.CreationTime.Time.In(loc), zoned: true}, true
+		}
+	case DateSourceFilename:
+		if match, ok := matchFilenameDate(mediaPath, zone); ok {
+			return dateCandidate{source: source, value: match.value, filename: match}, true
+		}
+	}
+	return dateCandidate{}, false
+}
+
+// readEmbeddedDate reads DateTimeOriginal from the media. Without
+// OffsetTimeOriginal the value is taken as wall-clock time in loc.
+func readEmbeddedDate(mediaPath string, loc *time.Location, run func(args []string) (string, error)) (dateCandidate, bool) {
+	output, err := run([]string{"-m", "-s3", "-DateTimeOriginal", "-OffsetTimeOriginal", patharg.Safe(mediaPath)})
+	if err != nil {
+		return dateCandidate{}, false
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	value, err := time.ParseInLocation(exifDateLayout, strings.TrimSpace(lines[0]), loc)
+	if err != nil {
+		return dateCandidate{}, false
+	}
+	candidate := dateCandidate{source: DateSourceEmbedded, value: value}
+	if len(lines) > 1 {
+		if offset, err := time.Parse("-07:00", strings.TrimSpace(lines[1])); err == nil {
+			_, seconds := offset.Zone()
+			candidate.value = time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), 0, time.FixedZone("", seconds)).In(loc)
+			candidate.zoned = true
+		}
+	}
+	return candidate, true
+}
+
+// parseFormattedDate reads photoTakenTime.formatted, such as
+// "Jul 1, 2024, 12:00:00 PM UTC". The format follows the account's locale,
+// so only common layouts are recognized.
+func parseFormattedDate(value string) (time.Time, bool) {
+	value = strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\u00a0' || r == '\u202f'
+	}), " ")
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range formattedDate {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// reject returns why value fails checks, or "" when it passes.
+func (checks DateChecks) reject(value time.Time, folderYear int, hasFolderYear bool) string {
+	utc := value.UTC()
+	if checks.enabled(dateCheckEpoch) && !utc.Before(time.Unix(0, 0).Add(-zoneSlack)) && utc.Before(time.Unix(0, 0).Add(24*time.Hour+zoneSlack)) {
+		return "Unix epoch"
+	}
+	if checks.enabled(dateCheckFuture) && value.After(nowFunc().Add(zoneSlack)) {
+		return "in the future"
+	}
+	if checks.enabled(dateCheckFolder) && hasFolderYear {
+		earliest, latest := utc.Add(-zoneSlack).Year(), utc.Add(zoneSlack).Year()
+		if folderYear < earliest || folderYear > latest {
+			return fmt.Sprintf(`outside the "Photos from %d" folder`, folderYear)
+		}
+	}
+	return ""
+}
+
+func (c dateCandidate) matches(other dateCandidate) bool {
+	tolerance := dateMatchTolerance
+	if !c.zoned || !other.zoned {
+		tolerance += zoneSlack
+	}
+	if c.filename.precision == PrecisionDate || other.filename.precision == PrecisionDate {
+		tolerance += 24 * time.Hour
+	}
+	diff := c.value.Sub(other.value)
+	return diff.Abs() <= tolerance
+}
+
+// photosFromYear returns the year of the closest "Photos from YYYY" folder
+// above mediaPath.
+func photosFromYear(mediaPath string) (int, bool) {
+	for dir := filepath.Dir(mediaPath); ; dir = filepath.Dir(dir) {
+		if match := photosFromRe.FindStringSubmatch(filepath.Base(dir)); match != nil {
+			year, err := strconv.Atoi(match[1])
+			return year, err == nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return 0, false
+		}
+	}
+}
+
+func (source DateSource) label() string {
+	switch source {
+	case DateSourceEmbedded:
+		return "DateTimeOriginal"
+	case DateSourceTaken:
+		return "photoTakenTime"
+	case DateSourceFormatted:
+		return "photoTakenTime.formatted"
+	case DateSourceCreated:
+		return "creationTime"
+	default:
+		return string(source)
+	}
+}
+
+func formatCandidate(c dateCandidate) string {
+	if c.zoned {
+		return c.value.Format("2006-01-02 15:04:05-07:00")
+	}
+	return c.value.Format("2006-01-02 15:04:05")
+}
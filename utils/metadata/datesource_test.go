@@ -0,0 +1,221 @@
+package metadata
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stubNow(t *testing.T, now time.Time) {
+	t.Helper()
+	orig := nowFunc
+	nowFunc = func() time.Time { return now }
+	t.Cleanup(func() {
+		nowFunc = orig
+	})
+}
+
+// answerDateRead answers the DateTimeOriginal read of the default date
+// precedence with no date and passes every other call to run.
+func answerDateRead(run func(args []string) (string, error)) func(args []string) (string, error) {
+	return func(args []string) (string, error) {
+		if slices.Contains(args, "-s3") && slices.Contains(args, "-DateTimeOriginal") {
+			return "", nil
+		}
+		return run(args)
+	}
+}
+
+func TestParseDatePrecedence(t *testing.T) {
+	for value, want := range map[string]DatePrecedence{
+		"":                      DefaultDatePrecedence,
+		"exif,taken,filename":   "exif,taken,filename",
+		" EXIF , Created ":      "exif,created",
+		"filename,formatted":    "filename,formatted",
+		"taken,formatted,exif":  "taken,formatted,exif",
+		"created,taken,exif":    "created,taken,exif",
+		"filename":              "filename",
+		"exif,filename,created": "exif,filename,created",
+	} {
+		got, err := ParseDatePrecedence(value)
+		if err != nil || got != want {
+			t.Fatalf("ParseDatePrecedence(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"exif,exif", "taken,", "gps"} {
+		if _, err := ParseDatePrecedence(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestParseDateChecks(t *testing.T) {
+	for value, want := range map[string]DateChecks{
+		"":                    "",
+		"none":                DateChecksNone,
+		"Future, epoch":       "future,epoch",
+		"folder,folder":       "folder",
+		"epoch,future,folder": "epoch,future,folder",
+	} {
+		got, err := ParseDateChecks(value)
+		if err != nil || got != want {
+			t.Fatalf("ParseDateChecks(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseDateChecks("epoch,soon"); err == nil {
+		t.Fatalf("expected error for unknown check")
+	}
+}
+
+func TestParseFormattedDate(t *testing.T) {
+	want := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"Jul 1, 2024, 12:00:00 PM UTC",
+		"Jul 1, 2024, 12:00:00 PM UTC",
+		"1 Jul 2024, 12:00:00 UTC",
+		"01.07.2024, 12:00:00 UTC",
+	} {
+		got, ok := parseFormattedDate(value)
+		if !ok || !got.Equal(want) {
+			t.Fatalf("parseFormattedDate(%q) = %v, %v; want %v", value, got, ok, want)
+		}
+	}
+	if _, ok := parseFormattedDate("sometime in July"); ok {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+}
+
+func TestPlanWithRunner_PrefersEmbeddedDateAndReportsConflict(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	var reads [][]string
+	runner := func(args []string) (string, error) {
+		reads = append(reads, args)
+		return "2001:02:03 04:05:06\n+02:00\n", nil
+	}
+
+	opts := Options{DatePrecedence: "exif,taken", Timezone: "+02:00"}
+	commands, result, err := PlanWithRunner("scan.jpg", jsonPath, opts, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(reads) != 1 || !slices.Contains(reads[0], "-DateTimeOriginal") {
+		t.Fatalf("expected one DateTimeOriginal read, got %v", reads)
+	}
+	if result.DateSource != DateSourceEmbedded {
+		t.Fatalf("expected embedded date source, got %q", result.DateSource)
+	}
+	if len(commands) != 1 || !slices.Contains(commands[0], "-AllDates=2001:02:03 04:05:06") {
+		t.Fatalf("expected the embedded date to be written, got %v", commands)
+	}
+	want := []string{"photoTakenTime 2024-07-01 14:00:00+02:00 differs from DateTimeOriginal 2001-02-03 04:05:06+02:00"}
+	if !slices.Equal(result.DateConflicts, want) {
+		t.Fatalf("expected conflicts %q, got %q", want, result.DateConflicts)
+	}
+}
+
+func TestPlanWithRunner_ReadsSourcePathOfRenamedMedia(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	var reads [][]string
+	runner := func(args []string) (string, error) {
+		reads = append(reads, args)
+		return "2001:02:03 04:05:06\n+02:00\n", nil
+	}
+
+	opts := Options{DatePrecedence: "exif,taken", Timezone: "+02:00", SourcePath: "scan.png"}
+	commands, _, err := PlanWithRunner("scan.jpg", jsonPath, opts, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(reads) != 1 || reads[0][len(reads[0])-1] != "scan.png" {
+		t.Fatalf("expected the read to go to the source path, got %v", reads)
+	}
+	if len(commands) != 1 || commands[0][len(commands[0])-1] != "scan.jpg" {
+		t.Fatalf("expected the command to name the planned path, got %v", commands)
+	}
+}
+
+func TestPlanWithRunner_DefaultPrecedencePrefersSaneEmbeddedDate(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	for embedded, want := range map[string]DateSource{
+		"2001:02:03 04:05:06\n+02:00\n": DateSourceEmbedded,
+		"1970:01:01 00:00:00\n":         DateSourceTaken,
+		"":                              DateSourceTaken,
+	} {
+		runner := func(args []string) (string, error) {
+			if !slices.Contains(args, "-DateTimeOriginal") {
+				t.Fatalf("expected only the embedded date read, got %v", args)
+			}
+			return embedded, nil
+		}
+
+		_, result, err := PlanWithRunner("photo.jpg", jsonPath, Options{}, runner)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.DateSource != want {
+			t.Fatalf("embedded %q: want date source %q, got %q (%q)", embedded, want, result.DateSource, result.DateConflicts)
+		}
+	}
+}
+
+func TestPlanWithRunner_RejectsFutureDateForFilename(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	stubNow(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanWithRunner("2013-06-11 16.19.16.jpg", jsonPath, Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.DateSource != DateSourceFilename || !result.UsedFilenameDate {
+		t.Fatalf("expected the filename date, got %+v", result)
+	}
+	if hasArgPrefix(commands[0], "-AllDates=") {
+		t.Fatalf("did not expect the JSON date to be written: %v", commands[0])
+	}
+	if len(result.DateConflicts) != 1 || !strings.Contains(result.DateConflicts[0], "photoTakenTime") || !strings.HasSuffix(result.DateConflicts[0], "rejected: in the future") {
+		t.Fatalf("expected the future JSON date to be reported, got %q", result.DateConflicts)
+	}
+}
+
+func TestPlanWithRunner_RejectsEpochAndFolderMismatch(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"60","formatted":"Jan 1, 1970, 12:01:00 AM UTC"},"creationTime":{"timestamp":"1561939200"}}`)
+	runner := func(args []string) (string, error) { return "", nil }
+	mediaPath := filepath.Join("Takeout", "Google Photos", "Photos from 2019", "2013-06-11 16.19.16.jpg")
+
+	opts := Options{DatePrecedence: "taken,formatted,filename,created"}
+	_, result, err := PlanWithRunner(mediaPath, jsonPath, opts, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.DateSource != DateSourceCreated {
+		t.Fatalf("expected creationTime to be the only sane date, got %q (%q)", result.DateSource, result.DateConflicts)
+	}
+	want := []string{
+		"photoTakenTime rejected: Unix epoch",
+		"photoTakenTime.formatted rejected: Unix epoch",
+		`filename rejected: outside the "Photos from 2019" folder`,
+	}
+	if len(result.DateConflicts) != len(want) {
+		t.Fatalf("expected %d conflicts, got %q", len(want), result.DateConflicts)
+	}
+	for i, conflict := range result.DateConflicts {
+		source, reason, _ := strings.Cut(want[i], " rejected: ")
+		if !strings.HasPrefix(conflict, source+" ") || !strings.HasSuffix(conflict, "rejected: "+reason) {
+			t.Fatalf("conflict %d: want %q, got %q", i, want[i], conflict)
+		}
+	}
+
+	opts.DateChecks = DateChecksNone
+	_, result, err = PlanWithRunner(mediaPath, jsonPath, opts, runner)
+	if err != nil || result.DateSource != DateSourceTaken {
+		t.Fatalf("expected checks to be disabled, got %q (%v)", result.DateSource, err)
+	}
+}
@@ -0,0 +1,133 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/vchilikov/takeout-fix/internal/patharg"
+)
+
+// ExifRepair is how corrupt EXIF was repaired so the JSON values could be
+// written.
+type ExifRepair string
+
+const (
+	// ExifRepairRebuilt copies every readable tag into a fresh metadata
+	// structure, dropping only the entries exiftool cannot read.
+	ExifRepairRebuilt ExifRepair = "rebuilt"
+	// ExifRepairStripped removes all metadata. It is the last resort when
+	// a rebuild fails or leaves the EXIF unwritable.
+	ExifRepairStripped ExifRepair = "stripped"
+)
+
+// exifRepairs are tried in order until the JSON values can be written.
+var exifRepairs = []ExifRepair{ExifRepairRebuilt, ExifRepairStripped}
+
+// exifRepairOutcome is the repair that made the media writable, with the
+// tags it lost.
+type exifRepairOutcome struct {
+	repair   ExifRepair
+	lostTags []string
+}
+
+// args returns the exiftool command that applies the repair to path.
+func (repair ExifRepair) args(path string) []string {
+	if repair == ExifRepairRebuilt {
+		// exiftool FAQ 20: rebuild the metadata from the readable tags,
+		// keeping the ICC profile and the unsafe tags -all:all skips.
+		return []string{"-m", "-all=", "-tagsfromfile", "@", "-all:all", "-unsafe", "-icc_profile", "-overwrite_original", patharg.Safe(path)}
+	}
+	return []string{"-all=", "-overwrite_original", patharg.Safe(path)}
+}
+
+// repairCorruptExif repairs the metadata of outMediaPath after writing the
+// JSON values failed on corrupt EXIF, then writes them again. writeArgs
+// builds the write command, with or without FileCreateDate. The tags that
+// could be read before the repair and are gone after it, before the JSON
+// values are written, are reported.
+func repairCorruptExif(
+	mediaPath string,
+	outMediaPath string,
+	includeCreateDate bool,
+	writesCreateDate bool,
+	writeArgs func(includeCreateDate bool) []string,
+	run func(args []string) (string, error),
+	writeErr error,
+	writeOutput string,
+) (bool, exifRepairOutcome, error) {
+	before := readTags(outMediaPath, run)
+	repaired := false
+	for _, repair := range exifRepairs {
+		if _, err := run(repair.args(outMediaPath)); err != nil {
+			continue
+		}
+		repaired = true
+		// Read before the JSON values are written again, so the tags they
+		// change are not counted as lost.
+		after := readTags(outMediaPath, run)
+
+		createDateWarned := false
+		output, err := run(writeArgs(includeCreateDate))
+		if err != nil && writesCreateDate && strings.Contains(strings.ToLower(output), "filecreatedate") {
+			output, err = run(writeArgs(false))
+			createDateWarned = err == nil
+		}
+		if err == nil {
+			return createDateWarned, exifRepairOutcome{repair: repair, lostTags: missingTags(before, after)}, nil
+		}
+		writeErr, writeOutput = err, output
+		if !looksLikeCorruptExif(output) {
+			break
+		}
+	}
+
+	if !repaired {
+		return false, exifRepairOutcome{}, fmt.Errorf("could not fix metadata for %s\nerror: %w\noutput: %s", mediaPath, writeErr, writeOutput)
+	}
+	return false, exifRepairOutcome{}, fmt.Errorf("could not fix metadata for %s after repairing corrupt EXIF\nerror: %w\noutput: %s", mediaPath, writeErr, writeOutput)
+}
+
+// readTags reads the metadata tags in path as "Group:Tag" with their
+// values, leaving out file system and computed tags. A file that cannot be
+// read has no tags.
+func readTags(path string, run func(args []string) (string, error)) map[string]json.RawMessage {
+	output, err := run([]string{"-j", "-G1", "-m", "--File:all", "--ExifTool:all", "--Composite:all", patharg.Safe(path)})
+	if err != nil {
+		return nil
+	}
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(output), &entries); err != nil || len(entries) == 0 {
+		return nil
+	}
+	delete(entries[0], "SourceFile")
+	return entries[0]
+}
+
+// missingTags returns, in order, the tags of before that no tag of after
+// has with the same name and value. Groups are ignored, as a rebuild may
+// move a tag, such as Make from a maker note group into IFD0.
+func missingTags(before map[string]json.RawMessage, after map[string]json.RawMessage) []string {
+	kept := make(map[string]struct{}, len(after))
+	for tag, value := range after {
+		kept[tagName(tag)+"="+string(value)] = struct{}{}
+	}
+	var missing []string
+	for _, tag := range slices.Sorted(maps.Keys(before)) {
+		if _, found := kept[tagName(tag)+"="+string(before[tag])]; !found {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// tagName drops the group of a "Group:Tag" name.
+func tagName(tag string) string {
+	_, name, found := strings.Cut(tag, ":")
+	if !found {
+		return tag
+	}
+	return name
+}
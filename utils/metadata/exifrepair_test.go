@@ -0,0 +1,265 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	corruptExifOutput = "Error: Bad format (0) for ExifIFD entry 25 - photo.jpg\n"
+	tagsBeforeRepair  = `[{"SourceFile":"photo.jpg","IFD0:Make":"Canon","ExifIFD:LensModel":"EF 50mm","ExifIFD:ExposureTime":"1/60","ICC_Profile:ProfileDescription":"sRGB"}]`
+	tagsAfterRebuild  = `[{"SourceFile":"photo.jpg","IFD0:Make":"Canon","ExifIFD:LensModel":"EF 50mm","ICC_Profile:ProfileDescription":"sRGB","XMP-dc:Title":"Trip"}]`
+	tagsAfterStrip    = `[{"SourceFile":"photo.jpg","XMP-dc:Title":"Trip"}]`
+)
+
+type runnerReply struct {
+	output string
+	err    error
+}
+
+// repairRunner answers JSON writes with writes in order and repairs with
+// repairs. Tag reads return tagsBeforeRepair until a repair succeeds. Every
+// call but the embedded date read is logged as "write", "read", "rebuild"
+// or "strip".
+func repairRunner(t *testing.T, writes []runnerReply, repairs map[ExifRepair]error, after string) (func([]string) (string, error), *[]string) {
+	t.Helper()
+	var calls []string
+	repaired := false
+	return answerDateRead(func(args []string) (string, error) {
+		switch {
+		case slices.Contains(args, "-G1"):
+			calls = append(calls, "read")
+			if repaired {
+				return after, nil
+			}
+			return tagsBeforeRepair, nil
+		case slices.Contains(args, "-all="):
+			repair := ExifRepairStripped
+			calls = append(calls, "strip")
+			if slices.Contains(args, "-tagsfromfile") {
+				repair = ExifRepairRebuilt
+				calls[len(calls)-1] = "rebuild"
+			}
+			err := repairs[repair]
+			repaired = repaired || err == nil
+			return "", err
+		default:
+			calls = append(calls, "write")
+			if len(writes) == 0 {
+				t.Fatalf("unexpected write: %v", args)
+			}
+			reply := writes[0]
+			writes = writes[1:]
+			return reply.output, reply.err
+		}
+	}), &calls
+}
+
+func TestApplyDetailedWithRunner_RebuildsCorruptExifAndReportsLostTags(t *testing.T) {
+	for _, output := range []string{
+		corruptExifOutput,
+		"Error: Error reading OtherImageStart data in IFD0 - photo.jpg\n",
+	} {
+		var rebuildArgs []string
+		runner, calls := repairRunner(t, []runnerReply{{output, errors.New("exiftool failed")}, {}}, nil, tagsAfterRebuild)
+		recording := func(args []string) (string, error) {
+			if slices.Contains(args, "-tagsfromfile") {
+				rebuildArgs = args
+			}
+			return runner(args)
+		}
+
+		result, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, recording)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if result.ExifRepair != ExifRepairRebuilt {
+			t.Fatalf("ExifRepair: want rebuilt, got %q", result.ExifRepair)
+		}
+		if !slices.Equal(result.LostTags, []string{"ExifIFD:ExposureTime"}) {
+			t.Fatalf("LostTags: want [ExifIFD:ExposureTime], got %v", result.LostTags)
+		}
+		if want := []string{"write", "read", "rebuild", "read", "write"}; !slices.Equal(*calls, want) {
+			t.Fatalf("calls: want %v, got %v", want, *calls)
+		}
+		for _, want := range []string{"@", "-all:all", "-icc_profile", "-overwrite_original"} {
+			if !slices.Contains(rebuildArgs, want) {
+				t.Fatalf("expected %q in rebuild args: %v", want, rebuildArgs)
+			}
+		}
+	}
+}
+
+func TestApplyDetailedWithRunner_StripsWhenRebuildFails(t *testing.T) {
+	runner, calls := repairRunner(t,
+		[]runnerReply{{corruptExifOutput, errors.New("exiftool failed")}, {}},
+		map[ExifRepair]error{ExifRepairRebuilt: errors.New("rebuild failed")},
+		tagsAfterStrip,
+	)
+
+	result, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if result.ExifRepair != ExifRepairStripped {
+		t.Fatalf("ExifRepair: want stripped, got %q", result.ExifRepair)
+	}
+	want := []string{"ExifIFD:ExposureTime", "ExifIFD:LensModel", "ICC_Profile:ProfileDescription", "IFD0:Make"}
+	if !slices.Equal(result.LostTags, want) {
+		t.Fatalf("LostTags: want %v, got %v", want, result.LostTags)
+	}
+	if want := []string{"write", "read", "rebuild", "strip", "read", "write"}; !slices.Equal(*calls, want) {
+		t.Fatalf("calls: want %v, got %v", want, *calls)
+	}
+}
+
+func TestApplyDetailedWithRunner_StripsWhenRebuiltExifIsStillCorrupt(t *testing.T) {
+	runner, calls := repairRunner(t,
+		[]runnerReply{
+			{corruptExifOutput, errors.New("exiftool failed")},
+			{corruptExifOutput, errors.New("exiftool failed")},
+			{},
+		},
+		nil,
+		tagsAfterStrip,
+	)
+
+	result, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if result.ExifRepair != ExifRepairStripped {
+		t.Fatalf("ExifRepair: want stripped, got %q", result.ExifRepair)
+	}
+	if want := []string{"write", "read", "rebuild", "read", "write", "strip", "read", "write"}; !slices.Equal(*calls, want) {
+		t.Fatalf("calls: want %v, got %v", want, *calls)
+	}
+}
+
+func TestApplyDetailedWithRunner_ReturnsErrorWhenRepairsFail(t *testing.T) {
+	runner, _ := repairRunner(t,
+		[]runnerReply{{corruptExifOutput, errors.New("exiftool failed")}},
+		map[ExifRepair]error{ExifRepairRebuilt: errors.New("rebuild failed"), ExifRepairStripped: errors.New("strip failed")},
+		tagsAfterStrip,
+	)
+
+	_, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "could not fix metadata for photo.jpg") {
+		t.Fatalf("expected original error message, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "repairing corrupt EXIF") {
+		t.Fatalf("should not mention the repair when no repair worked")
+	}
+}
+
+func TestApplyDetailedWithRunner_ReturnsErrorWhenRetryAfterRepairFails(t *testing.T) {
+	runner, calls := repairRunner(t,
+		[]runnerReply{
+			{corruptExifOutput, errors.New("exiftool failed")},
+			{"some other error\n", errors.New("retry failed")},
+		},
+		nil,
+		tagsAfterRebuild,
+	)
+
+	_, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "after repairing corrupt EXIF") {
+		t.Fatalf("expected error to mention the repair, got: %v", err)
+	}
+	// Stripping would not help with an error that is not corrupt EXIF.
+	if slices.Contains(*calls, "strip") {
+		t.Fatalf("did not expect a strip, got calls %v", *calls)
+	}
+}
+
+func TestApplyDetailedWithRunner_FileCreateDateFallbackAfterRepair(t *testing.T) {
+	orig := shouldWriteFileCreateDate
+	shouldWriteFileCreateDate = func() bool { return true }
+	defer func() { shouldWriteFileCreateDate = orig }()
+
+	runner, calls := repairRunner(t,
+		[]runnerReply{
+			{corruptExifOutput, errors.New("exiftool failed")},
+			{"Warning: Sorry, FileCreateDate is not supported\n", errors.New("exiftool failed")},
+			{},
+		},
+		nil,
+		tagsAfterRebuild,
+	)
+
+	result, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !result.CreateDateWarned {
+		t.Fatalf("expected CreateDateWarned to be true")
+	}
+	if result.ExifRepair != ExifRepairRebuilt {
+		t.Fatalf("ExifRepair: want rebuilt, got %q", result.ExifRepair)
+	}
+	if want := []string{"write", "read", "rebuild", "read", "write", "write"}; !slices.Equal(*calls, want) {
+		t.Fatalf("calls: want %v, got %v", want, *calls)
+	}
+}
+
+func TestApplyDetailedWithRunner_TagsChangedByTheJSONAreNotLost(t *testing.T) {
+	const (
+		before  = `[{"SourceFile":"photo.jpg","ExifIFD:DateTimeOriginal":"2001:02:03 04:05:06","ExifIFD:ExposureTime":"1/60"}]`
+		rebuilt = `[{"SourceFile":"photo.jpg","ExifIFD:DateTimeOriginal":"2001:02:03 04:05:06"}]`
+		written = `[{"SourceFile":"photo.jpg","ExifIFD:DateTimeOriginal":"2024:07:01 12:00:00"}]`
+	)
+	tags := before
+	writes := 0
+	runner := answerDateRead(func(args []string) (string, error) {
+		switch {
+		case slices.Contains(args, "-G1"):
+			return tags, nil
+		case slices.Contains(args, "-tagsfromfile"):
+			tags = rebuilt
+			return "", nil
+		default:
+			writes++
+			if writes == 1 {
+				return corruptExifOutput, errors.New("exiftool failed")
+			}
+			tags = written
+			return "", nil
+		}
+	})
+
+	result, err := ApplyDetailedWithRunner("photo.jpg", writeJSONFixture(t, testSidecarJSON), Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !slices.Equal(result.LostTags, []string{"ExifIFD:ExposureTime"}) {
+		t.Fatalf("LostTags: want only the tag the rebuild dropped, got %v", result.LostTags)
+	}
+}
+
+func TestMissingTags_ComparesNameAndValueAcrossGroups(t *testing.T) {
+	before := map[string]json.RawMessage{
+		"Canon:LensModel":      json.RawMessage(`"EF 50mm"`),
+		"IFD0:Model":           json.RawMessage(`"EOS 5D"`),
+		"ExifIFD:ExposureTime": json.RawMessage(`"1/60"`),
+		"ExifIFD:ISO":          json.RawMessage(`100`),
+	}
+	after := map[string]json.RawMessage{
+		"ExifIFD:LensModel": json.RawMessage(`"EF 50mm"`),
+		"IFD0:Model":        json.RawMessage(`"EOS"`),
+		"ExifIFD:ISO":       json.RawMessage(`100`),
+	}
+
+	want := []string{"ExifIFD:ExposureTime", "IFD0:Model"}
+	if got := missingTags(before, after); !slices.Equal(got, want) {
+		t.Fatalf("missingTags: want %v, got %v", want, got)
+	}
+}
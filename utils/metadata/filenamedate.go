@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatePrecision says how much of the capture time a filename encodes.
+type DatePrecision string
+
+const (
+	// PrecisionDate is a filename with only the day, such as a WhatsApp
+	// "IMG-20200101-WA0003.jpg". The time is written as 00:00:00.
+	PrecisionDate DatePrecision = "date"
+	// PrecisionDateTime is a filename with the day and the time to the
+	// second.
+	PrecisionDateTime DatePrecision = "datetime"
+)
+
+// filenamePattern is a filename layout that encodes a capture date. The
+// expression matches the name without its extension and captures the
+// named groups year, month and day, plus hour, minute and second for
+// PrecisionDateTime.
+type filenamePattern struct {
+	name      string
+	precision DatePrecision
+	re        *regexp.Regexp
+}
+
+// filenamePatterns are tried in order; the first match wins. Add a layout
+// here to restore dates from more filenames.
+var filenamePatterns = []filenamePattern{
+	newFilenamePattern("takeout", PrecisionDateTime,
+		`^(?P<year>\d{4})-(?P<month>\d{2})-(?P<day>\d{2}) (?P<hour>\d{2})\.(?P<minute>\d{2})\.(?P<second>\d{2})`),
+	newFilenamePattern("camera", PrecisionDateTime,
+		`^(?:IMG|VID|PXL|MVIMG|PANO)_(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})_(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})`),
+	newFilenamePattern("screenshot", PrecisionDateTime,
+		`^Screenshot_(?P<year>\d{4})-?(?P<month>\d{2})-?(?P<day>\d{2})-(?P<hour>\d{2})-?(?P<minute>\d{2})-?(?P<second>\d{2})`),
+	newFilenamePattern("whatsapp", PrecisionDate,
+		`^(?:IMG|VID|AUD|PTT)-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})-WA\d+`),
+	newFilenamePattern("burst", PrecisionDateTime,
+		`BURST(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})`),
+	newFilenamePattern("signal", PrecisionDateTime,
+		`^signal-(?P<year>\d{4})-(?P<month>\d{2})-(?P<day>\d{2})-(?P<hour>\d{2})-?(?P<minute>\d{2})-?(?P<second>\d{2})`),
+}
+
+func newFilenamePattern(name string, precision DatePrecision, expr string) filenamePattern {
+	return filenamePattern{name: name, precision: precision, re: regexp.MustCompile(expr)}
+}
+
+// filenameDate is a capture date read from a filename.
+type filenameDate struct {
+	value     time.Time
+	pattern   string
+	precision DatePrecision
+}
+
+// FilenameDate returns the capture date encoded in a filename such as
+// "2019-05-01 12.30.00.jpg" or "IMG_20190501_123000.jpg", as wall-clock
+// time in UTC.
+func FilenameDate(mediaPath string) (time.Time, bool) {
+	match, ok := matchFilenameDate(mediaPath, nil)
+	return match.value, ok
+}
+
+// matchFilenameDate reads the date of the first pattern that matches the
+// name of mediaPath as wall-clock time in zone, or in UTC when zone is nil.
+// Filenames do not encode a timezone.
+func matchFilenameDate(mediaPath string, zone *time.Location) (filenameDate, bool) {
+	if zone == nil {
+		zone = time.UTC
+	}
+	base := filepath.Base(mediaPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, pattern := range filenamePatterns {
+		if value, ok := pattern.parse(stem, zone); ok {
+			return filenameDate{value: value, pattern: pattern.name, precision: pattern.precision}, true
+		}
+	}
+	return filenameDate{}, false
+}
+
+// parse returns the date pattern finds in stem. Matches that are not a
+// real date, such as month 13, are ignored.
+func (p filenamePattern) parse(stem string, zone *time.Location) (time.Time, bool) {
+	match := p.re.FindStringSubmatch(stem)
+	if match == nil {
+		return time.Time{}, false
+	}
+	parts := map[string]int{}
+	for i, name := range p.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		value, err := strconv.Atoi(match[i])
+		if err != nil {
+			return time.Time{}, false
+		}
+		parts[name] = value
+	}
+	value := time.Date(parts["year"], time.Month(parts["month"]), parts["day"], parts["hour"], parts["minute"], parts["second"], 0, time.UTC)
+	if value.Year() != parts["year"] || int(value.Month()) != parts["month"] || value.Day() != parts["day"] ||
+		value.Hour() != parts["hour"] || value.Minute() != parts["minute"] || value.Second() != parts["second"] {
+		return time.Time{}, false
+	}
+	return time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), 0, zone), true
+}
@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchFilenameDate_Patterns(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		precision DatePrecision
+		want      time.Time
+	}{
+		{"2013-06-11 16.19.16.jpg", "takeout", PrecisionDateTime, time.Date(2013, 6, 11, 16, 19, 16, 0, time.UTC)},
+		{"2013-06-11 16.19.16(1).jpg", "takeout", PrecisionDateTime, time.Date(2013, 6, 11, 16, 19, 16, 0, time.UTC)},
+		{"IMG_20190704_153012.jpg", "camera", PrecisionDateTime, time.Date(2019, 7, 4, 15, 30, 12, 0, time.UTC)},
+		{"PXL_20230101_101010123.jpg", "camera", PrecisionDateTime, time.Date(2023, 1, 1, 10, 10, 10, 0, time.UTC)},
+		{"VID_20180505_090807.mp4", "camera", PrecisionDateTime, time.Date(2018, 5, 5, 9, 8, 7, 0, time.UTC)},
+		{"MVIMG_20200202_020202.jpg", "camera", PrecisionDateTime, time.Date(2020, 2, 2, 2, 2, 2, 0, time.UTC)},
+		{"Screenshot_2020-01-02-10-11-12.png", "screenshot", PrecisionDateTime, time.Date(2020, 1, 2, 10, 11, 12, 0, time.UTC)},
+		{"Screenshot_20200102-101112_Chrome.png", "screenshot", PrecisionDateTime, time.Date(2020, 1, 2, 10, 11, 12, 0, time.UTC)},
+		{"IMG-20200101-WA0003.jpg", "whatsapp", PrecisionDate, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"VID-20200101-WA0010.mp4", "whatsapp", PrecisionDate, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"00100lrPORTRAIT_00100_BURST20190101123456789_COVER.jpg", "burst", PrecisionDateTime, time.Date(2019, 1, 1, 12, 34, 56, 0, time.UTC)},
+		{"signal-2021-03-04-102030.jpg", "signal", PrecisionDateTime, time.Date(2021, 3, 4, 10, 20, 30, 0, time.UTC)},
+		{"signal-2021-03-04-10-20-30-123.jpg", "signal", PrecisionDateTime, time.Date(2021, 3, 4, 10, 20, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := matchFilenameDate(tt.name, nil)
+		if !ok {
+			t.Fatalf("%s: expected a match", tt.name)
+		}
+		if got.pattern != tt.pattern || got.precision != tt.precision || !got.value.Equal(tt.want) {
+			t.Fatalf("%s: got %s %s %v, want %s %s %v", tt.name, got.pattern, got.precision, got.value, tt.pattern, tt.precision, tt.want)
+		}
+	}
+}
+
+func TestMatchFilenameDate_RejectsNonDates(t *testing.T) {
+	for _, name := range []string{
+		"photo.jpg",
+		"IMG_1234.jpg",
+		"IMG_20191304_153012.jpg",
+		"IMG_20190230_153012.jpg",
+		"Screenshot_2020-01-02-25-11-12.png",
+		"IMG-2020-WA0003.jpg",
+	} {
+		if got, ok := matchFilenameDate(name, nil); ok {
+			t.Fatalf("%s: expected no match, got %+v", name, got)
+		}
+	}
+}
+
+func TestMatchFilenameDate_UsesZone(t *testing.T) {
+	zone := time.FixedZone("", 2*60*60)
+	got, ok := matchFilenameDate("IMG_20190704_153012.jpg", zone)
+	if !ok || !got.value.Equal(time.Date(2019, 7, 4, 15, 30, 12, 0, zone)) {
+		t.Fatalf("expected wall-clock time in zone, got %v", got.value)
+	}
+}
+
+func TestPlanWithRunner_DateOnlyFilenameMatchesJSONDay(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1577905200"}}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	_, result, err := PlanWithRunner("IMG-20200101-WA0003.jpg", jsonPath, Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.DateSource != DateSourceTaken || len(result.DateConflicts) != 0 {
+		t.Fatalf("expected a later time on the same day to agree, got %q %q", result.DateSource, result.DateConflicts)
+	}
+}
+
+func TestPlanWithRunner_ReportsFilenamePattern(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"title":"x"}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanWithRunner("IMG-20200101-WA0003.jpg", jsonPath, Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !result.UsedFilenameDate || result.FilenamePattern != "whatsapp" || result.FilenamePrecision != PrecisionDate {
+		t.Fatalf("unexpected filename date result: %+v", result)
+	}
+	if len(commands) != 2 || !hasArgPrefix(commands[1], "-DateTimeOriginal=2020:01:01 00:00:00") {
+		t.Fatalf("expected the filename day to be written at midnight, got %v", commands)
+	}
+}
@@ -0,0 +1,93 @@
+package metadata
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
+)
+
+// sidecarArgs writes the descriptive fields of sc as explicit tag values.
+// Empty fields are left alone so existing tags in the media survive.
+func sidecarArgs(sc sidecar.Sidecar, outMediaPath string) []string {
+	var args []string
+	if sc.Title != "" {
+		args = append(args, "-Title="+sc.Title)
+	}
+	if sc.Description != "" {
+		args = append(args,
+			"-Description="+sc.Description,
+			"-ImageDescription="+sc.Description,
+			"-Caption-Abstract="+sc.Description,
+		)
+	}
+	for _, tag := range sc.Tags {
+		args = append(args, "-Keywords="+tag, "-Subject="+tag)
+	}
+
+	if geo, ok := sc.Position(); ok {
+		lat, lon, alt := formatCoordinate(geo.Latitude), formatCoordinate(geo.Longitude), formatCoordinate(geo.Altitude)
+		// Signed values let exiftool derive the N/S and E/W references.
+		args = append(args,
+			"-GPSAltitude="+alt,
+			"-GPSLatitude="+lat,
+			"-GPSLatitudeRef="+lat,
+			"-GPSLongitude="+lon,
+			"-GPSLongitudeRef="+lon,
+		)
+		if isQuickTimeContainer(outMediaPath) {
+			args = append(args, videoGPSArgs(lat, lon, alt)...)
+		}
+	}
+	return args
+}
+
+// captureDateArgs writes takenAt as the capture date. Without localized,
+// EXIF and XMP dates get the wall-clock time of takenAt and no offset.
+func captureDateArgs(outMediaPath string, takenAt time.Time, localized bool) []string {
+	withOffset := "=" + takenAt.Format(exifDateLayout+"-07:00")
+	var args []string
+	switch {
+	case isQuickTimeContainer(outMediaPath):
+		args = append(args, quickTimeDateArgs(withOffset)...)
+	case localized:
+		args = append(args, localizedDateArgs(outMediaPath, takenAt)...)
+	default:
+		args = append(args, "-AllDates="+takenAt.Format(exifDateLayout))
+	}
+
+	if isHEIFContainer(outMediaPath) {
+		// HEIC/HEIF consumers (e.g. Apple Photos) often read container-level tags
+		// instead of EXIF AllDates, so write both sets.
+		args = append(args, quickTimeDateArgs(withOffset)...)
+	}
+	return args
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// escapeMultilineValues keeps values with line breaks, such as multi-line
+// descriptions, usable in an exiftool argument file, which is read line by
+// line. With -E exiftool decodes HTML entities in every assigned value, so
+// all values are escaped once one needs it.
+func escapeMultilineValues(args []string) []string {
+	if !slices.ContainsFunc(args, func(arg string) bool { return strings.ContainsAny(arg, "\r\n") }) {
+		return args
+	}
+	escaper := strings.NewReplacer("&", "&amp;", "\r", "&#xd;", "\n", "&#xa;")
+	escaped := make([]string, 0, len(args)+1)
+	escaped = append(escaped, "-E")
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || !strings.HasPrefix(arg, "-") {
+			escaped = append(escaped, arg)
+			continue
+		}
+		escaped = append(escaped, name+"="+escaper.Replace(value))
+	}
+	return escaped
+}
@@ -1,92 +1,79 @@
 package metadata
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"slices"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/vchilikov/takeout-fix/internal/exifcmd"
 	"github.com/vchilikov/takeout-fix/internal/mediaext"
 	"github.com/vchilikov/takeout-fix/internal/patharg"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
 )
 
 type ApplyResult struct {
-	UsedFilenameDate    bool
+	UsedFilenameDate bool
+	// FilenamePattern names the filename pattern the date was restored
+	// from, such as "camera", and FilenamePrecision says whether it had a
+	// time. Both are set with UsedFilenameDate.
+	FilenamePattern     string
+	FilenamePrecision   DatePrecision
 	UsedXMPSidecar      bool
 	CreateDateWarned    bool
 	FilenameDateWarned  bool
 	MediaFileDateWarned bool
-}
-
-type timestampStatus int
-
-const (
-	timestampStatusUnknown timestampStatus = iota
-	timestampStatusValid
-	timestampStatusMissing
-	timestampStatusInvalid
-)
-
-var filenameDatePrefixRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}\.\d{2}\.\d{2})`)
-
-type gpsInclusion struct {
-	geoData     bool
-	geoDataExif bool
-}
-
-func detectGPSInclusion(jsonPath string) gpsInclusion {
-	data, err := os.ReadFile(jsonPath)
-	if err != nil {
-		return gpsInclusion{true, true} // fail-open
-	}
-
-	var payload struct {
-		GeoData *struct {
-			Latitude  *float64 `json:"latitude"`
-			Longitude *float64 `json:"longitude"`
-		} `json:"geoData"`
-		GeoDataExif *struct {
-			Latitude  *float64 `json:"latitude"`
-			Longitude *float64 `json:"longitude"`
-		} `json:"geoDataExif"`
-	}
-	if err := json.Unmarshal(data, &payload); err != nil {
-		return gpsInclusion{true, true} // fail-open
-	}
-
-	hasCoords := func(lat, lon *float64) bool {
-		if lat == nil || lon == nil {
-			return false
-		}
-		return *lat != 0 || *lon != 0
-	}
-
-	gd := payload.GeoData != nil && hasCoords(payload.GeoData.Latitude, payload.GeoData.Longitude)
-	gde := payload.GeoDataExif != nil && hasCoords(payload.GeoDataExif.Latitude, payload.GeoDataExif.Longitude)
-	return gpsInclusion{gd, gde}
+	// SidecarIssues describes JSON fields that could not be used, such as
+	// a timestamp that is not a number. Other fields are still written.
+	SidecarIssues []string
+	// DateSource is the source the capture date was taken from, or empty
+	// when no source had a usable date.
+	DateSource DateSource
+	// DateConflicts describes dates that failed the date checks or
+	// disagree with the date that was written.
+	DateConflicts []string
+	// SkippedFields are the fields with a JSON value that the write policy
+	// left unwritten, in Fields order.
+	SkippedFields []string
+	// CaptureTime is the capture date resolved from the date sources. It is
+	// set even when the write policy keeps the dates already in the media,
+	// and zero when no source had a usable date.
+	CaptureTime time.Time
+	// SidecarPath is the XMP sidecar written next to the media, if any.
+	SidecarPath string
+	// ExifRepair is how corrupt EXIF in the media was repaired before the
+	// JSON values were written. Empty when no repair was needed.
+	ExifRepair ExifRepair
+	// LostTags are the tags, such as "ExifIFD:LensModel", that could be
+	// read before the repair and are gone or changed after it.
+	LostTags []string
+	// PeopleTagged is set when person names from the JSON were written.
+	PeopleTagged bool
+	// Favorite is set when the JSON marks the media as favorited and the
+	// rating was written.
+	Favorite bool
+	// LocalZoneFallback is set when TimezoneGPS found no usable GPS
+	// position, so the capture date was resolved in the local zone.
+	LocalZoneFallback bool
 }
 
 func Apply(mediaPath string, jsonPath string) error {
-	_, err := ApplyDetailed(mediaPath, jsonPath)
+	_, err := ApplyDetailed(mediaPath, jsonPath, Options{})
 	return err
 }
 
-func ApplyDetailed(mediaPath string, jsonPath string) (ApplyResult, error) {
-	return ApplyDetailedWithRunner(mediaPath, jsonPath, runExiftool)
+func ApplyDetailed(mediaPath string, jsonPath string, opts Options) (ApplyResult, error) {
+	return ApplyDetailedWithRunner(mediaPath, jsonPath, opts, runExiftool)
 }
 
 func ApplyDetailedWithRunner(
 	mediaPath string,
 	jsonPath string,
+	opts Options,
 	run func(args []string) (string, error),
 ) (ApplyResult, error) {
 	result := ApplyResult{}
@@ -96,27 +83,66 @@ func ApplyDetailedWithRunner(
 
 	metadataPath, mediaDatePath, useXMPSidecar := resolveWriteTargets(mediaPath)
 	result.UsedXMPSidecar = useXMPSidecar
+	if useXMPSidecar {
+		result.SidecarPath = metadataPath
+	}
+
+	sc, err := sidecar.Load(jsonPath)
+	if err != nil {
+		return result, fmt.Errorf("could not read JSON for %s: %w", mediaPath, err)
+	}
+	result.SidecarIssues = sc.Issues
 
 	includeCreateDate := shouldWriteFileCreateDate()
-	status := detectTimestampStatus(jsonPath)
-	includeJSONDate := status == timestampStatusValid || status == timestampStatusUnknown
+	zone, localFallback := opts.Timezone.location(sc)
+	chosen, found, conflicts := opts.resolveCaptureDate(mediaPath, mediaDatePath, sc, zone, run)
+	result.DateConflicts = conflicts
+	result.LocalZoneFallback = found && localFallback
+	useFilenameDate := found && chosen.source == DateSourceFilename
+	var takenAt time.Time
+	if found {
+		result.DateSource = chosen.source
+		result.CaptureTime = chosen.value
+		if !useFilenameDate {
+			takenAt = chosen.value
+		}
+	}
 
-	createDateWarned, err := applyJSONMetadata(
+	filter := newFieldFilter(opts.WritePolicy, metadataPath, run)
+	if !filter.allow(FieldDates, found) {
+		takenAt, useFilenameDate = time.Time{}, false
+	}
+	sc = filter.filterSidecar(sc)
+	result.SkippedFields = filter.skipped
+
+	people := sc.PeopleNames()
+	extra := opts.tagArgs(metadataPath, run)
+	extra = append(extra, opts.peopleArgs(people)...)
+	if sc.Favorited {
+		extra = append(extra, opts.favoriteArgs()...)
+	}
+	createDateWarned, repair, err := applyJSONMetadata(
 		mediaPath,
-		jsonPath,
+		sc,
 		metadataPath,
 		includeCreateDate,
-		includeJSONDate,
 		!useXMPSidecar,
+		takenAt,
+		zone != nil,
+		extra,
 		run,
 	)
 	if err != nil {
 		return result, err
 	}
 	result.CreateDateWarned = createDateWarned
+	result.ExifRepair = repair.repair
+	result.LostTags = repair.lostTags
+	result.PeopleTagged = len(people) > 0
+	result.Favorite = sc.Favorited
 
-	if useXMPSidecar && includeJSONDate {
-		fileDateCreateWarned, fileDateErr := applyMediaFileDatesFromJSON(mediaDatePath, jsonPath, includeCreateDate, run)
+	if useXMPSidecar && !takenAt.IsZero() {
+		fileDateCreateWarned, fileDateErr := applyMediaFileDatesFromJSON(mediaDatePath, takenAt, includeCreateDate, run)
 		if fileDateCreateWarned {
 			result.CreateDateWarned = true
 		}
@@ -125,32 +151,100 @@ func ApplyDetailedWithRunner(
 		}
 	}
 
-	if status == timestampStatusMissing || status == timestampStatusInvalid {
-		if useXMPSidecar {
-			usedFilenameDate, filenameCreateDateWarned, fileDateErr := applyMediaFileDatesFromFilename(mediaDatePath, includeCreateDate, run)
-			if fileDateErr != nil {
-				result.FilenameDateWarned = true
-				result.MediaFileDateWarned = true
-			} else {
-				result.UsedFilenameDate = usedFilenameDate
-				if filenameCreateDateWarned {
-					result.CreateDateWarned = true
-				}
+	if useFilenameDate {
+		writeFilenameDate(&result, chosen.filename, mediaPath, metadataPath, useXMPSidecar, includeCreateDate, zone, run)
+	}
+
+	return result, nil
+}
+
+// writeFilenameDate writes a date restored from the filename and records
+// the outcome in result. Media whose metadata goes to an XMP sidecar only
+// get their file dates.
+func writeFilenameDate(
+	result *ApplyResult,
+	match filenameDate,
+	mediaPath string,
+	metadataPath string,
+	useXMPSidecar bool,
+	includeCreateDate bool,
+	zone *time.Location,
+	run func(args []string) (string, error),
+) {
+	if useXMPSidecar {
+		usedFilenameDate, filenameCreateDateWarned, fileDateErr := applyMediaFileDatesFromFilename(mediaPath, includeCreateDate, zone, run)
+		if fileDateErr != nil {
+			result.FilenameDateWarned = true
+			result.MediaFileDateWarned = true
+		} else {
+			result.UsedFilenameDate = usedFilenameDate
+			if filenameCreateDateWarned {
+				result.CreateDateWarned = true
 			}
+		}
+	} else {
+		usedFilenameDate, filenameCreateDateWarned, fileDateErr := applyFilenameDate(mediaPath, metadataPath, includeCreateDate, zone, run)
+		if fileDateErr != nil {
+			result.FilenameDateWarned = true
 		} else {
-			usedFilenameDate, filenameCreateDateWarned, fileDateErr := applyFilenameDate(mediaPath, metadataPath, includeCreateDate, run)
-			if fileDateErr != nil {
-				result.FilenameDateWarned = true
-			} else {
-				result.UsedFilenameDate = usedFilenameDate
-				if filenameCreateDateWarned {
-					result.CreateDateWarned = true
+			result.UsedFilenameDate = usedFilenameDate
+			if filenameCreateDateWarned {
+				result.CreateDateWarned = true
+			}
+		}
+	}
+	if result.UsedFilenameDate {
+		result.FilenamePattern = match.pattern
+		result.FilenamePrecision = match.precision
+	}
+}
+
+// Plan reports the exiftool write commands ApplyDetailed would run for
+// mediaPath without changing any file.
+func Plan(mediaPath string, jsonPath string, opts Options) ([][]string, ApplyResult, error) {
+	return PlanWithRunner(mediaPath, jsonPath, opts, runExiftool)
+}
+
+// PlanWithRunner records the write commands ApplyDetailedWithRunner would run
+// instead of executing them. Read-only commands still go through run.
+func PlanWithRunner(
+	mediaPath string,
+	jsonPath string,
+	opts Options,
+	run func(args []string) (string, error),
+) ([][]string, ApplyResult, error) {
+	if run == nil {
+		return nil, ApplyResult{}, errors.New("nil exiftool runner")
+	}
+
+	var commands [][]string
+	result, err := ApplyDetailedWithRunner(mediaPath, jsonPath, opts, recordWrites(mediaPath, opts.SourcePath, run, &commands))
+	return commands, result, err
+}
+
+// recordWrites returns a runner that appends write commands to commands
+// and runs read-only ones. With sourcePath set, reads of mediaPath go to
+// sourcePath, where the media still is during a plan.
+func recordWrites(mediaPath string, sourcePath string, run func(args []string) (string, error), commands *[][]string) func(args []string) (string, error) {
+	return func(args []string) (string, error) {
+		if isWriteCommand(args) {
+			*commands = append(*commands, slices.Clone(args))
+			return "", nil
+		}
+		if sourcePath != "" && sourcePath != mediaPath {
+			args = slices.Clone(args)
+			for i, arg := range args {
+				if arg == patharg.Safe(mediaPath) {
+					args[i] = patharg.Safe(sourcePath)
 				}
 			}
 		}
+		return run(args)
 	}
+}
 
-	return result, nil
+func isWriteCommand(args []string) bool {
+	return slices.Contains(args, "-overwrite_original")
 }
 
 func runExiftool(args []string) (string, error) {
@@ -191,76 +285,47 @@ func resolveWriteTargets(mediaPath string) (metadataPath string, mediaDatePath s
 	return mediaPath + ".xmp", mediaPath, true
 }
 
-func buildExiftoolArgs(jsonPath string, outMediaPath string, includeCreateDate bool) []string {
-	return buildExiftoolArgsWithOptions(jsonPath, outMediaPath, includeCreateDate, true, true, gpsInclusion{true, true})
+func buildExiftoolArgs(sc sidecar.Sidecar, outMediaPath string, includeCreateDate bool) []string {
+	var takenAt time.Time
+	if sc.PhotoTakenTime.Status == sidecar.TimestampValid {
+		takenAt = sc.PhotoTakenTime.Time.Local()
+	}
+	return buildExiftoolArgsWithOptions(sc, outMediaPath, includeCreateDate, true, takenAt, false, nil)
 }
 
+// buildExiftoolArgsWithOptions builds the command that writes sc to
+// outMediaPath. takenAt is the capture time in the zone it is written in;
+// zero skips date tags. localized adds the zone offset to EXIF dates, which
+// are otherwise written as local wall-clock time without an offset.
 func buildExiftoolArgsWithOptions(
-	jsonPath string,
+	sc sidecar.Sidecar,
 	outMediaPath string,
 	includeCreateDate bool,
-	includeJSONDateTags bool,
 	includeFileSystemDates bool,
-	gps gpsInclusion,
+	takenAt time.Time,
+	localized bool,
+	extra []string,
 ) []string {
-	args := []string{
-		"-d", "%s",
-		"-m",
-		"-TagsFromFile", patharg.Safe(jsonPath),
-		"-Title<Title",
-		"-Description<Description",
-		"-ImageDescription<Description",
-		"-Caption-Abstract<Description",
-		// Google Takeout stores Tags as a JSON list. Exiftool maps this list
-		// into list-like target tags such as Keywords/Subject.
-		"-Keywords<Tags",
-		"-Subject<Tags",
-	}
-
-	if gps.geoData {
-		args = append(args,
-			"-GPSAltitude<GeoDataAltitude",
-			"-GPSLatitude<GeoDataLatitude",
-			"-GPSLatitudeRef<GeoDataLatitude",
-			"-GPSLongitude<GeoDataLongitude",
-			"-GPSLongitudeRef<GeoDataLongitude",
-		)
-	}
-	if gps.geoDataExif {
-		args = append(args,
-			"-GPSAltitude<GeoDataExifAltitude",
-			"-GPSLatitude<GeoDataExifLatitude",
-			"-GPSLatitudeRef<GeoDataExifLatitude",
-			"-GPSLongitude<GeoDataExifLongitude",
-			"-GPSLongitudeRef<GeoDataExifLongitude",
-		)
-	}
+	var tags []string
+	tags = append(tags, sidecarArgs(sc, outMediaPath)...)
 
-	if includeJSONDateTags {
-		args = append(args, "-AllDates<PhotoTakenTimeTimestamp")
+	if !takenAt.IsZero() {
+		tags = append(tags, captureDateArgs(outMediaPath, takenAt, localized)...)
+		// File dates are instants, so they always carry the offset.
+		fileDate := takenAt.Format(exifDateLayout + "-07:00")
 		if includeFileSystemDates {
-			args = append(args, "-FileModifyDate<PhotoTakenTimeTimestamp")
+			tags = append(tags, "-FileModifyDate="+fileDate)
+			if includeCreateDate {
+				tags = append(tags, "-FileCreateDate="+fileDate)
+			}
 		}
 	}
 
-	if includeJSONDateTags && isHEIFContainer(outMediaPath) {
-		// HEIC/HEIF consumers (e.g. Apple Photos) often read container-level tags
-		// instead of EXIF AllDates, so write both sets.
-		args = append(args,
-			"-QuickTime:CreateDate<PhotoTakenTimeTimestamp",
-			"-QuickTime:ModifyDate<PhotoTakenTimeTimestamp",
-			"-QuickTime:TrackCreateDate<PhotoTakenTimeTimestamp",
-			"-QuickTime:TrackModifyDate<PhotoTakenTimeTimestamp",
-			"-QuickTime:MediaCreateDate<PhotoTakenTimeTimestamp",
-			"-QuickTime:MediaModifyDate<PhotoTakenTimeTimestamp",
-			"-Keys:CreationDate<PhotoTakenTimeTimestamp",
-		)
-	}
-
-	if includeJSONDateTags && includeCreateDate && includeFileSystemDates {
-		args = append(args, "-FileCreateDate<PhotoTakenTimeTimestamp")
-	}
+	// Values that do not come from the sidecar model, such as album names.
+	tags = append(tags, extra...)
 
+	args := []string{"-m"}
+	args = append(args, escapeMultilineValues(tags)...)
 	args = append(args,
 		"-overwrite_original",
 	)
@@ -271,97 +336,65 @@ func buildExiftoolArgsWithOptions(
 
 func applyJSONMetadata(
 	mediaPath string,
-	jsonPath string,
+	sc sidecar.Sidecar,
 	outMediaPath string,
 	includeCreateDate bool,
-	includeJSONDateTags bool,
 	includeFileSystemDates bool,
+	takenAt time.Time,
+	localized bool,
+	extra []string,
 	run func(args []string) (string, error),
-) (bool, error) {
-	gps := detectGPSInclusion(jsonPath)
-	args := buildExiftoolArgsWithOptions(
-		jsonPath,
-		outMediaPath,
-		includeCreateDate,
-		includeJSONDateTags,
-		includeFileSystemDates,
-		gps,
-	)
-	output, err := run(args)
+) (bool, exifRepairOutcome, error) {
+	writeArgs := func(includeCreateDate bool) []string {
+		return buildExiftoolArgsWithOptions(
+			sc,
+			outMediaPath,
+			includeCreateDate,
+			includeFileSystemDates,
+			takenAt,
+			localized,
+			extra,
+		)
+	}
+	writesCreateDate := !takenAt.IsZero() && includeFileSystemDates && includeCreateDate
+	output, err := run(writeArgs(includeCreateDate))
 	if err != nil {
-		if includeJSONDateTags && includeFileSystemDates && includeCreateDate && strings.Contains(strings.ToLower(output), "filecreatedate") {
+		if writesCreateDate && strings.Contains(strings.ToLower(output), "filecreatedate") {
 			// Some filesystems and formats may not support FileCreateDate writes.
-			retryArgs := buildExiftoolArgsWithOptions(
-				jsonPath,
-				outMediaPath,
-				false,
-				includeJSONDateTags,
-				includeFileSystemDates,
-				gps,
-			)
-			retryOutput, retryErr := run(retryArgs)
+			retryOutput, retryErr := run(writeArgs(false))
 			if retryErr == nil {
-				return true, nil
+				return true, exifRepairOutcome{}, nil
 			}
-			return false, fmt.Errorf("could not fix metadata for %s\nerror: %w\noutput: %s", mediaPath, retryErr, retryOutput)
+			return false, exifRepairOutcome{}, fmt.Errorf("could not fix metadata for %s\nerror: %w\noutput: %s", mediaPath, retryErr, retryOutput)
 		}
 
 		// Corrupt EXIF (e.g. Samsung "Bad format (0) for ExifIFD entry 25",
-		// or "Error reading OtherImageStart data in IFD0"):
-		// strip all metadata, then re-apply from JSON.
+		// or "Error reading OtherImageStart data in IFD0"): repair the
+		// metadata, then re-apply from JSON.
 		if looksLikeCorruptExif(output) {
-			stripArgs := []string{"-all=", "-overwrite_original", patharg.Safe(outMediaPath)}
-			if _, stripErr := run(stripArgs); stripErr == nil {
-				retryArgs := buildExiftoolArgsWithOptions(
-					jsonPath,
-					outMediaPath,
-					includeCreateDate,
-					includeJSONDateTags,
-					includeFileSystemDates,
-					gps,
-				)
-				retryOutput, retryErr := run(retryArgs)
-				if retryErr == nil {
-					return false, nil
-				}
-				if includeJSONDateTags && includeFileSystemDates && includeCreateDate && strings.Contains(strings.ToLower(retryOutput), "filecreatedate") {
-					fallbackArgs := buildExiftoolArgsWithOptions(
-						jsonPath,
-						outMediaPath,
-						false,
-						includeJSONDateTags,
-						includeFileSystemDates,
-						gps,
-					)
-					fallbackOutput, fallbackErr := run(fallbackArgs)
-					if fallbackErr == nil {
-						return true, nil
-					}
-					return false, fmt.Errorf("could not fix metadata for %s after stripping corrupt EXIF\nerror: %w\noutput: %s", mediaPath, fallbackErr, fallbackOutput)
-				}
-				return false, fmt.Errorf("could not fix metadata for %s after stripping corrupt EXIF\nerror: %w\noutput: %s", mediaPath, retryErr, retryOutput)
-			}
+			return repairCorruptExif(mediaPath, outMediaPath, includeCreateDate, writesCreateDate, writeArgs, run, err, output)
 		}
 
-		return false, fmt.Errorf("could not fix metadata for %s\nerror: %w\noutput: %s", mediaPath, err, output)
+		return false, exifRepairOutcome{}, fmt.Errorf("could not fix metadata for %s\nerror: %w\noutput: %s", mediaPath, err, output)
 	}
-	return false, nil
+	return false, exifRepairOutcome{}, nil
 }
 
 func applyMediaFileDatesFromJSON(
 	mediaPath string,
-	jsonPath string,
+	takenAt time.Time,
 	includeCreateDate bool,
 	run func(args []string) (string, error),
 ) (bool, error) {
-	args := buildMediaFileDateArgsFromJSON(mediaPath, jsonPath, includeCreateDate)
+	formatted := takenAt.Format(exifDateLayout + "-07:00")
+	args := buildMediaFileDateArgs(mediaPath, formatted, includeCreateDate)
 	output, err := run(args)
 	if err == nil {
 		return false, nil
 	}
 
 	if includeCreateDate && strings.Contains(strings.ToLower(output), "filecreatedate") {
-		retryArgs := buildMediaFileDateArgsFromJSON(mediaPath, jsonPath, false)
+		retryArgs := buildMediaFileDateArgs(mediaPath, formatted, false)
 		retryOutput, retryErr := run(retryArgs)
 		if retryErr == nil {
 			return true, nil
@@ -372,33 +405,22 @@ func applyMediaFileDatesFromJSON(
 	return false, fmt.Errorf("could not apply media file dates for %s\nerror: %w\noutput: %s", mediaPath, err, output)
 }
 
-func buildMediaFileDateArgsFromJSON(mediaPath string, jsonPath string, includeCreateDate bool) []string {
-	args := []string{
-		"-d", "%s",
-		"-m",
-		"-TagsFromFile", patharg.Safe(jsonPath),
-		"-FileModifyDate<PhotoTakenTimeTimestamp",
-	}
-
-	if includeCreateDate {
-		args = append(args, "-FileCreateDate<PhotoTakenTimeTimestamp")
-	}
-
-	args = append(args, "-overwrite_original", patharg.Safe(mediaPath))
-	return args
-}
-
 func applyMediaFileDatesFromFilename(
 	mediaPath string,
 	includeCreateDate bool,
+	zone *time.Location,
 	run func(args []string) (string, error),
 ) (bool, bool, error) {
-	parsed, ok := parseFilenameDate(mediaPath)
+	match, ok := matchFilenameDate(mediaPath, zone)
 	if !ok {
 		return false, false, nil
 	}
+	parsed := match.value
 
 	formatted := parsed.Format("2006:01:02 15:04:05")
+	if zone != nil {
+		formatted = parsed.Format(exifDateLayout + "-07:00")
+	}
 	args := buildMediaFileDateArgs(mediaPath, formatted, includeCreateDate)
 	output, err := run(args)
 	if err == nil {
@@ -435,21 +457,24 @@ func applyFilenameDate(
 	mediaPath string,
 	outMediaPath string,
 	includeCreateDate bool,
+	zone *time.Location,
 	run func(args []string) (string, error),
 ) (bool, bool, error) {
-	parsed, ok := parseFilenameDate(mediaPath)
+	match, ok := matchFilenameDate(mediaPath, zone)
 	if !ok {
 		return false, false, nil
 	}
+	parsed := match.value
+	localized := zone != nil
 
-	args := buildFilenameDateArgs(outMediaPath, parsed, includeCreateDate)
+	args := buildFilenameDateArgs(outMediaPath, parsed, includeCreateDate, localized)
 	output, err := run(args)
 	if err == nil {
 		return true, false, nil
 	}
 
 	if includeCreateDate && strings.Contains(strings.ToLower(output), "filecreatedate") {
-		retryArgs := buildFilenameDateArgs(outMediaPath, parsed, false)
+		retryArgs := buildFilenameDateArgs(outMediaPath, parsed, false, localized)
 		retryOutput, retryErr := run(retryArgs)
 		if retryErr == nil {
 			return true, true, nil
@@ -460,32 +485,47 @@ func applyFilenameDate(
 	return false, false, fmt.Errorf("could not apply filename date for %s\nerror: %w\noutput: %s", mediaPath, err, output)
 }
 
-func buildFilenameDateArgs(outMediaPath string, value time.Time, includeCreateDate bool) []string {
+func buildFilenameDateArgs(outMediaPath string, value time.Time, includeCreateDate bool, localized bool) []string {
 	formatted := value.Format("2006:01:02 15:04:05")
+	// A localized value carries the zone of the timezone policy. File dates
+	// and XMP dates take the offset directly; EXIF dates get OffsetTime tags.
+	fileDate, dateValue := formatted, formatted
+	if localized {
+		fileDate = value.Format(exifDateLayout + "-07:00")
+		if isXMPSidecar(outMediaPath) {
+			dateValue = fileDate
+		}
+	}
 
 	// Intentionally omit -d "%s": fallback writes fully formatted date-time strings, not epoch values.
 	args := []string{
 		"-m",
-		"-DateTimeOriginal=" + formatted,
-		"-CreateDate=" + formatted,
-		"-ModifyDate=" + formatted,
-		"-FileModifyDate=" + formatted,
+		"-DateTimeOriginal=" + dateValue,
+		"-CreateDate=" + dateValue,
+		"-ModifyDate=" + dateValue,
+		"-FileModifyDate=" + fileDate,
+	}
+
+	// Filename dates without a timezone policy are UTC, so the QuickTime
+	// dates always carry an offset.
+	quickTimeDates := "=" + value.Format(exifDateLayout+"-07:00")
+	if isQuickTimeContainer(outMediaPath) {
+		args = append(args, quickTimeDateArgs(quickTimeDates)...)
+	} else if localized && !isXMPSidecar(outMediaPath) {
+		offset := value.Format("-07:00")
+		args = append(args,
+			"-OffsetTimeOriginal="+offset,
+			"-OffsetTime="+offset,
+			"-OffsetTimeDigitized="+offset,
+		)
 	}
 
 	if isHEIFContainer(outMediaPath) {
-		args = append(args,
-			"-QuickTime:CreateDate="+formatted,
-			"-QuickTime:ModifyDate="+formatted,
-			"-QuickTime:TrackCreateDate="+formatted,
-			"-QuickTime:TrackModifyDate="+formatted,
-			"-QuickTime:MediaCreateDate="+formatted,
-			"-QuickTime:MediaModifyDate="+formatted,
-			"-Keys:CreationDate="+formatted,
-		)
+		args = append(args, quickTimeDateArgs(quickTimeDates)...)
 	}
 
 	if includeCreateDate {
-		args = append(args, "-FileCreateDate="+formatted)
+		args = append(args, "-FileCreateDate="+fileDate)
 	}
 
 	args = append(args,
@@ -495,69 +535,6 @@ func buildFilenameDateArgs(outMediaPath string, value time.Time, includeCreateDa
 	return args
 }
 
-func parseFilenameDate(mediaPath string) (time.Time, bool) {
-	base := filepath.Base(mediaPath)
-	stem := strings.TrimSuffix(base, filepath.Ext(base))
-	match := filenameDatePrefixRe.FindStringSubmatch(stem)
-	if len(match) != 2 {
-		return time.Time{}, false
-	}
-	// Filenames do not encode timezone, so fallback parsing assumes UTC.
-	parsed, err := time.ParseInLocation("2006-01-02 15.04.05", match[1], time.UTC)
-	if err != nil {
-		return time.Time{}, false
-	}
-	return parsed, true
-}
-
-func detectTimestampStatus(jsonPath string) timestampStatus {
-	data, err := os.ReadFile(jsonPath)
-	if err != nil {
-		return timestampStatusUnknown
-	}
-
-	var payload map[string]any
-	if err := json.Unmarshal(data, &payload); err != nil {
-		return timestampStatusUnknown
-	}
-
-	photoTakenTimeValue, ok := payload["photoTakenTime"]
-	if !ok {
-		return timestampStatusMissing
-	}
-	photoTakenTime, ok := photoTakenTimeValue.(map[string]any)
-	if !ok {
-		return timestampStatusUnknown
-	}
-
-	timestampValue, ok := photoTakenTime["timestamp"]
-	if !ok {
-		return timestampStatusMissing
-	}
-
-	switch v := timestampValue.(type) {
-	case string:
-		if strings.TrimSpace(v) == "" {
-			return timestampStatusMissing
-		}
-		parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
-		if err != nil {
-			return timestampStatusInvalid
-		}
-		if parsed <= 0 {
-			return timestampStatusInvalid
-		}
-		return timestampStatusValid
-	case float64:
-		if v <= 0 {
-			return timestampStatusInvalid
-		}
-		return timestampStatusValid
-	default:
-		return timestampStatusInvalid
-	}
-}
-
 var shouldWriteFileCreateDate = func() bool {
 	return runtime.GOOS == "darwin"
 }
@@ -582,3 +559,44 @@ func isHEIFContainer(path string) bool {
 		return false
 	}
 }
+
+func isQuickTimeContainer(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".mov", ".m4v", ".3gp":
+		return true
+	default:
+		return false
+	}
+}
+
+// quickTimeDateArgs writes the QuickTime container, track and media dates
+// of MP4/MOV/3GP videos and HEIC/HEIF photos from source, such as
+// "=2024:07:01 14:00:00+02:00". QuickTime stores these dates in UTC; with
+// the QuickTimeUTC option exiftool converts the local value to UTC instead
+// of storing it as is. Keys:CreationDate keeps the local time and offset.
+func quickTimeDateArgs(source string) []string {
+	return []string{
+		"-api", "QuickTimeUTC=1",
+		"-QuickTime:CreateDate" + source,
+		"-QuickTime:ModifyDate" + source,
+		"-QuickTime:TrackCreateDate" + source,
+		"-QuickTime:TrackModifyDate" + source,
+		"-QuickTime:MediaCreateDate" + source,
+		"-QuickTime:MediaModifyDate" + source,
+		"-Keys:CreationDate" + source,
+	}
+}
+
+// videoGPSArgs writes a position to the location tags video players and
+// photo managers read from MP4/MOV/3GP files.
+func videoGPSArgs(lat string, lon string, alt string) []string {
+	coordinates := "=" + lat + " " + lon + " " + alt
+	return []string{
+		"-Keys:GPSCoordinates" + coordinates,
+		"-UserData:GPSCoordinates" + coordinates,
+	}
+}
+
+func isXMPSidecar(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xmp")
+}
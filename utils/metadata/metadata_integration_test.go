@@ -51,7 +51,7 @@ func TestApplyDetailed_UpdatesFileModifyAndCreateDatesOnDarwin(t *testing.T) {
 		t.Fatalf("unexpected precondition: timestamps already set")
 	}
 
-	_, err = ApplyDetailed(mediaPath, jsonPath)
+	_, err = ApplyDetailed(mediaPath, jsonPath, Options{})
 	if err != nil {
 		t.Fatalf("ApplyDetailed error: %v", err)
 	}
@@ -90,7 +90,7 @@ func TestApplyDetailed_UsesGeoDataExifFallback(t *testing.T) {
 		t.Fatalf("write json: %v", err)
 	}
 
-	if _, err := ApplyDetailed(mediaPath, jsonPath); err != nil {
+	if _, err := ApplyDetailed(mediaPath, jsonPath, Options{}); err != nil {
 		t.Fatalf("ApplyDetailed error: %v", err)
 	}
 
@@ -145,7 +145,7 @@ func TestApplyDetailed_WritesTagsToKeywordsAndSubject(t *testing.T) {
 		t.Fatalf("write json: %v", err)
 	}
 
-	if _, err := ApplyDetailed(mediaPath, jsonPath); err != nil {
+	if _, err := ApplyDetailed(mediaPath, jsonPath, Options{}); err != nil {
 		t.Fatalf("ApplyDetailed error: %v", err)
 	}
 
@@ -174,6 +174,171 @@ func TestApplyDetailed_WritesTagsToKeywordsAndSubject(t *testing.T) {
 	}
 }
 
+func TestApplyDetailed_WritesAlbumsToConfiguredTag(t *testing.T) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		t.Skip("exiftool not available")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(tinyJPEGB64)
+	if err != nil {
+		t.Fatalf("decode tiny jpeg: %v", err)
+	}
+	jsonData := `{
+  "photoTakenTime": {"timestamp": "1719835200"},
+  "tags": ["foo"]
+}`
+
+	for _, tc := range []struct {
+		tag  AlbumTag
+		read string
+		want []string
+	}{
+		{tag: AlbumTagAlbum, read: "-XMP-xmpDM:Album", want: []string{"Trip; Family"}},
+		{tag: AlbumTagHierarchical, read: "-XMP-lr:HierarchicalSubject", want: []string{"Albums|Trip", "Albums|Family"}},
+		{tag: AlbumTagKeywords, read: "-Keywords", want: []string{"foo", "Trip", "Family"}},
+	} {
+		dir := t.TempDir()
+		mediaPath := filepath.Join(dir, "file.jpg")
+		jsonPath := filepath.Join(dir, "meta.json")
+		if err := os.WriteFile(mediaPath, decoded, 0o600); err != nil {
+			t.Fatalf("write media: %v", err)
+		}
+		if err := os.WriteFile(jsonPath, []byte(jsonData), 0o600); err != nil {
+			t.Fatalf("write json: %v", err)
+		}
+
+		opts := Options{Albums: []string{"Trip", "Family"}, AlbumTag: tc.tag}
+		if _, err := ApplyDetailed(mediaPath, jsonPath, opts); err != nil {
+			t.Fatalf("ApplyDetailed(%s) error: %v", tc.tag, err)
+		}
+
+		out, err := exec.Command("exiftool", "-j", tc.read, "--", mediaPath).Output()
+		if err != nil {
+			t.Fatalf("read tags: %v", err)
+		}
+		var items []map[string]any
+		if err := json.Unmarshal(out, &items); err != nil || len(items) != 1 {
+			t.Fatalf("parse exiftool json: %v (%s)", err, out)
+		}
+		var got []string
+		for key, value := range items[0] {
+			if key != "SourceFile" {
+				got = append(got, valuesFromTag(value)...)
+			}
+		}
+		for _, want := range tc.want {
+			if !slices.Contains(got, want) {
+				t.Fatalf("%s: expected %q, got %v", tc.tag, want, got)
+			}
+		}
+	}
+}
+
+func TestApplyDetailed_WritesPeopleTags(t *testing.T) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		t.Skip("exiftool not available")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(tinyJPEGB64)
+	if err != nil {
+		t.Fatalf("decode tiny jpeg: %v", err)
+	}
+	dir := t.TempDir()
+	mediaPath := filepath.Join(dir, "file.jpg")
+	jsonPath := filepath.Join(dir, "meta.json")
+	if err := os.WriteFile(mediaPath, decoded, 0o600); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	jsonData := `{
+  "photoTakenTime": {"timestamp": "1719835200"},
+  "people": [{"name": "Alice"}, {"name": "Bob"}]
+}`
+	if err := os.WriteFile(jsonPath, []byte(jsonData), 0o600); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+
+	// A second run must not duplicate the keywords.
+	for range 2 {
+		result, err := ApplyDetailed(mediaPath, jsonPath, Options{})
+		if err != nil {
+			t.Fatalf("ApplyDetailed error: %v", err)
+		}
+		if !result.PeopleTagged {
+			t.Fatalf("expected PeopleTagged")
+		}
+	}
+
+	for tag, want := range map[string][]string{
+		"-XMP-iptcExt:PersonInImage":  {"Alice", "Bob"},
+		"-XMP-lr:HierarchicalSubject": {"People|Alice", "People|Bob"},
+	} {
+		out, err := exec.Command("exiftool", "-j", tag, "--", mediaPath).Output()
+		if err != nil {
+			t.Fatalf("read tags: %v", err)
+		}
+		var items []map[string]any
+		if err := json.Unmarshal(out, &items); err != nil || len(items) != 1 {
+			t.Fatalf("parse exiftool json: %v (%s)", err, out)
+		}
+		var got []string
+		for key, value := range items[0] {
+			if key != "SourceFile" {
+				got = append(got, valuesFromTag(value)...)
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: want %v, got %v", tag, want, got)
+		}
+	}
+}
+
+func TestApplyDetailed_RatesFavorites(t *testing.T) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		t.Skip("exiftool not available")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(tinyJPEGB64)
+	if err != nil {
+		t.Fatalf("decode tiny jpeg: %v", err)
+	}
+	dir := t.TempDir()
+	mediaPath := filepath.Join(dir, "file.jpg")
+	jsonPath := filepath.Join(dir, "meta.json")
+	if err := os.WriteFile(mediaPath, decoded, 0o600); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	jsonData := `{
+  "photoTakenTime": {"timestamp": "1719835200"},
+  "favorited": true
+}`
+	if err := os.WriteFile(jsonPath, []byte(jsonData), 0o600); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+
+	result, err := ApplyDetailed(mediaPath, jsonPath, Options{FavoriteRating: 4, FavoriteKeyword: true})
+	if err != nil {
+		t.Fatalf("ApplyDetailed error: %v", err)
+	}
+	if !result.Favorite {
+		t.Fatalf("expected Favorite")
+	}
+
+	out, err := exec.Command("exiftool", "-j", "-XMP:Rating", "-Keywords", "--", mediaPath).Output()
+	if err != nil {
+		t.Fatalf("read tags: %v", err)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(out, &items); err != nil || len(items) != 1 {
+		t.Fatalf("parse exiftool json: %v (%s)", err, out)
+	}
+	if rating, _ := items[0]["Rating"].(float64); rating != 4 {
+		t.Fatalf("expected rating 4, got %v", items[0]["Rating"])
+	}
+	if keywords := valuesFromTag(items[0]["Keywords"]); !slices.Equal(keywords, []string{"Favorite"}) {
+		t.Fatalf("expected Favorite keyword, got %v", keywords)
+	}
+}
+
 func statSeconds(t *testing.T, path string) (int64, int64) {
 	t.Helper()
 
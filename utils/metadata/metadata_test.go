@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
 )
 
 func TestHasSupportedExtension(t *testing.T) {
@@ -38,12 +41,41 @@ func stubWritableDecision(t *testing.T, fn func(path string) (bool, bool)) {
 	})
 }
 
+// testSidecarJSON has every field buildExiftoolArgs maps, with different
+// geoData and geoDataExif positions.
+const testSidecarJSON = `{
+	"title": "IMG_0001.jpg",
+	"description": "Lake trip",
+	"photoTakenTime": {"timestamp": "1719835200"},
+	"geoData": {"latitude": 10.5, "longitude": 20.25, "altitude": 3},
+	"geoDataExif": {"latitude": -33.5, "longitude": 151.25, "altitude": 42.5},
+	"tags": ["lake", "summer"]
+}`
+
+func parseTestSidecar(t *testing.T, data string) sidecar.Sidecar {
+	t.Helper()
+	sc, err := sidecar.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("parse sidecar fixture: %v", err)
+	}
+	return sc
+}
+
+func hasArgPrefix(args []string, prefix string) bool {
+	return slices.ContainsFunc(args, func(arg string) bool {
+		return strings.HasPrefix(arg, prefix)
+	})
+}
+
 func TestBuildExiftoolArgs_DoesNotIncludeOffsetTags(t *testing.T) {
-	args := buildExiftoolArgs("meta.json", "photo.jpg", true)
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.jpg", true)
 
 	if slices.Contains(args, "--") {
 		t.Fatalf("did not expect -- separator in args: %v", args)
 	}
+	if slices.Contains(args, "-TagsFromFile") {
+		t.Fatalf("did not expect values to be copied from the JSON file: %v", args)
+	}
 
 	for _, arg := range args {
 		if strings.HasPrefix(arg, "-OffsetTime") {
@@ -51,60 +83,80 @@ func TestBuildExiftoolArgs_DoesNotIncludeOffsetTags(t *testing.T) {
 		}
 	}
 
-	if !slices.Contains(args, "-FileModifyDate<PhotoTakenTimeTimestamp") {
-		t.Fatalf("expected FileModifyDate mapping in args")
+	if !hasArgPrefix(args, "-FileModifyDate=") {
+		t.Fatalf("expected FileModifyDate value in args: %v", args)
 	}
-	if !slices.Contains(args, "-FileCreateDate<PhotoTakenTimeTimestamp") {
-		t.Fatalf("expected FileCreateDate mapping in args")
+	if !hasArgPrefix(args, "-FileCreateDate=") {
+		t.Fatalf("expected FileCreateDate value in args: %v", args)
 	}
-	if !slices.Contains(args, "-GPSLatitude<GeoDataExifLatitude") {
-		t.Fatalf("expected GeoDataExif latitude fallback mapping in args")
+	for _, want := range []string{
+		"-Title=IMG_0001.jpg",
+		"-Description=Lake trip",
+		"-Caption-Abstract=Lake trip",
+		"-GPSLatitude=-33.5",
+		"-GPSLongitude=151.25",
+		"-GPSAltitude=42.5",
+		"-Keywords=lake",
+		"-Keywords=summer",
+		"-Subject=lake",
+		"-Subject=summer",
+	} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q in args: %v", want, args)
+		}
 	}
-	if !slices.Contains(args, "-GPSLongitude<GeoDataExifLongitude") {
-		t.Fatalf("expected GeoDataExif longitude fallback mapping in args")
+}
+
+func TestBuildExiftoolArgs_WritesCaptureTimeAsLocalWallClock(t *testing.T) {
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.jpg", true)
+
+	takenAt := time.Unix(1719835200, 0).Local()
+	if want := "-AllDates=" + takenAt.Format(exifDateLayout); !slices.Contains(args, want) {
+		t.Fatalf("expected %q in args: %v", want, args)
 	}
-	if !slices.Contains(args, "-Keywords<Tags") {
-		t.Fatalf("expected Keywords mapping in args")
+	if want := "-FileModifyDate=" + takenAt.Format(exifDateLayout+"-07:00"); !slices.Contains(args, want) {
+		t.Fatalf("expected %q in args: %v", want, args)
 	}
-	if !slices.Contains(args, "-Subject<Tags") {
-		t.Fatalf("expected Subject mapping in args")
+	if slices.Contains(args, "-d") {
+		t.Fatalf("did not expect a date format option: %v", args)
 	}
 }
 
 func TestBuildExiftoolArgs_ExcludeCreateDateWhenDisabled(t *testing.T) {
-	args := buildExiftoolArgs("meta.json", "photo.jpg", false)
-	if slices.Contains(args, "-FileCreateDate<PhotoTakenTimeTimestamp") {
-		t.Fatalf("did not expect FileCreateDate mapping when disabled, got: %v", args)
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.jpg", false)
+	if hasArgPrefix(args, "-FileCreateDate") {
+		t.Fatalf("did not expect FileCreateDate when disabled, got: %v", args)
 	}
 }
 
 func TestBuildExiftoolArgs_HEICIncludesQuickTimeAndKeysDates(t *testing.T) {
-	args := buildExiftoolArgs("meta.json", "photo.HEIC", true)
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.HEIC", true)
 
-	want := []string{
-		"-QuickTime:CreateDate<PhotoTakenTimeTimestamp",
-		"-QuickTime:ModifyDate<PhotoTakenTimeTimestamp",
-		"-QuickTime:TrackCreateDate<PhotoTakenTimeTimestamp",
-		"-QuickTime:TrackModifyDate<PhotoTakenTimeTimestamp",
-		"-QuickTime:MediaCreateDate<PhotoTakenTimeTimestamp",
-		"-QuickTime:MediaModifyDate<PhotoTakenTimeTimestamp",
-		"-Keys:CreationDate<PhotoTakenTimeTimestamp",
-	}
-
-	for _, tag := range want {
-		if !slices.Contains(args, tag) {
+	for _, tag := range []string{
+		"-QuickTime:CreateDate=",
+		"-QuickTime:ModifyDate=",
+		"-QuickTime:TrackCreateDate=",
+		"-QuickTime:TrackModifyDate=",
+		"-QuickTime:MediaCreateDate=",
+		"-QuickTime:MediaModifyDate=",
+		"-Keys:CreationDate=",
+	} {
+		if !hasArgPrefix(args, tag) {
 			t.Fatalf("expected %q in args, got: %v", tag, args)
 		}
 	}
+	if i := slices.Index(args, "QuickTimeUTC=1"); i < 1 || args[i-1] != "-api" {
+		t.Fatalf("HEIC QuickTime dates must be written in UTC like videos: %v", args)
+	}
 }
 
 func TestBuildExiftoolArgs_JPEGDoesNotIncludeQuickTimeAndKeysDates(t *testing.T) {
-	args := buildExiftoolArgs("meta.json", "photo.jpg", true)
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.jpg", true)
 	for _, tag := range []string{
-		"-QuickTime:CreateDate<PhotoTakenTimeTimestamp",
-		"-Keys:CreationDate<PhotoTakenTimeTimestamp",
+		"-QuickTime:CreateDate",
+		"-Keys:CreationDate",
 	} {
-		if slices.Contains(args, tag) {
+		if hasArgPrefix(args, tag) {
 			t.Fatalf("did not expect %q for jpeg, got: %v", tag, args)
 		}
 	}
@@ -117,193 +169,49 @@ func TestShouldWriteFileCreateDate(t *testing.T) {
 	}
 }
 
-func TestBuildExiftoolArgs_GeoDataExifComesAfterGeoData(t *testing.T) {
-	args := buildExiftoolArgs("meta.json", "photo.jpg", true)
-
-	indexOf := func(prefix string) int {
-		for i, arg := range args {
-			if strings.HasPrefix(arg, prefix) {
-				return i
-			}
-		}
-		return -1
-	}
-
-	geoData := indexOf("-GPSLatitude<GeoDataLatitude")
-	geoDataExif := indexOf("-GPSLatitude<GeoDataExifLatitude")
-	if geoData == -1 || geoDataExif == -1 {
-		t.Fatalf("expected both GeoData and GeoDataExif latitude mappings, got %v", args)
-	}
-	if geoDataExif <= geoData {
-		t.Fatalf("expected GeoDataExif mapping to be applied after GeoData mapping, got %v", args)
-	}
-}
+func TestBuildExiftoolArgs_PrefersGeoDataExif(t *testing.T) {
+	args := buildExiftoolArgs(parseTestSidecar(t, testSidecarJSON), "photo.jpg", true)
 
-func TestBuildExiftoolArgsWithOptions_ExcludesDateTagsWhenDisabled(t *testing.T) {
-	args := buildExiftoolArgsWithOptions("meta.json", "photo.jpg", true, false, true, gpsInclusion{true, true})
+	var latitudes []string
 	for _, arg := range args {
-		if strings.Contains(arg, "PhotoTakenTimeTimestamp") {
-			t.Fatalf("did not expect date mapping when disabled, got: %v", args)
+		if strings.HasPrefix(arg, "-GPSLatitude=") {
+			latitudes = append(latitudes, arg)
 		}
 	}
-}
-
-func TestApplyDetailedWithRunner_RetriesOnBadFormat(t *testing.T) {
-	var calls [][]string
-	runner := func(args []string) (string, error) {
-		cp := make([]string, len(args))
-		copy(cp, args)
-		calls = append(calls, cp)
-		switch len(calls) {
-		case 1:
-			return "Error: Bad format (0) for ExifIFD entry 25 - photo.jpg\n", fmt.Errorf("exiftool failed")
-		case 2: // strip
-			return "1 image files updated\n", nil
-		case 3: // retry apply
-			return "1 image files updated\n", nil
-		default:
-			return "", fmt.Errorf("unexpected call")
-		}
-	}
-
-	result, err := ApplyDetailedWithRunner("photo.jpg", "meta.json", runner)
-	if err != nil {
-		t.Fatalf("expected no error, got: %v", err)
-	}
-	if result.CreateDateWarned {
-		t.Fatalf("CreateDateWarned should be false")
-	}
-	if len(calls) != 3 {
-		t.Fatalf("expected 3 runner calls, got %d", len(calls))
-	}
-	// Second call should be the strip command.
-	if !slices.Contains(calls[1], "-all=") {
-		t.Fatalf("expected strip call with -all=, got: %v", calls[1])
+	if !slices.Equal(latitudes, []string{"-GPSLatitude=-33.5"}) {
+		t.Fatalf("expected only the GeoDataExif latitude, got %v", args)
 	}
 }
 
-func TestApplyDetailedWithRunner_ReturnsErrorWhenStripFails(t *testing.T) {
-	callCount := 0
-	runner := func(args []string) (string, error) {
-		callCount++
-		switch callCount {
-		case 1:
-			return "Error: Bad format (0) for ExifIFD entry 25\n", fmt.Errorf("exiftool failed")
-		case 2: // strip fails too
-			return "strip error\n", fmt.Errorf("strip failed")
-		default:
-			return "", fmt.Errorf("unexpected call")
+func TestBuildExiftoolArgsWithOptions_ExcludesDateTagsWithoutCaptureTime(t *testing.T) {
+	args := buildExiftoolArgsWithOptions(parseTestSidecar(t, testSidecarJSON), "photo.jpg", true, true, time.Time{}, false, nil)
+	for _, arg := range args {
+		if strings.Contains(arg, "Date") {
+			t.Fatalf("did not expect date tags without a capture time, got: %v", args)
 		}
 	}
-
-	_, err := ApplyDetailedWithRunner("photo.jpg", "meta.json", runner)
-	if err == nil {
-		t.Fatalf("expected error, got nil")
-	}
-	if !strings.Contains(err.Error(), "could not fix metadata for photo.jpg") {
-		t.Fatalf("expected original error message, got: %v", err)
-	}
-	if strings.Contains(err.Error(), "stripping corrupt EXIF") {
-		t.Fatalf("should not mention stripping when strip itself failed")
-	}
-	if callCount != 2 {
-		t.Fatalf("expected 2 runner calls, got %d", callCount)
-	}
 }
 
-func TestApplyDetailedWithRunner_ReturnsErrorWhenRetryAfterStripFails(t *testing.T) {
-	callCount := 0
-	runner := func(args []string) (string, error) {
-		callCount++
-		switch callCount {
-		case 1:
-			return "Error: Bad format (0) for ExifIFD entry 25\n", fmt.Errorf("exiftool failed")
-		case 2: // strip succeeds
-			return "1 image files updated\n", nil
-		case 3: // retry fails
-			return "some other error\n", fmt.Errorf("retry failed")
-		default:
-			return "", fmt.Errorf("unexpected call")
-		}
-	}
+func TestBuildExiftoolArgs_EscapesMultilineValues(t *testing.T) {
+	sc := parseTestSidecar(t, `{"description": "Day one\nFish & chips"}`)
+	args := buildExiftoolArgsWithOptions(sc, "photo.jpg", false, true, time.Time{}, false, []string{"-XMP-dc:Subject+=Tom & Jerry"})
 
-	_, err := ApplyDetailedWithRunner("photo.jpg", "meta.json", runner)
-	if err == nil {
-		t.Fatalf("expected error, got nil")
+	if !slices.Contains(args, "-E") {
+		t.Fatalf("expected -E for a multi-line value, got: %v", args)
 	}
-	if !strings.Contains(err.Error(), "after stripping corrupt EXIF") {
-		t.Fatalf("expected error to mention stripping, got: %v", err)
-	}
-	if callCount != 3 {
-		t.Fatalf("expected 3 runner calls, got %d", callCount)
-	}
-}
-
-func TestApplyDetailedWithRunner_RetriesOnErrorReading(t *testing.T) {
-	var calls [][]string
-	runner := func(args []string) (string, error) {
-		cp := make([]string, len(args))
-		copy(cp, args)
-		calls = append(calls, cp)
-		switch len(calls) {
-		case 1:
-			return "Error: Error reading OtherImageStart data in IFD0 - photo.jpg\n", fmt.Errorf("exiftool failed")
-		case 2: // strip
-			return "1 image files updated\n", nil
-		case 3: // retry apply
-			return "1 image files updated\n", nil
-		default:
-			return "", fmt.Errorf("unexpected call")
+	for _, want := range []string{
+		"-Description=Day one&#xa;Fish &amp; chips",
+		"-XMP-dc:Subject+=Tom &amp; Jerry",
+	} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q in args: %v", want, args)
 		}
 	}
-
-	result, err := ApplyDetailedWithRunner("photo.jpg", "meta.json", runner)
-	if err != nil {
-		t.Fatalf("expected no error, got: %v", err)
-	}
-	if result.CreateDateWarned {
-		t.Fatalf("CreateDateWarned should be false")
-	}
-	if len(calls) != 3 {
-		t.Fatalf("expected 3 runner calls, got %d", len(calls))
-	}
-	if !slices.Contains(calls[1], "-all=") {
-		t.Fatalf("expected strip call with -all=, got: %v", calls[1])
-	}
-}
-
-func TestApplyDetailedWithRunner_FileCreateDateFallbackAfterStrip(t *testing.T) {
-	orig := shouldWriteFileCreateDate
-	shouldWriteFileCreateDate = func() bool { return true }
-	defer func() { shouldWriteFileCreateDate = orig }()
-
-	callCount := 0
-	runner := func(args []string) (string, error) {
-		callCount++
-		switch callCount {
-		case 1: // initial apply fails with corrupt EXIF
-			return "Error: Bad format (0) for ExifIFD entry 25\n", fmt.Errorf("exiftool failed")
-		case 2: // strip succeeds
-			return "1 image files updated\n", nil
-		case 3: // retry after strip fails with FileCreateDate error
-			return "Warning: Sorry, FileCreateDate is not supported\n", fmt.Errorf("exiftool failed")
-		case 4: // fallback without FileCreateDate succeeds
-			return "1 image files updated\n", nil
-		default:
-			return "", fmt.Errorf("unexpected call %d", callCount)
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\r\n") {
+			t.Fatalf("did not expect a line break in args: %q", args)
 		}
 	}
-
-	result, err := ApplyDetailedWithRunner("photo.jpg", "meta.json", runner)
-	if err != nil {
-		t.Fatalf("expected no error, got: %v", err)
-	}
-	if !result.CreateDateWarned {
-		t.Fatalf("expected CreateDateWarned to be true")
-	}
-	if callCount != 4 {
-		t.Fatalf("expected 4 runner calls, got %d", callCount)
-	}
 }
 
 func TestApplyDetailedWithRunner_NonWritableUsesXMPSidecarAndWarnsOnMediaDateFailure(t *testing.T) {
@@ -320,10 +228,10 @@ func TestApplyDetailedWithRunner_NonWritableUsesXMPSidecarAndWarnsOnMediaDateFai
 		calls++
 		switch calls {
 		case 1:
-			if !slices.Contains(args, "-AllDates<PhotoTakenTimeTimestamp") {
+			if !hasArgPrefix(args, "-AllDates=") {
 				t.Fatalf("expected JSON date mappings in sidecar write, args: %v", args)
 			}
-			if slices.Contains(args, "-FileModifyDate<PhotoTakenTimeTimestamp") {
+			if hasArgPrefix(args, "-FileModifyDate=") {
 				t.Fatalf("did not expect file date mapping in sidecar write, args: %v", args)
 			}
 			if !slices.Contains(args, "clip.avi.xmp") {
@@ -331,7 +239,7 @@ func TestApplyDetailedWithRunner_NonWritableUsesXMPSidecarAndWarnsOnMediaDateFai
 			}
 			return "1 image files updated\n", nil
 		case 2:
-			if !slices.Contains(args, "-FileModifyDate<PhotoTakenTimeTimestamp") {
+			if !hasArgPrefix(args, "-FileModifyDate=") {
 				t.Fatalf("expected media file date mapping call, args: %v", args)
 			}
 			if !slices.Contains(args, "clip.avi") {
@@ -343,13 +251,16 @@ func TestApplyDetailedWithRunner_NonWritableUsesXMPSidecarAndWarnsOnMediaDateFai
 		}
 	}
 
-	result, err := ApplyDetailedWithRunner("clip.avi", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("clip.avi", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	if !result.UsedXMPSidecar {
 		t.Fatalf("expected UsedXMPSidecar=true")
 	}
+	if result.SidecarPath != "clip.avi.xmp" {
+		t.Fatalf("expected SidecarPath clip.avi.xmp, got %q", result.SidecarPath)
+	}
 	if !result.MediaFileDateWarned {
 		t.Fatalf("expected MediaFileDateWarned=true")
 	}
@@ -375,7 +286,7 @@ func TestApplyDetailedWithRunner_NonWritableMissingTimestampUsesFilenameDateOnOr
 		calls++
 		switch calls {
 		case 1:
-			if slices.Contains(args, "-AllDates<PhotoTakenTimeTimestamp") {
+			if hasArgPrefix(args, "-AllDates=") {
 				t.Fatalf("did not expect JSON date mapping when timestamp missing, args: %v", args)
 			}
 			if !slices.Contains(args, "2013-06-11 16.19.16.avi.xmp") {
@@ -398,7 +309,7 @@ func TestApplyDetailedWithRunner_NonWritableMissingTimestampUsesFilenameDateOnOr
 		}
 	}
 
-	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.avi", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.avi", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -435,13 +346,13 @@ func TestApplyDetailedWithRunner_WritableFormatsStillWriteDirectly(t *testing.T)
 		if slices.Contains(args, "photo.jpg.xmp") {
 			t.Fatalf("did not expect sidecar target for writable media, args: %v", args)
 		}
-		if !slices.Contains(args, "-FileModifyDate<PhotoTakenTimeTimestamp") {
+		if !hasArgPrefix(args, "-FileModifyDate=") {
 			t.Fatalf("expected file date mapping for writable media, args: %v", args)
 		}
 		return "1 image files updated\n", nil
 	}
 
-	result, err := ApplyDetailedWithRunner("photo.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("photo.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -453,99 +364,376 @@ func TestApplyDetailedWithRunner_WritableFormatsStillWriteDirectly(t *testing.T)
 	}
 }
 
-func TestLooksLikeCorruptExif(t *testing.T) {
+func TestPlanWithRunner_RecordsWritesWithoutRunningThem(t *testing.T) {
+	stubWritableDecision(t, func(path string) (bool, bool) {
+		if filepath.Ext(path) == ".avi" {
+			return false, true
+		}
+		return true, true
+	})
+
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	runner := func(args []string) (string, error) {
+		t.Fatalf("write commands must not reach the runner, args: %v", args)
+		return "", nil
+	}
+
+	commands, result, err := PlanWithRunner("clip.avi", jsonPath, Options{}, answerDateRead(runner))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !result.UsedXMPSidecar {
+		t.Fatalf("expected UsedXMPSidecar=true")
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected sidecar and media date commands, got %v", commands)
+	}
+	if !slices.Contains(commands[0], "clip.avi.xmp") {
+		t.Fatalf("expected first command to target sidecar, got %v", commands[0])
+	}
+	if !hasArgPrefix(commands[1], "-FileModifyDate=") {
+		t.Fatalf("expected second command to set media file dates, got %v", commands[1])
+	}
+}
+
+func TestPlanWithRunner_WritesAlbumsToConfiguredTag(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
 	tests := []struct {
-		name   string
-		output string
-		want   bool
+		tag  AlbumTag
+		want []string
 	}{
-		{"bad format lowercase", "Warning: bad format for entry", true},
-		{"bad format mixed case", "Error: Bad format (0) for ExifIFD entry 25 - photo.jpg", true},
-		{"error reading lowercase", "error reading OtherImageStart data in IFD0", true},
-		{"error reading mixed case", "Error: Error reading OtherImageStart data in IFD0 - photo.jpg", true},
-		{"clean output", "1 image files updated", false},
-		{"empty output", "", false},
-		{"unrelated error", "Error: File not found - photo.jpg", false},
+		{AlbumTagAlbum, []string{"-XMP-xmpDM:Album=Trip; Family"}},
+		{AlbumTagHierarchical, []string{"-XMP-lr:HierarchicalSubject+=Albums|Trip", "-XMP-lr:HierarchicalSubject+=Albums|Family"}},
+		{AlbumTagKeywords, []string{"-Keywords+=Trip", "-Subject+=Trip", "-Keywords+=Family", "-Subject+=Family"}},
+		{AlbumTagNone, nil},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := looksLikeCorruptExif(tt.output); got != tt.want {
-				t.Errorf("looksLikeCorruptExif(%q) = %v, want %v", tt.output, got, tt.want)
+		opts := Options{Albums: []string{"Trip", "Family"}, AlbumTag: tt.tag}
+		commands, _, err := PlanWithRunner("photo.jpg", jsonPath, opts, runner)
+		if err != nil || len(commands) != 1 {
+			t.Fatalf("%s: expected one command, got %v (%v)", tt.tag, commands, err)
+		}
+		args := commands[0]
+		var got []string
+		for _, arg := range args {
+			if strings.Contains(arg, "Trip") || strings.Contains(arg, "Family") {
+				got = append(got, arg)
 			}
-		})
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%s: album args mismatch: want %v, got %v", tt.tag, tt.want, got)
+		}
+		if len(got) > 0 && slices.Index(args, got[len(got)-1]) > slices.Index(args, "-overwrite_original") {
+			t.Fatalf("%s: album args must come before -overwrite_original: %v", tt.tag, args)
+		}
 	}
 }
 
-func TestDetectTimestampStatus(t *testing.T) {
-	t.Run("valid", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusValid {
-			t.Fatalf("expected valid status, got %v", got)
+func TestPlanWithRunner_WritesContentIdentifierPerContainer(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"}}`)
+	makes := map[string]string{"IMG_1.HEIC": "Apple\n", "IMG_1.jpg": "samsung\n"}
+	runner := func(args []string) (string, error) {
+		if slices.Contains(args, "-Make") {
+			return makes[args[len(args)-1]], nil
 		}
-	})
+		return "", nil
+	}
+
+	tests := []struct {
+		media string
+		want  string
+	}{
+		{"IMG_1.HEIC", "-MakerNotes:ContentIdentifier=ABC"},
+		{"IMG_1.jpg", ""},
+		{"IMG_1.MP4", "-Keys:ContentIdentifier=ABC"},
+		{"IMG_1.mov", "-Keys:ContentIdentifier=ABC"},
+	}
+	for _, tt := range tests {
+		commands, _, err := PlanWithRunner(tt.media, jsonPath, Options{ContentIdentifier: "ABC"}, runner)
+		if err != nil || len(commands) != 1 {
+			t.Fatalf("%s: expected one command, got %v (%v)", tt.media, commands, err)
+		}
+		if tt.want == "" {
+			if slices.ContainsFunc(commands[0], func(arg string) bool { return strings.Contains(arg, "ContentIdentifier") }) {
+				t.Fatalf("%s: a non-Apple still cannot take ContentIdentifier, got %v", tt.media, commands[0])
+			}
+			continue
+		}
+		if !slices.Contains(commands[0], tt.want) {
+			t.Fatalf("%s: expected %q in %v", tt.media, tt.want, commands[0])
+		}
+	}
+}
 
-	t.Run("missing photoTakenTime", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"title":"x"}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusMissing {
-			t.Fatalf("expected missing status, got %v", got)
+func TestPlanWithRunner_WritesPeopleTags(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"people":[{"name":"Alice"},{"name":" "},{"name":"Bob"},{"name":"Alice"}]}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	tests := []struct {
+		hierarchy string
+		want      []string
+	}{
+		{"", []string{
+			"-XMP-iptcExt:PersonInImage=Alice",
+			"-XMP-iptcExt:PersonInImage=Bob",
+			"-XMP-lr:HierarchicalSubject-=People|Alice",
+			"-XMP-lr:HierarchicalSubject+=People|Alice",
+			"-XMP-lr:HierarchicalSubject-=People|Bob",
+			"-XMP-lr:HierarchicalSubject+=People|Bob",
+		}},
+		{"Tags|Faces", []string{
+			"-XMP-iptcExt:PersonInImage=Alice",
+			"-XMP-iptcExt:PersonInImage=Bob",
+			"-XMP-lr:HierarchicalSubject-=Tags|Faces|Alice",
+			"-XMP-lr:HierarchicalSubject+=Tags|Faces|Alice",
+			"-XMP-lr:HierarchicalSubject-=Tags|Faces|Bob",
+			"-XMP-lr:HierarchicalSubject+=Tags|Faces|Bob",
+		}},
+		{PeopleHierarchyNone, []string{
+			"-XMP-iptcExt:PersonInImage=Alice",
+			"-XMP-iptcExt:PersonInImage=Bob",
+		}},
+	}
+	for _, tt := range tests {
+		commands, result, err := PlanWithRunner("photo.jpg", jsonPath, Options{PeopleHierarchy: tt.hierarchy}, runner)
+		if err != nil || len(commands) != 1 {
+			t.Fatalf("%q: expected one command, got %v (%v)", tt.hierarchy, commands, err)
 		}
-	})
+		var got []string
+		for _, arg := range commands[0] {
+			if strings.Contains(arg, "Alice") || strings.Contains(arg, "Bob") {
+				got = append(got, arg)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%q: people args mismatch: want %v, got %v", tt.hierarchy, tt.want, got)
+		}
+		if !result.PeopleTagged {
+			t.Fatalf("%q: expected PeopleTagged", tt.hierarchy)
+		}
+	}
+}
+
+func TestPlanWithRunner_WritesPeopleTagsToXMPSidecar(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return false, true })
+	jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"1719835200"},"people":[{"name":"Alice"}]}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanWithRunner("clip.avi", jsonPath, Options{}, runner)
+	if err != nil || len(commands) == 0 {
+		t.Fatalf("expected commands, got %v (%v)", commands, err)
+	}
+	args := commands[0]
+	if !slices.Contains(args, "-XMP-iptcExt:PersonInImage=Alice") || args[len(args)-1] != "clip.avi.xmp" {
+		t.Fatalf("expected people tags in the XMP sidecar, got %v", args)
+	}
+	if !result.PeopleTagged {
+		t.Fatalf("expected PeopleTagged")
+	}
+}
 
-	t.Run("missing timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusMissing {
-			t.Fatalf("expected missing status, got %v", got)
+func TestPlanWithRunner_NoPeopleTagsWithoutPeople(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"people":[]}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanWithRunner("photo.jpg", jsonPath, Options{}, runner)
+	if err != nil || len(commands) != 1 {
+		t.Fatalf("expected one command, got %v (%v)", commands, err)
+	}
+	for _, arg := range commands[0] {
+		if strings.Contains(arg, "PersonInImage") || strings.Contains(arg, "HierarchicalSubject") {
+			t.Fatalf("unexpected people arg %q", arg)
 		}
-	})
+	}
+	if result.PeopleTagged {
+		t.Fatalf("PeopleTagged should be false")
+	}
+}
+
+func TestPlanWithRunner_RatesFavorites(t *testing.T) {
+	runner := func(args []string) (string, error) { return "", nil }
 
-	t.Run("invalid timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"not-a-number"}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusInvalid {
-			t.Fatalf("expected invalid status, got %v", got)
+	tests := []struct {
+		name     string
+		json     string
+		writable bool
+		opts     Options
+		want     []string
+	}{
+		{"default rating", `{"favorited":true}`, true, Options{}, []string{"-XMP:Rating=5"}},
+		{"configured rating and keyword", `{"favorited":true}`, true, Options{FavoriteRating: 4, FavoriteKeyword: true}, []string{
+			"-XMP:Rating=4",
+			"-Keywords-=Favorite",
+			"-Keywords+=Favorite",
+			"-Subject-=Favorite",
+			"-Subject+=Favorite",
+		}},
+		{"not favorited", `{"favorited":false}`, true, Options{FavoriteKeyword: true}, nil},
+		{"xmp sidecar", `{"favorited":true}`, false, Options{}, []string{"-XMP:Rating=5"}},
+	}
+	for _, tt := range tests {
+		stubWritableDecision(t, func(string) (bool, bool) { return tt.writable, true })
+		jsonPath := writeJSONFixture(t, tt.json)
+		commands, result, err := PlanWithRunner("photo.jpg", jsonPath, tt.opts, runner)
+		if err != nil || len(commands) == 0 {
+			t.Fatalf("%s: expected commands, got %v (%v)", tt.name, commands, err)
 		}
-	})
+		args := commands[0]
+		var got []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") && (strings.Contains(arg, "Rating") || strings.Contains(arg, "Favorite")) {
+				got = append(got, arg)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%s: favorite args mismatch: want %v, got %v", tt.name, tt.want, got)
+		}
+		if result.Favorite != (tt.want != nil) {
+			t.Fatalf("%s: unexpected Favorite %v", tt.name, result.Favorite)
+		}
+		if !tt.writable && args[len(args)-1] != "photo.jpg.xmp" {
+			t.Fatalf("%s: expected the rating in the XMP sidecar, got %v", tt.name, args)
+		}
+	}
+}
 
-	t.Run("invalid zero string timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"0"}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusInvalid {
-			t.Fatalf("expected invalid status for zero string, got %v", got)
+func TestValidateFavoriteRating(t *testing.T) {
+	for _, rating := range []int{1, 5} {
+		if err := ValidateFavoriteRating(rating); err != nil {
+			t.Fatalf("ValidateFavoriteRating(%d) returned error: %v", rating, err)
 		}
-	})
+	}
+	for _, rating := range []int{-1, 0, 6} {
+		if err := ValidateFavoriteRating(rating); err == nil {
+			t.Fatalf("ValidateFavoriteRating(%d) should fail", rating)
+		}
+	}
+}
 
-	t.Run("invalid negative string timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":"-1"}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusInvalid {
-			t.Fatalf("expected invalid status for negative string, got %v", got)
+func TestParsePeopleHierarchy(t *testing.T) {
+	for value, want := range map[string]string{
+		"":           DefaultPeopleHierarchy,
+		"none":       PeopleHierarchyNone,
+		"Tags|Faces": "Tags|Faces",
+	} {
+		got, err := ParsePeopleHierarchy(value)
+		if err != nil || got != want {
+			t.Fatalf("ParsePeopleHierarchy(%q) = %q, %v; want %q", value, got, err, want)
 		}
-	})
+	}
+	for _, value := range []string{"|People", "People|", "Tags||People"} {
+		if _, err := ParsePeopleHierarchy(value); err == nil {
+			t.Fatalf("ParsePeopleHierarchy(%q) should fail", value)
+		}
+	}
+}
 
-	t.Run("invalid zero numeric timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":0}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusInvalid {
-			t.Fatalf("expected invalid status for zero numeric, got %v", got)
+func TestBuildExiftoolArgs_WritesQuickTimeDatesAndGPSForVideos(t *testing.T) {
+	sc := parseTestSidecar(t, testSidecarJSON)
+	takenAt := time.Date(2024, 7, 1, 14, 0, 0, 0, time.FixedZone("", 2*60*60))
+	for _, media := range []string{"clip.mp4", "clip.MOV", "clip.m4v", "clip.3gp"} {
+		args := buildExiftoolArgsWithOptions(sc, media, false, true, takenAt, false, nil)
+
+		for _, want := range []string{
+			"QuickTimeUTC=1",
+			"-QuickTime:CreateDate=2024:07:01 14:00:00+02:00",
+			"-QuickTime:ModifyDate=2024:07:01 14:00:00+02:00",
+			"-QuickTime:TrackCreateDate=2024:07:01 14:00:00+02:00",
+			"-QuickTime:TrackModifyDate=2024:07:01 14:00:00+02:00",
+			"-QuickTime:MediaCreateDate=2024:07:01 14:00:00+02:00",
+			"-QuickTime:MediaModifyDate=2024:07:01 14:00:00+02:00",
+			"-Keys:CreationDate=2024:07:01 14:00:00+02:00",
+			// GeoDataExif wins over GeoData, as for photos.
+			"-Keys:GPSCoordinates=-33.5 151.25 42.5",
+			"-UserData:GPSCoordinates=-33.5 151.25 42.5",
+		} {
+			if !slices.Contains(args, want) {
+				t.Fatalf("%s: expected %q in %v", media, want, args)
+			}
 		}
-	})
+		if i := slices.Index(args, "QuickTimeUTC=1"); args[i-1] != "-api" {
+			t.Fatalf("%s: QuickTimeUTC must be an -api option: %v", media, args)
+		}
+		if hasArgPrefix(args, "-AllDates=") {
+			t.Fatalf("%s: videos should not use AllDates: %v", media, args)
+		}
+	}
 
-	t.Run("valid numeric timestamp", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":{"timestamp":1}}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusValid {
-			t.Fatalf("expected valid status for numeric timestamp, got %v", got)
+	args := buildExiftoolArgsWithOptions(sc, "photo.jpg", false, true, takenAt, false, nil)
+	for _, arg := range args {
+		if strings.Contains(arg, "QuickTimeUTC") || strings.Contains(arg, "GPSCoordinates") {
+			t.Fatalf("photos should not get video tags: %v", args)
 		}
-	})
+	}
+}
+
+func TestBuildFilenameDateArgs_WritesQuickTimeDatesInUTCForVideos(t *testing.T) {
+	value := time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC)
+	args := buildFilenameDateArgs("clip.mp4", value, false, false)
 
-	t.Run("unknown malformed json", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusUnknown {
-			t.Fatalf("expected unknown status, got %v", got)
+	for _, want := range []string{"QuickTimeUTC=1", "-QuickTime:CreateDate=2024:01:15 12:30:00+00:00", "-QuickTime:MediaModifyDate=2024:01:15 12:30:00+00:00"} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q in %v", want, args)
 		}
-	})
+	}
+}
+
+func TestBuildFilenameDateArgs_WritesHEIFQuickTimeDatesInUTC(t *testing.T) {
+	value := time.Date(2024, 1, 15, 12, 30, 0, 0, time.FixedZone("", 2*60*60))
+	args := buildFilenameDateArgs("photo.heic", value, false, true)
 
-	t.Run("unknown invalid shape", func(t *testing.T) {
-		jsonPath := writeJSONFixture(t, `{"photoTakenTime":"bad-shape"}`)
-		if got := detectTimestampStatus(jsonPath); got != timestampStatusUnknown {
-			t.Fatalf("expected unknown status, got %v", got)
+	for _, want := range []string{
+		"QuickTimeUTC=1",
+		"-QuickTime:CreateDate=2024:01:15 12:30:00+02:00",
+		"-QuickTime:MediaModifyDate=2024:01:15 12:30:00+02:00",
+		"-Keys:CreationDate=2024:01:15 12:30:00+02:00",
+		"-OffsetTimeOriginal=+02:00",
+	} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q in %v", want, args)
 		}
-	})
+	}
+	if i := slices.Index(args, "QuickTimeUTC=1"); args[i-1] != "-api" {
+		t.Fatalf("QuickTimeUTC must be an -api option: %v", args)
+	}
+}
+
+func TestParseAlbumTag(t *testing.T) {
+	if tag, err := ParseAlbumTag(""); err != nil || tag != DefaultAlbumTag {
+		t.Fatalf("empty name should give the default, got %q (%v)", tag, err)
+	}
+	if _, err := ParseAlbumTag("caption"); err == nil {
+		t.Fatalf("expected error for unknown album tag")
+	}
+}
+
+func TestLooksLikeCorruptExif(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{"bad format lowercase", "Warning: bad format for entry", true},
+		{"bad format mixed case", "Error: Bad format (0) for ExifIFD entry 25 - photo.jpg", true},
+		{"error reading lowercase", "error reading OtherImageStart data in IFD0", true},
+		{"error reading mixed case", "Error: Error reading OtherImageStart data in IFD0 - photo.jpg", true},
+		{"clean output", "1 image files updated", false},
+		{"empty output", "", false},
+		{"unrelated error", "Error: File not found - photo.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeCorruptExif(tt.output); got != tt.want {
+				t.Errorf("looksLikeCorruptExif(%q) = %v, want %v", tt.output, got, tt.want)
+			}
+		})
+	}
 }
 
 func TestApplyFilenameDate_ReturnsUsedFalseOnError(t *testing.T) {
@@ -553,7 +741,7 @@ func TestApplyFilenameDate_ReturnsUsedFalseOnError(t *testing.T) {
 		return "Error: failed\n", fmt.Errorf("failed")
 	}
 
-	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.jpg", "out.xmp", false, runner)
+	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.jpg", "out.xmp", false, nil, runner)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -579,7 +767,7 @@ func TestApplyFilenameDate_ParsesFromMediaPath(t *testing.T) {
 		return "1 image files updated\n", nil
 	}
 
-	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.raw", "output.xmp", false, runner)
+	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.raw", "output.xmp", false, nil, runner)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -616,7 +804,7 @@ func TestApplyFilenameDate_FileCreateDateRetryKeepsMinorWarningMode(t *testing.T
 		}
 	}
 
-	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.jpg", "out.jpg", true, runner)
+	used, warned, err := applyFilenameDate("2024-01-15 12.30.00.jpg", "out.jpg", true, nil, runner)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -637,19 +825,19 @@ func TestApplyMediaFileDatesFromJSON_FileCreateDateRetry(t *testing.T) {
 		calls++
 		switch calls {
 		case 1:
-			if !slices.Contains(args, "-FileCreateDate<PhotoTakenTimeTimestamp") {
+			if !hasArgPrefix(args, "-FileCreateDate=") {
 				t.Fatalf("expected FileCreateDate mapping in first call, args: %v", args)
 			}
 			if !slices.Contains(args, "clip.avi") {
 				t.Fatalf("expected media target clip.avi, args: %v", args)
 			}
-			if !slices.Contains(args, "meta.json") {
-				t.Fatalf("expected JSON source meta.json, args: %v", args)
+			if !slices.Contains(args, "-FileModifyDate=2024:07:01 14:00:00+02:00") {
+				t.Fatalf("expected capture time with offset, args: %v", args)
 			}
 			return "Warning: Sorry, FileCreateDate is not supported\n", fmt.Errorf("exiftool failed")
 		case 2:
 			for _, arg := range args {
-				if strings.HasPrefix(arg, "-FileCreateDate<") {
+				if strings.HasPrefix(arg, "-FileCreateDate=") {
 					t.Fatalf("did not expect FileCreateDate mapping in retry call, args: %v", args)
 				}
 			}
@@ -662,7 +850,8 @@ func TestApplyMediaFileDatesFromJSON_FileCreateDateRetry(t *testing.T) {
 		}
 	}
 
-	createDateWarned, err := applyMediaFileDatesFromJSON("clip.avi", "meta.json", true, runner)
+	takenAt := time.Date(2024, 7, 1, 14, 0, 0, 0, time.FixedZone("", 2*60*60))
+	createDateWarned, err := applyMediaFileDatesFromJSON("clip.avi", takenAt, true, runner)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -690,7 +879,7 @@ func TestApplyMediaFileDatesFromFilename_Success(t *testing.T) {
 		return "1 image files updated\n", nil
 	}
 
-	used, warned, err := applyMediaFileDatesFromFilename("2013-06-11 16.19.16.avi", true, runner)
+	used, warned, err := applyMediaFileDatesFromFilename("2013-06-11 16.19.16.avi", true, nil, runner)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -706,7 +895,7 @@ func TestApplyMediaFileDatesFromFilename_Success(t *testing.T) {
 }
 
 func TestParseFilenameDate_AssumesUTC(t *testing.T) {
-	parsed, ok := parseFilenameDate("2013-06-11 16.19.16.jpg")
+	parsed, ok := FilenameDate("2013-06-11 16.19.16.jpg")
 	if !ok {
 		t.Fatalf("expected parse success")
 	}
@@ -732,13 +921,16 @@ func TestApplyDetailedWithRunner_ValidTimestampDoesNotUseFilenameFallback(t *tes
 		return "1 image files updated\n", nil
 	}
 
-	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	if result.UsedFilenameDate {
 		t.Fatalf("expected UsedFilenameDate=false for valid timestamp")
 	}
+	if !result.CaptureTime.Equal(time.Unix(1719835200, 0)) {
+		t.Fatalf("expected capture time from photoTakenTime, got %v", result.CaptureTime)
+	}
 	if callCount != 1 {
 		t.Fatalf("expected one exiftool call, got %d", callCount)
 	}
@@ -751,7 +943,7 @@ func TestApplyDetailedWithRunner_MissingTimestampUsesFilenameFallback(t *testing
 		calls++
 		switch calls {
 		case 1:
-			if slices.Contains(args, "-AllDates<PhotoTakenTimeTimestamp") {
+			if hasArgPrefix(args, "-AllDates=") {
 				t.Fatalf("did not expect JSON date mapping when timestamp is missing, args: %v", args)
 			}
 			return "1 image files updated\n", nil
@@ -765,13 +957,19 @@ func TestApplyDetailedWithRunner_MissingTimestampUsesFilenameFallback(t *testing
 		}
 	}
 
-	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	if !result.UsedFilenameDate {
 		t.Fatalf("expected UsedFilenameDate=true")
 	}
+	if result.FilenamePattern != "takeout" || result.FilenamePrecision != PrecisionDateTime {
+		t.Fatalf("unexpected filename pattern: %q %q", result.FilenamePattern, result.FilenamePrecision)
+	}
+	if want := time.Date(2013, 6, 11, 16, 19, 16, 0, time.UTC); !result.CaptureTime.Equal(want) {
+		t.Fatalf("expected capture time from filename %v, got %v", want, result.CaptureTime)
+	}
 	if calls != 2 {
 		t.Fatalf("expected two exiftool calls, got %d", calls)
 	}
@@ -784,7 +982,7 @@ func TestApplyDetailedWithRunner_InvalidTimestampUsesFilenameFallback(t *testing
 		calls++
 		switch calls {
 		case 1:
-			if slices.Contains(args, "-AllDates<PhotoTakenTimeTimestamp") {
+			if hasArgPrefix(args, "-AllDates=") {
 				t.Fatalf("did not expect JSON date mapping when timestamp is invalid, args: %v", args)
 			}
 			return "1 image files updated\n", nil
@@ -798,7 +996,7 @@ func TestApplyDetailedWithRunner_InvalidTimestampUsesFilenameFallback(t *testing
 		}
 	}
 
-	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -817,7 +1015,7 @@ func TestApplyDetailedWithRunner_MissingTimestampFilenameFallbackFailureIsWarnin
 		calls++
 		switch calls {
 		case 1:
-			if slices.Contains(args, "-AllDates<PhotoTakenTimeTimestamp") {
+			if hasArgPrefix(args, "-AllDates=") {
 				t.Fatalf("did not expect JSON date mapping when timestamp is missing, args: %v", args)
 			}
 			return "1 image files updated\n", nil
@@ -831,7 +1029,7 @@ func TestApplyDetailedWithRunner_MissingTimestampFilenameFallbackFailureIsWarnin
 		}
 	}
 
-	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("2013-06-11 16.19.16.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -857,7 +1055,7 @@ func TestApplyDetailedWithRunner_MissingTimestampUnparseableFilenameSkipsFallbac
 		return "1 image files updated\n", nil
 	}
 
-	result, err := ApplyDetailedWithRunner("IMG_1234.jpg", jsonPath, runner)
+	result, err := ApplyDetailedWithRunner("IMG_1234.jpg", jsonPath, Options{}, answerDateRead(runner))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -869,109 +1067,70 @@ func TestApplyDetailedWithRunner_MissingTimestampUnparseableFilenameSkipsFallbac
 	}
 }
 
-func TestDetectGPSInclusion_BothZero(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"geoData":{"latitude":0.0,"longitude":0.0},"geoDataExif":{"latitude":0.0,"longitude":0.0}}`)
-	gps := detectGPSInclusion(jsonPath)
-	if gps.geoData {
-		t.Fatalf("expected geoData=false for zero coords")
-	}
-	if gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=false for zero coords")
-	}
-}
+func TestBuildExiftoolArgs_ExcludesGeoDataGPSWhenZero(t *testing.T) {
+	sc := parseTestSidecar(t, `{"geoData":{"latitude":0.0,"longitude":0.0},"geoDataExif":{"latitude":48.8,"longitude":2.3}}`)
+	args := buildExiftoolArgs(sc, "photo.jpg", true)
 
-func TestDetectGPSInclusion_GeoDataValid(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"geoData":{"latitude":55.7,"longitude":37.5},"geoDataExif":{"latitude":0.0,"longitude":0.0}}`)
-	gps := detectGPSInclusion(jsonPath)
-	if !gps.geoData {
-		t.Fatalf("expected geoData=true for valid coords")
+	if !slices.Contains(args, "-GPSLatitude=48.8") {
+		t.Fatalf("expected GeoDataExif latitude, got: %v", args)
 	}
-	if gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=false for zero coords")
+	if !slices.Contains(args, "-GPSLongitude=2.3") {
+		t.Fatalf("expected GeoDataExif longitude, got: %v", args)
 	}
 }
 
-func TestDetectGPSInclusion_GeoDataZeroExifValid(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"geoData":{"latitude":0.0,"longitude":0.0},"geoDataExif":{"latitude":48.8,"longitude":2.3}}`)
-	gps := detectGPSInclusion(jsonPath)
-	if gps.geoData {
-		t.Fatalf("expected geoData=false for zero coords")
-	}
-	if !gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=true for valid coords")
-	}
-}
+func TestBuildExiftoolArgs_ExcludesAllGPSWhenBothZero(t *testing.T) {
+	sc := parseTestSidecar(t, `{"title":"x","tags":["a"],"geoData":{"latitude":0.0,"longitude":0.0},"geoDataExif":{"latitude":0.0,"longitude":0.0}}`)
+	args := buildExiftoolArgs(sc, "photo.jpg", true)
 
-func TestDetectGPSInclusion_BothValid(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"geoData":{"latitude":55.7,"longitude":37.5},"geoDataExif":{"latitude":48.8,"longitude":2.3}}`)
-	gps := detectGPSInclusion(jsonPath)
-	if !gps.geoData {
-		t.Fatalf("expected geoData=true for valid coords")
-	}
-	if !gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=true for valid coords")
+	for _, arg := range args {
+		if strings.Contains(arg, "GPS") {
+			t.Fatalf("did not expect any GPS args when both are zero, got: %v", args)
+		}
 	}
-}
-
-func TestDetectGPSInclusion_NullCoords(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"geoDataExif":{"latitude":null,"longitude":null}}`)
-	gps := detectGPSInclusion(jsonPath)
-	if gps.geoData {
-		t.Fatalf("expected geoData=false for missing field")
+	// Non-GPS tags should still be present.
+	if !slices.Contains(args, "-Title=x") {
+		t.Fatalf("expected Title even when GPS excluded, got: %v", args)
 	}
-	if gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=false for null coords")
+	if !slices.Contains(args, "-Keywords=a") {
+		t.Fatalf("expected Keywords even when GPS excluded, got: %v", args)
 	}
 }
 
-func TestDetectGPSInclusion_MissingFields(t *testing.T) {
-	jsonPath := writeJSONFixture(t, `{"title":"no geo at all"}`)
-	gps := detectGPSInclusion(jsonPath)
-	if gps.geoData {
-		t.Fatalf("expected geoData=false when field is missing")
-	}
-	if gps.geoDataExif {
-		t.Fatalf("expected geoDataExif=false when field is missing")
+func TestApplyDetailedWithRunner_ReportsSidecarIssues(t *testing.T) {
+	jsonPath := writeJSONFixture(t, `{"title":42,"description":"kept","photoTakenTime":{"timestamp":"soon"}}`)
+	var commands [][]string
+	runner := func(args []string) (string, error) {
+		commands = append(commands, args)
+		return "", nil
 	}
-}
 
-func TestDetectGPSInclusion_UnreadableFile(t *testing.T) {
-	gps := detectGPSInclusion("/nonexistent/path/meta.json")
-	if !gps.geoData || !gps.geoDataExif {
-		t.Fatalf("expected fail-open (both true) for unreadable file, got geoData=%v geoDataExif=%v", gps.geoData, gps.geoDataExif)
+	result, err := ApplyDetailedWithRunner("photo.jpg", jsonPath, Options{}, answerDateRead(runner))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
-}
-
-func TestBuildExiftoolArgs_ExcludesGeoDataGPSWhenZero(t *testing.T) {
-	args := buildExiftoolArgsWithOptions("meta.json", "photo.jpg", true, true, true, gpsInclusion{false, true})
-
-	for _, arg := range args {
-		if strings.Contains(arg, "GeoDataLatitude") && !strings.Contains(arg, "GeoDataExif") {
-			t.Fatalf("did not expect GeoData (non-Exif) GPS args, got: %v", args)
-		}
+	want := []string{
+		"title: expected a string, got 42",
+		`photoTakenTime.timestamp: invalid value "soon"`,
 	}
-	if !slices.Contains(args, "-GPSLatitude<GeoDataExifLatitude") {
-		t.Fatalf("expected GeoDataExif latitude mapping, got: %v", args)
+	if !slices.Equal(result.SidecarIssues, want) {
+		t.Fatalf("expected issues %q, got %q", want, result.SidecarIssues)
 	}
-	if !slices.Contains(args, "-GPSLongitude<GeoDataExifLongitude") {
-		t.Fatalf("expected GeoDataExif longitude mapping, got: %v", args)
+	if len(commands) == 0 || !slices.Contains(commands[0], "-Description=kept") {
+		t.Fatalf("expected valid fields to be written, got %v", commands)
 	}
 }
 
-func TestBuildExiftoolArgs_ExcludesAllGPSWhenBothZero(t *testing.T) {
-	args := buildExiftoolArgsWithOptions("meta.json", "photo.jpg", true, true, true, gpsInclusion{false, false})
-
-	for _, arg := range args {
-		if strings.Contains(arg, "GPS") {
-			t.Fatalf("did not expect any GPS args when both are zero, got: %v", args)
-		}
-	}
-	// Non-GPS tags should still be present.
-	if !slices.Contains(args, "-Title<Title") {
-		t.Fatalf("expected Title mapping even when GPS excluded, got: %v", args)
+func TestApplyDetailedWithRunner_RejectsInvalidJSON(t *testing.T) {
+	jsonPath := writeJSONFixture(t, `{"title":`)
+	runner := func(args []string) (string, error) {
+		t.Fatalf("did not expect exiftool to run, args: %v", args)
+		return "", nil
 	}
-	if !slices.Contains(args, "-Keywords<Tags") {
-		t.Fatalf("expected Keywords mapping even when GPS excluded, got: %v", args)
+
+	_, err := ApplyDetailedWithRunner("photo.jpg", jsonPath, Options{}, runner)
+	if !errors.Is(err, sidecar.ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
 	}
 }
 
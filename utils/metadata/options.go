@@ -0,0 +1,205 @@
+package metadata
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vchilikov/takeout-fix/internal/patharg"
+)
+
+// AlbumTag selects where album names are written.
+type AlbumTag string
+
+const (
+	// AlbumTagNone skips album names.
+	AlbumTagNone AlbumTag = "none"
+	// AlbumTagAlbum writes XMP-xmpDM:Album. Several albums are joined with "; ".
+	AlbumTagAlbum AlbumTag = "album"
+	// AlbumTagHierarchical adds an "Albums|<name>" entry per album to
+	// XMP-lr:HierarchicalSubject.
+	AlbumTagHierarchical AlbumTag = "hierarchical"
+	// AlbumTagKeywords adds album names to Keywords and Subject.
+	AlbumTagKeywords AlbumTag = "keywords"
+)
+
+// DefaultAlbumTag is used when Options.AlbumTag is empty.
+const DefaultAlbumTag = AlbumTagAlbum
+
+// ParseAlbumTag validates an album tag name. An empty name gives DefaultAlbumTag.
+func ParseAlbumTag(name string) (AlbumTag, error) {
+	if name == "" {
+		return DefaultAlbumTag, nil
+	}
+	switch tag := AlbumTag(name); tag {
+	case AlbumTagNone, AlbumTagAlbum, AlbumTagHierarchical, AlbumTagKeywords:
+		return tag, nil
+	default:
+		return "", fmt.Errorf("unknown album tag %q (want album, hierarchical, keywords or none)", name)
+	}
+}
+
+// DefaultPeopleHierarchy is the HierarchicalSubject parent used for person
+// names when Options.PeopleHierarchy is empty.
+const DefaultPeopleHierarchy = "People"
+
+// PeopleHierarchyNone skips person keywords. PersonInImage is still written.
+const PeopleHierarchyNone = "none"
+
+// ParsePeopleHierarchy validates a HierarchicalSubject parent such as
+// "People" or "Tags|People". An empty value gives DefaultPeopleHierarchy.
+func ParsePeopleHierarchy(value string) (string, error) {
+	if value == "" {
+		return DefaultPeopleHierarchy, nil
+	}
+	if value == PeopleHierarchyNone {
+		return value, nil
+	}
+	for part := range strings.SplitSeq(value, "|") {
+		if strings.TrimSpace(part) == "" {
+			return "", fmt.Errorf("invalid people hierarchy %q: empty level", value)
+		}
+	}
+	return value, nil
+}
+
+// DefaultFavoriteRating is the XMP:Rating written for favorites when
+// Options.FavoriteRating is zero.
+const DefaultFavoriteRating = 5
+
+// FavoriteKeyword is the keyword added to favorites with
+// Options.FavoriteKeyword.
+const FavoriteKeyword = "Favorite"
+
+// ValidateFavoriteRating checks that rating is a star rating from 1 to 5.
+func ValidateFavoriteRating(rating int) error {
+	if rating < 1 || rating > 5 {
+		return fmt.Errorf("invalid favorite rating %d (want 1 to 5)", rating)
+	}
+	return nil
+}
+
+// Options carries values that are not in the media's JSON sidecar.
+type Options struct {
+	// Albums are the titles of the albums the media belongs to.
+	Albums []string
+	// AlbumTag selects where Albums are written. Empty uses DefaultAlbumTag.
+	AlbumTag AlbumTag
+	// ContentIdentifier links the still and video halves of a Live Photo.
+	// Both halves get the same value; stills not made by an Apple camera
+	// are left without it.
+	ContentIdentifier string
+	// PeopleHierarchy is the HierarchicalSubject parent for person names
+	// from the JSON. Empty uses DefaultPeopleHierarchy.
+	PeopleHierarchy string
+	// FavoriteRating is the XMP:Rating written for media the JSON marks as
+	// favorited. Zero uses DefaultFavoriteRating.
+	FavoriteRating int
+	// FavoriteKeyword also adds FavoriteKeyword to Keywords and Subject of
+	// favorites.
+	FavoriteKeyword bool
+	// Timezone selects the zone capture dates are written in.
+	Timezone TimezonePolicy
+	// DatePrecedence orders the sources the capture date is taken from.
+	// Empty uses DefaultDatePrecedence.
+	DatePrecedence DatePrecedence
+	// DateChecks selects the sanity checks dates must pass. Empty enables
+	// all checks.
+	DateChecks DateChecks
+	// WritePolicy selects per field whether JSON values replace existing
+	// values. Empty overwrites every field.
+	WritePolicy WritePolicy
+	// SourcePath is where a plan reads media that will only be renamed to
+	// the planned path by the run. Recorded commands still name the
+	// planned path. Empty reads the planned path.
+	SourcePath string
+}
+
+// tagArgs returns the exiftool assignments for opts. Stills only get
+// ContentIdentifier when they were made by an Apple camera, because
+// exiftool can only write it into existing Apple maker notes.
+func (opts Options) tagArgs(outMediaPath string, run func(args []string) (string, error)) []string {
+	var args []string
+	if opts.ContentIdentifier != "" {
+		if isQuickTimeContainer(outMediaPath) {
+			args = append(args, "-Keys:ContentIdentifier="+opts.ContentIdentifier)
+		} else if isAppleStill(outMediaPath, run) {
+			args = append(args, "-MakerNotes:ContentIdentifier="+opts.ContentIdentifier)
+		}
+	}
+	return append(args, opts.albumArgs()...)
+}
+
+// isAppleStill reports whether the Make of the still at path is Apple. An
+// XMP sidecar has no Make and is never one.
+func isAppleStill(path string, run func(args []string) (string, error)) bool {
+	output, err := run([]string{"-m", "-s3", "-Make", patharg.Safe(path)})
+	return err == nil && strings.EqualFold(strings.TrimSpace(output), "Apple")
+}
+
+// peopleArgs writes names to PersonInImage, replacing the list, and adds a
+// "<hierarchy>|<name>" keyword per name unless it is already present.
+func (opts Options) peopleArgs(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	hierarchy := cmp.Or(opts.PeopleHierarchy, DefaultPeopleHierarchy)
+	args := make([]string, 0, 3*len(names))
+	for _, name := range names {
+		args = append(args, "-XMP-iptcExt:PersonInImage="+name)
+	}
+	if hierarchy == PeopleHierarchyNone {
+		return args
+	}
+	for _, name := range names {
+		keyword := hierarchy + "|" + name
+		args = append(args,
+			"-XMP-lr:HierarchicalSubject-="+keyword,
+			"-XMP-lr:HierarchicalSubject+="+keyword,
+		)
+	}
+	return args
+}
+
+// favoriteArgs rates a favorite and, with FavoriteKeyword, adds the keyword
+// unless it is already present.
+func (opts Options) favoriteArgs() []string {
+	rating := cmp.Or(opts.FavoriteRating, DefaultFavoriteRating)
+	args := []string{"-XMP:Rating=" + strconv.Itoa(rating)}
+	if opts.FavoriteKeyword {
+		args = append(args,
+			"-Keywords-="+FavoriteKeyword,
+			"-Keywords+="+FavoriteKeyword,
+			"-Subject-="+FavoriteKeyword,
+			"-Subject+="+FavoriteKeyword,
+		)
+	}
+	return args
+}
+
+func (opts Options) albumArgs() []string {
+	if len(opts.Albums) == 0 {
+		return nil
+	}
+
+	switch opts.AlbumTag {
+	case AlbumTagNone:
+		return nil
+	case AlbumTagHierarchical:
+		args := make([]string, 0, len(opts.Albums))
+		for _, album := range opts.Albums {
+			args = append(args, "-XMP-lr:HierarchicalSubject+=Albums|"+album)
+		}
+		return args
+	case AlbumTagKeywords:
+		args := make([]string, 0, 2*len(opts.Albums))
+		for _, album := range opts.Albums {
+			args = append(args, "-Keywords+="+album, "-Subject+="+album)
+		}
+		return args
+	default:
+		return []string{"-XMP-xmpDM:Album=" + strings.Join(opts.Albums, "; ")}
+	}
+}
@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vchilikov/takeout-fix/internal/tzlookup"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
+)
+
+// TimezonePolicy selects the zone capture dates are written in. Besides the
+// named policies, any IANA zone name (such as "Europe/Berlin"), "UTC" or a
+// fixed offset such as "+02:00" writes all dates in that zone.
+type TimezonePolicy string
+
+const (
+	// TimezoneDefault lets exiftool convert the JSON timestamp with the zone
+	// of the machine running takeoutfix and writes no offset tags. Filename
+	// dates are taken as UTC.
+	TimezoneDefault TimezonePolicy = ""
+	// TimezoneLocal writes dates in the zone of the machine running
+	// takeoutfix, with offset tags.
+	TimezoneLocal TimezonePolicy = "local"
+	// TimezoneGPS writes dates in the zone of the JSON GPS position, found
+	// offline with tzlookup. Media without GPS use the local zone and are
+	// reported with ApplyResult.LocalZoneFallback.
+	TimezoneGPS TimezonePolicy = "gps"
+)
+
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// ParseTimezonePolicy validates a timezone policy: "local", "gps", an IANA
+// zone name or a fixed offset such as "+02:00". Empty gives TimezoneDefault.
+func ParseTimezonePolicy(value string) (TimezonePolicy, error) {
+	policy := TimezonePolicy(value)
+	switch policy {
+	case TimezoneDefault, TimezoneLocal, TimezoneGPS:
+		return policy, nil
+	}
+	if _, err := policy.fixedZone(); err != nil {
+		return "", err
+	}
+	return policy, nil
+}
+
+// location returns the zone dates are written in for the media described by
+// sc, or nil for TimezoneDefault. localFallback reports that TimezoneGPS
+// had no usable position and fell back to the local zone.
+func (policy TimezonePolicy) location(sc sidecar.Sidecar) (loc *time.Location, localFallback bool) {
+	switch policy {
+	case TimezoneDefault:
+		return nil, false
+	case TimezoneLocal:
+		return time.Local, false
+	case TimezoneGPS:
+		if geo, ok := sc.Position(); ok {
+			if loc, ok := tzlookup.Lookup(geo.Latitude, geo.Longitude); ok {
+				return loc, false
+			}
+		}
+		return time.Local, true
+	}
+	loc, err := policy.fixedZone()
+	if err != nil {
+		return nil, false
+	}
+	return loc, false
+}
+
+func (policy TimezonePolicy) fixedZone() (*time.Location, error) {
+	value := string(policy)
+	if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		offset, err := time.Parse("-07:00", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone offset %q (want +hh:mm or -hh:mm)", value)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(value, seconds), nil
+	}
+	if strings.EqualFold(value, "local") {
+		return nil, fmt.Errorf("unknown timezone %q (did you mean local?)", value)
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q (want local, gps, a zone name such as Europe/Berlin or an offset such as +02:00)", value)
+	}
+	return loc, nil
+}
+
+// localizedDateArgs writes value as the capture date in its own zone. EXIF
+// dates have no zone, so the offset goes to the OffsetTime tags; XMP dates
+// carry the offset themselves.
+func localizedDateArgs(outMediaPath string, value time.Time) []string {
+	if isXMPSidecar(outMediaPath) {
+		return []string{"-AllDates=" + value.Format(exifDateLayout+"-07:00")}
+	}
+	offset := value.Format("-07:00")
+	return []string{
+		"-AllDates=" + value.Format(exifDateLayout),
+		"-OffsetTimeOriginal=" + offset,
+		"-OffsetTime=" + offset,
+		"-OffsetTimeDigitized=" + offset,
+	}
+}
@@ -0,0 +1,166 @@
+package metadata
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTimezonePolicy(t *testing.T) {
+	for _, value := range []string{"", "local", "gps", "UTC", "Europe/Berlin", "+02:00", "-05:30"} {
+		if _, err := ParseTimezonePolicy(value); err != nil {
+			t.Fatalf("ParseTimezonePolicy(%q) returned error: %v", value, err)
+		}
+	}
+	for _, value := range []string{"Mars/Olympus", "+2", "+25:00", "Local"} {
+		if _, err := ParseTimezonePolicy(value); err == nil {
+			t.Fatalf("ParseTimezonePolicy(%q) should fail", value)
+		}
+	}
+}
+
+func TestPlanWithRunner_LocalizesJSONDates(t *testing.T) {
+	runner := func(args []string) (string, error) { return "", nil }
+
+	tests := []struct {
+		name     string
+		media    string
+		writable bool
+		json     string
+		policy   TimezonePolicy
+		want     []string
+		hour     int
+	}{
+		{
+			name:     "fixed offset",
+			media:    "photo.jpg",
+			writable: true,
+			json:     `{"photoTakenTime":{"timestamp":"1719835200"}}`,
+			policy:   "+02:00",
+			want:     []string{"-AllDates=2024:07:01 14:00:00", "-OffsetTimeOriginal=+02:00", "-OffsetTime=+02:00", "-OffsetTimeDigitized=+02:00"},
+			hour:     14,
+		},
+		{
+			name:     "gps zone",
+			media:    "photo.jpg",
+			writable: true,
+			json:     `{"photoTakenTime":{"timestamp":"1719835200"},"geoData":{"latitude":35.68,"longitude":139.65}}`,
+			policy:   TimezoneGPS,
+			want:     []string{"-AllDates=2024:07:01 21:00:00", "-OffsetTimeOriginal=+09:00", "-OffsetTime=+09:00", "-OffsetTimeDigitized=+09:00"},
+			hour:     21,
+		},
+		{
+			name:   "xmp sidecar",
+			media:  "clip.avi",
+			json:   `{"photoTakenTime":{"timestamp":"1719835200"}}`,
+			policy: "America/New_York",
+			want:   []string{"-AllDates=2024:07:01 08:00:00-04:00"},
+			hour:   8,
+		},
+		{
+			name:     "heif keys date",
+			media:    "photo.heic",
+			writable: true,
+			json:     `{"photoTakenTime":{"timestamp":"1719835200"}}`,
+			policy:   "UTC",
+			want:     []string{"-AllDates=2024:07:01 12:00:00", "-OffsetTimeOriginal=+00:00", "-OffsetTime=+00:00", "-OffsetTimeDigitized=+00:00", "-Keys:CreationDate=2024:07:01 12:00:00+00:00"},
+			hour:     12,
+		},
+		{
+			name:     "video",
+			media:    "clip.mp4",
+			writable: true,
+			json:     `{"photoTakenTime":{"timestamp":"1719835200"}}`,
+			policy:   "+02:00",
+			want:     []string{"-Keys:CreationDate=2024:07:01 14:00:00+02:00"},
+			hour:     14,
+		},
+	}
+	for _, tt := range tests {
+		stubWritableDecision(t, func(string) (bool, bool) { return tt.writable, true })
+		jsonPath := writeJSONFixture(t, tt.json)
+		commands, result, err := PlanWithRunner(tt.media, jsonPath, Options{Timezone: tt.policy}, runner)
+		if err != nil || len(commands) == 0 {
+			t.Fatalf("%s: expected commands, got %v (%v)", tt.name, commands, err)
+		}
+		var got []string
+		for _, arg := range commands[0] {
+			if strings.HasPrefix(arg, "-AllDates") || strings.HasPrefix(arg, "-OffsetTime") || strings.HasPrefix(arg, "-Keys:CreationDate") {
+				got = append(got, arg)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%s: date args mismatch: want %v, got %v", tt.name, tt.want, got)
+		}
+		if slices.Contains(commands[0], "%s") {
+			t.Fatalf("%s: explicit dates must not be parsed as epoch: %v", tt.name, commands[0])
+		}
+		if result.CaptureTime.Hour() != tt.hour {
+			t.Fatalf("%s: expected capture hour %d, got %v", tt.name, tt.hour, result.CaptureTime)
+		}
+	}
+}
+
+func TestPlanWithRunner_LocalizesFilenameDates(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, `{"title":"x"}`)
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanWithRunner("2024-01-15 12.30.00.jpg", jsonPath, Options{Timezone: "America/New_York"}, runner)
+	if err != nil || len(commands) != 2 {
+		t.Fatalf("expected JSON and filename commands, got %v (%v)", commands, err)
+	}
+	args := commands[1]
+	for _, want := range []string{
+		"-DateTimeOriginal=2024:01:15 12:30:00",
+		"-OffsetTimeOriginal=-05:00",
+		"-FileModifyDate=2024:01:15 12:30:00-05:00",
+	} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q in %v", want, args)
+		}
+	}
+	if !result.UsedFilenameDate || result.CaptureTime.Hour() != 12 || result.CaptureTime.Location().String() != "America/New_York" {
+		t.Fatalf("unexpected capture time: %v", result.CaptureTime)
+	}
+}
+
+func TestPlanWithRunner_DefaultTimezoneWritesNoOffsets(t *testing.T) {
+	jsonPath := writeJSONFixture(t, `{"title":"x"}`)
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, _, err := PlanWithRunner("2024-01-15 12.30.00.jpg", jsonPath, Options{}, runner)
+	if err != nil {
+		t.Fatalf("PlanWithRunner error: %v", err)
+	}
+	for _, command := range commands {
+		for _, arg := range command {
+			if strings.HasPrefix(arg, "-OffsetTime") {
+				t.Fatalf("did not expect offset tags without a timezone policy: %v", command)
+			}
+		}
+	}
+}
+
+func TestPlanWithRunner_ReportsLocalZoneFallback(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) { return "", nil }
+
+	for _, tt := range []struct {
+		json string
+		want bool
+	}{
+		{json: `{"photoTakenTime":{"timestamp":"1719835200"},"geoData":{"latitude":35.68,"longitude":139.65}}`, want: false},
+		{json: `{"photoTakenTime":{"timestamp":"1719835200"}}`, want: true},
+		{json: `{"title":"x"}`, want: false},
+	} {
+		_, result, err := PlanWithRunner("photo.jpg", writeJSONFixture(t, tt.json), Options{Timezone: TimezoneGPS}, runner)
+		if err != nil {
+			t.Fatalf("PlanWithRunner error: %v", err)
+		}
+		if result.LocalZoneFallback != tt.want {
+			t.Fatalf("%s: want local zone fallback %v, got %v", tt.json, tt.want, result.LocalZoneFallback)
+		}
+	}
+}
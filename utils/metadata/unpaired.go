@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"errors"
+
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
+)
+
+// unpairedDatePrecedence orders the date sources of media without a JSON.
+// A DateTimeOriginal already in the file wins over the filename.
+const unpairedDatePrecedence DatePrecedence = "exif,filename"
+
+// ApplyUnpaired restores the capture date of media that has no JSON.
+func ApplyUnpaired(mediaPath string, opts Options) (ApplyResult, error) {
+	return ApplyUnpairedWithRunner(mediaPath, opts, runExiftool)
+}
+
+// ApplyUnpairedWithRunner restores the capture date of media that has no
+// JSON. When the file already has a DateTimeOriginal, only its file dates
+// are set to it. Otherwise the date is restored from the filename as in
+// ApplyDetailedWithRunner. Timezone, DateChecks and the dates entry of
+// WritePolicy apply as they do for paired media, so with fill-missing a
+// file that already has a date is left alone; other options are ignored.
+// A media without either date is left unchanged.
+func ApplyUnpairedWithRunner(
+	mediaPath string,
+	opts Options,
+	run func(args []string) (string, error),
+) (ApplyResult, error) {
+	result := ApplyResult{}
+	if run == nil {
+		return result, errors.New("nil exiftool runner")
+	}
+	if opts.WritePolicy.mode(FieldDates) == WriteSkip {
+		return result, nil
+	}
+
+	metadataPath, mediaDatePath, useXMPSidecar := resolveWriteTargets(mediaPath)
+	zone, localFallback := opts.Timezone.location(sidecar.Sidecar{})
+	dateOpts := Options{DatePrecedence: unpairedDatePrecedence, DateChecks: opts.DateChecks}
+	chosen, found, conflicts := dateOpts.resolveCaptureDate(mediaPath, mediaDatePath, sidecar.Sidecar{}, zone, run)
+	result.DateConflicts = conflicts
+	if !found {
+		return result, nil
+	}
+	result.DateSource = chosen.source
+	result.LocalZoneFallback = localFallback
+	result.CaptureTime = chosen.value
+
+	filter := newFieldFilter(opts.WritePolicy, metadataPath, run)
+	allowed := filter.allow(FieldDates, true)
+	result.SkippedFields = filter.skipped
+	if !allowed {
+		return result, nil
+	}
+
+	includeCreateDate := shouldWriteFileCreateDate()
+	if chosen.source == DateSourceFilename {
+		writeFilenameDate(&result, chosen.filename, mediaPath, metadataPath, useXMPSidecar, includeCreateDate, zone, run)
+		return result, nil
+	}
+
+	createDateWarned, err := applyMediaFileDatesFromJSON(mediaDatePath, chosen.value, includeCreateDate, run)
+	result.CreateDateWarned = createDateWarned
+	if err != nil {
+		result.MediaFileDateWarned = true
+	}
+	return result, nil
+}
+
+// PlanUnpaired reports the exiftool write commands ApplyUnpaired would run
+// for mediaPath without changing any file.
+func PlanUnpaired(mediaPath string, opts Options) ([][]string, ApplyResult, error) {
+	return PlanUnpairedWithRunner(mediaPath, opts, runExiftool)
+}
+
+// PlanUnpairedWithRunner records the write commands ApplyUnpairedWithRunner
+// would run instead of executing them. Read-only commands still go through
+// run.
+func PlanUnpairedWithRunner(
+	mediaPath string,
+	opts Options,
+	run func(args []string) (string, error),
+) ([][]string, ApplyResult, error) {
+	if run == nil {
+		return nil, ApplyResult{}, errors.New("nil exiftool runner")
+	}
+
+	var commands [][]string
+	result, err := ApplyUnpairedWithRunner(mediaPath, opts, recordWrites(mediaPath, opts.SourcePath, run, &commands))
+	return commands, result, err
+}
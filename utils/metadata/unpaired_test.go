@@ -0,0 +1,117 @@
+package metadata
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlanUnpairedWithRunner_SyncsFileDatesToEmbeddedDate(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	var reads [][]string
+	runner := func(args []string) (string, error) {
+		reads = append(reads, args)
+		return "2001:02:03 04:05:06\n+02:00\n", nil
+	}
+
+	commands, result, err := PlanUnpairedWithRunner("IMG_20190704_153012.jpg", Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(reads) != 1 || !slices.Contains(reads[0], "-DateTimeOriginal") {
+		t.Fatalf("expected one DateTimeOriginal read, got %v", reads)
+	}
+	if result.DateSource != DateSourceEmbedded || result.UsedFilenameDate {
+		t.Fatalf("expected the embedded date to win over the filename, got %+v", result)
+	}
+	want := time.Date(2001, 2, 3, 4, 5, 6, 0, time.FixedZone("", 2*60*60))
+	if !result.CaptureTime.Equal(want) {
+		t.Fatalf("expected capture time %v, got %v", want, result.CaptureTime)
+	}
+	if len(commands) != 1 || !hasArgPrefix(commands[0], "-FileModifyDate=") || hasArgPrefix(commands[0], "-AllDates=") || hasArgPrefix(commands[0], "-DateTimeOriginal=") {
+		t.Fatalf("expected only the file dates to be written, got %v", commands)
+	}
+	if len(result.DateConflicts) != 1 {
+		t.Fatalf("expected the filename date to be reported as differing, got %q", result.DateConflicts)
+	}
+}
+
+func TestPlanUnpairedWithRunner_RestoresDateFromFilename(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanUnpairedWithRunner("Screenshot_2020-01-02-10-11-12.png", Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !result.UsedFilenameDate || result.DateSource != DateSourceFilename || result.FilenamePattern != "screenshot" {
+		t.Fatalf("expected the filename date, got %+v", result)
+	}
+	if len(commands) != 1 || !slices.Contains(commands[0], "-DateTimeOriginal=2020:01:02 10:11:12") {
+		t.Fatalf("expected the filename date to be written, got %v", commands)
+	}
+}
+
+func TestPlanUnpairedWithRunner_LeavesMediaWithoutDate(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) { return "", nil }
+
+	commands, result, err := PlanUnpairedWithRunner("holiday.jpg", Options{}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(commands) != 0 || result.DateSource != "" || !result.CaptureTime.IsZero() {
+		t.Fatalf("expected no change, got %v %+v", commands, result)
+	}
+}
+
+func TestPlanUnpairedWithRunner_SkipDatesDoesNothing(t *testing.T) {
+	runner := func(args []string) (string, error) {
+		t.Fatalf("did not expect exiftool with dates=skip, args: %v", args)
+		return "", nil
+	}
+
+	commands, _, err := PlanUnpairedWithRunner("IMG_20190704_153012.jpg", Options{WritePolicy: "dates=skip"}, runner)
+	if err != nil || len(commands) != 0 {
+		t.Fatalf("expected no commands, got %v (%v)", commands, err)
+	}
+}
+
+func TestPlanUnpairedWithRunner_FillMissingDatesKeepsExistingDate(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) {
+		if slices.Contains(args, "-j") {
+			return `[{"CreateDate":"2010:01:01 00:00:00"}]`, nil
+		}
+		return "", nil
+	}
+
+	commands, result, err := PlanUnpairedWithRunner("Screenshot_2020-01-02-10-11-12.png", Options{WritePolicy: "dates=fill-missing"}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(commands) != 0 {
+		t.Fatalf("expected the existing date to be kept, got %v", commands)
+	}
+	if !slices.Equal(result.SkippedFields, []string{FieldDates}) {
+		t.Fatalf("expected dates to be reported as skipped, got %v", result.SkippedFields)
+	}
+}
+
+func TestPlanUnpairedWithRunner_FillMissingDatesWritesMissingDate(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	runner := func(args []string) (string, error) {
+		if slices.Contains(args, "-j") {
+			return `[{}]`, nil
+		}
+		return "", nil
+	}
+
+	commands, _, err := PlanUnpairedWithRunner("Screenshot_2020-01-02-10-11-12.png", Options{WritePolicy: "dates=fill-missing"}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(commands) != 1 || !slices.Contains(commands[0], "-DateTimeOriginal=2020:01:02 10:11:12") {
+		t.Fatalf("expected the filename date to be written, got %v", commands)
+	}
+}
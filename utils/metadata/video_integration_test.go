@@ -0,0 +1,144 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyDetailed_WritesQuickTimeDatesAndGPSToVideo(t *testing.T) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		t.Skip("exiftool not available")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		ext      string
+		timezone TimezonePolicy
+	}{
+		{name: "mp4", ext: ".mp4"},
+		{name: "mov", ext: ".mov"},
+		{name: "3gp", ext: ".3gp"},
+		{name: "mp4 with timezone", ext: ".mp4", timezone: "+02:00"},
+	} {
+		dir := t.TempDir()
+		mediaPath := filepath.Join(dir, "clip"+tc.ext)
+		jsonPath := filepath.Join(dir, "meta.json")
+		if err := os.WriteFile(mediaPath, tinyMP4(), 0o600); err != nil {
+			t.Fatalf("write media: %v", err)
+		}
+		jsonData := `{
+  "photoTakenTime": {"timestamp": "1719835200"},
+  "geoData": {"latitude": 48.8584, "longitude": 2.2945, "altitude": 35.0}
+}`
+		if err := os.WriteFile(jsonPath, []byte(jsonData), 0o600); err != nil {
+			t.Fatalf("write json: %v", err)
+		}
+
+		if _, err := ApplyDetailed(mediaPath, jsonPath, Options{Timezone: tc.timezone}); err != nil {
+			t.Fatalf("%s: ApplyDetailed error: %v", tc.name, err)
+		}
+
+		// Without QuickTimeUTC exiftool shows the stored UTC values.
+		dates := readVideoTags(t, mediaPath,
+			"-QuickTime:CreateDate", "-QuickTime:TrackCreateDate", "-QuickTime:MediaCreateDate")
+		for _, tag := range []string{"CreateDate", "TrackCreateDate", "MediaCreateDate"} {
+			if got := dates[tag]; got != "2024:07:01 12:00:00" {
+				t.Fatalf("%s: %s = %v, want 2024:07:01 12:00:00 UTC", tc.name, tag, got)
+			}
+		}
+
+		coords := readVideoTags(t, mediaPath, "-n", "-Keys:GPSCoordinates", "-UserData:GPSCoordinates", "-G1")
+		for _, tag := range []string{"Keys:GPSCoordinates", "UserData:GPSCoordinates"} {
+			got, _ := coords[tag].(string)
+			if !strings.HasPrefix(got, "48.8584 2.2945") {
+				t.Fatalf("%s: %s = %v, want 48.8584 2.2945", tc.name, tag, coords[tag])
+			}
+		}
+	}
+}
+
+func readVideoTags(t *testing.T, mediaPath string, args ...string) map[string]any {
+	t.Helper()
+
+	args = append([]string{"-j"}, args...)
+	out, err := exec.Command("exiftool", append(args, "--", mediaPath)...).Output()
+	if err != nil {
+		t.Fatalf("read tags: %v", err)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(out, &items); err != nil || len(items) != 1 {
+		t.Fatalf("parse exiftool json: %v (%s)", err, out)
+	}
+	return items[0]
+}
+
+// tinyMP4 builds the smallest QuickTime structure exiftool writes dates and
+// GPS to: ftyp and a moov with one video track and no media data.
+func tinyMP4() []byte {
+	matrix := u32s(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+
+	mvhd := fullBox("mvhd",
+		u32s(0, 0, 1000, 0), // creation, modification, timescale, duration
+		u32s(0x00010000),    // rate
+		[]byte{0x01, 0x00},  // volume
+		make([]byte, 10),    // reserved
+		matrix,
+		make([]byte, 24), // pre-defined
+		u32s(2),          // next track ID
+	)
+	tkhd := fullBoxFlags("tkhd", 7,
+		u32s(0, 0, 1, 0, 0), // creation, modification, track ID, reserved, duration
+		make([]byte, 16),    // reserved, layer, alternate group, volume, reserved
+		matrix,
+		u32s(0, 0), // width, height
+	)
+	mdhd := fullBox("mdhd",
+		u32s(0, 0, 1000, 0),      // creation, modification, timescale, duration
+		[]byte{0x55, 0xc4, 0, 0}, // language "und", pre-defined
+	)
+	hdlr := fullBox("hdlr",
+		u32s(0),
+		[]byte("vide"),
+		make([]byte, 12),
+		[]byte{0}, // empty name
+	)
+
+	return concat(
+		box("ftyp", []byte("isom"), u32s(0x200), []byte("isomiso2mp41")),
+		box("moov", mvhd, box("trak", tkhd, box("mdia", mdhd, hdlr))),
+	)
+}
+
+func box(kind string, payload ...[]byte) []byte {
+	body := concat(payload...)
+	return concat(u32s(uint32(8+len(body))), []byte(kind), body)
+}
+
+func fullBox(kind string, payload ...[]byte) []byte {
+	return fullBoxFlags(kind, 0, payload...)
+}
+
+func fullBoxFlags(kind string, flags uint32, payload ...[]byte) []byte {
+	return box(kind, append([][]byte{u32s(flags & 0x00ffffff)}, payload...)...)
+}
+
+func u32s(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
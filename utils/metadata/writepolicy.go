@@ -0,0 +1,214 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vchilikov/takeout-fix/internal/patharg"
+	"github.com/vchilikov/takeout-fix/utils/sidecar"
+)
+
+// WriteMode says whether a field from the JSON replaces the value already
+// in the media or its XMP sidecar.
+type WriteMode string
+
+const (
+	// WriteOverwrite always writes the JSON value.
+	WriteOverwrite WriteMode = "overwrite"
+	// WriteFillMissing writes the JSON value only when the target has no
+	// value for the field yet.
+	WriteFillMissing WriteMode = "fill-missing"
+	// WriteSkip never writes the field.
+	WriteSkip WriteMode = "skip"
+)
+
+// Fields a WritePolicy can set a mode for.
+const (
+	FieldDates       = "dates"
+	FieldGPS         = "gps"
+	FieldDescription = "description"
+	FieldTitle       = "title"
+	FieldKeywords    = "keywords"
+	FieldPeople      = "people"
+	FieldRating      = "rating"
+)
+
+// Fields lists the fields of a WritePolicy in report order.
+var Fields = []string{FieldDates, FieldGPS, FieldDescription, FieldTitle, FieldKeywords, FieldPeople, FieldRating}
+
+// fieldTags are the tags whose values make a field present in the target.
+// They are the names exiftool -j reports.
+var fieldTags = map[string][]string{
+	FieldDates:       {"DateTimeOriginal", "CreateDate"},
+	FieldGPS:         {"GPSLatitude", "GPSCoordinates"},
+	FieldDescription: {"Description", "ImageDescription", "Caption-Abstract"},
+	FieldTitle:       {"Title"},
+	FieldKeywords:    {"Keywords", "Subject"},
+	FieldPeople:      {"PersonInImage"},
+	FieldRating:      {"Rating"},
+}
+
+// WritePolicy is a comma-separated list of "field=mode" entries, such as
+// "gps=fill-missing,title=skip". An entry without a field sets the mode of
+// every field not listed. Empty overwrites every field.
+type WritePolicy string
+
+// ParseWritePolicy validates a write policy.
+func ParseWritePolicy(value string) (WritePolicy, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
+	}
+	var fields []string
+	defaults := 0
+	for part := range strings.SplitSeq(value, ",") {
+		field, mode, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			field, mode = "", field
+			defaults++
+		}
+		field, mode = strings.TrimSpace(field), strings.TrimSpace(mode)
+		switch WriteMode(mode) {
+		case WriteOverwrite, WriteFillMissing, WriteSkip:
+		default:
+			return "", fmt.Errorf("unknown write mode %q in %q (want overwrite, fill-missing or skip)", mode, part)
+		}
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(Fields, field) {
+			return "", fmt.Errorf("unknown field %q in write policy (want %s)", field, strings.Join(Fields, ", "))
+		}
+		if slices.Contains(fields, field) {
+			return "", fmt.Errorf("field %q is listed twice in write policy", field)
+		}
+		fields = append(fields, field)
+	}
+	if defaults > 1 {
+		return "", fmt.Errorf("write policy %q sets the default mode twice", value)
+	}
+	return WritePolicy(value), nil
+}
+
+// mode returns the write mode of field.
+func (policy WritePolicy) mode(field string) WriteMode {
+	mode := WriteOverwrite
+	for part := range strings.SplitSeq(string(policy), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		switch {
+		case !ok && strings.TrimSpace(name) != "":
+			mode = WriteMode(strings.TrimSpace(name))
+		case strings.TrimSpace(name) == field:
+			return WriteMode(strings.TrimSpace(value))
+		}
+	}
+	return mode
+}
+
+// existingFields reads which fields already have a value in path. It is
+// only called when some field is WriteFillMissing. A target that cannot be
+// read, such as an XMP sidecar that does not exist yet, has no fields.
+func (policy WritePolicy) existingFields(path string, run func(args []string) (string, error)) map[string]bool {
+	args := []string{"-j", "-m"}
+	for _, field := range Fields {
+		if policy.mode(field) != WriteFillMissing {
+			continue
+		}
+		for _, tag := range fieldTags[field] {
+			args = append(args, "-"+tag)
+		}
+	}
+	args = append(args, patharg.Safe(path))
+
+	existing := make(map[string]bool)
+	output, err := run(args)
+	if err != nil {
+		return existing
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal([]byte(output), &entries); err != nil || len(entries) == 0 {
+		return existing
+	}
+	for field, tags := range fieldTags {
+		for _, tag := range tags {
+			if hasTagValue(entries[0][tag]) {
+				existing[field] = true
+			}
+		}
+	}
+	return existing
+}
+
+func hasTagValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		v = strings.TrimSpace(v)
+		return v != "" && !strings.HasPrefix(v, "0000:00:00")
+	case []any:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// fieldFilter decides per field whether the JSON value is written.
+type fieldFilter struct {
+	policy   WritePolicy
+	existing map[string]bool
+	// skipped are the fields that had a JSON value that was not written.
+	skipped []string
+}
+
+func newFieldFilter(policy WritePolicy, target string, run func(args []string) (string, error)) *fieldFilter {
+	filter := &fieldFilter{policy: policy}
+	if slices.ContainsFunc(Fields, func(field string) bool { return policy.mode(field) == WriteFillMissing }) {
+		filter.existing = policy.existingFields(target, run)
+	}
+	return filter
+}
+
+// allow reports whether field is written. hasValue says whether the JSON
+// has a value for it; only fields with a value are counted as skipped.
+func (f *fieldFilter) allow(field string, hasValue bool) bool {
+	var allowed bool
+	switch f.policy.mode(field) {
+	case WriteSkip:
+		allowed = false
+	case WriteFillMissing:
+		allowed = !f.existing[field]
+	default:
+		allowed = true
+	}
+	if !allowed && hasValue {
+		f.skipped = append(f.skipped, field)
+	}
+	return allowed
+}
+
+// filterSidecar clears the fields of sc that the policy does not write.
+func (f *fieldFilter) filterSidecar(sc sidecar.Sidecar) sidecar.Sidecar {
+	_, hasPosition := sc.Position()
+	if !f.allow(FieldGPS, hasPosition) {
+		sc.GeoData, sc.GeoDataExif = sidecar.GeoData{}, sidecar.GeoData{}
+	}
+	if !f.allow(FieldDescription, sc.Description != "") {
+		sc.Description = ""
+	}
+	if !f.allow(FieldTitle, sc.Title != "") {
+		sc.Title = ""
+	}
+	if !f.allow(FieldKeywords, len(sc.Tags) > 0) {
+		sc.Tags = nil
+	}
+	if !f.allow(FieldPeople, len(sc.People) > 0) {
+		sc.People = nil
+	}
+	if !f.allow(FieldRating, sc.Favorited) {
+		sc.Favorited = false
+	}
+	return sc
+}
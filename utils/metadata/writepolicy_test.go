@@ -0,0 +1,133 @@
+package metadata
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseWritePolicy(t *testing.T) {
+	for value, want := range map[string]WritePolicy{
+		"":                                 "",
+		"fill-missing":                     "fill-missing",
+		"GPS=Skip, title=fill-missing":     "gps=skip, title=fill-missing",
+		"skip,dates=overwrite":             "skip,dates=overwrite",
+		"rating=skip,people=overwrite":     "rating=skip,people=overwrite",
+		"keywords=fill-missing,dates=skip": "keywords=fill-missing,dates=skip",
+	} {
+		got, err := ParseWritePolicy(value)
+		if err != nil || got != want {
+			t.Fatalf("ParseWritePolicy(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"gps=never", "albums=skip", "gps=skip,gps=overwrite", "skip,fill-missing"} {
+		if _, err := ParseWritePolicy(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestWritePolicyMode(t *testing.T) {
+	policy := WritePolicy("fill-missing,title=skip,dates=overwrite")
+	for field, want := range map[string]WriteMode{
+		FieldTitle:    WriteSkip,
+		FieldDates:    WriteOverwrite,
+		FieldGPS:      WriteFillMissing,
+		FieldKeywords: WriteFillMissing,
+	} {
+		if got := policy.mode(field); got != want {
+			t.Fatalf("mode(%q) = %q, want %q", field, got, want)
+		}
+	}
+	if got := WritePolicy("").mode(FieldRating); got != WriteOverwrite {
+		t.Fatalf("expected overwrite by default, got %q", got)
+	}
+}
+
+func TestPlanWithRunner_FillMissingKeepsExistingFields(t *testing.T) {
+	stubWritableDecision(t, func(string) (bool, bool) { return true, true })
+	jsonPath := writeJSONFixture(t, testSidecarJSON)
+	var reads [][]string
+	runner := func(args []string) (string, error) {
+		reads = append(reads, args)
+		return `[{"SourceFile":"photo.jpg","Title":"Mine","GPSLatitude":"33 deg 30' 0.00\" S","DateTimeOriginal":"2001:02:03 04:05:06","Keywords":[],"Description":""}]`, nil
+	}
+
+	commands, result, err := PlanWithRunner("photo.jpg", jsonPath, Options{WritePolicy: "fill-missing"}, answerDateRead(runner))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(reads) != 1 || !slices.Contains(reads[0], "-j") || !slices.Contains(reads[0], "-PersonInImage") {
+		t.Fatalf("expected one read of the existing tags, got %v", reads)
+	}
+	if len(commands) != 1 {
+		t.Fatalf("expected one write, got %v", commands)
+	}
+	args := commands[0]
+	for _, prefix := range []string{"-Title=", "-GPSLatitude=", "-AllDates=", "-FileModifyDate="} {
+		if hasArgPrefix(args, prefix) {
+			t.Fatalf("did not expect %s for a field the media already has: %v", prefix, args)
+		}
+	}
+	for _, want := range []string{"-Description=Lake trip", "-Keywords=lake"} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q for an empty field: %v", want, args)
+		}
+	}
+	if !slices.Equal(result.SkippedFields, []string{FieldDates, FieldGPS, FieldTitle}) {
+		t.Fatalf("unexpected skipped fields: %v", result.SkippedFields)
+	}
+	if result.CaptureTime.IsZero() {
+		t.Fatalf("expected the resolved capture time to be kept for layout")
+	}
+}
+
+func TestPlanWithRunner_FillMissingWritesNewXMPSidecar(t *testing.T) {
+	stubWritableDecision(t, func(path string) (bool, bool) { return filepath.Ext(path) != ".avi", true })
+	jsonPath := writeJSONFixture(t, testSidecarJSON)
+	runner := func(args []string) (string, error) {
+		return "Error: File not found - clip.avi.xmp", errors.New("exit status 1")
+	}
+
+	commands, result, err := PlanWithRunner("clip.avi", jsonPath, Options{WritePolicy: "fill-missing"}, runner)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(result.SkippedFields) != 0 {
+		t.Fatalf("expected every field to be written to a new sidecar, got %v", result.SkippedFields)
+	}
+	if len(commands) != 2 || commands[0][len(commands[0])-1] != "clip.avi.xmp" || !hasArgPrefix(commands[0], "-AllDates=") {
+		t.Fatalf("expected dates in the new sidecar, got %v", commands)
+	}
+}
+
+func TestPlanWithRunner_SkipFieldsInXMPSidecar(t *testing.T) {
+	stubWritableDecision(t, func(path string) (bool, bool) { return filepath.Ext(path) != ".avi", true })
+	jsonPath := writeJSONFixture(t, `{"description":"x","favorited":true,"people":[{"name":"Alice"}],"photoTakenTime":{"timestamp":"1719835200"}}`)
+	runner := func(args []string) (string, error) {
+		t.Fatalf("did not expect a read without fill-missing, args: %v", args)
+		return "", nil
+	}
+
+	opts := Options{WritePolicy: "description=skip,people=skip,rating=skip,dates=skip"}
+	commands, result, err := PlanWithRunner("clip.avi", jsonPath, opts, answerDateRead(runner))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(commands) != 1 {
+		t.Fatalf("expected only the sidecar write without dates, got %v", commands)
+	}
+	for _, arg := range commands[0] {
+		if strings.Contains(arg, "Description") || strings.Contains(arg, "PersonInImage") || strings.Contains(arg, "Rating") || strings.Contains(arg, "Date") {
+			t.Fatalf("did not expect skipped field %q: %v", arg, commands[0])
+		}
+	}
+	if !slices.Equal(result.SkippedFields, []string{FieldDates, FieldDescription, FieldPeople, FieldRating}) {
+		t.Fatalf("unexpected skipped fields: %v", result.SkippedFields)
+	}
+	if result.PeopleTagged || result.Favorite {
+		t.Fatalf("skipped people and rating must not be reported as written: %+v", result)
+	}
+}
@@ -0,0 +1,371 @@
+// Package sidecar reads the JSON files Google Takeout writes next to each
+// media file.
+package sidecar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidJSON is returned for sidecars that are not a JSON object.
+var ErrInvalidJSON = errors.New("invalid sidecar JSON")
+
+// Sidecar is the content of a Takeout JSON sidecar. Decoding is tolerant:
+// fields the JSON lacks keep their zero value, and a value of the wrong
+// type or out of range is dropped and described in Issues instead of
+// failing the whole file.
+type Sidecar struct {
+	Title                 string
+	Description           string
+	ImageViews            int64
+	URL                   string
+	CreationTime          Timestamp
+	PhotoTakenTime        Timestamp
+	PhotoLastModifiedTime Timestamp
+	GeoData               GeoData
+	GeoDataExif           GeoData
+	People                []Person
+	Tags                  []string
+	Favorited             bool
+	Archived              bool
+	Trashed               bool
+	Origin                Origin
+	// AppSource is appSource.androidPackageName, the app that created the
+	// media.
+	AppSource string
+	// Issues describes values that were present but unusable, such as
+	// `photoTakenTime.timestamp: invalid value "abc"`.
+	Issues []string
+}
+
+// TimestampStatus tells whether a timestamp can be used.
+type TimestampStatus int
+
+const (
+	TimestampMissing TimestampStatus = iota
+	TimestampValid
+	TimestampInvalid
+)
+
+// Timestamp is a Takeout time value such as photoTakenTime.
+type Timestamp struct {
+	// Time is the instant in UTC. It is zero unless Status is TimestampValid.
+	Time time.Time
+	// Formatted is Google's human-readable rendering, read by the
+	// "formatted" capture date source.
+	Formatted string
+	Status    TimestampStatus
+}
+
+// GeoData is a Takeout position. Takeout writes zero coordinates for media
+// without a location.
+type GeoData struct {
+	Latitude      float64
+	Longitude     float64
+	Altitude      float64
+	LatitudeSpan  float64
+	LongitudeSpan float64
+}
+
+// HasPosition reports whether g has coordinates.
+func (g GeoData) HasPosition() bool {
+	return g.Latitude != 0 || g.Longitude != 0
+}
+
+// Person is an entry of the "people" list.
+type Person struct {
+	Name string
+}
+
+// Origin is googlePhotosOrigin: where the media came from.
+type Origin struct {
+	// Kind is the origin key, such as "mobileUpload", "webUpload" or
+	// "fromSharedAlbum".
+	Kind string
+	// DeviceType is mobileUpload.deviceType, such as "ANDROID_PHONE".
+	DeviceType string
+	// DeviceFolder is mobileUpload.deviceFolder.localFolderName.
+	DeviceFolder string
+}
+
+// Position returns geoDataExif, or geoData when geoDataExif has no
+// coordinates. Camera coordinates are preferred over Google's estimate.
+func (s Sidecar) Position() (GeoData, bool) {
+	for _, geo := range []GeoData{s.GeoDataExif, s.GeoData} {
+		if geo.HasPosition() {
+			return geo, true
+		}
+	}
+	return GeoData{}, false
+}
+
+// PeopleNames returns the unique, non-empty names of People in their
+// original order.
+func (s Sidecar) PeopleNames() []string {
+	var names []string
+	for _, person := range s.People {
+		name := strings.TrimSpace(person.Name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Load reads and parses the sidecar at path.
+func Load(path string) (Sidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Sidecar{}, fmt.Errorf("read sidecar: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes a sidecar. It fails only when data is not a JSON object;
+// problems with single values end up in Sidecar.Issues.
+func Parse(data []byte) (Sidecar, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return Sidecar{}, fmt.Errorf("%w: %v at byte %d", ErrInvalidJSON, syntaxErr, syntaxErr.Offset)
+		}
+		return Sidecar{}, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if fields == nil {
+		return Sidecar{}, fmt.Errorf("%w: not an object", ErrInvalidJSON)
+	}
+
+	d := decoder{fields: fields}
+	s := Sidecar{
+		Title:                 d.string("title"),
+		Description:           d.string("description"),
+		ImageViews:            d.count("imageViews"),
+		URL:                   d.string("url"),
+		CreationTime:          d.timestamp("creationTime"),
+		PhotoTakenTime:        d.timestamp("photoTakenTime"),
+		PhotoLastModifiedTime: d.timestamp("photoLastModifiedTime"),
+		GeoData:               d.geoData("geoData"),
+		GeoDataExif:           d.geoData("geoDataExif"),
+		People:                d.people("people"),
+		Tags:                  d.strings("tags"),
+		Favorited:             d.bool("favorited"),
+		Archived:              d.bool("archived"),
+		Trashed:               d.bool("trashed"),
+		Origin:                d.origin("googlePhotosOrigin"),
+		AppSource:             d.nestedString("appSource", "androidPackageName"),
+	}
+	s.Issues = d.issues
+	return s, nil
+}
+
+// decoder reads single fields and collects issues for unusable values.
+type decoder struct {
+	fields map[string]json.RawMessage
+	issues []string
+}
+
+func (d *decoder) issuef(format string, args ...any) {
+	d.issues = append(d.issues, fmt.Sprintf(format, args...))
+}
+
+// value decodes the field into out. It reports false when the field is
+// missing or null, and records an issue when it has the wrong type.
+func (d *decoder) value(name string, want string, out any) bool {
+	raw, ok := d.fields[name]
+	if !ok || string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		d.issuef("%s: expected %s, got %s", name, want, abbreviate(raw))
+		return false
+	}
+	return true
+}
+
+func (d *decoder) string(name string) string {
+	var v string
+	d.value(name, "a string", &v)
+	return v
+}
+
+func (d *decoder) bool(name string) bool {
+	var v bool
+	d.value(name, "true or false", &v)
+	return v
+}
+
+func (d *decoder) strings(name string) []string {
+	var v []string
+	d.value(name, "a list of strings", &v)
+	return v
+}
+
+func (d *decoder) nestedString(name string, key string) string {
+	var v map[string]json.RawMessage
+	if !d.value(name, "an object", &v) {
+		return ""
+	}
+	nested := decoder{fields: v}
+	s := nested.string(key)
+	for _, issue := range nested.issues {
+		d.issuef("%s.%s", name, issue)
+	}
+	return s
+}
+
+// count reads a non-negative integer written as a string or a number.
+func (d *decoder) count(name string) int64 {
+	var v any
+	if !d.value(name, "a number", &v) {
+		return 0
+	}
+	n, ok := parseInt(v)
+	if !ok || n < 0 {
+		d.issuef("%s: invalid value %s", name, abbreviate(d.fields[name]))
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) timestamp(name string) Timestamp {
+	raw, present := d.fields[name]
+	var v map[string]json.RawMessage
+	if !d.value(name, "an object", &v) {
+		if present && string(raw) != "null" {
+			return Timestamp{Status: TimestampInvalid}
+		}
+		return Timestamp{}
+	}
+
+	nested := decoder{fields: v}
+	ts := Timestamp{Formatted: nested.string("formatted")}
+	var value any
+	nested.value("timestamp", "a number", &value)
+	if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+		value = nil
+	}
+	if value != nil {
+		if n, ok := parseInt(value); ok && n > 0 {
+			ts.Status = TimestampValid
+			ts.Time = time.Unix(n, 0).UTC()
+		} else {
+			ts.Status = TimestampInvalid
+			nested.issuef("timestamp: invalid value %s", abbreviate(v["timestamp"]))
+		}
+	}
+	for _, issue := range nested.issues {
+		d.issuef("%s.%s", name, issue)
+	}
+	return ts
+}
+
+func (d *decoder) geoData(name string) GeoData {
+	var v map[string]json.RawMessage
+	if !d.value(name, "an object", &v) {
+		return GeoData{}
+	}
+
+	nested := decoder{fields: v}
+	number := func(key string) float64 {
+		var f float64
+		nested.value(key, "a number", &f)
+		return f
+	}
+	geo := GeoData{
+		Latitude:      number("latitude"),
+		Longitude:     number("longitude"),
+		Altitude:      number("altitude"),
+		LatitudeSpan:  number("latitudeSpan"),
+		LongitudeSpan: number("longitudeSpan"),
+	}
+	if math.Abs(geo.Latitude) > 90 || math.Abs(geo.Longitude) > 180 {
+		nested.issuef("position %v, %v out of range", geo.Latitude, geo.Longitude)
+		geo.Latitude, geo.Longitude = 0, 0
+	}
+	for _, issue := range nested.issues {
+		d.issuef("%s.%s", name, issue)
+	}
+	return geo
+}
+
+func (d *decoder) people(name string) []Person {
+	var v []json.RawMessage
+	if !d.value(name, "a list", &v) {
+		return nil
+	}
+
+	var people []Person
+	for i, raw := range v {
+		var entry map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &entry); err != nil || entry == nil {
+			d.issuef("%s[%d]: expected an object, got %s", name, i, abbreviate(raw))
+			continue
+		}
+		nested := decoder{fields: entry}
+		people = append(people, Person{Name: nested.string("name")})
+		for _, issue := range nested.issues {
+			d.issuef("%s[%d].%s", name, i, issue)
+		}
+	}
+	return people
+}
+
+func (d *decoder) origin(name string) Origin {
+	var v map[string]json.RawMessage
+	if !d.value(name, "an object", &v) || len(v) == 0 {
+		return Origin{}
+	}
+
+	kinds := make([]string, 0, len(v))
+	for kind := range v {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	origin := Origin{Kind: kinds[0]}
+
+	var upload struct {
+		DeviceType   string `json:"deviceType"`
+		DeviceFolder struct {
+			LocalFolderName string `json:"localFolderName"`
+		} `json:"deviceFolder"`
+	}
+	if raw, ok := v["mobileUpload"]; ok && json.Unmarshal(raw, &upload) == nil {
+		origin.Kind = "mobileUpload"
+		origin.DeviceType = upload.DeviceType
+		origin.DeviceFolder = upload.DeviceFolder.LocalFolderName
+	}
+	return origin
+}
+
+// parseInt reads an integer written as a JSON string or number.
+func parseInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return 0, false
+		}
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func abbreviate(raw json.RawMessage) string {
+	const limit = 40
+	s := string(raw)
+	if len(s) > limit {
+		return s[:limit] + "..."
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package sidecar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse_FullSidecar(t *testing.T) {
+	data := `{
+  "title": "IMG_1234.HEIC",
+  "description": "Beach",
+  "imageViews": "12",
+  "creationTime": {"timestamp": "1719900000", "formatted": "Jul 2, 2024"},
+  "photoTakenTime": {"timestamp": "1719835200", "formatted": "Jul 1, 2024, 12:00:00 PM UTC"},
+  "photoLastModifiedTime": {"timestamp": 1719900100},
+  "geoData": {"latitude": 48.1, "longitude": 11.5, "altitude": 520.0, "latitudeSpan": 0.0, "longitudeSpan": 0.0},
+  "geoDataExif": {"latitude": 48.2, "longitude": 11.6, "altitude": 530.5},
+  "people": [{"name": "Alice"}, {"name": "Bob"}, {"name": "Alice"}],
+  "tags": ["beach", "summer"],
+  "url": "https://photos.google.com/photo/abc",
+  "favorited": true,
+  "archived": true,
+  "googlePhotosOrigin": {"mobileUpload": {"deviceFolder": {"localFolderName": "Camera"}, "deviceType": "ANDROID_PHONE"}},
+  "appSource": {"androidPackageName": "com.google.android.GoogleCamera"}
+}`
+	s, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(s.Issues) != 0 {
+		t.Fatalf("unexpected issues: %v", s.Issues)
+	}
+	if s.Title != "IMG_1234.HEIC" || s.Description != "Beach" || s.ImageViews != 12 || s.URL == "" {
+		t.Fatalf("unexpected text fields: %+v", s)
+	}
+	if s.PhotoTakenTime.Status != TimestampValid || !s.PhotoTakenTime.Time.Equal(time.Unix(1719835200, 0)) {
+		t.Fatalf("unexpected photoTakenTime: %+v", s.PhotoTakenTime)
+	}
+	if s.PhotoLastModifiedTime.Status != TimestampValid || s.CreationTime.Formatted != "Jul 2, 2024" {
+		t.Fatalf("unexpected timestamps: %+v, %+v", s.PhotoLastModifiedTime, s.CreationTime)
+	}
+	if pos, ok := s.Position(); !ok || pos.Latitude != 48.2 || pos.Altitude != 530.5 {
+		t.Fatalf("expected geoDataExif position, got %+v (%v)", pos, ok)
+	}
+	if !slices.Equal(s.PeopleNames(), []string{"Alice", "Bob"}) {
+		t.Fatalf("unexpected people: %v", s.PeopleNames())
+	}
+	if !slices.Equal(s.Tags, []string{"beach", "summer"}) || !s.Favorited || !s.Archived || s.Trashed {
+		t.Fatalf("unexpected flags or tags: %+v", s)
+	}
+	want := Origin{Kind: "mobileUpload", DeviceType: "ANDROID_PHONE", DeviceFolder: "Camera"}
+	if s.Origin != want || s.AppSource != "com.google.android.GoogleCamera" {
+		t.Fatalf("unexpected origin: %+v, %q", s.Origin, s.AppSource)
+	}
+}
+
+func TestParse_TimestampStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want TimestampStatus
+	}{
+		{"valid string", `{"photoTakenTime":{"timestamp":"1719835200"}}`, TimestampValid},
+		{"valid number", `{"photoTakenTime":{"timestamp":1719835200}}`, TimestampValid},
+		{"missing object", `{"title":"x"}`, TimestampMissing},
+		{"missing timestamp", `{"photoTakenTime":{"formatted":"x"}}`, TimestampMissing},
+		{"empty string", `{"photoTakenTime":{"timestamp":"  "}}`, TimestampMissing},
+		{"null", `{"photoTakenTime":{"timestamp":null}}`, TimestampMissing},
+		{"not a number", `{"photoTakenTime":{"timestamp":"abc"}}`, TimestampInvalid},
+		{"zero", `{"photoTakenTime":{"timestamp":"0"}}`, TimestampInvalid},
+		{"negative", `{"photoTakenTime":{"timestamp":-5}}`, TimestampInvalid},
+		{"fraction", `{"photoTakenTime":{"timestamp":1.5}}`, TimestampInvalid},
+		{"bool", `{"photoTakenTime":{"timestamp":true}}`, TimestampInvalid},
+		{"not an object", `{"photoTakenTime":"1719835200"}`, TimestampInvalid},
+	}
+	for _, tt := range tests {
+		s, err := Parse([]byte(tt.json))
+		if err != nil {
+			t.Fatalf("%s: Parse returned error: %v", tt.name, err)
+		}
+		if s.PhotoTakenTime.Status != tt.want {
+			t.Fatalf("%s: want status %v, got %v", tt.name, tt.want, s.PhotoTakenTime.Status)
+		}
+		if (tt.want == TimestampInvalid) != (len(s.Issues) > 0) {
+			t.Fatalf("%s: issues mismatch: %v", tt.name, s.Issues)
+		}
+	}
+}
+
+func TestParse_CollectsIssuesAndKeepsOtherFields(t *testing.T) {
+	data := `{
+  "title": 42,
+  "description": "kept",
+  "photoTakenTime": {"timestamp": "soon"},
+  "geoData": {"latitude": 123.0, "longitude": 11.5},
+  "geoDataExif": {"latitude": "north"},
+  "people": [{"name": "Alice"}, "Bob"],
+  "favorited": "yes"
+}`
+	s, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if s.Description != "kept" || s.Title != "" || s.Favorited {
+		t.Fatalf("unexpected fields: %+v", s)
+	}
+	if _, ok := s.Position(); ok {
+		t.Fatalf("out-of-range coordinates must be dropped: %+v", s.GeoData)
+	}
+	if !slices.Equal(s.PeopleNames(), []string{"Alice"}) {
+		t.Fatalf("unexpected people: %v", s.PeopleNames())
+	}
+	want := []string{
+		"title: expected a string, got 42",
+		`photoTakenTime.timestamp: invalid value "soon"`,
+		"geoData.position 123, 11.5 out of range",
+		`geoDataExif.latitude: expected a number, got "north"`,
+		`people[1]: expected an object, got "Bob"`,
+		`favorited: expected true or false, got "yes"`,
+	}
+	for _, issue := range want {
+		if !slices.Contains(s.Issues, issue) {
+			t.Fatalf("expected issue %q in %v", issue, s.Issues)
+		}
+	}
+	if len(s.Issues) != len(want) {
+		t.Fatalf("unexpected issues: %v", s.Issues)
+	}
+}
+
+func TestParse_RejectsInvalidJSON(t *testing.T) {
+	for _, data := range []string{`{"title": }`, `[1, 2]`, `null`, ``} {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrInvalidJSON) {
+			t.Fatalf("Parse(%q): expected ErrInvalidJSON, got %v", data, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg.json")
+	if err := os.WriteFile(path, []byte(`{"title":"a.jpg"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s, err := Load(path)
+	if err != nil || s.Title != "a.jpg" {
+		t.Fatalf("Load = %+v, %v", s, err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil || errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected read error, got %v", err)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want GeoData
+		ok   bool
+	}{
+		{"both zero", `{"geoData":{"latitude":0,"longitude":0},"geoDataExif":{"latitude":0,"longitude":0}}`, GeoData{}, false},
+		{"geoData only", `{"geoData":{"latitude":55.7,"longitude":37.5},"geoDataExif":{"latitude":0,"longitude":0}}`, GeoData{Latitude: 55.7, Longitude: 37.5}, true},
+		{"exif preferred", `{"geoData":{"latitude":55.7,"longitude":37.5},"geoDataExif":{"latitude":48.8,"longitude":2.3}}`, GeoData{Latitude: 48.8, Longitude: 2.3}, true},
+		{"null coordinates", `{"geoDataExif":{"latitude":null,"longitude":null}}`, GeoData{}, false},
+		{"missing", `{"title":"no geo at all"}`, GeoData{}, false},
+	}
+	for _, tt := range tests {
+		s, err := Parse([]byte(tt.json))
+		if err != nil {
+			t.Fatalf("%s: Parse returned error: %v", tt.name, err)
+		}
+		got, ok := s.Position()
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("%s: want %+v %v, got %+v %v", tt.name, tt.want, tt.ok, got, ok)
+		}
+	}
+}